@@ -3,6 +3,7 @@ package main
 import (
     "context"
     "database/sql"
+    "encoding/base64"
     "fmt"
     "net/http"
     "os"
@@ -15,8 +16,11 @@ import (
 
     "github.com/Misha-Glazunov/bank-api/internal/config"
     "github.com/Misha-Glazunov/bank-api/internal/handlers"
+    "github.com/Misha-Glazunov/bank-api/internal/mailer"
+    "github.com/Misha-Glazunov/bank-api/internal/middleware"
     "github.com/Misha-Glazunov/bank-api/internal/repositories"
     "github.com/Misha-Glazunov/bank-api/internal/routes"
+    "github.com/Misha-Glazunov/bank-api/internal/scheduler"
     "github.com/Misha-Glazunov/bank-api/internal/services"
 )
 
@@ -50,17 +54,185 @@ func main() {
     }
 
     // Инициализация репозиториев
+    txManager := repositories.NewTxManager(db)
     userRepo := repositories.NewUserRepository(db)
     accountRepo := repositories.NewAccountRepository(db)
-    cardRepo := repositories.NewCardRepository(db)
+    ledgerRepo := repositories.NewLedgerRepository(db)
+    encryptionKey, err := base64.StdEncoding.DecodeString(cfg.Encryption.Key)
+    if err != nil {
+        logger.Fatalf("Invalid encryption key: %v", err)
+    }
+    cardRepo := repositories.NewCardRepository(db, encryptionKey, []byte(cfg.HMAC.Secret))
     transactionRepo := repositories.NewTransactionRepository(db)
+    idempotencyRepo := repositories.NewIdempotencyRepository(db)
+    limitRepo := repositories.NewAccountLimitRepository(db)
+    cardLimitRepo := repositories.NewCardLimitRepository(db)
+    cardAuthorizationRepo := repositories.NewCardAuthorizationRepository(db)
+    holdRepo := repositories.NewHoldRepository(db)
+    tokenRepo := repositories.NewTokenRepository(db)
+    twoFactorRepo := repositories.NewTwoFactorRepository(db, encryptionKey)
+    scheduledPaymentRepo := repositories.NewScheduledPaymentRepository(db)
+    loanRepo := repositories.NewLoanRepository(db)
+    depositRepo := repositories.NewDepositRepository(db)
+    bulkPaymentRepo := repositories.NewBulkPaymentRepository(db)
+    auditRepo := repositories.NewAuditRepository(db)
+
+    smtpMailer, err := mailer.NewSMTPMailer(cfg.SMTP)
+    if err != nil {
+        logger.Fatalf("Failed to initialize mailer: %v", err)
+    }
+    if cfg.SMTP.Host == "" {
+        logger.Warn("SMTP_HOST is not set, emails will not be sent")
+    }
 
     // Инициализация сервисов
-    authService := services.NewAuthService(userRepo, cfg.JWT.Secret)
-    accountService := services.NewAccountService(accountRepo)
-    cardService := services.NewCardService(cardRepo)
-    paymentService := services.NewPaymentService(accountRepo, transactionRepo)
+    authorizer := services.NewAuthorizer(accountRepo, cardRepo, logger)
+    authService := services.NewAuthService(
+        txManager,
+        userRepo,
+        tokenRepo,
+        twoFactorRepo,
+        smtpMailer,
+        cfg.JWT,
+        cfg.Email,
+        cfg.TwoFactor,
+        cfg.App.PublicURL,
+        logger,
+    )
+    twoFactorService := services.NewTwoFactorService(txManager, userRepo, twoFactorRepo, cfg.TwoFactor, logger)
+    accountService := services.NewAccountService(
+        txManager,
+        authorizer,
+        accountRepo,
+        ledgerRepo,
+        transactionRepo,
+        userRepo,
+        limitRepo,
+        cfg.Limits,
+    )
+    holdService := services.NewHoldService(txManager, authorizer, accountRepo, holdRepo, cfg.Scheduler.BatchSize, logger)
+    cardService := services.NewCardService(
+        txManager,
+        authorizer,
+        accountRepo,
+        cardRepo,
+        cardLimitRepo,
+        userRepo,
+        cfg.Cards,
+        cfg.Scheduler.BatchSize,
+        logger,
+    )
     centralBankService := services.NewCentralBankService(cfg, logger)
+    paymentService := services.NewPaymentService(
+        txManager,
+        authorizer,
+        accountRepo,
+        userRepo,
+        ledgerRepo,
+        transactionRepo,
+        centralBankService,
+        cfg.FX.SpreadPercent,
+        limitRepo,
+        cfg.Limits,
+    )
+    scheduledPaymentService := services.NewScheduledPaymentService(
+        txManager,
+        authorizer,
+        accountRepo,
+        scheduledPaymentRepo,
+        paymentService,
+        cfg.Scheduler,
+        logger,
+    )
+    loanService := services.NewLoanService(
+        txManager,
+        authorizer,
+        accountRepo,
+        ledgerRepo,
+        transactionRepo,
+        loanRepo,
+        centralBankService,
+        cfg.Scheduler.BatchSize,
+        logger,
+    )
+    depositService := services.NewDepositService(
+        txManager,
+        authorizer,
+        accountRepo,
+        ledgerRepo,
+        transactionRepo,
+        depositRepo,
+        paymentService,
+        centralBankService,
+        cfg.Scheduler.BatchSize,
+        logger,
+    )
+    statementService := services.NewStatementService(txManager, authorizer, ledgerRepo, logger)
+    bulkPaymentService := services.NewBulkPaymentService(txManager, bulkPaymentRepo, paymentService, logger)
+    cardPaymentService := services.NewCardPaymentService(
+        txManager,
+        accountRepo,
+        cardRepo,
+        cardLimitRepo,
+        cardAuthorizationRepo,
+        holdRepo,
+        ledgerRepo,
+        transactionRepo,
+        userRepo,
+        limitRepo,
+        cfg.Limits,
+        cfg.Cards,
+        logger,
+    )
+    ledgerService := services.NewLedgerService(txManager, accountRepo, ledgerRepo)
+    adminService := services.NewAdminService(
+        txManager,
+        userRepo,
+        accountRepo,
+        cardRepo,
+        ledgerRepo,
+        transactionRepo,
+        limitRepo,
+        tokenRepo,
+        auditRepo,
+        ledgerService,
+        logger,
+    )
+
+    // Номера карт, выпущенных до включения шифрования, шифруются до приема запросов
+    if err := cardService.EncryptStoredNumbers(context.Background()); err != nil {
+        logger.Fatalf("Failed to encrypt stored card numbers: %v", err)
+    }
+
+    // Фоновые задачи
+    jobs := scheduler.New(logger)
+    jobs.Register("scheduled_payments", cfg.Scheduler.Interval, scheduledPaymentService.ExecuteDue)
+    jobs.Register("loans", cfg.Scheduler.Interval, loanService.ProcessDue)
+    jobs.Register("deposit_interest", cfg.Scheduler.Interval, depositService.AccrueInterest)
+    jobs.Register("hold_expiry", cfg.Scheduler.Interval, holdService.ExpireDue)
+    // Расхождение кэшированных балансов с журналом - инцидент, о котором сообщается в лог
+    jobs.Register("ledger_reconciliation", time.Hour, func(ctx context.Context) error {
+        mismatches, err := ledgerService.Reconcile(ctx)
+        if err != nil {
+            return err
+        }
+        for _, m := range mismatches {
+            logger.WithFields(logrus.Fields{
+                "account_id":     m.AccountID,
+                "cached_balance": m.CachedBalance.String(),
+                "ledger_balance": m.LedgerBalance.String(),
+            }).Error("Account balance does not match the ledger")
+        }
+        return nil
+    })
+    jobs.Register("idempotency_cleanup", time.Hour, func(ctx context.Context) error {
+        _, err := idempotencyRepo.DeleteExpired(ctx)
+        return err
+    })
+    jobs.Register("token_cleanup", time.Hour, func(ctx context.Context) error {
+        _, err := tokenRepo.DeleteExpired(ctx, time.Now().UTC())
+        return err
+    })
 
     // Инициализация обработчиков
     h := handlers.NewHandlers(
@@ -69,10 +241,23 @@ func main() {
         cardService,
         paymentService,
         centralBankService,
+        scheduledPaymentService,
+        loanService,
+        depositService,
+        statementService,
+        bulkPaymentService,
+        cardPaymentService,
+        holdService,
+        twoFactorService,
+        adminService,
         logger,
     )
 
-    router := routes.NewRouter(h, cfg.JWT.Secret)
+    idempotency := middleware.Idempotency(idempotencyRepo, cfg.Idempotency.Retention, cfg.Idempotency.LockTimeout, logger)
+    merchantAuth := middleware.MerchantAuth(cfg.Merchants.Secrets, cfg.Merchants.SignatureTolerance)
+    auth := middleware.AuthMiddleware(cfg.JWT.Secret, tokenRepo, logger)
+    rateLimit := middleware.RateLimit(cfg.RateLimit.RequestsPerMinute)
+    router := routes.NewRouter(h, auth, rateLimit, idempotency, merchantAuth)
 
     srv := &http.Server{
         Addr:         fmt.Sprintf(":%d", cfg.App.HTTPPort),
@@ -82,6 +267,8 @@ func main() {
         IdleTimeout:  60 * time.Second,
     }
 
+    jobs.Start()
+
     go func() {
         logger.Infof("Server started on port %d", cfg.App.HTTPPort)
         if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -100,5 +287,8 @@ func main() {
     if err := srv.Shutdown(ctx); err != nil {
         logger.Fatalf("Server shutdown failed: %v", err)
     }
+    if err := jobs.Stop(ctx); err != nil {
+        logger.Errorf("Scheduler shutdown failed: %v", err)
+    }
     logger.Info("Server exited properly")
 }
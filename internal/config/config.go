@@ -2,10 +2,16 @@
 package config
 
 import (
+	"encoding/base64"
 	"fmt"
+	"math/big"
+	"strings"
 	"time"
 
 	"github.com/spf13/viper"
+
+	"github.com/Misha-Glazunov/bank-api/pkg/card"
+	"github.com/Misha-Glazunov/bank-api/pkg/money"
 )
 
 // Все конфигурационные настройки приложения
@@ -13,8 +19,30 @@ type Config struct {
 	DB        DBConfig
 	JWT       JWTConfig
 	SMTP      SMTPConfig
-	CentralCB CentralCBConfig
-	App       AppConfig
+	Email       EmailConfig
+	TwoFactor   TwoFactorConfig
+	CentralCB   CentralCBConfig
+	App         AppConfig
+	Idempotency IdempotencyConfig
+	RateLimit   RateLimitConfig
+	FX          FXConfig
+	Limits      LimitsConfig
+	Scheduler   SchedulerConfig
+	Cards       CardsConfig
+	Encryption  EncryptionConfig
+	HMAC        HMACConfig
+	Merchants   MerchantsConfig
+}
+
+// Настройки двухфакторной аутентификации. Перевод на сумму от порога
+// StepUpAmounts для валюты счета требует кода; после MaxAttempts неверных
+// кодов подряд проверки блокируются на LockoutDuration.
+type TwoFactorConfig struct {
+	Issuer            string
+	StepUpAmounts     map[string]string
+	ChallengeLifetime time.Duration
+	MaxAttempts       int
+	LockoutDuration   time.Duration
 }
 
 // Параметры подключения к PostgreSQL
@@ -27,24 +55,29 @@ type DBConfig struct {
 	SSLMode  string
 }
 
-// Настройки JWT-аутентификации
+// Настройки JWT-аутентификации: срок действия access-токена и refresh-токена
 type JWTConfig struct {
-	Secret   string
-	Lifetime time.Duration
+	Secret          string
+	Lifetime        time.Duration
+	RefreshLifetime time.Duration
 }
 
-JWT: JWTConfig{
-    Secret:   viper.GetString("JWT_SECRET"),
-    Lifetime: viper.GetDuration("JWT_LIFETIME"),
-},
-
-// Параметры SMTP-сервера
+// Параметры SMTP-сервера. Пустой SMTP_HOST отключает отправку писем.
 type SMTPConfig struct {
 	Host     string
 	Port     int
 	User     string
 	Password string
 	From     string
+	Timeout  time.Duration
+}
+
+// Ссылки из писем: ключ подписи токенов и сроки действия
+// подтверждения адреса и сброса пароля
+type EmailConfig struct {
+	TokenSecret           string
+	VerificationLifetime  time.Duration
+	PasswordResetLifetime time.Duration
 }
 
 // Настройки интеграции с ЦБ РФ
@@ -55,26 +88,141 @@ type CentralCBConfig struct {
 	RetryDelay   time.Duration
 }
 
-// Настройки приложения
+// Настройки приложения. PublicURL — внешний адрес API для ссылок в письмах.
 type AppConfig struct {
 	Env          string
 	HTTPPort     int
 	ReadTimeout  time.Duration
 	WriteTimeout time.Duration
+	PublicURL    string
+}
+
+// Настройки конвертации валют: спред банка в процентах к курсу ЦБ
+type FXConfig struct {
+	SpreadPercent string
+}
+
+// Лимиты по умолчанию для исходящих операций со счетов по их валюте
+type LimitsConfig struct {
+	ByCurrency map[string]CurrencyLimits
+}
+
+// Лимиты по умолчанию в одной валюте. Пустое значение отключает лимит,
+// для овердрафта — запрещает его.
+type CurrencyLimits struct {
+	MaxTransfer     string
+	Overdraft       string
+	DailyOutgoing   string
+	MonthlyOutgoing string
+}
+
+// Настройки фонового исполнения регулярных переводов.
+// При нехватке средств перевод повторяется MaxRetries раз с интервалом RetryDelay.
+type SchedulerConfig struct {
+	Interval   time.Duration
+	BatchSize  int
+	RetryDelay time.Duration
+	MaxRetries int
+}
+
+// Настройки выпуска карт: диапазоны BIN по платежным системам и срок действия.
+// Платежная система по умолчанию используется, если клиент ее не указал.
+type CardsConfig struct {
+	BINRanges            map[string][]card.BINRange
+	DefaultPaymentSystem string
+	ValidityMonths       int
+	// Срок, в течение которого авторизация удерживает средства до списания
+	AuthorizationHold time.Duration
+	// Страна банка (ISO 3166-1 alpha-2); операции в других странах считаются зарубежными
+	HomeCountry string
+	// Неверных PIN подряд, после которых карта закрывается
+	MaxPINAttempts int
+	// Авторизаций подряд с неверными сроком действия или CVV, после которых карта закрывается
+	MaxCVVAttempts int
+}
+
+// Секреты мерчантов для подписи запросов HMAC-SHA256 по идентификатору мерчанта
+// и допустимое расхождение времени подписи с временем сервера
+type MerchantsConfig struct {
+	Secrets            map[string]string
+	SignatureTolerance time.Duration
+}
+
+// Настройки обработки заголовка Idempotency-Key: срок хранения ответов и время,
+// после которого ключ запроса без сохраненного ответа можно занять заново.
+// LockTimeout должен быть больше времени выполнения самого долгого запроса.
+type IdempotencyConfig struct {
+	Retention   time.Duration
+	LockTimeout time.Duration
+}
+
+// Ограничение частоты запросов: не больше RequestsPerMinute запросов
+// аутентифицированного пользователя в минуту
+type RateLimitConfig struct {
+	RequestsPerMinute int
 }
 
+// Ключ AES-256 для шифрования номеров карт, в base64
 type EncryptionConfig struct {
     Key    string
 }
 
+// Секрет HMAC для слепого индекса номеров карт
 type HMACConfig struct {
     Secret string
 }
 
+// Минимальная длина секрета HMAC
+const minHMACSecretLength = 32
+
+// Валюты счетов, для которых задаются лимиты по умолчанию
+var limitCurrencies = []string{money.DefaultCurrency, "USD", "EUR", "CNY"}
+
 // Загружает конфигурацию из файла .env и переменных окружения
 func LoadConfig() (*Config, error) {
 	viper.AutomaticEnv()
 	viper.SetConfigFile(".env")
+	viper.SetDefault("JWT_LIFETIME", 15*time.Minute)
+	viper.SetDefault("JWT_REFRESH_LIFETIME", 30*24*time.Hour)
+	viper.SetDefault("SMTP_PORT", 587)
+	viper.SetDefault("SMTP_TIMEOUT", 10*time.Second)
+	viper.SetDefault("EMAIL_VERIFICATION_LIFETIME", 48*time.Hour)
+	viper.SetDefault("PASSWORD_RESET_LIFETIME", time.Hour)
+	viper.SetDefault("APP_PUBLIC_URL", "http://localhost:8080")
+	viper.SetDefault("TWO_FACTOR_ISSUER", "Bank API")
+	viper.SetDefault("TWO_FACTOR_STEP_UP_AMOUNT", "100000.00")
+	viper.SetDefault("TWO_FACTOR_STEP_UP_AMOUNT_USD", "1200.00")
+	viper.SetDefault("TWO_FACTOR_STEP_UP_AMOUNT_EUR", "1100.00")
+	viper.SetDefault("TWO_FACTOR_STEP_UP_AMOUNT_CNY", "8500.00")
+	viper.SetDefault("TWO_FACTOR_CHALLENGE_LIFETIME", 5*time.Minute)
+	viper.SetDefault("TWO_FACTOR_MAX_ATTEMPTS", 5)
+	viper.SetDefault("TWO_FACTOR_LOCKOUT", 15*time.Minute)
+	viper.SetDefault("IDEMPOTENCY_RETENTION", 24*time.Hour)
+	viper.SetDefault("IDEMPOTENCY_LOCK_TIMEOUT", 5*time.Minute)
+	viper.SetDefault("RATE_LIMIT_RPM", 100)
+	viper.SetDefault("FX_SPREAD_PERCENT", "1.5")
+	viper.SetDefault("LIMIT_MAX_TRANSFER", "1000000.00")
+	viper.SetDefault("LIMIT_OVERDRAFT", "50000.00")
+	viper.SetDefault("LIMIT_MAX_TRANSFER_USD", "12000.00")
+	viper.SetDefault("LIMIT_OVERDRAFT_USD", "600.00")
+	viper.SetDefault("LIMIT_MAX_TRANSFER_EUR", "11000.00")
+	viper.SetDefault("LIMIT_OVERDRAFT_EUR", "550.00")
+	viper.SetDefault("LIMIT_MAX_TRANSFER_CNY", "85000.00")
+	viper.SetDefault("LIMIT_OVERDRAFT_CNY", "4000.00")
+	viper.SetDefault("SCHEDULER_INTERVAL", time.Minute)
+	viper.SetDefault("SCHEDULER_BATCH_SIZE", 100)
+	viper.SetDefault("SCHEDULED_PAYMENT_RETRY_DELAY", time.Hour)
+	viper.SetDefault("SCHEDULED_PAYMENT_MAX_RETRIES", 3)
+	viper.SetDefault("CARD_BINS_MIR", "220070")
+	viper.SetDefault("CARD_BINS_VISA", "427600")
+	viper.SetDefault("CARD_BINS_MASTERCARD", "546900")
+	viper.SetDefault("CARD_DEFAULT_PAYMENT_SYSTEM", card.PaymentSystemMir)
+	viper.SetDefault("CARD_VALIDITY_MONTHS", 48)
+	viper.SetDefault("CARD_AUTHORIZATION_HOLD", 7*24*time.Hour)
+	viper.SetDefault("CARD_HOME_COUNTRY", "RU")
+	viper.SetDefault("CARD_MAX_PIN_ATTEMPTS", 3)
+	viper.SetDefault("CARD_MAX_CVV_ATTEMPTS", 3)
+	viper.SetDefault("MERCHANT_SIGNATURE_TOLERANCE", 5*time.Minute)
 
 	// Чтение конфигурационного файла
 	if err := viper.ReadInConfig(); err != nil {
@@ -92,8 +240,9 @@ func LoadConfig() (*Config, error) {
 			SSLMode:  viper.GetString("DB_SSLMODE"),
 		},
 		JWT: JWTConfig{
-			Secret:   viper.GetString("JWT_SECRET"),
-			Lifetime: viper.GetDuration("JWT_LIFETIME"),
+			Secret:          viper.GetString("JWT_SECRET"),
+			Lifetime:        viper.GetDuration("JWT_LIFETIME"),
+			RefreshLifetime: viper.GetDuration("JWT_REFRESH_LIFETIME"),
 		},
 		SMTP: SMTPConfig{
 			Host:     viper.GetString("SMTP_HOST"),
@@ -101,6 +250,19 @@ func LoadConfig() (*Config, error) {
 			User:     viper.GetString("SMTP_USER"),
 			Password: viper.GetString("SMTP_PASSWORD"),
 			From:     viper.GetString("SMTP_FROM"),
+			Timeout:  viper.GetDuration("SMTP_TIMEOUT"),
+		},
+		Email: EmailConfig{
+			TokenSecret:           viper.GetString("ACTION_TOKEN_SECRET"),
+			VerificationLifetime:  viper.GetDuration("EMAIL_VERIFICATION_LIFETIME"),
+			PasswordResetLifetime: viper.GetDuration("PASSWORD_RESET_LIFETIME"),
+		},
+		TwoFactor: TwoFactorConfig{
+			Issuer:            viper.GetString("TWO_FACTOR_ISSUER"),
+			StepUpAmounts:     map[string]string{},
+			ChallengeLifetime: viper.GetDuration("TWO_FACTOR_CHALLENGE_LIFETIME"),
+			MaxAttempts:       viper.GetInt("TWO_FACTOR_MAX_ATTEMPTS"),
+			LockoutDuration:   viper.GetDuration("TWO_FACTOR_LOCKOUT"),
 		},
 		CentralCB: CentralCBConfig{
 			WSDLURL:      viper.GetString("CENTRAL_CB_WSDL_URL"),
@@ -113,6 +275,45 @@ func LoadConfig() (*Config, error) {
 			HTTPPort:     viper.GetInt("HTTP_PORT"),
 			ReadTimeout:  viper.GetDuration("READ_TIMEOUT") * time.Second,
 			WriteTimeout: viper.GetDuration("WRITE_TIMEOUT") * time.Second,
+			PublicURL:    strings.TrimRight(viper.GetString("APP_PUBLIC_URL"), "/"),
+		},
+		Idempotency: IdempotencyConfig{
+			Retention:   viper.GetDuration("IDEMPOTENCY_RETENTION"),
+			LockTimeout: viper.GetDuration("IDEMPOTENCY_LOCK_TIMEOUT"),
+		},
+		RateLimit: RateLimitConfig{
+			RequestsPerMinute: viper.GetInt("RATE_LIMIT_RPM"),
+		},
+		FX: FXConfig{
+			SpreadPercent: viper.GetString("FX_SPREAD_PERCENT"),
+		},
+		Limits: LimitsConfig{
+			ByCurrency: map[string]CurrencyLimits{},
+		},
+		Scheduler: SchedulerConfig{
+			Interval:   viper.GetDuration("SCHEDULER_INTERVAL"),
+			BatchSize:  viper.GetInt("SCHEDULER_BATCH_SIZE"),
+			RetryDelay: viper.GetDuration("SCHEDULED_PAYMENT_RETRY_DELAY"),
+			MaxRetries: viper.GetInt("SCHEDULED_PAYMENT_MAX_RETRIES"),
+		},
+		Encryption: EncryptionConfig{
+			Key: viper.GetString("ENCRYPTION_KEY"),
+		},
+		HMAC: HMACConfig{
+			Secret: viper.GetString("HMAC_SECRET"),
+		},
+		Cards: CardsConfig{
+			BINRanges:            map[string][]card.BINRange{},
+			DefaultPaymentSystem: viper.GetString("CARD_DEFAULT_PAYMENT_SYSTEM"),
+			ValidityMonths:       viper.GetInt("CARD_VALIDITY_MONTHS"),
+			AuthorizationHold:    viper.GetDuration("CARD_AUTHORIZATION_HOLD"),
+			HomeCountry:          strings.ToUpper(viper.GetString("CARD_HOME_COUNTRY")),
+			MaxPINAttempts:       viper.GetInt("CARD_MAX_PIN_ATTEMPTS"),
+			MaxCVVAttempts:       viper.GetInt("CARD_MAX_CVV_ATTEMPTS"),
+		},
+		Merchants: MerchantsConfig{
+			Secrets:            map[string]string{},
+			SignatureTolerance: viper.GetDuration("MERCHANT_SIGNATURE_TOLERANCE"),
 		},
 	}
 
@@ -123,6 +324,177 @@ func LoadConfig() (*Config, error) {
 	if cfg.JWT.Secret == "" {
 		return nil, fmt.Errorf("JWT_SECRET is required")
 	}
+	if cfg.JWT.Lifetime <= 0 || cfg.JWT.RefreshLifetime <= 0 {
+		return nil, fmt.Errorf("JWT_LIFETIME and JWT_REFRESH_LIFETIME must be positive")
+	}
+	if cfg.JWT.RefreshLifetime < cfg.JWT.Lifetime {
+		return nil, fmt.Errorf("JWT_REFRESH_LIFETIME must not be shorter than JWT_LIFETIME")
+	}
+	if cfg.SMTP.Host != "" && cfg.SMTP.From == "" {
+		return nil, fmt.Errorf("SMTP_FROM is required when SMTP_HOST is set")
+	}
+	if cfg.Email.VerificationLifetime <= 0 || cfg.Email.PasswordResetLifetime <= 0 {
+		return nil, fmt.Errorf("EMAIL_VERIFICATION_LIFETIME and PASSWORD_RESET_LIFETIME must be positive")
+	}
+	if len(cfg.Email.TokenSecret) < minHMACSecretLength {
+		return nil, fmt.Errorf("ACTION_TOKEN_SECRET must be at least %d characters", minHMACSecretLength)
+	}
+	if cfg.Email.TokenSecret == cfg.JWT.Secret {
+		return nil, fmt.Errorf("ACTION_TOKEN_SECRET must differ from JWT_SECRET")
+	}
+	if cfg.TwoFactor.Issuer == "" || strings.Contains(cfg.TwoFactor.Issuer, ":") {
+		return nil, fmt.Errorf("TWO_FACTOR_ISSUER must be non-empty and must not contain a colon")
+	}
+	if err := loadStepUpAmounts(cfg); err != nil {
+		return nil, err
+	}
+	if cfg.TwoFactor.ChallengeLifetime <= 0 || cfg.TwoFactor.MaxAttempts <= 0 || cfg.TwoFactor.LockoutDuration <= 0 {
+		return nil, fmt.Errorf("TWO_FACTOR_CHALLENGE_LIFETIME, TWO_FACTOR_MAX_ATTEMPTS and TWO_FACTOR_LOCKOUT must be positive")
+	}
+	if key, err := base64.StdEncoding.DecodeString(cfg.Encryption.Key); err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("ENCRYPTION_KEY must be a base64-encoded 32-byte key")
+	}
+	if len(cfg.HMAC.Secret) < minHMACSecretLength {
+		return nil, fmt.Errorf("HMAC_SECRET must be at least %d characters", minHMACSecretLength)
+	}
+	if spread, ok := new(big.Rat).SetString(cfg.FX.SpreadPercent); !ok || spread.Sign() < 0 || spread.Cmp(big.NewRat(100, 1)) >= 0 {
+		return nil, fmt.Errorf("FX_SPREAD_PERCENT must be a number in [0, 100)")
+	}
+	if cfg.Idempotency.Retention <= 0 || cfg.Idempotency.LockTimeout <= 0 {
+		return nil, fmt.Errorf("IDEMPOTENCY_RETENTION and IDEMPOTENCY_LOCK_TIMEOUT must be positive")
+	}
+	if cfg.Idempotency.LockTimeout >= cfg.Idempotency.Retention {
+		return nil, fmt.Errorf("IDEMPOTENCY_LOCK_TIMEOUT must be shorter than IDEMPOTENCY_RETENTION")
+	}
+	if cfg.RateLimit.RequestsPerMinute <= 0 {
+		return nil, fmt.Errorf("RATE_LIMIT_RPM must be positive")
+	}
+	if cfg.Scheduler.Interval <= 0 || cfg.Scheduler.BatchSize <= 0 {
+		return nil, fmt.Errorf("SCHEDULER_INTERVAL and SCHEDULER_BATCH_SIZE must be positive")
+	}
+	if err := loadLimits(cfg); err != nil {
+		return nil, err
+	}
+	if err := loadCardBINs(cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Cards.AuthorizationHold <= 0 {
+		return nil, fmt.Errorf("CARD_AUTHORIZATION_HOLD must be positive")
+	}
+	if len(cfg.Cards.HomeCountry) != 2 {
+		return nil, fmt.Errorf("CARD_HOME_COUNTRY must be a two-letter country code")
+	}
+	if cfg.Cards.MaxPINAttempts <= 0 || cfg.Cards.MaxCVVAttempts <= 0 {
+		return nil, fmt.Errorf("CARD_MAX_PIN_ATTEMPTS and CARD_MAX_CVV_ATTEMPTS must be positive")
+	}
+	if err := loadMerchantSecrets(cfg); err != nil {
+		return nil, err
+	}
 
 	return cfg, nil
 }
+
+// Разбирает лимиты по умолчанию для каждой валюты счета: LIMIT_<ЛИМИТ>
+// для рублей и LIMIT_<ЛИМИТ>_<ВАЛЮТА> для остальных валют
+func loadLimits(cfg *Config) error {
+	for _, currency := range limitCurrencies {
+		suffix := ""
+		if currency != money.DefaultCurrency {
+			suffix = "_" + currency
+		}
+
+		var limits CurrencyLimits
+		for _, f := range []struct {
+			key string
+			dst *string
+		}{
+			{"LIMIT_MAX_TRANSFER", &limits.MaxTransfer},
+			{"LIMIT_OVERDRAFT", &limits.Overdraft},
+			{"LIMIT_DAILY_OUTGOING", &limits.DailyOutgoing},
+			{"LIMIT_MONTHLY_OUTGOING", &limits.MonthlyOutgoing},
+		} {
+			key := f.key + suffix
+			value := viper.GetString(key)
+			if value == "" {
+				continue
+			}
+			if _, err := money.Parse(value, currency); err != nil {
+				return fmt.Errorf("%s must be a non-negative amount: %w", key, err)
+			}
+			*f.dst = value
+		}
+		cfg.Limits.ByCurrency[currency] = limits
+	}
+	return nil
+}
+
+// Разбирает пороги подтверждения операций кодом: TWO_FACTOR_STEP_UP_AMOUNT
+// для рублей и TWO_FACTOR_STEP_UP_AMOUNT_<ВАЛЮТА> для остальных валют
+func loadStepUpAmounts(cfg *Config) error {
+	for _, currency := range limitCurrencies {
+		key := "TWO_FACTOR_STEP_UP_AMOUNT"
+		if currency != money.DefaultCurrency {
+			key += "_" + currency
+		}
+		value := viper.GetString(key)
+		if _, err := money.Parse(value, currency); err != nil {
+			return fmt.Errorf("%s must be a non-negative amount: %w", key, err)
+		}
+		cfg.TwoFactor.StepUpAmounts[currency] = value
+	}
+	return nil
+}
+
+// Разбирает диапазоны BIN из CARD_BINS_<СИСТЕМА> (через запятую) и проверяет,
+// что каждый диапазон принадлежит своей платежной системе
+func loadCardBINs(cfg *Config) error {
+	for system, key := range map[string]string{
+		card.PaymentSystemMir:        "CARD_BINS_MIR",
+		card.PaymentSystemVisa:       "CARD_BINS_VISA",
+		card.PaymentSystemMastercard: "CARD_BINS_MASTERCARD",
+	} {
+		for _, value := range strings.Split(viper.GetString(key), ",") {
+			if strings.TrimSpace(value) == "" {
+				continue
+			}
+			r, err := card.ParseBINRange(value)
+			if err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+			if card.PaymentSystemOf(r.Low) != system || card.PaymentSystemOf(r.High) != system {
+				return fmt.Errorf("%s: BIN range %q does not belong to %s", key, value, system)
+			}
+			cfg.Cards.BINRanges[system] = append(cfg.Cards.BINRanges[system], r)
+		}
+	}
+
+	if len(cfg.Cards.BINRanges[cfg.Cards.DefaultPaymentSystem]) == 0 {
+		return fmt.Errorf("CARD_DEFAULT_PAYMENT_SYSTEM %q has no BIN ranges configured", cfg.Cards.DefaultPaymentSystem)
+	}
+	if cfg.Cards.ValidityMonths <= 0 {
+		return fmt.Errorf("CARD_VALIDITY_MONTHS must be positive")
+	}
+	return nil
+}
+
+// Разбирает MERCHANT_SECRETS: пары идентификатор:секрет через запятую
+func loadMerchantSecrets(cfg *Config) error {
+	for _, pair := range strings.Split(viper.GetString("MERCHANT_SECRETS"), ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		id, secret, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok || id == "" {
+			return fmt.Errorf("MERCHANT_SECRETS: expected merchant_id:secret, got %q", pair)
+		}
+		if len(secret) < minHMACSecretLength {
+			return fmt.Errorf("MERCHANT_SECRETS: secret of merchant %s must be at least %d characters", id, minHMACSecretLength)
+		}
+		cfg.Merchants.Secrets[id] = secret
+	}
+
+	if cfg.Merchants.SignatureTolerance <= 0 {
+		return fmt.Errorf("MERCHANT_SIGNATURE_TOLERANCE must be positive")
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/Misha-Glazunov/bank-api/internal/services"
+	"github.com/Misha-Glazunov/bank-api/pkg/money"
+)
+
+// Список счетов текущего пользователя
+func (h *Handlers) ListAccounts(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	accounts, err := h.accountService.ListAccounts(r.Context(), userID)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, accounts)
+}
+
+// Информация о счете
+func (h *Handlers) GetAccount(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	accountID, ok := h.pathID(w, r, "id", services.ErrAccountNotFound)
+	if !ok {
+		return
+	}
+
+	account, err := h.accountService.GetAccount(r.Context(), userID, accountID)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, account)
+}
+
+// Пополнение счета
+func (h *Handlers) Deposit(w http.ResponseWriter, r *http.Request) {
+	h.changeBalance(w, r, h.accountService.Deposit, false)
+}
+
+// Снятие средств со счета; крупные суммы подтверждаются вторым фактором
+func (h *Handlers) Withdraw(w http.ResponseWriter, r *http.Request) {
+	h.changeBalance(w, r, h.accountService.Withdraw, true)
+}
+
+// Закрытие счета с нулевым балансом
+func (h *Handlers) CloseAccount(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	accountID, ok := h.pathID(w, r, "id", services.ErrAccountNotFound)
+	if !ok {
+		return
+	}
+
+	account, err := h.accountService.CloseAccount(r.Context(), userID, accountID)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, account)
+}
+
+// Действующие лимиты счета и доступные остатки
+func (h *Handlers) GetAccountLimits(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	accountID, ok := h.pathID(w, r, "id", services.ErrAccountNotFound)
+	if !ok {
+		return
+	}
+
+	limits, err := h.accountService.GetLimits(r.Context(), userID, accountID)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, limits)
+}
+
+type balanceOperation func(ctx context.Context, userID, accountID string, amount money.Money) error
+
+// Общая часть пополнения и снятия: разбор суммы, операция и актуальное состояние счета.
+// Для списаний сумма от порога подтверждается вторым фактором.
+func (h *Handlers) changeBalance(w http.ResponseWriter, r *http.Request, operation balanceOperation, debit bool) {
+	userID, err := getUserIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	accountID, ok := h.pathID(w, r, "id", services.ErrAccountNotFound)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Amount money.Money `json:"amount"`
+	}
+
+	if err := decodeJSON(w, r, &req); err != nil {
+		h.respondDecodeError(w, err)
+		return
+	}
+
+	v := &validator{}
+	v.positive("amount", req.Amount)
+	if !h.validate(w, v) {
+		return
+	}
+
+	if debit && !h.stepUpDebit(w, r, userID, accountID, req.Amount) {
+		return
+	}
+
+	if err := operation(r.Context(), userID, accountID, req.Amount); err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	account, err := h.accountService.GetAccount(r.Context(), userID, accountID)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, account)
+}
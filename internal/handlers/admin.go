@@ -0,0 +1,375 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Misha-Glazunov/bank-api/internal/models"
+	"github.com/Misha-Glazunov/bank-api/internal/services"
+)
+
+// Поиск клиентов: q — идентификатор, адрес или часть имени пользователя либо адреса
+func (h *Handlers) AdminSearchUsers(w http.ResponseWriter, r *http.Request) {
+	actorID, err := getUserIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	limit, ok := h.parseLimit(w, r)
+	if !ok {
+		return
+	}
+
+	users, err := h.adminService.SearchUsers(r.Context(), actorID, r.URL.Query().Get("q"), limit)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, users)
+}
+
+// Карточка клиента со счетами и картами
+func (h *Handlers) AdminGetUser(w http.ResponseWriter, r *http.Request) {
+	actorID, err := getUserIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	userID, ok := h.pathID(w, r, "id", services.ErrUserNotFound)
+	if !ok {
+		return
+	}
+
+	overview, err := h.adminService.GetUser(r.Context(), actorID, userID)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, overview)
+}
+
+// Смена роли пользователя; требует кода второго фактора, если он включен
+func (h *Handlers) AdminChangeRole(w http.ResponseWriter, r *http.Request) {
+	actorID, err := getUserIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	userID, ok := h.pathID(w, r, "id", services.ErrUserNotFound)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Role   string `json:"role"`
+		Reason string `json:"reason"`
+	}
+	if err := decodeJSON(w, r, &req); err != nil {
+		h.respondDecodeError(w, err)
+		return
+	}
+
+	v := &validator{}
+	v.oneOf("role", req.Role, models.RoleCustomer, models.RoleOperator, models.RoleAdmin)
+	v.required("reason", req.Reason)
+	if !h.validate(w, v) {
+		return
+	}
+
+	if !h.stepUp(w, r, actorID, nil) {
+		return
+	}
+
+	user, err := h.adminService.ChangeRole(r.Context(), actorID, userID, req.Role, req.Reason)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, user)
+}
+
+// Любой клиентский счет
+func (h *Handlers) AdminGetAccount(w http.ResponseWriter, r *http.Request) {
+	actorID, err := getUserIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	accountID, ok := h.pathID(w, r, "id", services.ErrAccountNotFound)
+	if !ok {
+		return
+	}
+
+	account, err := h.adminService.GetAccount(r.Context(), actorID, accountID)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, account)
+}
+
+func (h *Handlers) AdminFreezeAccount(w http.ResponseWriter, r *http.Request) {
+	h.adminAccountAction(w, r, h.adminService.FreezeAccount)
+}
+
+func (h *Handlers) AdminUnfreezeAccount(w http.ResponseWriter, r *http.Request) {
+	h.adminAccountAction(w, r, h.adminService.UnfreezeAccount)
+}
+
+func (h *Handlers) AdminFreezeCard(w http.ResponseWriter, r *http.Request) {
+	h.adminCardAction(w, r, h.adminService.FreezeCard)
+}
+
+func (h *Handlers) AdminUnfreezeCard(w http.ResponseWriter, r *http.Request) {
+	h.adminCardAction(w, r, h.adminService.UnfreezeCard)
+}
+
+// Ручное зачисление или списание с обязательной причиной;
+// требует кода второго фактора, если он включен
+func (h *Handlers) AdminAdjustBalance(w http.ResponseWriter, r *http.Request) {
+	actorID, err := getUserIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	accountID, ok := h.pathID(w, r, "id", services.ErrAccountNotFound)
+	if !ok {
+		return
+	}
+
+	var req models.BalanceAdjustment
+	if err := decodeJSON(w, r, &req); err != nil {
+		h.respondDecodeError(w, err)
+		return
+	}
+
+	v := &validator{}
+	v.oneOf("direction", req.Direction, models.PostingCredit, models.PostingDebit)
+	v.positive("amount", req.Amount)
+	v.required("reason", req.Reason)
+	if !h.validate(w, v) {
+		return
+	}
+
+	if !h.stepUp(w, r, actorID, nil) {
+		return
+	}
+
+	account, err := h.adminService.AdjustBalance(r.Context(), actorID, accountID, req)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, account)
+}
+
+// Индивидуальные лимиты счета; требует кода второго фактора, если он включен
+func (h *Handlers) AdminSetAccountLimits(w http.ResponseWriter, r *http.Request) {
+	actorID, err := getUserIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	accountID, ok := h.pathID(w, r, "id", services.ErrAccountNotFound)
+	if !ok {
+		return
+	}
+
+	var req models.AccountLimitsUpdate
+	if err := decodeJSON(w, r, &req); err != nil {
+		h.respondDecodeError(w, err)
+		return
+	}
+
+	v := &validator{}
+	v.required("reason", req.Reason)
+	if !h.validate(w, v) {
+		return
+	}
+
+	if !h.stepUp(w, r, actorID, nil) {
+		return
+	}
+
+	limits, err := h.adminService.SetAccountLimits(r.Context(), actorID, accountID, req)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, limits)
+}
+
+// Журнал аудита с фильтрами actor_id, target_type, target_id;
+// следующая страница запрашивается с before, равным created_at последней записи
+func (h *Handlers) AdminListAudit(w http.ResponseWriter, r *http.Request) {
+	actorID, err := getUserIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	q := r.URL.Query()
+	filter := models.AuditFilter{
+		ActorID:    q.Get("actor_id"),
+		TargetType: q.Get("target_type"),
+		TargetID:   q.Get("target_id"),
+	}
+
+	limit, ok := h.parseLimit(w, r)
+	if !ok {
+		return
+	}
+	filter.Limit = limit
+
+	if v := q.Get("before"); v != "" {
+		before, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			h.respondError(w, http.StatusBadRequest, "Invalid before, expected RFC 3339 time")
+			return
+		}
+		filter.Before = &before
+	}
+
+	records, err := h.adminService.ListAudit(r.Context(), actorID, filter)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, records)
+}
+
+// Сторно записи журнала зеркальными проводками; требует кода второго фактора, если он включен
+func (h *Handlers) AdminReverseEntry(w http.ResponseWriter, r *http.Request) {
+	actorID, reason, ok := h.adminReason(w, r)
+	if !ok {
+		return
+	}
+
+	entryID, ok := h.pathID(w, r, "id", services.ErrEntryNotFound)
+	if !ok {
+		return
+	}
+
+	if !h.stepUp(w, r, actorID, nil) {
+		return
+	}
+
+	reversal, err := h.adminService.ReverseEntry(r.Context(), actorID, entryID, reason)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, reversal)
+}
+
+// Сверка кэшированных балансов счетов с журналом
+func (h *Handlers) AdminReconcileLedger(w http.ResponseWriter, r *http.Request) {
+	actorID, err := getUserIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	mismatches, err := h.adminService.Reconcile(r.Context(), actorID)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, mismatches)
+}
+
+// Действие над счетом с причиной в теле запроса
+func (h *Handlers) adminAccountAction(w http.ResponseWriter, r *http.Request, action func(ctx context.Context, actorID, id, reason string) (*models.Account, error)) {
+	actorID, reason, ok := h.adminReason(w, r)
+	if !ok {
+		return
+	}
+
+	accountID, ok := h.pathID(w, r, "id", services.ErrAccountNotFound)
+	if !ok {
+		return
+	}
+
+	account, err := action(r.Context(), actorID, accountID, reason)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, account)
+}
+
+// Действие над картой с причиной в теле запроса
+func (h *Handlers) adminCardAction(w http.ResponseWriter, r *http.Request, action func(ctx context.Context, actorID, id, reason string) (*models.Card, error)) {
+	actorID, reason, ok := h.adminReason(w, r)
+	if !ok {
+		return
+	}
+
+	cardID, ok := h.pathID(w, r, "id", services.ErrCardNotFound)
+	if !ok {
+		return
+	}
+
+	card, err := action(r.Context(), actorID, cardID, reason)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, card)
+}
+
+// Сотрудник из контекста и причина действия из тела запроса
+func (h *Handlers) adminReason(w http.ResponseWriter, r *http.Request) (string, string, bool) {
+	actorID, err := getUserIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return "", "", false
+	}
+
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if err := decodeJSON(w, r, &req); err != nil {
+		h.respondDecodeError(w, err)
+		return "", "", false
+	}
+
+	v := &validator{}
+	v.required("reason", req.Reason)
+	if !h.validate(w, v) {
+		return "", "", false
+	}
+	return actorID, req.Reason, true
+}
+
+func (h *Handlers) parseLimit(w http.ResponseWriter, r *http.Request) (int, bool) {
+	v := r.URL.Query().Get("limit")
+	if v == "" {
+		return 0, true
+	}
+	limit, err := strconv.Atoi(v)
+	if err != nil || limit <= 0 {
+		h.respondError(w, http.StatusBadRequest, "Invalid limit")
+		return 0, false
+	}
+	return limit, true
+}
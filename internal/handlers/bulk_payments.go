@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/beevik/etree"
+
+	"github.com/Misha-Glazunov/bank-api/internal/models"
+)
+
+// Максимальный размер загружаемого файла pain.001
+const maxPaymentFileBytes = 5 << 20
+
+const pain002Namespace = "urn:iso:std:iso:20022:tech:xsd:pain.002.001.03"
+
+// Импорт пакета переводов из файла pain.001. Файл передается телом запроса
+// или полем file формы multipart/form-data; mode=all_or_nothing|best_effort.
+// Ответ - отчет о статусе pain.002.
+func (h *Handlers) ImportPaymentFile(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	raw, err := readPaymentFile(w, r)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			h.respondError(w, http.StatusRequestEntityTooLarge, "Payment file is too large")
+			return
+		}
+		h.respondError(w, http.StatusBadRequest, "Invalid payment file upload")
+		return
+	}
+
+	// Файл может содержать много переводов, поэтому код требуется независимо от сумм
+	if !h.stepUp(w, r, userID, nil) {
+		return
+	}
+
+	report, err := h.bulkPaymentService.Import(r.Context(), userID, raw, r.URL.Query().Get("mode"))
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondPain002(w, report)
+}
+
+func readPaymentFile(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxPaymentFileBytes)
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return io.ReadAll(r.Body)
+	}
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+// Отчет pain.002.001.03. Отклонение группы из-за ошибок в файле - 422,
+// повторная загрузка того же MsgId - 409.
+func (h *Handlers) respondPain002(w http.ResponseWriter, report *models.BulkPaymentReport) {
+	doc := etree.NewDocument()
+	doc.CreateProcInst("xml", `version="1.0" encoding="UTF-8"`)
+
+	root := doc.CreateElement("Document")
+	root.CreateAttr("xmlns", pain002Namespace)
+	stsRpt := root.CreateElement("CstmrPmtStsRpt")
+
+	header := stsRpt.CreateElement("GrpHdr")
+	header.CreateElement("MsgId").SetText(fmt.Sprintf("STS-%s", report.CreatedAt.Format("20060102150405.000000")))
+	header.CreateElement("CreDtTm").SetText(report.CreatedAt.Format(time.RFC3339))
+
+	group := stsRpt.CreateElement("OrgnlGrpInfAndSts")
+	group.CreateElement("OrgnlMsgId").SetText(report.MessageID)
+	group.CreateElement("OrgnlMsgNmId").SetText("pain.001")
+	group.CreateElement("OrgnlNbOfTxs").SetText(strconv.Itoa(report.NumberOfTransactions))
+	group.CreateElement("OrgnlCtrlSum").SetText(report.ControlSum)
+	group.CreateElement("GrpSts").SetText(report.Status)
+	painStatusReason(group, report.Reason, report.Details)
+
+	for _, instruction := range report.Instructions {
+		info := stsRpt.CreateElement("OrgnlPmtInfAndSts")
+		info.CreateElement("OrgnlPmtInfId").SetText(instruction.PaymentInfoID)
+		info.CreateElement("PmtInfSts").SetText(instruction.Status)
+
+		for _, transfer := range instruction.Transfers {
+			tx := info.CreateElement("TxInfAndSts")
+			if transfer.InstructionID != "" {
+				tx.CreateElement("OrgnlInstrId").SetText(transfer.InstructionID)
+			}
+			tx.CreateElement("OrgnlEndToEndId").SetText(transfer.EndToEndID)
+			tx.CreateElement("TxSts").SetText(transfer.Status)
+			painStatusReason(tx, transfer.Reason, transfer.Details)
+		}
+	}
+
+	code := http.StatusOK
+	switch report.Reason {
+	case models.ReasonDuplication:
+		code = http.StatusConflict
+	case models.ReasonInvalidFileFormat, models.ReasonInvalidControlSum, models.ReasonInvalidNumberOfTxs:
+		code = http.StatusUnprocessableEntity
+	}
+
+	doc.Indent(2)
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(code)
+	if _, err := doc.WriteTo(w); err != nil {
+		h.logger.Errorf("Failed to write pain.002 report: %v", err)
+	}
+}
+
+func painStatusReason(parent *etree.Element, reason, details string) {
+	if reason == "" {
+		return
+	}
+	info := parent.CreateElement("StsRsnInf")
+	info.CreateElement("Rsn").CreateElement("Cd").SetText(reason)
+	if details != "" {
+		info.CreateElement("AddtlInf").SetText(details)
+	}
+}
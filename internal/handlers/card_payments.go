@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/Misha-Glazunov/bank-api/internal/middleware"
+	"github.com/Misha-Glazunov/bank-api/internal/models"
+	"github.com/Misha-Glazunov/bank-api/internal/services"
+	"github.com/Misha-Glazunov/bank-api/pkg/money"
+)
+
+// Авторизация платежа по реквизитам карты. Отказ возвращается
+// со статусом 402 и причиной для мерчанта.
+func (h *Handlers) AuthorizeCardPayment(w http.ResponseWriter, r *http.Request) {
+	merchantID, err := middleware.GetMerchantIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req models.CardAuthorizationRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		h.respondDecodeError(w, err)
+		return
+	}
+
+	v := &validator{}
+	v.required("pan", req.PAN)
+	v.positive("amount", req.Amount)
+	if !h.validate(w, v) {
+		return
+	}
+
+	authorization, err := h.cardPaymentService.Authorize(r.Context(), merchantID, req)
+	if err != nil {
+		var declined *services.CardDeclinedError
+		if errors.As(err, &declined) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusPaymentRequired)
+			json.NewEncoder(w).Encode(map[string]string{
+				"status": "declined",
+				"reason": declined.Reason,
+			})
+			return
+		}
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, authorization)
+}
+
+func (h *Handlers) GetCardAuthorization(w http.ResponseWriter, r *http.Request) {
+	merchantID, err := middleware.GetMerchantIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	authorization, err := h.cardPaymentService.Get(r.Context(), merchantID, mux.Vars(r)["id"])
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, authorization)
+}
+
+// Полное или частичное списание авторизованной суммы
+func (h *Handlers) CaptureCardPayment(w http.ResponseWriter, r *http.Request) {
+	h.settleCardPayment(w, r, h.cardPaymentService.Capture)
+}
+
+// Отмена авторизации до списания
+func (h *Handlers) VoidCardPayment(w http.ResponseWriter, r *http.Request) {
+	merchantID, err := middleware.GetMerchantIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	authorization, err := h.cardPaymentService.Void(r.Context(), merchantID, mux.Vars(r)["id"])
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, authorization)
+}
+
+// Полный или частичный возврат списанной суммы. Reference возврата обязателен:
+// повтор с тем же reference не возвращает средства второй раз.
+func (h *Handlers) RefundCardPayment(w http.ResponseWriter, r *http.Request) {
+	merchantID, err := middleware.GetMerchantIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req models.CardRefundRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		h.respondDecodeError(w, err)
+		return
+	}
+
+	v := &validator{}
+	v.required("reference", req.Reference)
+	v.optionalPositive("amount", req.Amount)
+	if !h.validate(w, v) {
+		return
+	}
+
+	authorization, err := h.cardPaymentService.Refund(r.Context(), merchantID, mux.Vars(r)["id"], req)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, authorization)
+}
+
+type settlementOperation func(ctx context.Context, merchantID, authorizationID string, amount *money.Money) (*models.CardAuthorization, error)
+
+// Списание: тело с суммой необязательно
+func (h *Handlers) settleCardPayment(w http.ResponseWriter, r *http.Request, operation settlementOperation) {
+	merchantID, err := middleware.GetMerchantIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req struct {
+		Amount *money.Money `json:"amount"`
+	}
+	if err := decodeJSON(w, r, &req); err != nil && !errors.Is(err, io.EOF) {
+		h.respondDecodeError(w, err)
+		return
+	}
+
+	v := &validator{}
+	v.optionalPositive("amount", req.Amount)
+	if !h.validate(w, v) {
+		return
+	}
+
+	authorization, err := operation(r.Context(), merchantID, mux.Vars(r)["id"], req.Amount)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, authorization)
+}
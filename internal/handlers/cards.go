@@ -0,0 +1,321 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/Misha-Glazunov/bank-api/internal/models"
+	"github.com/Misha-Glazunov/bank-api/internal/services"
+)
+
+// Список карт текущего пользователя
+func (h *Handlers) ListCards(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	cards, err := h.cardService.List(r.Context(), userID)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, cards)
+}
+
+// Информация о карте
+func (h *Handlers) GetCard(w http.ResponseWriter, r *http.Request) {
+	h.cardOperation(w, r, h.cardService.Get)
+}
+
+// Привязка карты к другому счету владельца
+func (h *Handlers) LinkCardAccount(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	cardID, ok := h.pathID(w, r, "id", services.ErrCardNotFound)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		AccountID string `json:"account_id"`
+	}
+	if err := decodeJSON(w, r, &req); err != nil {
+		h.respondDecodeError(w, err)
+		return
+	}
+
+	v := &validator{}
+	v.uuid("account_id", req.AccountID)
+	if !h.validate(w, v) {
+		return
+	}
+
+	card, err := h.cardService.LinkAccount(r.Context(), userID, cardID, req.AccountID)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, card)
+}
+
+// Временная блокировка карты
+func (h *Handlers) BlockCard(w http.ResponseWriter, r *http.Request) {
+	h.cardOperation(w, r, h.cardService.Block)
+}
+
+// Снятие временной блокировки; подтверждается вторым фактором
+func (h *Handlers) UnblockCard(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	cardID, ok := h.pathID(w, r, "id", services.ErrCardNotFound)
+	if !ok {
+		return
+	}
+
+	if !h.stepUp(w, r, userID, nil) {
+		return
+	}
+
+	card, err := h.cardService.Unblock(r.Context(), userID, cardID)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, card)
+}
+
+// Постоянная блокировка утерянной или украденной карты
+func (h *Handlers) CloseCard(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	cardID, ok := h.pathID(w, r, "id", services.ErrCardNotFound)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if err := decodeJSON(w, r, &req); err != nil {
+		h.respondDecodeError(w, err)
+		return
+	}
+
+	v := &validator{}
+	v.required("reason", req.Reason)
+	if !h.validate(w, v) {
+		return
+	}
+
+	card, err := h.cardService.Close(r.Context(), userID, cardID, req.Reason)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, card)
+}
+
+// Перевыпуск карты с новым номером и переносом лимитов
+func (h *Handlers) ReissueCard(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	cardID, ok := h.pathID(w, r, "id", services.ErrCardNotFound)
+	if !ok {
+		return
+	}
+
+	card, err := h.cardService.Reissue(r.Context(), userID, cardID)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	// Ответ содержит CVV новой карты, как и при выпуске
+	w.Header().Set("Cache-Control", "no-store")
+	h.respondJSON(w, card)
+}
+
+// Первичная установка PIN
+func (h *Handlers) SetCardPIN(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	cardID, ok := h.pathID(w, r, "id", services.ErrCardNotFound)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		PIN string `json:"pin"`
+	}
+	if err := decodeJSON(w, r, &req); err != nil {
+		h.respondDecodeError(w, err)
+		return
+	}
+
+	v := &validator{}
+	v.pin("pin", req.PIN)
+	if !h.validate(w, v) {
+		return
+	}
+
+	if err := h.cardService.SetPIN(r.Context(), userID, cardID, req.PIN); err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Смена PIN с проверкой текущего и второго фактора
+func (h *Handlers) ChangeCardPIN(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	cardID, ok := h.pathID(w, r, "id", services.ErrCardNotFound)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		OldPIN string `json:"old_pin"`
+		NewPIN string `json:"new_pin"`
+	}
+	if err := decodeJSON(w, r, &req); err != nil {
+		h.respondDecodeError(w, err)
+		return
+	}
+
+	v := &validator{}
+	v.pin("old_pin", req.OldPIN)
+	v.pin("new_pin", req.NewPIN)
+	if !h.validate(w, v) {
+		return
+	}
+
+	if !h.stepUp(w, r, userID, nil) {
+		return
+	}
+
+	err = h.cardService.ChangePIN(r.Context(), userID, cardID, req.OldPIN, req.NewPIN)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Лимиты расходных операций по карте
+func (h *Handlers) GetCardLimits(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	cardID, ok := h.pathID(w, r, "id", services.ErrCardNotFound)
+	if !ok {
+		return
+	}
+
+	limits, err := h.cardService.GetLimits(r.Context(), userID, cardID)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, limits)
+}
+
+// Замена лимитов карты; отсутствующий лимит снимается. Подтверждается вторым фактором
+func (h *Handlers) UpdateCardLimits(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	cardID, ok := h.pathID(w, r, "id", services.ErrCardNotFound)
+	if !ok {
+		return
+	}
+
+	var req models.CardLimits
+	if err := decodeJSON(w, r, &req); err != nil {
+		h.respondDecodeError(w, err)
+		return
+	}
+
+	v := &validator{}
+	v.optionalPositive("per_transaction", req.PerTransaction)
+	v.optionalPositive("daily", req.Daily)
+	v.optionalPositive("monthly", req.Monthly)
+	if !h.validate(w, v) {
+		return
+	}
+
+	if !h.stepUp(w, r, userID, nil) {
+		return
+	}
+
+	limits, err := h.cardService.UpdateLimits(r.Context(), userID, cardID, &req)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, limits)
+}
+
+type cardOperationFunc func(ctx context.Context, userID, cardID string) (*models.Card, error)
+
+// Общая часть операций над картой без тела запроса
+func (h *Handlers) cardOperation(w http.ResponseWriter, r *http.Request, operation cardOperationFunc) {
+	userID, err := getUserIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	cardID, ok := h.pathID(w, r, "id", services.ErrCardNotFound)
+	if !ok {
+		return
+	}
+
+	card, err := operation(r.Context(), userID, cardID)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, card)
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/Misha-Glazunov/bank-api/internal/models"
+	"github.com/Misha-Glazunov/bank-api/internal/services"
+	"github.com/Misha-Glazunov/bank-api/pkg/money"
+)
+
+// Список продуктов вкладов
+func (h *Handlers) ListDepositProducts(w http.ResponseWriter, r *http.Request) {
+	products, err := h.depositService.ListProducts(r.Context())
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, products)
+}
+
+// Открытие вклада с переводом суммы с другого счета
+func (h *Handlers) OpenDeposit(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req struct {
+		Product       string      `json:"product"`
+		FromAccountID string      `json:"from_account"`
+		Amount        money.Money `json:"amount"`
+	}
+
+	if err := decodeJSON(w, r, &req); err != nil {
+		h.respondDecodeError(w, err)
+		return
+	}
+
+	v := &validator{}
+	v.required("product", req.Product)
+	v.uuid("from_account", req.FromAccountID)
+	v.positive("amount", req.Amount)
+	if !h.validate(w, v) {
+		return
+	}
+
+	deposit, err := h.depositService.Open(r.Context(), userID, models.DepositApplication{
+		ProductCode:   req.Product,
+		FromAccountID: req.FromAccountID,
+		Amount:        req.Amount,
+	})
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, deposit)
+}
+
+func (h *Handlers) ListDeposits(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	deposits, err := h.depositService.List(r.Context(), userID)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, deposits)
+}
+
+func (h *Handlers) GetDeposit(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	depositID, ok := h.pathID(w, r, "id", services.ErrDepositNotFound)
+	if !ok {
+		return
+	}
+
+	deposit, err := h.depositService.Get(r.Context(), userID, depositID)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, deposit)
+}
+
+// Ежедневные начисления процентов по вкладу
+func (h *Handlers) ListDepositAccruals(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	depositID, ok := h.pathID(w, r, "id", services.ErrDepositNotFound)
+	if !ok {
+		return
+	}
+
+	accruals, err := h.depositService.ListAccruals(r.Context(), userID, depositID)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, accruals)
+}
+
+// Закрытие вклада с переводом остатка; срочный вклад до окончания срока
+// закрывается с пересчетом процентов
+func (h *Handlers) CloseDeposit(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	depositID, ok := h.pathID(w, r, "id", services.ErrDepositNotFound)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		ToAccountID string `json:"to_account"`
+	}
+
+	if err := decodeJSON(w, r, &req); err != nil {
+		h.respondDecodeError(w, err)
+		return
+	}
+
+	v := &validator{}
+	v.uuid("to_account", req.ToAccountID)
+	if !h.validate(w, v) {
+		return
+	}
+
+	deposit, err := h.depositService.Close(r.Context(), userID, depositID, req.ToAccountID)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, deposit)
+}
@@ -3,10 +3,13 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 		
 	"github.com/Misha-Glazunov/bank-api/internal/middleware"
 	"github.com/Misha-Glazunov/bank-api/internal/services"
+	"github.com/Misha-Glazunov/bank-api/pkg/money"
 	"github.com/sirupsen/logrus"
 )
 
@@ -17,6 +20,16 @@ type Handlers struct {
 	paymentService services.PaymentService
 	cbService      services.CentralBankService
 	logger         *logrus.Logger
+
+	scheduledPaymentService services.ScheduledPaymentService
+	loanService             services.LoanService
+	depositService          services.DepositService
+	statementService        services.StatementService
+	bulkPaymentService      services.BulkPaymentService
+	cardPaymentService      services.CardPaymentService
+	holdService             services.HoldService
+	twoFactorService        services.TwoFactorService
+	adminService            services.AdminService
 }
 
 func NewHandlers(
@@ -25,6 +38,15 @@ func NewHandlers(
 	card services.CardService,
 	payment services.PaymentService,
 	cb services.CentralBankService,
+	scheduledPayment services.ScheduledPaymentService,
+	loan services.LoanService,
+	deposit services.DepositService,
+	statement services.StatementService,
+	bulkPayment services.BulkPaymentService,
+	cardPayment services.CardPaymentService,
+	hold services.HoldService,
+	twoFactor services.TwoFactorService,
+	admin services.AdminService,
 	logger *logrus.Logger,
 ) *Handlers {
 	return &Handlers{
@@ -34,6 +56,16 @@ func NewHandlers(
 		paymentService: payment,
 		cbService:      cb,
 		logger:         logger,
+
+		scheduledPaymentService: scheduledPayment,
+		loanService:             loan,
+		depositService:          deposit,
+		statementService:        statement,
+		bulkPaymentService:      bulkPayment,
+		cardPaymentService:      cardPayment,
+		holdService:             hold,
+		twoFactorService:        twoFactor,
+		adminService:            admin,
 	}
 }
 
@@ -45,8 +77,16 @@ func (h *Handlers) Register(w http.ResponseWriter, r *http.Request) {
 		Password string `json:"password"`
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.respondError(w, http.StatusBadRequest, "Invalid request format")
+	if err := decodeJSON(w, r, &req); err != nil {
+		h.respondDecodeError(w, err)
+		return
+	}
+
+	v := &validator{}
+	v.email("email", req.Email)
+	v.username("username", req.Username)
+	v.password("password", req.Password)
+	if !h.validate(w, v) {
 		return
 	}
 
@@ -58,25 +98,160 @@ func (h *Handlers) Register(w http.ResponseWriter, r *http.Request) {
 	h.respondJSON(w, map[string]string{"status": "success"})
 }
 
-// Обработчик аутентификации
+// Обработчик аутентификации. При включенной двухфакторной аутентификации
+// ответ содержит токен второго шага вместо пары токенов.
 func (h *Handlers) Login(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.respondError(w, http.StatusBadRequest, "Invalid request format")
+	if err := decodeJSON(w, r, &req); err != nil {
+		h.respondDecodeError(w, err)
+		return
+	}
+
+	v := &validator{}
+	v.required("email", req.Email)
+	v.required("password", req.Password)
+	if !h.validate(w, v) {
+		return
+	}
+
+	tokens, err := h.authService.Login(r.Context(), req.Email, req.Password)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	h.respondJSON(w, tokens)
+}
+
+// Обмен refresh-токена на новую пару токенов
+func (h *Handlers) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	if err := decodeJSON(w, r, &req); err != nil {
+		h.respondDecodeError(w, err)
+		return
+	}
+
+	v := &validator{}
+	v.required("refresh_token", req.RefreshToken)
+	if !h.validate(w, v) {
 		return
 	}
 
-	token, err := h.authService.Login(r.Context(), req.Email, req.Password)
+	tokens, err := h.authService.Refresh(r.Context(), req.RefreshToken)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	h.respondJSON(w, tokens)
+}
+
+// Завершение сессии текущего access-токена
+func (h *Handlers) Logout(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	sessionID, err := middleware.GetSessionIDFromContext(r.Context())
 	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	if err := h.authService.Logout(r.Context(), userID, sessionID); err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Подтверждение адреса электронной почты по ссылке из письма
+func (h *Handlers) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	if err := h.authService.VerifyEmail(r.Context(), r.URL.Query().Get("token")); err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, map[string]string{"status": "verified"})
+}
+
+// Повторная отправка письма для подтверждения адреса
+func (h *Handlers) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	if err := h.authService.ResendVerification(r.Context(), userID); err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// Запрос ссылки для сброса пароля. Ответ не зависит от того, зарегистрирован ли адрес.
+func (h *Handlers) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+	}
+
+	if err := decodeJSON(w, r, &req); err != nil {
+		h.respondDecodeError(w, err)
+		return
+	}
+
+	v := &validator{}
+	v.email("email", req.Email)
+	if !h.validate(w, v) {
+		return
+	}
+
+	if err := h.authService.RequestPasswordReset(r.Context(), req.Email); err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// Установка нового пароля по токену из письма
+func (h *Handlers) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	if err := decodeJSON(w, r, &req); err != nil {
+		h.respondDecodeError(w, err)
+		return
+	}
+
+	v := &validator{}
+	v.required("token", req.Token)
+	v.password("password", req.Password)
+	if !h.validate(w, v) {
+		return
+	}
+
+	if err := h.authService.ResetPassword(r.Context(), req.Token, req.Password); err != nil {
 		h.handleServiceError(w, err)
 		return
 	}
 
-	h.respondJSON(w, map[string]string{"token": token})
+	w.WriteHeader(http.StatusNoContent)
 }
 
 // Создание нового счета
@@ -87,7 +262,18 @@ func (h *Handlers) CreateAccount(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	account, err := h.accountService.CreateAccount(r.Context(), userID)
+	var req struct {
+		Currency    string `json:"currency"`
+		ProductType string `json:"product_type"`
+	}
+
+	// Тело необязательно: без него открывается рублевый текущий счет
+	if err := decodeJSON(w, r, &req); err != nil && !errors.Is(err, io.EOF) {
+		h.respondDecodeError(w, err)
+		return
+	}
+
+	account, err := h.accountService.CreateAccount(r.Context(), userID, req.Currency, req.ProductType)
 	if err != nil {
 		h.handleServiceError(w, err)
 		return
@@ -104,29 +290,109 @@ func (h *Handlers) CreateCard(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	card, err := h.cardService.CreateCard(r.Context(), userID)
+	var req struct {
+		AccountID     string `json:"account_id"`
+		PaymentSystem string `json:"payment_system"`
+	}
+
+	// Без payment_system выпускается карта платежной системы по умолчанию
+	if err := decodeJSON(w, r, &req); err != nil {
+		h.respondDecodeError(w, err)
+		return
+	}
+
+	v := &validator{}
+	v.uuid("account_id", req.AccountID)
+	if !h.validate(w, v) {
+		return
+	}
+
+	card, err := h.cardService.CreateCard(r.Context(), userID, req.AccountID, req.PaymentSystem)
 	if err != nil {
 		h.handleServiceError(w, err)
 		return
 	}
 
+	// CVV показывается один раз: ответ не кешируется и не сохраняется для Idempotency-Key
+	w.Header().Set("Cache-Control", "no-store")
+
+	h.respondJSON(w, card)
+}
+
+// Привилегированное раскрытие полного номера карты; требует повторного ввода пароля
+// и второго фактора
+func (h *Handlers) RevealCardNumber(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	cardID, ok := h.pathID(w, r, "id", services.ErrCardNotFound)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Password string `json:"password"`
+	}
+	if err := decodeJSON(w, r, &req); err != nil {
+		h.respondDecodeError(w, err)
+		return
+	}
+
+	v := &validator{}
+	v.required("password", req.Password)
+	if !h.validate(w, v) {
+		return
+	}
+
+	if !h.stepUp(w, r, userID, nil) {
+		return
+	}
+
+	card, err := h.cardService.RevealNumber(r.Context(), userID, cardID, req.Password)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
 	h.respondJSON(w, card)
 }
 
 // Обработчик перевода средств
 func (h *Handlers) TransferFunds(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
 	var req struct {
 		FromAccountID string  `json:"from_account"`
 		ToAccountID   string  `json:"to_account"`
-		Amount        float64 `json:"amount"`
+		Amount        money.Money `json:"amount"`
+	}
+
+	if err := decodeJSON(w, r, &req); err != nil {
+		h.respondDecodeError(w, err)
+		return
+	}
+
+	v := &validator{}
+	v.uuid("from_account", req.FromAccountID)
+	v.uuid("to_account", req.ToAccountID)
+	v.positive("amount", req.Amount)
+	if !h.validate(w, v) {
+		return
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.respondError(w, http.StatusBadRequest, "Invalid request format")
+	if !h.stepUpDebit(w, r, userID, req.FromAccountID, req.Amount) {
 		return
 	}
 
-	if err := h.paymentService.Transfer(r.Context(), req.FromAccountID, req.ToAccountID, req.Amount); err != nil {
+	if err := h.paymentService.Transfer(r.Context(), userID, req.FromAccountID, req.ToAccountID, req.Amount); err != nil {
 		h.handleServiceError(w, err)
 		return
 	}
@@ -134,6 +400,34 @@ func (h *Handlers) TransferFunds(w http.ResponseWriter, r *http.Request) {
 	h.respondJSON(w, map[string]string{"status": "success"})
 }
 
+// История операций по счету с курсорной пагинацией и фильтрами
+func (h *Handlers) GetTransactions(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	accountID, ok := h.pathID(w, r, "id", services.ErrAccountNotFound)
+	if !ok {
+		return
+	}
+
+	filter, err := parseTransactionFilter(r.URL.Query())
+	if err != nil {
+		h.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	page, err := h.paymentService.GetTransactions(r.Context(), userID, accountID, filter, r.URL.Query().Get("cursor"))
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, page)
+}
+
 func (h *Handlers) respondError(w http.ResponseWriter, code int, message string) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(code)
@@ -149,21 +443,132 @@ func (h *Handlers) respondJSON(w http.ResponseWriter, data interface{}) {
 }
 
 func (h *Handlers) handleServiceError(w http.ResponseWriter, err error) {
-	switch err {
-	case services.ErrUserAlreadyExists:
+	var limitErr *services.LimitExceededError
+	switch {
+	case errors.As(err, &limitErr):
+		h.respondLimitError(w, limitErr)
+	case errors.Is(err, services.ErrUserAlreadyExists):
 		h.respondError(w, http.StatusConflict, err.Error())
-	case services.ErrInvalidCredentials:
+	case errors.Is(err, services.ErrInvalidCredentials),
+		errors.Is(err, services.ErrInvalidRefreshToken),
+		errors.Is(err, services.ErrInvalidChallenge):
 		h.respondError(w, http.StatusUnauthorized, err.Error())
-	case services.ErrAccountNotFound:
+	case errors.Is(err, services.ErrAccountNotFound),
+		errors.Is(err, services.ErrDestinationNotFound),
+		errors.Is(err, services.ErrCardNotFound),
+		errors.Is(err, services.ErrScheduledPaymentNotFound),
+		errors.Is(err, services.ErrLoanNotFound),
+		errors.Is(err, services.ErrDepositNotFound),
+		errors.Is(err, services.ErrCardAuthorizationNotFound),
+		errors.Is(err, services.ErrHoldNotFound),
+		errors.Is(err, services.ErrUserNotFound),
+		errors.Is(err, services.ErrEntryNotFound):
 		h.respondError(w, http.StatusNotFound, err.Error())
-	case services.ErrInsufficientFunds:
+	case errors.Is(err, services.ErrAccessDenied),
+		errors.Is(err, services.ErrIncorrectPIN),
+		errors.Is(err, services.ErrEmailNotVerified),
+		errors.Is(err, services.ErrTwoFactorRequired),
+		errors.Is(err, services.ErrInvalidTwoFactorCode):
+		h.respondError(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, services.ErrAccountClosed),
+		errors.Is(err, services.ErrAccountBalanceNotZero),
+		errors.Is(err, services.ErrScheduledPaymentInactive),
+		errors.Is(err, services.ErrLoanClosed),
+		errors.Is(err, services.ErrDepositClosed),
+		errors.Is(err, services.ErrDepositLocked),
+		errors.Is(err, services.ErrCardBlocked),
+		errors.Is(err, services.ErrCardClosed),
+		errors.Is(err, services.ErrCardExpired),
+		errors.Is(err, services.ErrCardNotBlocked),
+		errors.Is(err, services.ErrCardReissued),
+		errors.Is(err, services.ErrPINAlreadySet),
+		errors.Is(err, services.ErrPINNotSet),
+		errors.Is(err, services.ErrDuplicateAuthorization),
+		errors.Is(err, services.ErrAuthorizationNotPending),
+		errors.Is(err, services.ErrAuthorizationExpired),
+		errors.Is(err, services.ErrAuthorizationNotCaptured),
+		errors.Is(err, services.ErrRefundReferenceConflict),
+		errors.Is(err, services.ErrHoldNotActive),
+		errors.Is(err, services.ErrHoldNotReleasable),
+		errors.Is(err, services.ErrAccountHasHolds),
+		errors.Is(err, services.ErrEmailAlreadyVerified),
+		errors.Is(err, services.ErrTwoFactorEnabled),
+		errors.Is(err, services.ErrTwoFactorNotEnabled),
+		errors.Is(err, services.ErrTwoFactorNotEnrolled),
+		errors.Is(err, services.ErrAccountFrozen),
+		errors.Is(err, services.ErrAccountNotFrozen),
+		errors.Is(err, services.ErrCardFrozen),
+		errors.Is(err, services.ErrCardNotFrozen),
+		errors.Is(err, services.ErrEntryNotReversible),
+		errors.Is(err, services.ErrPostingRejected):
+		h.respondError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, services.ErrInsufficientFunds),
+		errors.Is(err, services.ErrInvalidAmount),
+		errors.Is(err, services.ErrSameAccount),
+		errors.Is(err, services.ErrCurrencyMismatch),
+		errors.Is(err, services.ErrInvalidCursor),
+		errors.Is(err, services.ErrUnsupportedCurrency),
+		errors.Is(err, services.ErrUnsupportedProduct),
+		errors.Is(err, services.ErrInvalidSchedule),
+		errors.Is(err, services.ErrLoanTermsOutOfRange),
+		errors.Is(err, services.ErrRepaymentExceedsDebt),
+		errors.Is(err, services.ErrDepositAmountTooLow),
+		errors.Is(err, services.ErrInvalidPeriod),
+		errors.Is(err, services.ErrInvalidPaymentFile),
+		errors.Is(err, services.ErrInvalidBulkMode),
+		errors.Is(err, services.ErrInvalidBlockReason),
+		errors.Is(err, services.ErrInvalidPIN),
+		errors.Is(err, services.ErrAccountRequired),
+		errors.Is(err, services.ErrReferenceRequired),
+		errors.Is(err, services.ErrAmountExceedsAuthorization),
+		errors.Is(err, services.ErrReasonRequired),
+		errors.Is(err, services.ErrInvalidHoldExpiry),
+		errors.Is(err, services.ErrInvalidMCC),
+		errors.Is(err, services.ErrInvalidChannel),
+		errors.Is(err, services.ErrInvalidCountry),
+		errors.Is(err, services.ErrInvalidActionToken),
+		errors.Is(err, services.ErrWeakPassword),
+		errors.Is(err, services.ErrInvalidEmail),
+		errors.Is(err, services.ErrInvalidUsername),
+		errors.Is(err, services.ErrInvalidRole),
+		errors.Is(err, services.ErrQueryRequired),
+		errors.Is(err, services.ErrInvalidDirection),
+		errors.Is(err, services.ErrUnsupportedPaymentSystem):
 		h.respondError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, services.ErrTooManyTwoFactorAttempts):
+		h.respondError(w, http.StatusTooManyRequests, err.Error())
+	case errors.Is(err, services.ErrUnsupportedCurrencyPair):
+		h.respondError(w, http.StatusUnprocessableEntity, err.Error())
+	case errors.Is(err, services.ErrExchangeRateUnavailable):
+		h.logger.Warnf("Exchange rate unavailable: %v", err)
+		h.respondError(w, http.StatusServiceUnavailable, services.ErrExchangeRateUnavailable.Error())
+	case errors.Is(err, services.ErrKeyRateUnavailable):
+		h.logger.Warnf("Key rate unavailable: %v", err)
+		h.respondError(w, http.StatusServiceUnavailable, services.ErrKeyRateUnavailable.Error())
 	default:
 		h.logger.Errorf("Internal server error: %v", err)
 		h.respondError(w, http.StatusInternalServerError, "Internal server error")
 	}
 }
 
+// Ответ на превышение лимита с указанием лимита и доступного остатка.
+// Нехватка средств с учетом овердрафта остается ошибкой запроса.
+func (h *Handlers) respondLimitError(w http.ResponseWriter, err *services.LimitExceededError) {
+	code := http.StatusUnprocessableEntity
+	if errors.Is(err, services.ErrInsufficientFunds) {
+		code = http.StatusBadRequest
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":     err.Error(),
+		"limit":     err.Limit,
+		"amount":    err.Amount,
+		"remaining": err.Remaining,
+	})
+}
+
 func getUserIDFromContext(ctx context.Context) (string, error) {
     return middleware.GetUserIDFromContext(ctx)
 }
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/Misha-Glazunov/bank-api/internal/models"
+	"github.com/Misha-Glazunov/bank-api/internal/services"
+)
+
+// Удержания по счету, включая снятые и истекшие
+func (h *Handlers) ListHolds(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	accountID, ok := h.pathID(w, r, "id", services.ErrAccountNotFound)
+	if !ok {
+		return
+	}
+
+	holds, err := h.holdService.List(r.Context(), userID, accountID)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, holds)
+}
+
+// Резервирование средств на счете
+func (h *Handlers) CreateHold(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	accountID, ok := h.pathID(w, r, "id", services.ErrAccountNotFound)
+	if !ok {
+		return
+	}
+
+	var req models.HoldRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		h.respondDecodeError(w, err)
+		return
+	}
+
+	v := &validator{}
+	v.positive("amount", req.Amount)
+	v.required("reason", req.Reason)
+	if !h.validate(w, v) {
+		return
+	}
+
+	hold, err := h.holdService.Create(r.Context(), userID, accountID, req)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, hold)
+}
+
+// Снятие резерва владельцем счета
+func (h *Handlers) ReleaseHold(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	accountID, ok := h.pathID(w, r, "id", services.ErrAccountNotFound)
+	if !ok {
+		return
+	}
+	holdID, ok := h.pathID(w, r, "holdId", services.ErrHoldNotFound)
+	if !ok {
+		return
+	}
+
+	hold, err := h.holdService.Release(r.Context(), userID, accountID, holdID)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, hold)
+}
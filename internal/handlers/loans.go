@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/Misha-Glazunov/bank-api/internal/models"
+	"github.com/Misha-Glazunov/bank-api/internal/services"
+	"github.com/Misha-Glazunov/bank-api/pkg/money"
+)
+
+// Список кредитных продуктов
+func (h *Handlers) ListLoanProducts(w http.ResponseWriter, r *http.Request) {
+	products, err := h.loanService.ListProducts(r.Context())
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, products)
+}
+
+// Заявка на кредит с зачислением суммы на счет
+func (h *Handlers) ApplyForLoan(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req struct {
+		Product      string      `json:"product"`
+		AccountID    string      `json:"account_id"`
+		Amount       money.Money `json:"amount"`
+		TermMonths   int         `json:"term_months"`
+		ScheduleType string      `json:"schedule_type"`
+	}
+
+	if err := decodeJSON(w, r, &req); err != nil {
+		h.respondDecodeError(w, err)
+		return
+	}
+
+	v := &validator{}
+	v.uuid("account_id", req.AccountID)
+	v.positive("amount", req.Amount)
+	if !h.validate(w, v) {
+		return
+	}
+
+	loan, err := h.loanService.Apply(r.Context(), userID, models.LoanApplication{
+		ProductCode:  req.Product,
+		AccountID:    req.AccountID,
+		Amount:       req.Amount,
+		TermMonths:   req.TermMonths,
+		ScheduleType: req.ScheduleType,
+	})
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, loan)
+}
+
+func (h *Handlers) ListLoans(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	loans, err := h.loanService.List(r.Context(), userID)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, loans)
+}
+
+// Кредит с графиком платежей
+func (h *Handlers) GetLoan(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	loanID, ok := h.pathID(w, r, "id", services.ErrLoanNotFound)
+	if !ok {
+		return
+	}
+
+	loan, err := h.loanService.Get(r.Context(), userID, loanID)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, loan)
+}
+
+// Досрочное погашение с уменьшением срока или ежемесячного платежа
+func (h *Handlers) RepayLoan(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	loanID, ok := h.pathID(w, r, "id", services.ErrLoanNotFound)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Amount money.Money `json:"amount"`
+		Mode   string      `json:"mode"`
+	}
+
+	if err := decodeJSON(w, r, &req); err != nil {
+		h.respondDecodeError(w, err)
+		return
+	}
+
+	v := &validator{}
+	v.positive("amount", req.Amount)
+	if !h.validate(w, v) {
+		return
+	}
+
+	loan, err := h.loanService.Repay(r.Context(), userID, loanID, req.Amount, req.Mode)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, loan)
+}
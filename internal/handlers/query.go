@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/Misha-Glazunov/bank-api/internal/models"
+	"github.com/Misha-Glazunov/bank-api/pkg/money"
+	"github.com/Misha-Glazunov/bank-api/pkg/utils"
+)
+
+var transactionTypes = map[string]bool{
+	models.TransactionTypeTransfer:         true,
+	models.TransactionTypeDeposit:          true,
+	models.TransactionTypeWithdrawal:       true,
+	models.TransactionTypeLoanDisbursement: true,
+	models.TransactionTypeLoanRepayment:    true,
+	models.TransactionTypeInterest:         true,
+	models.TransactionTypeCardPayment:      true,
+	models.TransactionTypeCardRefund:       true,
+	models.TransactionTypeAdjustment:       true,
+}
+
+// Разбирает параметры запроса истории операций:
+// limit, from, to (RFC 3339), type (через запятую), min_amount, max_amount,
+// sort (created_at, -created_at, amount, -amount)
+func parseTransactionFilter(q url.Values) (models.TransactionFilter, error) {
+	filter := models.TransactionFilter{
+		SortBy:   models.TransactionSortCreatedAt,
+		SortDesc: true,
+	}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return filter, fmt.Errorf("invalid limit %q", v)
+		}
+		filter.Limit = limit
+	}
+
+	for _, param := range []string{"from", "to"} {
+		v := q.Get(param)
+		if v == "" {
+			continue
+		}
+		t, err := utils.ParseRFC3339(v)
+		if err != nil {
+			return filter, fmt.Errorf("invalid %s: expected RFC 3339 timestamp", param)
+		}
+		t = t.UTC()
+		if param == "from" {
+			filter.From = &t
+		} else {
+			filter.To = &t
+		}
+	}
+
+	if v := q.Get("type"); v != "" {
+		for _, t := range strings.Split(v, ",") {
+			if !transactionTypes[t] {
+				return filter, fmt.Errorf("unknown transaction type %q", t)
+			}
+			filter.Types = append(filter.Types, t)
+		}
+	}
+
+	for _, param := range []string{"min_amount", "max_amount"} {
+		v := q.Get(param)
+		if v == "" {
+			continue
+		}
+		amount, err := money.Parse(v, "")
+		if err != nil {
+			return filter, fmt.Errorf("invalid %s: %w", param, err)
+		}
+		if param == "min_amount" {
+			filter.MinAmount = &amount
+		} else {
+			filter.MaxAmount = &amount
+		}
+	}
+
+	if v := q.Get("sort"); v != "" {
+		filter.SortDesc = strings.HasPrefix(v, "-")
+		filter.SortBy = strings.TrimPrefix(v, "-")
+		if filter.SortBy != models.TransactionSortCreatedAt && filter.SortBy != models.TransactionSortAmount {
+			return filter, fmt.Errorf("unsupported sort %q", v)
+		}
+	}
+
+	return filter, nil
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Misha-Glazunov/bank-api/internal/models"
+	"github.com/Misha-Glazunov/bank-api/internal/services"
+	"github.com/Misha-Glazunov/bank-api/pkg/money"
+)
+
+// Создание отложенного или регулярного перевода
+func (h *Handlers) CreateScheduledPayment(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req struct {
+		FromAccountID string      `json:"from_account"`
+		ToAccountID   string      `json:"to_account"`
+		Amount        money.Money `json:"amount"`
+		Recurrence    string      `json:"recurrence"`
+		DayOfMonth    int         `json:"day_of_month"`
+		StartAt       *time.Time  `json:"start_at"`
+		EndAt         *time.Time  `json:"end_at"`
+	}
+
+	if err := decodeJSON(w, r, &req); err != nil {
+		h.respondDecodeError(w, err)
+		return
+	}
+
+	v := &validator{}
+	v.uuid("from_account", req.FromAccountID)
+	v.uuid("to_account", req.ToAccountID)
+	v.positive("amount", req.Amount)
+	if !h.validate(w, v) {
+		return
+	}
+
+	if !h.stepUpDebit(w, r, userID, req.FromAccountID, req.Amount) {
+		return
+	}
+
+	payment := &models.ScheduledPayment{
+		FromAccount: req.FromAccountID,
+		ToAccount:   req.ToAccountID,
+		Amount:      req.Amount,
+		Recurrence:  req.Recurrence,
+		DayOfMonth:  req.DayOfMonth,
+		EndAt:       req.EndAt,
+	}
+	if req.StartAt != nil {
+		payment.ScheduledFor = *req.StartAt
+	}
+
+	created, err := h.scheduledPaymentService.Create(r.Context(), userID, payment)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, created)
+}
+
+func (h *Handlers) ListScheduledPayments(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	payments, err := h.scheduledPaymentService.List(r.Context(), userID)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, payments)
+}
+
+func (h *Handlers) GetScheduledPayment(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	paymentID, ok := h.pathID(w, r, "id", services.ErrScheduledPaymentNotFound)
+	if !ok {
+		return
+	}
+
+	payment, err := h.scheduledPaymentService.Get(r.Context(), userID, paymentID)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, payment)
+}
+
+// Изменение суммы и даты окончания, приостановка и возобновление перевода
+func (h *Handlers) UpdateScheduledPayment(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	paymentID, ok := h.pathID(w, r, "id", services.ErrScheduledPaymentNotFound)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Amount *money.Money `json:"amount"`
+		Status *string      `json:"status"`
+		EndAt  *time.Time   `json:"end_at"`
+	}
+
+	if err := decodeJSON(w, r, &req); err != nil {
+		h.respondDecodeError(w, err)
+		return
+	}
+
+	v := &validator{}
+	v.optionalPositive("amount", req.Amount)
+	if !h.validate(w, v) {
+		return
+	}
+
+	if req.Amount != nil {
+		current, err := h.scheduledPaymentService.Get(r.Context(), userID, paymentID)
+		if err != nil {
+			h.handleServiceError(w, err)
+			return
+		}
+		if !h.stepUpDebit(w, r, userID, current.FromAccount, *req.Amount) {
+			return
+		}
+	}
+
+	payment, err := h.scheduledPaymentService.Update(r.Context(), userID, paymentID, models.ScheduledPaymentUpdate{
+		Amount: req.Amount,
+		Status: req.Status,
+		EndAt:  req.EndAt,
+	})
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, payment)
+}
+
+// Отмена перевода; история исполнений сохраняется
+func (h *Handlers) CancelScheduledPayment(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	paymentID, ok := h.pathID(w, r, "id", services.ErrScheduledPaymentNotFound)
+	if !ok {
+		return
+	}
+
+	payment, err := h.scheduledPaymentService.Cancel(r.Context(), userID, paymentID)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, payment)
+}
+
+// Результаты исполнения перевода
+func (h *Handlers) ListScheduledPaymentRuns(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	paymentID, ok := h.pathID(w, r, "id", services.ErrScheduledPaymentNotFound)
+	if !ok {
+		return
+	}
+
+	runs, err := h.scheduledPaymentService.ListRuns(r.Context(), userID, paymentID)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, runs)
+}
@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/beevik/etree"
+
+	"github.com/Misha-Glazunov/bank-api/internal/models"
+	"github.com/Misha-Glazunov/bank-api/internal/services"
+	"github.com/Misha-Glazunov/bank-api/pkg/money"
+	"github.com/Misha-Glazunov/bank-api/pkg/utils"
+)
+
+// Форматы выписки
+const (
+	statementFormatJSON    = "json"
+	statementFormatCSV     = "csv"
+	statementFormatCamt053 = "camt053"
+)
+
+const camt053Namespace = "urn:iso:std:iso:20022:tech:xsd:camt.053.001.02"
+
+// Выписка по счету за месяц (period=YYYY-MM) или произвольный период
+// (from=YYYY-MM-DD&to=YYYY-MM-DD, обе даты включительно)
+func (h *Handlers) GetStatement(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	accountID, ok := h.pathID(w, r, "id", services.ErrAccountNotFound)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	from, to, err := parseStatementPeriod(query)
+	if err != nil {
+		h.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	format := query.Get("format")
+	if format == "" {
+		format = statementFormatJSON
+	}
+	if format != statementFormatJSON && format != statementFormatCSV && format != statementFormatCamt053 {
+		h.respondError(w, http.StatusBadRequest, "format must be json, csv or camt053")
+		return
+	}
+
+	statement, err := h.statementService.Generate(r.Context(), userID, accountID, from, to)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	switch format {
+	case statementFormatCSV:
+		h.respondStatementCSV(w, statement)
+	case statementFormatCamt053:
+		h.respondStatementCamt053(w, statement)
+	default:
+		h.respondJSON(w, statement)
+	}
+}
+
+func parseStatementPeriod(query url.Values) (time.Time, time.Time, error) {
+	if period := query.Get("period"); period != "" {
+		if query.Get("from") != "" || query.Get("to") != "" {
+			return time.Time{}, time.Time{}, errors.New("period cannot be combined with from/to")
+		}
+		month, err := time.Parse("2006-01", period)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.New("period must be in YYYY-MM format")
+		}
+		from := utils.BeginningOfMonth(month)
+		return from, from.AddDate(0, 1, 0), nil
+	}
+
+	if query.Get("from") == "" || query.Get("to") == "" {
+		return time.Time{}, time.Time{}, errors.New("either period or both from and to are required")
+	}
+	from, err := time.Parse("2006-01-02", query.Get("from"))
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.New("from must be in YYYY-MM-DD format")
+	}
+	to, err := time.Parse("2006-01-02", query.Get("to"))
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.New("to must be in YYYY-MM-DD format")
+	}
+	// Дата окончания входит в период
+	return from, to.AddDate(0, 0, 1), nil
+}
+
+// Имя файла выписки; дата окончания включительная
+func statementFilename(statement *models.Statement, ext string) string {
+	return fmt.Sprintf("statement-%s-%s-%s.%s",
+		statement.AccountID,
+		statement.From.Format("20060102"),
+		statement.To.AddDate(0, 0, -1).Format("20060102"),
+		ext,
+	)
+}
+
+// CSV: строка входящего остатка, проводки с остатком после каждой, строка исходящего остатка
+func (h *Handlers) respondStatementCSV(w http.ResponseWriter, statement *models.Statement) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, statementFilename(statement, "csv")))
+
+	writer := csv.NewWriter(w)
+	writer.Write([]string{
+		"booked_at", "entry_id", "transaction_id", "type", "direction",
+		"amount", "currency", "counterparty", "description", "balance",
+	})
+	writer.Write([]string{
+		statement.From.Format(time.RFC3339), "", "", "opening_balance", "",
+		"", statement.Currency, "", "", statement.OpeningBalance.String(),
+	})
+	for _, line := range statement.Lines {
+		writer.Write([]string{
+			line.BookedAt.Format(time.RFC3339),
+			line.EntryID,
+			line.TransactionID,
+			line.Type,
+			line.Direction,
+			line.Amount.String(),
+			line.Amount.Currency,
+			line.Counterparty,
+			line.Description,
+			line.Balance.String(),
+		})
+	}
+	writer.Write([]string{
+		statement.To.Format(time.RFC3339), "", "", "closing_balance", "",
+		"", statement.Currency, "", "", statement.ClosingBalance.String(),
+	})
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		h.logger.Errorf("Failed to write CSV statement: %v", err)
+	}
+}
+
+// Выписка в формате ISO 20022 camt.053.001.02
+func (h *Handlers) respondStatementCamt053(w http.ResponseWriter, statement *models.Statement) {
+	doc := etree.NewDocument()
+	doc.CreateProcInst("xml", `version="1.0" encoding="UTF-8"`)
+
+	root := doc.CreateElement("Document")
+	root.CreateAttr("xmlns", camt053Namespace)
+	report := root.CreateElement("BkToCstmrStmt")
+
+	msgID := fmt.Sprintf("STMT-%s-%s", statement.AccountID, statement.GeneratedAt.Format("20060102150405"))
+	header := report.CreateElement("GrpHdr")
+	header.CreateElement("MsgId").SetText(msgID)
+	header.CreateElement("CreDtTm").SetText(statement.GeneratedAt.Format(time.RFC3339))
+
+	stmt := report.CreateElement("Stmt")
+	stmt.CreateElement("Id").SetText(msgID)
+	stmt.CreateElement("CreDtTm").SetText(statement.GeneratedAt.Format(time.RFC3339))
+	period := stmt.CreateElement("FrToDt")
+	period.CreateElement("FrDtTm").SetText(statement.From.Format(time.RFC3339))
+	period.CreateElement("ToDtTm").SetText(statement.To.Format(time.RFC3339))
+
+	account := stmt.CreateElement("Acct")
+	account.CreateElement("Id").CreateElement("Othr").CreateElement("Id").SetText(statement.AccountID)
+	account.CreateElement("Ccy").SetText(statement.Currency)
+
+	camtBalance(stmt, "OPBD", statement.OpeningBalance, statement.From)
+	camtBalance(stmt, "CLBD", statement.ClosingBalance, statement.To.AddDate(0, 0, -1))
+
+	net := statement.TotalCredits.Sub(statement.TotalDebits)
+	summary := stmt.CreateElement("TxsSummry")
+	total := summary.CreateElement("TtlNtries")
+	total.CreateElement("NbOfNtries").SetText(strconv.Itoa(len(statement.Lines)))
+	total.CreateElement("Sum").SetText(statement.TotalCredits.Add(statement.TotalDebits).String())
+	total.CreateElement("TtlNetNtryAmt").SetText(absMoney(net).String())
+	total.CreateElement("CdtDbtInd").SetText(camtIndicator(net))
+	camtTotals(summary, "TtlCdtNtries", statement.CreditCount, statement.TotalCredits)
+	camtTotals(summary, "TtlDbtNtries", statement.DebitCount, statement.TotalDebits)
+
+	for _, line := range statement.Lines {
+		entry := stmt.CreateElement("Ntry")
+		entry.CreateElement("NtryRef").SetText(line.EntryID)
+		camtAmount(entry, line.Amount)
+		if line.Direction == models.DirectionCredit {
+			entry.CreateElement("CdtDbtInd").SetText("CRDT")
+		} else {
+			entry.CreateElement("CdtDbtInd").SetText("DBIT")
+		}
+		entry.CreateElement("Sts").SetText("BOOK")
+		entry.CreateElement("BookgDt").CreateElement("DtTm").SetText(line.BookedAt.Format(time.RFC3339))
+		entry.CreateElement("ValDt").CreateElement("Dt").SetText(line.BookedAt.Format("2006-01-02"))
+		entry.CreateElement("AcctSvcrRef").SetText(line.EntryID)
+		entry.CreateElement("BkTxCd").CreateElement("Prtry").CreateElement("Cd").SetText(line.Type)
+
+		details := entry.CreateElement("NtryDtls").CreateElement("TxDtls")
+		if line.TransactionID != "" {
+			details.CreateElement("Refs").CreateElement("TxId").SetText(line.TransactionID)
+		}
+		if line.Counterparty != "" {
+			party := "CdtrAcct"
+			if line.Direction == models.DirectionCredit {
+				party = "DbtrAcct"
+			}
+			details.CreateElement("RltdPties").CreateElement(party).
+				CreateElement("Id").CreateElement("Othr").CreateElement("Id").SetText(line.Counterparty)
+		}
+		if line.Description != "" {
+			details.CreateElement("AddtlTxInf").SetText(line.Description)
+		}
+	}
+
+	doc.Indent(2)
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, statementFilename(statement, "xml")))
+	if _, err := doc.WriteTo(w); err != nil {
+		h.logger.Errorf("Failed to write camt.053 statement: %v", err)
+	}
+}
+
+func camtBalance(stmt *etree.Element, code string, balance money.Money, date time.Time) {
+	el := stmt.CreateElement("Bal")
+	el.CreateElement("Tp").CreateElement("CdOrPrtry").CreateElement("Cd").SetText(code)
+	camtAmount(el, balance)
+	el.CreateElement("CdtDbtInd").SetText(camtIndicator(balance))
+	el.CreateElement("Dt").CreateElement("Dt").SetText(date.Format("2006-01-02"))
+}
+
+func camtTotals(summary *etree.Element, tag string, count int, sum money.Money) {
+	el := summary.CreateElement(tag)
+	el.CreateElement("NbOfNtries").SetText(strconv.Itoa(count))
+	el.CreateElement("Sum").SetText(sum.String())
+}
+
+// Суммы в camt.053 неотрицательны, знак передается признаком CRDT/DBIT
+func camtAmount(parent *etree.Element, amount money.Money) {
+	el := parent.CreateElement("Amt")
+	el.CreateAttr("Ccy", amount.Currency)
+	el.SetText(absMoney(amount).String())
+}
+
+func camtIndicator(amount money.Money) string {
+	if amount.IsNegative() {
+		return "DBIT"
+	}
+	return "CRDT"
+}
+
+func absMoney(amount money.Money) money.Money {
+	if amount.IsNegative() {
+		return amount.Neg()
+	}
+	return amount
+}
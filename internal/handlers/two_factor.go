@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/Misha-Glazunov/bank-api/pkg/money"
+)
+
+// Заголовок с кодом TOTP или резервным кодом для подтверждения операции
+const TwoFactorCodeHeader = "X-2FA-Code"
+
+// Второй шаг входа: токен из ответа /login и код из приложения или резервный код
+func (h *Handlers) CompleteLogin(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ChallengeToken string `json:"challenge_token"`
+		Code           string `json:"code"`
+	}
+
+	if err := decodeJSON(w, r, &req); err != nil {
+		h.respondDecodeError(w, err)
+		return
+	}
+
+	v := &validator{}
+	v.required("challenge_token", req.ChallengeToken)
+	v.required("code", req.Code)
+	if !h.validate(w, v) {
+		return
+	}
+
+	tokens, err := h.authService.CompleteLogin(r.Context(), req.ChallengeToken, req.Code)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	h.respondJSON(w, tokens)
+}
+
+func (h *Handlers) GetTwoFactorStatus(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	status, err := h.twoFactorService.Status(r.Context(), userID)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, status)
+}
+
+// Новый секрет TOTP и URI otpauth:// для приложения-аутентификатора
+func (h *Handlers) EnrollTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	enrollment, err := h.twoFactorService.Enroll(r.Context(), userID)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	h.respondJSON(w, enrollment)
+}
+
+// Включение двухфакторной аутентификации по первому коду; в ответе резервные коды
+func (h *Handlers) ConfirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := decodeJSON(w, r, &req); err != nil {
+		h.respondDecodeError(w, err)
+		return
+	}
+
+	v := &validator{}
+	v.required("code", req.Code)
+	if !h.validate(w, v) {
+		return
+	}
+
+	codes, err := h.twoFactorService.Confirm(r.Context(), userID, req.Code)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	h.respondJSON(w, codes)
+}
+
+// Отключение двухфакторной аутентификации, код передается в заголовке X-2FA-Code
+func (h *Handlers) DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	if err := h.twoFactorService.Disable(r.Context(), userID, r.Header.Get(TwoFactorCodeHeader)); err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Новый набор резервных кодов, код передается в заголовке X-2FA-Code
+func (h *Handlers) RegenerateBackupCodes(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromContext(r.Context())
+	if err != nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	codes, err := h.twoFactorService.RegenerateBackupCodes(r.Context(), userID, r.Header.Get(TwoFactorCodeHeader))
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	h.respondJSON(w, codes)
+}
+
+// Подтверждение операции кодом из заголовка X-2FA-Code. Без суммы код нужен
+// всегда, с суммой — начиная с порога. Возвращает false, если ответ уже отправлен.
+func (h *Handlers) stepUp(w http.ResponseWriter, r *http.Request, userID string, amount *money.Money) bool {
+	err := h.twoFactorService.StepUp(r.Context(), userID, r.Header.Get(TwoFactorCodeHeader), amount)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return false
+	}
+	return true
+}
+
+// Подтверждение списания со счета: сумма в запросе указывается без валюты,
+// поэтому с порогом сравнивается в валюте счета списания
+func (h *Handlers) stepUpDebit(w http.ResponseWriter, r *http.Request, userID, accountID string, amount money.Money) bool {
+	account, err := h.accountService.GetAccount(r.Context(), userID, accountID)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return false
+	}
+	amount.Currency = account.Currency
+	return h.stepUp(w, r, userID, &amount)
+}
@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/Misha-Glazunov/bank-api/pkg/money"
+	"github.com/Misha-Glazunov/bank-api/pkg/utils"
+)
+
+// Максимальный размер JSON-тела запроса
+const maxJSONBodyBytes = 64 << 10
+
+// Машиночитаемые коды ошибок полей в ответе 422
+const (
+	codeRequired        = "required"
+	codeUnknownField    = "unknown_field"
+	codeInvalidType     = "invalid_type"
+	codeInvalidEmail    = "invalid_email"
+	codeWeakPassword    = "weak_password"
+	codeInvalidUsername = "invalid_username"
+	codeInvalidUUID     = "invalid_uuid"
+	codeNotPositive     = "not_positive"
+	codeInvalidAmount   = "invalid_amount"
+	codeInvalidPIN      = "invalid_pin"
+	codeInvalidValue    = "invalid_value"
+)
+
+var errTrailingData = errors.New("request body must contain a single JSON value")
+
+var pinPattern = regexp.MustCompile(`^[0-9]{4}$`)
+
+// Ошибка разбора суммы с именем поля, в котором она передана
+type amountError struct {
+	field string
+	raw   string
+	err   error
+}
+
+func (e *amountError) Error() string { return e.err.Error() }
+
+func (e *amountError) Unwrap() error { return e.err }
+
+// Отрицательная сумма - не положительная, прочие ошибки формата - неверная сумма
+func (e *amountError) fieldError() FieldError {
+	switch {
+	case e.raw == "null":
+		return FieldError{Field: e.field, Code: codeRequired, Message: "is required"}
+	case strings.HasPrefix(strings.Trim(e.raw, `"`), "-"):
+		return FieldError{Field: e.field, Code: codeNotPositive, Message: "must be greater than zero"}
+	default:
+		return FieldError{Field: e.field, Code: codeInvalidAmount, Message: "must be a decimal string with at most two fractional digits"}
+	}
+}
+
+// Ошибка одного поля запроса
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Строгий разбор JSON-тела: неизвестные поля, данные после объекта
+// и тела больше maxJSONBodyBytes отклоняются
+func decodeJSON(w http.ResponseWriter, r *http.Request, dst interface{}) error {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxJSONBodyBytes))
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(dst); err != nil {
+		if errors.Is(err, money.ErrInvalidAmount) {
+			return invalidAmountField(body, dst, err)
+		}
+		return err
+	}
+	if err := decoder.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		return errTrailingData
+	}
+	return nil
+}
+
+// Ищет поле верхнего уровня, сумму в котором не удалось разобрать: encoding/json
+// не добавляет имя поля к ошибкам UnmarshalJSON
+func invalidAmountField(body []byte, dst interface{}, err error) error {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(body, &fields) != nil {
+		return err
+	}
+
+	if amountErr := findAmountError(reflect.TypeOf(dst), fields); amountErr != nil {
+		return amountErr
+	}
+	return err
+}
+
+// Встроенные структуры просматриваются вместе с внешней, как их разбирает encoding/json
+func findAmountError(t reflect.Type, fields map[string]json.RawMessage) *amountError {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous {
+			if amountErr := findAmountError(field.Type, fields); amountErr != nil {
+				return amountErr
+			}
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		raw, ok := fields[name]
+		if !ok {
+			continue
+		}
+		if err := json.Unmarshal(raw, reflect.New(field.Type).Interface()); errors.Is(err, money.ErrInvalidAmount) {
+			return &amountError{field: name, raw: string(raw), err: err}
+		}
+	}
+	return nil
+}
+
+// Собирает ошибки всех полей, чтобы клиент получил их одним ответом
+type validator struct {
+	errors []FieldError
+}
+
+func (v *validator) add(field, code, message string) {
+	v.errors = append(v.errors, FieldError{Field: field, Code: code, Message: message})
+}
+
+func (v *validator) required(field, value string) bool {
+	if strings.TrimSpace(value) == "" {
+		v.add(field, codeRequired, "is required")
+		return false
+	}
+	return true
+}
+
+func (v *validator) email(field, value string) {
+	if v.required(field, value) && !utils.IsValidEmail(value) {
+		v.add(field, codeInvalidEmail, "must be a valid email address")
+	}
+}
+
+func (v *validator) password(field, value string) {
+	if v.required(field, value) && !utils.IsStrongPassword(value) {
+		v.add(field, codeWeakPassword, "must be at least 8 characters and contain upper and lower case letters, a digit and a special character")
+	}
+}
+
+func (v *validator) username(field, value string) {
+	if v.required(field, value) && !utils.IsValidUsername(value) {
+		v.add(field, codeInvalidUsername, "must be 3 to 32 letters, digits, dots, hyphens or underscores")
+	}
+}
+
+func (v *validator) uuid(field, value string) {
+	if v.required(field, value) {
+		v.optionalUUID(field, value)
+	}
+}
+
+// Пустое значение допустимо: поле необязательное
+func (v *validator) optionalUUID(field, value string) {
+	if value != "" && !utils.IsValidUUID(value) {
+		v.add(field, codeInvalidUUID, "must be a UUID")
+	}
+}
+
+func (v *validator) pin(field, value string) {
+	if v.required(field, value) && !pinPattern.MatchString(value) {
+		v.add(field, codeInvalidPIN, "must be 4 digits")
+	}
+}
+
+func (v *validator) oneOf(field, value string, allowed ...string) {
+	if !v.required(field, value) {
+		return
+	}
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	v.add(field, codeInvalidValue, "must be one of: "+strings.Join(allowed, ", "))
+}
+
+func (v *validator) positive(field string, amount money.Money) {
+	if !amount.IsPositive() {
+		v.add(field, codeNotPositive, "must be greater than zero")
+	}
+}
+
+// Отсутствующая сумма допустима: поле необязательное
+func (v *validator) optionalPositive(field string, amount *money.Money) {
+	if amount != nil {
+		v.positive(field, *amount)
+	}
+}
+
+// Идентификатор ресурса из пути. Значение не в формате UUID отклоняется до обращения
+// к БД той же ошибкой, что и отсутствующая запись; false, если ответ уже отправлен.
+func (h *Handlers) pathID(w http.ResponseWriter, r *http.Request, name string, notFound error) (string, bool) {
+	id := mux.Vars(r)[name]
+	v := &validator{}
+	v.uuid(name, id)
+	if len(v.errors) > 0 {
+		h.handleServiceError(w, notFound)
+		return "", false
+	}
+	return id, true
+}
+
+// Отвечает 422 со списком ошибок полей; false, если запрос не прошел проверку
+func (h *Handlers) validate(w http.ResponseWriter, v *validator) bool {
+	if len(v.errors) == 0 {
+		return true
+	}
+	h.respondValidationError(w, v.errors)
+	return false
+}
+
+func (h *Handlers) respondValidationError(w http.ResponseWriter, fields []FieldError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(struct {
+		Error  string       `json:"error"`
+		Fields []FieldError `json:"fields"`
+	}{
+		Error:  "Validation failed",
+		Fields: fields,
+	})
+}
+
+// Ответ на ошибку разбора тела запроса. Неизвестные поля, значения неверного
+// типа и неверные суммы возвращаются как ошибки полей.
+func (h *Handlers) respondDecodeError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	var typeErr *json.UnmarshalTypeError
+	var amountErr *amountError
+	switch {
+	case errors.As(err, &tooLarge):
+		h.respondError(w, http.StatusRequestEntityTooLarge, "Request body too large")
+	case errors.As(err, &amountErr):
+		h.respondValidationError(w, []FieldError{amountErr.fieldError()})
+	case errors.Is(err, money.ErrInvalidAmount):
+		h.respondError(w, http.StatusBadRequest, err.Error())
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		h.respondValidationError(w, []FieldError{{
+			Field:   typeErr.Field,
+			Code:    codeInvalidType,
+			Message: fmt.Sprintf("must be of type %s", typeErr.Type),
+		}})
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json не экспортирует тип этой ошибки, имя поля берется из текста
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		h.respondValidationError(w, []FieldError{{
+			Field:   field,
+			Code:    codeUnknownField,
+			Message: "is not allowed",
+		}})
+	default:
+		h.respondError(w, http.StatusBadRequest, "Invalid request format")
+	}
+}
@@ -1,80 +1,97 @@
 package integration_tests
 
 import (
-    "bytes"
-    "encoding/json"
     "net/http"
     "testing"
     "github.com/stretchr/testify/assert"
 )
 
-func TestMoneyTransfer(t *testing.T) {
-    baseURL := "http://localhost:8080"
-    
-    // 1. Регистрация и логин
+func TestCreateAccount(t *testing.T) {
     user := map[string]string{
-        "email":    "transfer_test@example.com",
-        "username": "transfer_user",
-        "password": "transfer_pass123",
+        "email":    "account_test@example.com",
+        "username": "account_user",
+        "password": "Acc0unt!Pass",
     }
     token := registerAndLogin(t, user)
 
-    // 2. Создание счетов
-    fromAccount := createAccount(t, token)
-    toAccount := createAccount(t, token)
+    first := createAccount(t, token)
+    second := createAccount(t, token)
 
-    // 3. Тест перевода
-    transferData := map[string]interface{}{
-        "from_account": fromAccount,
-        "to_account":   toAccount,
-        "amount":       100.50,
-    }
-    payload, _ := json.Marshal(transferData)
-    
-    req, _ := http.NewRequest("POST", baseURL+"/transfer", bytes.NewBuffer(payload))
-    req.Header.Set("Authorization", "Bearer "+token)
-    req.Header.Set("Content-Type", "application/json")
-    
-    client := &http.Client{}
-    resp, err := client.Do(req)
-    assert.NoError(t, err)
-    assert.Equal(t, http.StatusOK, resp.StatusCode)
+    assert.NotEmpty(t, first)
+    assert.NotEmpty(t, second)
+    assert.NotEqual(t, first, second)
 }
 
-func createAccount(t *testing.T, token string) string {
-    req, _ := http.NewRequest("POST", "http://localhost:8080/accounts", nil)
-    req.Header.Set("Authorization", "Bearer "+token)
-    
-    client := &http.Client{}
-    resp, err := client.Do(req)
-    assert.NoError(t, err)
-    
-    var account struct {
-        ID string `json:"id"`
-    }
-    json.NewDecoder(resp.Body).Decode(&account)
-    return account.ID
+type accountResponse struct {
+    ID          string `json:"id"`
+    Balance     string `json:"balance"`
+    Currency    string `json:"currency"`
+    ProductType string `json:"product_type"`
+    Status      string `json:"status"`
 }
 
-func registerAndLogin(t *testing.T, user map[string]string) string {
-    // Регистрация
-    payload, _ := json.Marshal(user)
-    resp, err := http.Post("http://localhost:8080/register", "application/json", bytes.NewBuffer(payload))
-    assert.NoError(t, err)
-    
-    // Логин
-    loginData := map[string]string{
-        "email":    user["email"],
-        "password": user["password"],
-    }
-    payload, _ = json.Marshal(loginData)
-    
-    resp, err = http.Post("http://localhost:8080/login", "application/json", bytes.NewBuffer(payload))
-    assert.NoError(t, err)
-    
-    var result struct {
-        Token string `json:"token"`
-    }
-    json.NewDecoder(resp.Body).Decode(&result)
-    return result.Token
+func TestCreateAccountWithCurrencyAndProduct(t *testing.T) {
+    token := authenticateUser(t)
+
+    var account accountResponse
+    status := doJSON(t, "POST", token, "/accounts", map[string]string{
+        "currency":     "USD",
+        "product_type": "savings",
+    }, &account)
+    assert.Equal(t, http.StatusOK, status)
+    assert.Equal(t, "USD", account.Currency)
+    assert.Equal(t, "savings", account.ProductType)
+    assert.Equal(t, "active", account.Status)
+
+    status = doJSON(t, "POST", token, "/accounts", map[string]string{"currency": "XXX"}, nil)
+    assert.Equal(t, http.StatusBadRequest, status)
+}
+
+func TestAccountLifecycle(t *testing.T) {
+    token := authenticateUser(t)
+    accountID := createAccount(t, token)
+    setAccountLimit(t, accountID, "overdraft", "0")
+
+    var accounts []accountResponse
+    assert.Equal(t, http.StatusOK, doJSON(t, "GET", token, "/accounts", nil, &accounts))
+    assert.Len(t, accounts, 1)
+
+    var account accountResponse
+    status := doJSON(t, "POST", token, "/accounts/"+accountID+"/deposit", map[string]string{"amount": "100.00"}, &account)
+    assert.Equal(t, http.StatusOK, status)
+    assert.Equal(t, "100.00", account.Balance)
+
+    status = doJSON(t, "POST", token, "/accounts/"+accountID+"/withdraw", map[string]string{"amount": "30.00"}, &account)
+    assert.Equal(t, http.StatusOK, status)
+    assert.Equal(t, "70.00", account.Balance)
+
+    status = doJSON(t, "POST", token, "/accounts/"+accountID+"/withdraw", map[string]string{"amount": "70.01"}, nil)
+    assert.Equal(t, http.StatusBadRequest, status)
+
+    // Счет с ненулевым балансом закрыть нельзя
+    status = doJSON(t, "POST", token, "/accounts/"+accountID+"/close", nil, nil)
+    assert.Equal(t, http.StatusConflict, status)
+
+    status = doJSON(t, "POST", token, "/accounts/"+accountID+"/withdraw", map[string]string{"amount": "70.00"}, nil)
+    assert.Equal(t, http.StatusOK, status)
+
+    status = doJSON(t, "POST", token, "/accounts/"+accountID+"/close", nil, &account)
+    assert.Equal(t, http.StatusOK, status)
+    assert.Equal(t, "closed", account.Status)
+
+    status = doJSON(t, "POST", token, "/accounts/"+accountID+"/deposit", map[string]string{"amount": "1.00"}, nil)
+    assert.Equal(t, http.StatusConflict, status)
+
+    assert.Equal(t, http.StatusOK, doJSON(t, "GET", token, "/accounts/"+accountID, nil, &account))
+    assert.Equal(t, "0.00", account.Balance)
+}
+
+func TestGetForeignAccountForbidden(t *testing.T) {
+    owner := authenticateUser(t)
+    stranger := authenticateUser(t)
+    accountID := createAccount(t, owner)
+
+    assert.Equal(t, http.StatusForbidden, doJSON(t, "GET", stranger, "/accounts/"+accountID, nil, nil))
+    assert.Equal(t, http.StatusForbidden,
+        doJSON(t, "POST", stranger, "/accounts/"+accountID+"/withdraw", map[string]string{"amount": "1.00"}, nil))
 }
@@ -0,0 +1,410 @@
+package integration_tests
+
+import (
+    "fmt"
+    "net/http"
+    "testing"
+    "time"
+    "github.com/stretchr/testify/assert"
+)
+
+type auditRecordResponse struct {
+    ActorID    string            `json:"actor_id"`
+    Action     string            `json:"action"`
+    TargetType string            `json:"target_type"`
+    TargetID   string            `json:"target_id"`
+    Reason     string            `json:"reason"`
+    Details    map[string]string `json:"details"`
+}
+
+type adminAccountResponse struct {
+    ID       string `json:"id"`
+    UserID   string `json:"user_id"`
+    Balance  string `json:"balance"`
+    FrozenAt string `json:"frozen_at"`
+}
+
+// Регистрирует сотрудника с ролью role. Роль назначается в БД,
+// поэтому токен берется из повторного входа.
+func authenticateStaff(t *testing.T, role string) string {
+    suffix := time.Now().UnixNano()
+    user := map[string]string{
+        "email":    fmt.Sprintf("staff_%d@example.com", suffix),
+        "username": fmt.Sprintf("staff%d", suffix),
+        "password": "Str0ng!Password",
+    }
+    registerAndLogin(t, user)
+    _, err := testDB.Exec("UPDATE users SET role = $1 WHERE email = $2", role, user["email"])
+    assert.NoError(t, err)
+    return login(t, user["email"], user["password"])
+}
+
+func login(t *testing.T, email, password string) string {
+    var tokens struct {
+        Token string `json:"token"`
+    }
+    status := doJSON(t, "POST", "", "/login", map[string]string{"email": email, "password": password}, &tokens)
+    assert.Equal(t, http.StatusOK, status)
+    return tokens.Token
+}
+
+// Записи журнала аудита по объекту, от новых к старым
+func auditFor(t *testing.T, token, targetID string) []auditRecordResponse {
+    var records []auditRecordResponse
+    status := doJSON(t, "GET", token, "/admin/audit?target_id="+targetID, nil, &records)
+    assert.Equal(t, http.StatusOK, status)
+    return records
+}
+
+func TestAdminRequiresRole(t *testing.T) {
+    customer := authenticateUser(t)
+    operator := authenticateStaff(t, "operator")
+    accountID := createAccount(t, customer)
+
+    status := doJSON(t, "GET", "", "/admin/users?q=user", nil, nil)
+    assert.Equal(t, http.StatusUnauthorized, status)
+    status = doJSON(t, "GET", customer, "/admin/users?q=user", nil, nil)
+    assert.Equal(t, http.StatusForbidden, status)
+    status = doJSON(t, "GET", customer, "/admin/accounts/"+accountID, nil, nil)
+    assert.Equal(t, http.StatusForbidden, status)
+
+    // Операционисту недоступны корректировки баланса и смена ролей
+    status = doJSON(t, "GET", operator, "/admin/accounts/"+accountID, nil, nil)
+    assert.Equal(t, http.StatusOK, status)
+    status = doJSON(t, "POST", operator, "/admin/accounts/"+accountID+"/adjustments", map[string]string{
+        "direction": "credit",
+        "amount":    "100.00",
+        "reason":    "Goodwill",
+    }, nil)
+    assert.Equal(t, http.StatusForbidden, status)
+    status = doJSON(t, "PUT", operator, "/admin/users/"+userIDFromToken(t, customer)+"/role", map[string]string{
+        "role":   "admin",
+        "reason": "Promotion",
+    }, nil)
+    assert.Equal(t, http.StatusForbidden, status)
+}
+
+func TestAdminSearchAndViewAudited(t *testing.T) {
+    suffix := time.Now().UnixNano()
+    user := map[string]string{
+        "email":    fmt.Sprintf("client_%d@example.com", suffix),
+        "username": fmt.Sprintf("client%d", suffix),
+        "password": "Str0ng!Password",
+    }
+    customer := registerAndLogin(t, user)
+    userID := userIDFromToken(t, customer)
+    accountID := createAccount(t, customer)
+    operator := authenticateStaff(t, "operator")
+
+    var users []struct {
+        ID    string `json:"id"`
+        Email string `json:"email"`
+        Role  string `json:"role"`
+    }
+    status := doJSON(t, "GET", operator, fmt.Sprintf("/admin/users?q=client_%d", suffix), nil, &users)
+    assert.Equal(t, http.StatusOK, status)
+    if assert.Len(t, users, 1) {
+        assert.Equal(t, userID, users[0].ID)
+        assert.Equal(t, "customer", users[0].Role)
+    }
+    status = doJSON(t, "GET", operator, "/admin/users", nil, nil)
+    assert.Equal(t, http.StatusBadRequest, status)
+
+    var overview struct {
+        User     struct{ ID string } `json:"user"`
+        Accounts []adminAccountResponse `json:"accounts"`
+    }
+    status = doJSON(t, "GET", operator, "/admin/users/"+userID, nil, &overview)
+    assert.Equal(t, http.StatusOK, status)
+    assert.Equal(t, userID, overview.User.ID)
+    if assert.Len(t, overview.Accounts, 1) {
+        assert.Equal(t, accountID, overview.Accounts[0].ID)
+    }
+
+    var account adminAccountResponse
+    status = doJSON(t, "GET", operator, "/admin/accounts/"+accountID, nil, &account)
+    assert.Equal(t, http.StatusOK, status)
+    assert.Equal(t, userID, account.UserID)
+
+    // Просмотр данных клиента тоже попадает в журнал
+    records := auditFor(t, operator, userID)
+    if assert.Len(t, records, 1) {
+        assert.Equal(t, "user.view", records[0].Action)
+        assert.Equal(t, userIDFromToken(t, operator), records[0].ActorID)
+    }
+    records = auditFor(t, operator, accountID)
+    if assert.Len(t, records, 1) {
+        assert.Equal(t, "account.view", records[0].Action)
+    }
+
+    // Просмотр самого журнала тоже записывается вместе с фильтром
+    var views []auditRecordResponse
+    operatorID := userIDFromToken(t, operator)
+    status = doJSON(t, "GET", operator, "/admin/audit?target_type=audit_log&actor_id="+operatorID, nil, &views)
+    assert.Equal(t, http.StatusOK, status)
+    if assert.Len(t, views, 2) {
+        assert.Equal(t, "audit.view", views[0].Action)
+        assert.Equal(t, "records", views[0].TargetID)
+        assert.Equal(t, accountID, views[0].Details["target_id"])
+        assert.Equal(t, userID, views[1].Details["target_id"])
+    }
+}
+
+func TestAdminFreezeAccount(t *testing.T) {
+    customer := authenticateUser(t)
+    accountID := createAccount(t, customer)
+    otherID := createAccount(t, customer)
+    setBalance(t, accountID, "500.00")
+    setBalance(t, otherID, "500.00")
+    operator := authenticateStaff(t, "operator")
+
+    var invalid validationErrorResponse
+    status := doJSON(t, "POST", operator, "/admin/accounts/"+accountID+"/freeze", map[string]string{}, &invalid)
+    assert.Equal(t, http.StatusUnprocessableEntity, status)
+    assert.Equal(t, map[string]string{"reason": "required"}, invalid.codes())
+
+    var account adminAccountResponse
+    status = doJSON(t, "POST", operator, "/admin/accounts/"+accountID+"/freeze", map[string]string{"reason": "Suspicious activity"}, &account)
+    assert.Equal(t, http.StatusOK, status)
+    assert.NotEmpty(t, account.FrozenAt)
+    status = doJSON(t, "POST", operator, "/admin/accounts/"+accountID+"/freeze", map[string]string{"reason": "Again"}, nil)
+    assert.Equal(t, http.StatusConflict, status)
+
+    // Списания запрещены, зачисления проходят
+    assert.Equal(t, http.StatusConflict, transfer(t, customer, accountID, otherID, "10.00"))
+    status = doJSON(t, "POST", customer, "/accounts/"+accountID+"/withdraw", map[string]string{"amount": "10.00"}, nil)
+    assert.Equal(t, http.StatusConflict, status)
+    assert.Equal(t, http.StatusOK, transfer(t, customer, otherID, accountID, "10.00"))
+    assert.Equal(t, "510.00", getBalance(t, accountID))
+
+    status = doJSON(t, "POST", operator, "/admin/accounts/"+accountID+"/unfreeze", map[string]string{"reason": "Verified by phone"}, &account)
+    assert.Equal(t, http.StatusOK, status)
+    assert.Empty(t, account.FrozenAt)
+    assert.Equal(t, http.StatusOK, transfer(t, customer, accountID, otherID, "10.00"))
+
+    records := auditFor(t, operator, accountID)
+    if assert.Len(t, records, 2) {
+        assert.Equal(t, "account.unfreeze", records[0].Action)
+        assert.Equal(t, "Verified by phone", records[0].Reason)
+        assert.Equal(t, "account.freeze", records[1].Action)
+        assert.Equal(t, "Suspicious activity", records[1].Reason)
+    }
+}
+
+func TestAdminFreezeCard(t *testing.T) {
+    customer := authenticateUser(t)
+    card := fundedCard(t, customer, "500.00")
+    operator := authenticateStaff(t, "operator")
+
+    status := doJSON(t, "POST", operator, "/admin/cards/"+card.CardID+"/freeze", map[string]string{"reason": "Fraud report"}, nil)
+    assert.Equal(t, http.StatusOK, status)
+
+    var declined authorizationResponse
+    status = authorizeCard(t, card, "10.00", &declined)
+    assert.Equal(t, http.StatusPaymentRequired, status)
+    assert.Equal(t, "card_blocked", declined.Reason)
+
+    // Владелец не может обойти заморозку разблокировкой или перевыпуском
+    status = doJSON(t, "POST", customer, "/cards/"+card.CardID+"/unblock", nil, nil)
+    assert.Equal(t, http.StatusConflict, status)
+    status = doJSON(t, "POST", customer, "/cards/"+card.CardID+"/reissue", nil, nil)
+    assert.Equal(t, http.StatusConflict, status)
+
+    status = doJSON(t, "POST", operator, "/admin/cards/"+card.CardID+"/unfreeze", map[string]string{"reason": "Customer confirmed"}, nil)
+    assert.Equal(t, http.StatusOK, status)
+    var auth authorizationResponse
+    status = authorizeCard(t, card, "10.00", &auth)
+    assert.Equal(t, http.StatusOK, status)
+    assert.Equal(t, "authorized", auth.Status)
+
+    records := auditFor(t, operator, card.CardID)
+    assert.Len(t, records, 2)
+}
+
+func TestAdminAdjustBalance(t *testing.T) {
+    customer := authenticateUser(t)
+    accountID := createAccount(t, customer)
+    admin := authenticateStaff(t, "admin")
+    path := "/admin/accounts/" + accountID + "/adjustments"
+
+    var invalid validationErrorResponse
+    status := doJSON(t, "POST", admin, path, map[string]string{"direction": "sideways", "amount": "100.00"}, &invalid)
+    assert.Equal(t, http.StatusUnprocessableEntity, status)
+    assert.Equal(t, map[string]string{"direction": "invalid_value", "reason": "required"}, invalid.codes())
+
+    var account adminAccountResponse
+    status = doJSON(t, "POST", admin, path, map[string]string{
+        "direction": "credit",
+        "amount":    "100.00",
+        "reason":    "Compensation for failed transfer",
+    }, &account)
+    assert.Equal(t, http.StatusOK, status)
+    assert.Equal(t, "100.00", account.Balance)
+
+    status = doJSON(t, "POST", admin, path, map[string]string{
+        "direction": "debit",
+        "amount":    "30.00",
+        "reason":    "Duplicate compensation",
+    }, &account)
+    assert.Equal(t, http.StatusOK, status)
+    assert.Equal(t, "70.00", account.Balance)
+    assert.Equal(t, "70.00", getLedgerBalance(t, accountID))
+
+    var history struct {
+        Transactions []struct {
+            Type string `json:"type"`
+        } `json:"transactions"`
+    }
+    status = doJSON(t, "GET", customer, "/accounts/"+accountID+"/transactions?type=adjustment", nil, &history)
+    assert.Equal(t, http.StatusOK, status)
+    if assert.Len(t, history.Transactions, 2) {
+        assert.Equal(t, "adjustment", history.Transactions[0].Type)
+    }
+
+    records := auditFor(t, admin, accountID)
+    if assert.Len(t, records, 2) {
+        assert.Equal(t, "account.adjust", records[0].Action)
+        assert.Equal(t, "Duplicate compensation", records[0].Reason)
+        assert.Equal(t, "debit", records[0].Details["direction"])
+        assert.Equal(t, "30.00", records[0].Details["amount"])
+        assert.NotEmpty(t, records[0].Details["entry_id"])
+    }
+}
+
+func TestAdminSetAccountLimits(t *testing.T) {
+    customer := authenticateUser(t)
+    fromAccount := createAccount(t, customer)
+    toAccount := createAccount(t, customer)
+    setBalance(t, fromAccount, "1000.00")
+    admin := authenticateStaff(t, "admin")
+    path := "/admin/accounts/" + fromAccount + "/limits"
+
+    status := doJSON(t, "PUT", authenticateStaff(t, "operator"), path, map[string]string{"max_transfer": "100.00", "reason": "Test"}, nil)
+    assert.Equal(t, http.StatusForbidden, status)
+    var invalid validationErrorResponse
+    status = doJSON(t, "PUT", admin, path, map[string]string{"max_transfer": "100.00"}, &invalid)
+    assert.Equal(t, http.StatusUnprocessableEntity, status)
+    assert.Equal(t, map[string]string{"reason": "required"}, invalid.codes())
+
+    var limits struct {
+        MaxTransfer string `json:"max_transfer"`
+        Overdraft   string `json:"overdraft"`
+    }
+    status = doJSON(t, "PUT", admin, path, map[string]string{
+        "max_transfer": "100.00",
+        "overdraft":    "0",
+        "reason":       "Customer request",
+    }, &limits)
+    assert.Equal(t, http.StatusOK, status)
+    assert.Equal(t, "100.00", limits.MaxTransfer)
+    assert.Equal(t, "0.00", limits.Overdraft)
+
+    var body limitErrorResponse
+    status = doJSON(t, "POST", customer, "/transfer", transferBody(fromAccount, toAccount, "100.01"), &body)
+    assert.Equal(t, http.StatusUnprocessableEntity, status)
+    assert.Equal(t, "max_transfer", body.Limit)
+    assert.Equal(t, http.StatusOK, transfer(t, customer, fromAccount, toAccount, "100.00"))
+
+    records := auditFor(t, admin, fromAccount)
+    if assert.Len(t, records, 1) {
+        assert.Equal(t, "account.set_limits", records[0].Action)
+        assert.Equal(t, "Customer request", records[0].Reason)
+        assert.Equal(t, "100.00", records[0].Details["max_transfer"])
+        assert.Equal(t, "default", records[0].Details["daily_outgoing"])
+    }
+
+    // Незаданные лимиты возвращаются к значениям по умолчанию
+    status = doJSON(t, "PUT", admin, path, map[string]string{"reason": "Reset"}, nil)
+    assert.Equal(t, http.StatusOK, status)
+    status = doJSON(t, "GET", customer, "/accounts/"+fromAccount+"/limits", nil, &limits)
+    assert.Equal(t, http.StatusOK, status)
+    assert.Equal(t, "1000000.00", limits.MaxTransfer)
+    assert.Equal(t, "50000.00", limits.Overdraft)
+}
+
+func TestAdminLedgerReversal(t *testing.T) {
+    customer := authenticateUser(t)
+    accountID := createAccount(t, customer)
+    admin := authenticateStaff(t, "admin")
+    operator := authenticateStaff(t, "operator")
+
+    status := doJSON(t, "POST", admin, "/admin/accounts/"+accountID+"/adjustments", map[string]string{
+        "direction": "credit",
+        "amount":    "100.00",
+        "reason":    "Posted to the wrong account",
+    }, nil)
+    assert.Equal(t, http.StatusOK, status)
+    records := auditFor(t, admin, accountID)
+    if !assert.Len(t, records, 1) {
+        return
+    }
+    entryID := records[0].Details["entry_id"]
+    path := "/admin/ledger/entries/" + entryID + "/reversal"
+
+    status = doJSON(t, "POST", operator, path, map[string]string{"reason": "Test"}, nil)
+    assert.Equal(t, http.StatusForbidden, status)
+
+    var reversal struct {
+        ID         string `json:"id"`
+        Type       string `json:"type"`
+        ReversalOf string `json:"reversal_of"`
+    }
+    status = doJSON(t, "POST", admin, path, map[string]string{"reason": "Wrong account"}, &reversal)
+    assert.Equal(t, http.StatusOK, status)
+    assert.Equal(t, "reversal", reversal.Type)
+    assert.Equal(t, entryID, reversal.ReversalOf)
+    assert.Equal(t, "0.00", getBalance(t, accountID))
+    assert.Equal(t, "0.00", getLedgerBalance(t, accountID))
+
+    // Повторное сторно и сторно сторно запрещены
+    status = doJSON(t, "POST", admin, path, map[string]string{"reason": "Again"}, nil)
+    assert.Equal(t, http.StatusConflict, status)
+    status = doJSON(t, "POST", admin, "/admin/ledger/entries/"+reversal.ID+"/reversal", map[string]string{"reason": "Undo"}, nil)
+    assert.Equal(t, http.StatusConflict, status)
+
+    records = auditFor(t, admin, entryID)
+    if assert.Len(t, records, 1) {
+        assert.Equal(t, "ledger.reverse", records[0].Action)
+        assert.Equal(t, reversal.ID, records[0].Details["reversal_id"])
+    }
+
+    var mismatches []interface{}
+    status = doJSON(t, "GET", admin, "/admin/ledger/reconciliation", nil, &mismatches)
+    assert.Equal(t, http.StatusOK, status)
+    assert.Empty(t, mismatches)
+}
+
+func TestAdminChangeRole(t *testing.T) {
+    suffix := time.Now().UnixNano()
+    user := map[string]string{
+        "email":    fmt.Sprintf("promoted_%d@example.com", suffix),
+        "username": fmt.Sprintf("promoted%d", suffix),
+        "password": "Str0ng!Password",
+    }
+    customer := registerAndLogin(t, user)
+    admin := authenticateStaff(t, "admin")
+    userID := userIDFromToken(t, customer)
+
+    var invalid validationErrorResponse
+    status := doJSON(t, "PUT", admin, "/admin/users/"+userID+"/role", map[string]string{"role": "superuser"}, &invalid)
+    assert.Equal(t, http.StatusUnprocessableEntity, status)
+    assert.Equal(t, map[string]string{"role": "invalid_value", "reason": "required"}, invalid.codes())
+    status = doJSON(t, "PUT", admin, "/admin/users/"+userIDFromToken(t, admin)+"/role", map[string]string{"role": "customer", "reason": "Test"}, nil)
+    assert.Equal(t, http.StatusForbidden, status)
+
+    status = doJSON(t, "PUT", admin, "/admin/users/"+userID+"/role", map[string]string{"role": "operator", "reason": "Joined support team"}, nil)
+    assert.Equal(t, http.StatusOK, status)
+
+    // Сессии с прежней ролью завершаются, новая роль приходит с новым входом
+    status = doJSON(t, "GET", customer, "/accounts", nil, nil)
+    assert.Equal(t, http.StatusUnauthorized, status)
+    operator := login(t, user["email"], user["password"])
+    status = doJSON(t, "GET", operator, "/admin/users?q=promoted", nil, nil)
+    assert.Equal(t, http.StatusOK, status)
+
+    records := auditFor(t, admin, userID)
+    if assert.Len(t, records, 1) {
+        assert.Equal(t, "user.change_role", records[0].Action)
+        assert.Equal(t, map[string]string{"from": "customer", "to": "operator"}, records[0].Details)
+    }
+}
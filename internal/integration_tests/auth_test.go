@@ -20,7 +20,7 @@ func TestUserRegistrationAndLogin(t *testing.T) {
     user := UserCredentials{
         Email:    "testuser@example.com",
         Username: "testuser",
-        Password: "securepassword123",
+        Password: "S3cure!Password",
     }
 
     payload, _ := json.Marshal(user)
@@ -0,0 +1,146 @@
+package integration_tests
+
+import (
+    "net/http"
+    "testing"
+    "github.com/stretchr/testify/assert"
+)
+
+func TestTransferFromForeignAccountForbidden(t *testing.T) {
+    owner := authenticateUser(t)
+    attacker := authenticateUser(t)
+
+    victimAccount := createAccount(t, owner)
+    attackerAccount := createAccount(t, attacker)
+    setBalance(t, victimAccount, "500.00")
+
+    status := transfer(t, attacker, victimAccount, attackerAccount, "100.00")
+    assert.Equal(t, http.StatusForbidden, status)
+    assert.Equal(t, "500.00", getBalance(t, victimAccount))
+    assert.Equal(t, "0.00", getBalance(t, attackerAccount))
+}
+
+func TestTransferToMissingDestination(t *testing.T) {
+    token := authenticateUser(t)
+
+    account := createAccount(t, token)
+    setBalance(t, account, "100.00")
+
+    var body struct {
+        Error string `json:"error"`
+    }
+    status := doJSON(t, "POST", token, "/transfer", map[string]interface{}{
+        "from_account": account,
+        "to_account":   "00000000-0000-0000-0000-000000000000",
+        "amount":       "10.00",
+    }, &body)
+    assert.Equal(t, http.StatusNotFound, status)
+    assert.Equal(t, "destination account not found", body.Error)
+    assert.Equal(t, "100.00", getBalance(t, account))
+}
+
+// Идентификатор не в формате UUID дает тот же ответ, что и отсутствующая запись
+func TestMalformedPathIDNotFound(t *testing.T) {
+    token := authenticateUser(t)
+    accountID := createAccount(t, token)
+
+    cases := map[string]string{
+        "/accounts/not-a-uuid":              "account not found",
+        "/accounts/not-a-uuid/transactions": "account not found",
+        "/cards/1":                          "card not found",
+        "/loans/42":                         "loan not found",
+        "/deposits/abc":                     "deposit not found",
+        "/scheduled-payments/abc":           "scheduled payment not found",
+    }
+    for path, message := range cases {
+        var body struct {
+            Error string `json:"error"`
+        }
+        status := doJSON(t, "GET", token, path, nil, &body)
+        assert.Equal(t, http.StatusNotFound, status, path)
+        assert.Equal(t, message, body.Error, path)
+    }
+
+    status := doJSON(t, "DELETE", token, "/accounts/"+accountID+"/holds/abc", nil, nil)
+    assert.Equal(t, http.StatusNotFound, status)
+}
+
+// Внутренние счета банка не принимают переводы клиентов
+func TestTransferToSystemAccountRejected(t *testing.T) {
+    token := authenticateUser(t)
+
+    account := createAccount(t, token)
+    setBalance(t, account, "100.00")
+
+    var systemAccount string
+    err := testDB.QueryRow("SELECT id FROM accounts WHERE system_code = 'opening_balance' AND currency = 'RUB'").Scan(&systemAccount)
+    if !assert.NoError(t, err) {
+        return
+    }
+
+    status := transfer(t, token, account, systemAccount, "10.00")
+    assert.Equal(t, http.StatusNotFound, status)
+    status = doJSON(t, "POST", token, "/scheduled-payments", map[string]interface{}{
+        "from_account": account,
+        "to_account":   systemAccount,
+        "amount":       "10.00",
+        "recurrence":   "daily",
+    }, nil)
+    assert.Equal(t, http.StatusNotFound, status)
+    assert.Equal(t, "100.00", getBalance(t, account))
+}
+
+func TestDelegatedUserCanTransfer(t *testing.T) {
+    owner := authenticateUser(t)
+    delegate := authenticateUser(t)
+
+    ownerAccount := createAccount(t, owner)
+    delegateAccount := createAccount(t, delegate)
+    setBalance(t, ownerAccount, "100.00")
+
+    _, err := testDB.Exec(
+        "INSERT INTO account_delegates (account_id, user_id) VALUES ($1, $2)",
+        ownerAccount, userIDFromToken(t, delegate),
+    )
+    assert.NoError(t, err)
+
+    assert.Equal(t, http.StatusOK, transfer(t, delegate, ownerAccount, delegateAccount, "40.00"))
+    assert.Equal(t, "60.00", getBalance(t, ownerAccount))
+}
+
+// Доверенный пользователь видит счет и переводит с него, но не может
+// снять наличные, закрыть счет, выпустить к нему карту или поставить удержание
+func TestDelegatedUserCannotManageAccount(t *testing.T) {
+    owner := authenticateUser(t)
+    delegate := authenticateUser(t)
+
+    ownerAccount := createAccount(t, owner)
+    emptyAccount := createAccount(t, owner)
+    setBalance(t, ownerAccount, "100.00")
+
+    for _, account := range []string{ownerAccount, emptyAccount} {
+        _, err := testDB.Exec(
+            "INSERT INTO account_delegates (account_id, user_id) VALUES ($1, $2)",
+            account, userIDFromToken(t, delegate),
+        )
+        assert.NoError(t, err)
+    }
+
+    assert.Equal(t, http.StatusOK, doJSON(t, "GET", delegate, "/accounts/"+ownerAccount, nil, nil))
+
+    status := doJSON(t, "POST", delegate, "/accounts/"+emptyAccount+"/close", nil, nil)
+    assert.Equal(t, http.StatusForbidden, status)
+    status = doJSON(t, "POST", delegate, "/accounts/"+ownerAccount+"/withdraw", map[string]string{"amount": "10.00"}, nil)
+    assert.Equal(t, http.StatusForbidden, status)
+    status = doJSON(t, "POST", delegate, "/cards", map[string]string{"account_id": ownerAccount, "payment_system": "visa"}, nil)
+    assert.Equal(t, http.StatusForbidden, status)
+    status = doJSON(t, "POST", delegate, "/accounts/"+ownerAccount+"/holds", map[string]string{"amount": "10.00", "reason": "test"}, nil)
+    assert.Equal(t, http.StatusForbidden, status)
+
+    assert.Equal(t, "100.00", getBalance(t, ownerAccount))
+    var account struct {
+        Status string `json:"status"`
+    }
+    assert.Equal(t, http.StatusOK, doJSON(t, "GET", owner, "/accounts/"+emptyAccount, nil, &account))
+    assert.Equal(t, "active", account.Status)
+}
@@ -0,0 +1,213 @@
+package integration_tests
+
+import (
+    "fmt"
+    "io"
+    "net/http"
+    "strings"
+    "testing"
+    "github.com/beevik/etree"
+    "github.com/stretchr/testify/assert"
+)
+
+type bulkTransfer struct {
+    endToEndID string
+    amount     string
+    creditor   string
+}
+
+// Собирает pain.001.001.03 с одним блоком PmtInf; CtrlSum передается как есть
+func pain001(msgID, debtor, controlSum string, transfers ...bulkTransfer) string {
+    var txs strings.Builder
+    for _, tx := range transfers {
+        fmt.Fprintf(&txs, `
+      <CdtTrfTxInf>
+        <PmtId><EndToEndId>%s</EndToEndId></PmtId>
+        <Amt><InstdAmt Ccy="RUB">%s</InstdAmt></Amt>
+        <Cdtr><Nm>Creditor</Nm></Cdtr>
+        <CdtrAcct><Id><Othr><Id>%s</Id></Othr></Id></CdtrAcct>
+      </CdtTrfTxInf>`, tx.endToEndID, tx.amount, tx.creditor)
+    }
+
+    return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<Document xmlns="urn:iso:std:iso:20022:tech:xsd:pain.001.001.03">
+  <CstmrCdtTrfInitn>
+    <GrpHdr>
+      <MsgId>%[1]s</MsgId>
+      <CreDtTm>2024-01-01T10:00:00</CreDtTm>
+      <NbOfTxs>%[2]d</NbOfTxs>
+      <CtrlSum>%[3]s</CtrlSum>
+      <InitgPty><Nm>Test</Nm></InitgPty>
+    </GrpHdr>
+    <PmtInf>
+      <PmtInfId>%[1]s-1</PmtInfId>
+      <PmtMtd>TRF</PmtMtd>
+      <NbOfTxs>%[2]d</NbOfTxs>
+      <Dbtr><Nm>Debtor</Nm></Dbtr>
+      <DbtrAcct><Id><Othr><Id>%[4]s</Id></Othr></Id></DbtrAcct>%[5]s
+    </PmtInf>
+  </CstmrCdtTrfInitn>
+</Document>`, msgID, len(transfers), controlSum, debtor, txs.String())
+}
+
+// Загружает файл и возвращает код ответа и разобранный pain.002
+func uploadPaymentFile(t *testing.T, token, mode, file string) (int, *etree.Element) {
+    req, _ := http.NewRequest("POST", "http://localhost:8080/payments/bulk?mode="+mode, strings.NewReader(file))
+    req.Header.Set("Authorization", "Bearer "+token)
+    req.Header.Set("Content-Type", "application/xml")
+
+    resp, err := http.DefaultClient.Do(req)
+    if !assert.NoError(t, err) {
+        return 0, nil
+    }
+    defer resp.Body.Close()
+
+    body, _ := io.ReadAll(resp.Body)
+    if !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/xml") {
+        return resp.StatusCode, nil
+    }
+    doc := etree.NewDocument()
+    assert.NoError(t, doc.ReadFromBytes(body))
+    return resp.StatusCode, doc.FindElement("/Document/CstmrPmtStsRpt")
+}
+
+func transferStatuses(report *etree.Element) map[string]string {
+    statuses := map[string]string{}
+    for _, tx := range report.FindElements("OrgnlPmtInfAndSts/TxInfAndSts") {
+        status := tx.SelectElement("TxSts").Text()
+        if reason := tx.FindElement("StsRsnInf/Rsn/Cd"); reason != nil {
+            status += "/" + reason.Text()
+        }
+        statuses[tx.SelectElement("OrgnlEndToEndId").Text()] = status
+    }
+    return statuses
+}
+
+func TestBulkPaymentBestEffort(t *testing.T) {
+    token := authenticateUser(t)
+    debtor := createAccount(t, token)
+    creditor := createAccount(t, token)
+    setBalance(t, debtor, "100.00")
+
+    file := pain001("BE-1", debtor, "180.00",
+        bulkTransfer{"E2E-1", "30.00", creditor},
+        bulkTransfer{"E2E-2", "150.00", creditor},
+    )
+    status, report := uploadPaymentFile(t, token, "best_effort", file)
+    assert.Equal(t, http.StatusOK, status)
+    if !assert.NotNil(t, report) {
+        return
+    }
+    assert.Equal(t, "BE-1", report.FindElement("OrgnlGrpInfAndSts/OrgnlMsgId").Text())
+    assert.Equal(t, "PART", report.FindElement("OrgnlGrpInfAndSts/GrpSts").Text())
+    assert.Equal(t, map[string]string{
+        "E2E-1": "ACSC",
+        "E2E-2": "RJCT/AM04",
+    }, transferStatuses(report))
+
+    assert.Equal(t, "70.00", getBalance(t, debtor))
+    assert.Equal(t, "30.00", getBalance(t, creditor))
+}
+
+// Отказ одного перевода откатывает весь пакет
+func TestBulkPaymentAllOrNothing(t *testing.T) {
+    token := authenticateUser(t)
+    debtor := createAccount(t, token)
+    creditor := createAccount(t, token)
+    setBalance(t, debtor, "100.00")
+
+    file := pain001("AON-1", debtor, "180.00",
+        bulkTransfer{"E2E-1", "30.00", creditor},
+        bulkTransfer{"E2E-2", "150.00", creditor},
+    )
+    status, report := uploadPaymentFile(t, token, "all_or_nothing", file)
+    assert.Equal(t, http.StatusOK, status)
+    if !assert.NotNil(t, report) {
+        return
+    }
+    assert.Equal(t, "RJCT", report.FindElement("OrgnlGrpInfAndSts/GrpSts").Text())
+    assert.Equal(t, map[string]string{
+        "E2E-1": "RJCT/NARR",
+        "E2E-2": "RJCT/AM04",
+    }, transferStatuses(report))
+    assert.Equal(t, "100.00", getBalance(t, debtor))
+    assert.Equal(t, "0.00", getBalance(t, creditor))
+
+    // Отклоненный пакет не регистрируется, исправленный файл принимается с тем же MsgId
+    file = pain001("AON-1", debtor, "80.00",
+        bulkTransfer{"E2E-1", "30.00", creditor},
+        bulkTransfer{"E2E-2", "50.00", creditor},
+    )
+    status, report = uploadPaymentFile(t, token, "", file)
+    assert.Equal(t, http.StatusOK, status)
+    if assert.NotNil(t, report) {
+        assert.Equal(t, "ACSC", report.FindElement("OrgnlGrpInfAndSts/GrpSts").Text())
+    }
+    assert.Equal(t, "20.00", getBalance(t, debtor))
+    assert.Equal(t, "80.00", getBalance(t, creditor))
+
+    // Повторная загрузка исполненного пакета
+    status, report = uploadPaymentFile(t, token, "", file)
+    assert.Equal(t, http.StatusConflict, status)
+    if assert.NotNil(t, report) {
+        assert.Equal(t, "AM05", report.FindElement("OrgnlGrpInfAndSts/StsRsnInf/Rsn/Cd").Text())
+    }
+    assert.Equal(t, "20.00", getBalance(t, debtor))
+}
+
+func TestBulkPaymentValidation(t *testing.T) {
+    token := authenticateUser(t)
+    debtor := createAccount(t, token)
+    creditor := createAccount(t, token)
+    setBalance(t, debtor, "100.00")
+
+    // Контрольная сумма не совпадает с суммой переводов
+    file := pain001("VAL-1", debtor, "99.99", bulkTransfer{"E2E-1", "10.00", creditor})
+    status, report := uploadPaymentFile(t, token, "best_effort", file)
+    assert.Equal(t, http.StatusUnprocessableEntity, status)
+    if assert.NotNil(t, report) {
+        assert.Equal(t, "RJCT", report.FindElement("OrgnlGrpInfAndSts/GrpSts").Text())
+        assert.Equal(t, "AM10", report.FindElement("OrgnlGrpInfAndSts/StsRsnInf/Rsn/Cd").Text())
+    }
+
+    // NbOfTxs не совпадает с числом переводов
+    file = strings.Replace(
+        pain001("VAL-2", debtor, "10.00", bulkTransfer{"E2E-1", "10.00", creditor}),
+        "<NbOfTxs>1</NbOfTxs>", "<NbOfTxs>2</NbOfTxs>", 1)
+    status, report = uploadPaymentFile(t, token, "best_effort", file)
+    assert.Equal(t, http.StatusUnprocessableEntity, status)
+    if assert.NotNil(t, report) {
+        assert.Equal(t, "AM18", report.FindElement("OrgnlGrpInfAndSts/StsRsnInf/Rsn/Cd").Text())
+    }
+
+    // Внешний IBAN и неизвестный идентификатор счета
+    file = pain001("VAL-3", debtor, "30.00",
+        bulkTransfer{"E2E-1", "10.00", "DE89370400440532013000"},
+        bulkTransfer{"E2E-2", "10.00", "not-an-account"},
+        bulkTransfer{"E2E-3", "10.00", creditor},
+    )
+    status, report = uploadPaymentFile(t, token, "best_effort", file)
+    assert.Equal(t, http.StatusOK, status)
+    if assert.NotNil(t, report) {
+        assert.Equal(t, map[string]string{
+            "E2E-1": "RJCT/AC03",
+            "E2E-2": "RJCT/AC03",
+            "E2E-3": "ACSC",
+        }, transferStatuses(report))
+    }
+    assert.Equal(t, "90.00", getBalance(t, debtor))
+
+    // Счет плательщика другого пользователя
+    stranger := authenticateUser(t)
+    file = pain001("VAL-4", debtor, "10.00", bulkTransfer{"E2E-1", "10.00", creditor})
+    status, report = uploadPaymentFile(t, stranger, "best_effort", file)
+    assert.Equal(t, http.StatusOK, status)
+    if assert.NotNil(t, report) {
+        assert.Equal(t, map[string]string{"E2E-1": "RJCT/AG01"}, transferStatuses(report))
+    }
+
+    status, _ = uploadPaymentFile(t, token, "best_effort", "<Document>not pain.001</Document>")
+    assert.Equal(t, http.StatusBadRequest, status)
+    status, _ = uploadPaymentFile(t, token, "sometimes", pain001("VAL-5", debtor, "10.00", bulkTransfer{"E2E-1", "10.00", creditor}))
+    assert.Equal(t, http.StatusBadRequest, status)
+}
@@ -0,0 +1,421 @@
+package integration_tests
+
+import (
+    "bytes"
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "strconv"
+    "testing"
+    "time"
+    "github.com/stretchr/testify/assert"
+)
+
+// Мерчант из MERCHANT_SECRETS в .env
+const (
+    testMerchantID     = "test-merchant"
+    testMerchantSecret = "test_merchant_secret_at_least_32_chars"
+)
+
+type authorizationResponse struct {
+    ID             string `json:"id"`
+    MaskedNumber   string `json:"masked_number"`
+    Reference      string `json:"reference"`
+    Amount         string `json:"amount"`
+    CapturedAmount string `json:"captured_amount"`
+    RefundedAmount string `json:"refunded_amount"`
+    Currency       string `json:"currency"`
+    Status         string `json:"status"`
+    Reason         string `json:"reason"`
+}
+
+// Карта с реквизитами, которые мерчант передает при авторизации
+type paymentCard struct {
+    AccountID string
+    CardID    string
+    PAN       string
+    Expiry    string
+    CVV       string
+}
+
+// Выпускает карту к счету с заданным балансом без овердрафта
+func fundedCard(t *testing.T, token, balance string) paymentCard {
+    accountID := createAccount(t, token)
+    setBalance(t, accountID, balance)
+    setAccountLimit(t, accountID, "overdraft", "0")
+
+    card := issueCardForAccount(t, token, accountID, "visa")
+    return paymentCard{
+        AccountID: accountID,
+        CardID:    card.ID,
+        PAN:       revealCardNumber(t, token, card.ID),
+        Expiry:    card.Expiry,
+        CVV:       card.CVV,
+    }
+}
+
+// Отправляет запрос мерчанта, подписанный HMAC-SHA256
+func merchantRequest(t *testing.T, method, path string, body interface{}, out interface{}) int {
+    return signedRequest(t, method, path, body, out, testMerchantSecret, time.Now())
+}
+
+func signedRequest(t *testing.T, method, path string, body interface{}, out interface{}, secret string, at time.Time) int {
+    var raw []byte
+    if body != nil {
+        raw, _ = json.Marshal(body)
+    }
+    timestamp := strconv.FormatInt(at.Unix(), 10)
+
+    mac := hmac.New(sha256.New, []byte(secret))
+    mac.Write([]byte(timestamp + "\n" + method + "\n" + path + "\n" + string(raw)))
+
+    req, _ := http.NewRequest(method, "http://localhost:8080"+path, bytes.NewReader(raw))
+    req.Header.Set("Content-Type", "application/json")
+    req.Header.Set("X-Merchant-Id", testMerchantID)
+    req.Header.Set("X-Timestamp", timestamp)
+    req.Header.Set("X-Signature", hex.EncodeToString(mac.Sum(nil)))
+
+    resp, err := http.DefaultClient.Do(req)
+    if !assert.NoError(t, err) {
+        return 0
+    }
+    defer resp.Body.Close()
+
+    if out != nil {
+        json.NewDecoder(resp.Body).Decode(out)
+    }
+    return resp.StatusCode
+}
+
+func authorizeCard(t *testing.T, card paymentCard, amount string, out *authorizationResponse) int {
+    return merchantRequest(t, "POST", "/merchant/authorizations", map[string]string{
+        "pan":       card.PAN,
+        "expiry":    card.Expiry,
+        "cvv":       card.CVV,
+        "amount":    amount,
+        "reference": fmt.Sprintf("order-%d", time.Now().UnixNano()),
+    }, out)
+}
+
+func TestCardAuthorizationAndCapture(t *testing.T) {
+    token := authenticateUser(t)
+    card := fundedCard(t, token, "1000.00")
+
+    var auth authorizationResponse
+    status := authorizeCard(t, card, "300.00", &auth)
+    assert.Equal(t, http.StatusOK, status)
+    assert.Equal(t, "authorized", auth.Status)
+    assert.Equal(t, "300.00", auth.Amount)
+    assert.Equal(t, card.PAN[:6]+"******"+card.PAN[12:], auth.MaskedNumber)
+
+    // Удержание не меняет баланс, но уменьшает остаток для новых авторизаций
+    assert.Equal(t, "1000.00", getBalance(t, card.AccountID))
+    var declined authorizationResponse
+    status = authorizeCard(t, card, "800.00", &declined)
+    assert.Equal(t, http.StatusPaymentRequired, status)
+    assert.Equal(t, "insufficient_funds", declined.Reason)
+
+    // Частичное списание освобождает остаток удержания
+    status = merchantRequest(t, "POST", "/merchant/authorizations/"+auth.ID+"/capture", map[string]string{"amount": "200.00"}, &auth)
+    assert.Equal(t, http.StatusOK, status)
+    assert.Equal(t, "captured", auth.Status)
+    assert.Equal(t, "200.00", auth.CapturedAmount)
+    assert.Equal(t, "800.00", getBalance(t, card.AccountID))
+    assert.Equal(t, "800.00", getLedgerBalance(t, card.AccountID))
+
+    status = merchantRequest(t, "POST", "/merchant/authorizations/"+auth.ID+"/capture", nil, nil)
+    assert.Equal(t, http.StatusConflict, status)
+
+    status = authorizeCard(t, card, "800.00", nil)
+    assert.Equal(t, http.StatusOK, status)
+
+    var history struct {
+        Transactions []struct {
+            Type   string `json:"type"`
+            Amount string `json:"amount"`
+        } `json:"transactions"`
+    }
+    status = doJSON(t, "GET", token, "/accounts/"+card.AccountID+"/transactions?type=card_payment", nil, &history)
+    assert.Equal(t, http.StatusOK, status)
+    if assert.Len(t, history.Transactions, 1) {
+        assert.Equal(t, "200.00", history.Transactions[0].Amount)
+    }
+}
+
+func TestCardAuthorizationVoid(t *testing.T) {
+    token := authenticateUser(t)
+    card := fundedCard(t, token, "500.00")
+
+    var auth authorizationResponse
+    assert.Equal(t, http.StatusOK, authorizeCard(t, card, "500.00", &auth))
+
+    status := merchantRequest(t, "POST", "/merchant/authorizations/"+auth.ID+"/capture", map[string]string{"amount": "500.01"}, nil)
+    assert.Equal(t, http.StatusBadRequest, status)
+
+    status = merchantRequest(t, "POST", "/merchant/authorizations/"+auth.ID+"/void", nil, &auth)
+    assert.Equal(t, http.StatusOK, status)
+    assert.Equal(t, "voided", auth.Status)
+    assert.Equal(t, "500.00", getBalance(t, card.AccountID))
+
+    status = merchantRequest(t, "POST", "/merchant/authorizations/"+auth.ID+"/capture", nil, nil)
+    assert.Equal(t, http.StatusConflict, status)
+    assert.Equal(t, http.StatusOK, authorizeCard(t, card, "500.00", nil))
+}
+
+func TestCardRefund(t *testing.T) {
+    token := authenticateUser(t)
+    card := fundedCard(t, token, "500.00")
+
+    var auth authorizationResponse
+    assert.Equal(t, http.StatusOK, authorizeCard(t, card, "100.00", &auth))
+
+    refundURL := "/merchant/authorizations/" + auth.ID + "/refund"
+    status := merchantRequest(t, "POST", refundURL, map[string]string{"reference": "refund-1"}, nil)
+    assert.Equal(t, http.StatusConflict, status)
+
+    status = merchantRequest(t, "POST", "/merchant/authorizations/"+auth.ID+"/capture", nil, &auth)
+    assert.Equal(t, http.StatusOK, status)
+    assert.Equal(t, "400.00", getBalance(t, card.AccountID))
+
+    // Без reference возврат не принимается
+    status = merchantRequest(t, "POST", refundURL, map[string]string{"amount": "40.00"}, nil)
+    assert.Equal(t, http.StatusUnprocessableEntity, status)
+
+    status = merchantRequest(t, "POST", refundURL, map[string]string{"reference": "refund-1", "amount": "40.00"}, &auth)
+    assert.Equal(t, http.StatusOK, status)
+    assert.Equal(t, "captured", auth.Status)
+    assert.Equal(t, "40.00", auth.RefundedAmount)
+    assert.Equal(t, "440.00", getBalance(t, card.AccountID))
+
+    status = merchantRequest(t, "POST", refundURL, map[string]string{"reference": "refund-2", "amount": "70.00"}, nil)
+    assert.Equal(t, http.StatusBadRequest, status)
+
+    status = merchantRequest(t, "POST", refundURL, map[string]string{"reference": "refund-2"}, &auth)
+    assert.Equal(t, http.StatusOK, status)
+    assert.Equal(t, "refunded", auth.Status)
+    assert.Equal(t, "100.00", auth.RefundedAmount)
+    assert.Equal(t, "500.00", getBalance(t, card.AccountID))
+    assert.Equal(t, "500.00", getLedgerBalance(t, card.AccountID))
+}
+
+// Повтор частичного возврата с тем же reference (например, после таймаута
+// у мерчанта) не возвращает средства второй раз
+func TestCardRefundReplay(t *testing.T) {
+    token := authenticateUser(t)
+    card := fundedCard(t, token, "500.00")
+
+    var auth authorizationResponse
+    assert.Equal(t, http.StatusOK, authorizeCard(t, card, "100.00", &auth))
+    status := merchantRequest(t, "POST", "/merchant/authorizations/"+auth.ID+"/capture", nil, &auth)
+    assert.Equal(t, http.StatusOK, status)
+
+    refundURL := "/merchant/authorizations/" + auth.ID + "/refund"
+    refund := map[string]string{"reference": "replayed-refund", "amount": "30.00"}
+    for i := 0; i < 3; i++ {
+        status = merchantRequest(t, "POST", refundURL, refund, &auth)
+        assert.Equal(t, http.StatusOK, status)
+        assert.Equal(t, "captured", auth.Status)
+        assert.Equal(t, "30.00", auth.RefundedAmount)
+    }
+    assert.Equal(t, "430.00", getBalance(t, card.AccountID))
+    assert.Equal(t, "430.00", getLedgerBalance(t, card.AccountID))
+
+    // Тот же reference с другой суммой - конфликт, а не новый возврат
+    status = merchantRequest(t, "POST", refundURL, map[string]string{"reference": "replayed-refund", "amount": "50.00"}, nil)
+    assert.Equal(t, http.StatusConflict, status)
+
+    status = merchantRequest(t, "POST", refundURL, map[string]string{"reference": "second-refund", "amount": "30.00"}, &auth)
+    assert.Equal(t, http.StatusOK, status)
+    assert.Equal(t, "60.00", auth.RefundedAmount)
+    assert.Equal(t, "460.00", getBalance(t, card.AccountID))
+}
+
+func TestCardAuthorizationDeclines(t *testing.T) {
+    token := authenticateUser(t)
+    card := fundedCard(t, token, "500.00")
+
+    wrongCVV := card
+    wrongCVV.CVV = fmt.Sprintf("%03d", (mustAtoi(card.CVV)+1)%1000)
+    wrongExpiry := card
+    wrongExpiry.Expiry = "01/20"
+    unknown := card
+    unknown.PAN = "4276000000000000"
+
+    for reason, c := range map[string]paymentCard{
+        "invalid_cvv":    wrongCVV,
+        "invalid_expiry": wrongExpiry,
+        "invalid_card":   unknown,
+    } {
+        var declined authorizationResponse
+        status := authorizeCard(t, c, "10.00", &declined)
+        assert.Equal(t, http.StatusPaymentRequired, status)
+        assert.Equal(t, reason, declined.Reason)
+    }
+
+    // CVV неверного формата отклоняется без сравнения с хешем
+    for _, cvv := range []string{"", "12", "1234", "12a"} {
+        var declined authorizationResponse
+        status := authorizeCardWith(t, card, "10.00", map[string]string{"cvv": cvv}, &declined)
+        assert.Equal(t, http.StatusPaymentRequired, status, "cvv %q", cvv)
+        assert.Equal(t, "invalid_cvv", declined.Reason, "cvv %q", cvv)
+    }
+
+    status := doJSON(t, "POST", token, "/cards/"+card.CardID+"/block", nil, nil)
+    assert.Equal(t, http.StatusOK, status)
+    var declined authorizationResponse
+    status = authorizeCard(t, card, "10.00", &declined)
+    assert.Equal(t, http.StatusPaymentRequired, status)
+    assert.Equal(t, "card_blocked", declined.Reason)
+}
+
+// После CARD_MAX_CVV_ATTEMPTS авторизаций подряд с неверными реквизитами карта
+// закрывается; успешная авторизация сбрасывает счетчик
+func TestCardClosedAfterInvalidCVVAttempts(t *testing.T) {
+    token := authenticateUser(t)
+    card := fundedCard(t, token, "500.00")
+
+    wrongCVV := card
+    wrongCVV.CVV = fmt.Sprintf("%03d", (mustAtoi(card.CVV)+1)%1000)
+    wrongExpiry := card
+    wrongExpiry.Expiry = "01/20"
+
+    for _, c := range []paymentCard{wrongCVV, wrongExpiry} {
+        assert.Equal(t, http.StatusPaymentRequired, authorizeCard(t, c, "10.00", nil))
+    }
+    assert.Equal(t, http.StatusOK, authorizeCard(t, card, "10.00", nil))
+
+    for _, c := range []paymentCard{wrongCVV, wrongExpiry, wrongCVV} {
+        assert.Equal(t, http.StatusPaymentRequired, authorizeCard(t, c, "10.00", nil))
+    }
+
+    var declined authorizationResponse
+    status := authorizeCard(t, card, "10.00", &declined)
+    assert.Equal(t, http.StatusPaymentRequired, status)
+    assert.Equal(t, "card_closed", declined.Reason)
+
+    var got cardResponse
+    status = doJSON(t, "GET", token, "/cards/"+card.CardID, nil, &got)
+    assert.Equal(t, http.StatusOK, status)
+    assert.Equal(t, "too_many_attempts", got.BlockReason)
+}
+
+func TestMerchantSignature(t *testing.T) {
+    token := authenticateUser(t)
+    card := fundedCard(t, token, "500.00")
+    body := map[string]string{
+        "pan":       card.PAN,
+        "expiry":    card.Expiry,
+        "cvv":       card.CVV,
+        "amount":    "10.00",
+        "reference": fmt.Sprintf("order-%d", time.Now().UnixNano()),
+    }
+
+    status := signedRequest(t, "POST", "/merchant/authorizations", body, nil, "wrong_secret_of_sufficient_length_000", time.Now())
+    assert.Equal(t, http.StatusUnauthorized, status)
+    status = signedRequest(t, "POST", "/merchant/authorizations", body, nil, testMerchantSecret, time.Now().Add(-time.Hour))
+    assert.Equal(t, http.StatusUnauthorized, status)
+
+    // JWT пользователя не дает доступа к API мерчантов
+    status = doJSON(t, "POST", token, "/merchant/authorizations", body, nil)
+    assert.Equal(t, http.StatusUnauthorized, status)
+
+    var auth authorizationResponse
+    status = merchantRequest(t, "POST", "/merchant/authorizations", body, &auth)
+    assert.Equal(t, http.StatusOK, status)
+    status = merchantRequest(t, "POST", "/merchant/authorizations", body, nil)
+    assert.Equal(t, http.StatusConflict, status)
+
+    status = merchantRequest(t, "GET", "/merchant/authorizations/"+auth.ID, nil, &auth)
+    assert.Equal(t, http.StatusOK, status)
+    assert.Equal(t, body["reference"], auth.Reference)
+}
+
+// Авторизация с параметрами операции: канал, страна и MCC
+func authorizeCardWith(t *testing.T, card paymentCard, amount string, params map[string]string, out *authorizationResponse) int {
+    body := map[string]string{
+        "pan":       card.PAN,
+        "expiry":    card.Expiry,
+        "cvv":       card.CVV,
+        "amount":    amount,
+        "reference": fmt.Sprintf("order-%d", time.Now().UnixNano()),
+    }
+    for k, v := range params {
+        body[k] = v
+    }
+    return merchantRequest(t, "POST", "/merchant/authorizations", body, out)
+}
+
+func TestCardSpendingControls(t *testing.T) {
+    token := authenticateUser(t)
+    card := fundedCard(t, token, "10000.00")
+
+    status := doJSON(t, "PUT", token, "/cards/"+card.CardID+"/limits", map[string]interface{}{
+        "per_transaction": "1000.00",
+        "daily":           "1500.00",
+        "offline_enabled": false,
+        "foreign_enabled": false,
+        "blocked_mcc":     []string{"7995"},
+    }, nil)
+    assert.Equal(t, http.StatusOK, status)
+
+    for reason, params := range map[string]map[string]string{
+        "offline_disabled": {"channel": "offline"},
+        "foreign_disabled": {"country": "de"},
+        "mcc_blocked":      {"mcc": "7995"},
+    } {
+        var declined authorizationResponse
+        status := authorizeCardWith(t, card, "10.00", params, &declined)
+        assert.Equal(t, http.StatusPaymentRequired, status)
+        assert.Equal(t, reason, declined.Reason)
+    }
+
+    // Без страны и MCC нельзя проверить запрет зарубежных операций и MCC
+    for reason, params := range map[string]map[string]string{
+        "foreign_disabled": {"mcc": "5411"},
+        "mcc_blocked":      {"country": "RU"},
+    } {
+        var declined authorizationResponse
+        status := authorizeCardWith(t, card, "10.00", params, &declined)
+        assert.Equal(t, http.StatusPaymentRequired, status)
+        assert.Equal(t, reason, declined.Reason)
+    }
+
+    domestic := map[string]string{"country": "RU", "mcc": "5411"}
+    var declined authorizationResponse
+    status = authorizeCardWith(t, card, "1000.01", domestic, &declined)
+    assert.Equal(t, http.StatusPaymentRequired, status)
+    assert.Equal(t, "card_transaction_limit", declined.Reason)
+
+    var auth authorizationResponse
+    status = authorizeCardWith(t, card, "1000.00", domestic, &auth)
+    assert.Equal(t, http.StatusOK, status)
+    status = authorizeCardWith(t, card, "600.00", domestic, &declined)
+    assert.Equal(t, http.StatusPaymentRequired, status)
+    assert.Equal(t, "card_daily_limit", declined.Reason)
+
+    // Отмененная авторизация не расходует дневной лимит
+    merchantRequest(t, "POST", "/merchant/authorizations/"+auth.ID+"/void", nil, nil)
+    assert.Equal(t, http.StatusOK, authorizeCardWith(t, card, "600.00", domestic, nil))
+
+    status = doJSON(t, "PUT", token, "/cards/"+card.CardID+"/limits", map[string]interface{}{
+        "allowed_mcc": []string{"5411"},
+    }, nil)
+    assert.Equal(t, http.StatusOK, status)
+    status = authorizeCardWith(t, card, "10.00", map[string]string{"mcc": "5812"}, &declined)
+    assert.Equal(t, http.StatusPaymentRequired, status)
+    assert.Equal(t, "mcc_not_allowed", declined.Reason)
+    assert.Equal(t, http.StatusOK, authorizeCardWith(t, card, "10.00", map[string]string{"mcc": "5411", "channel": "offline"}, nil))
+
+    status = doJSON(t, "PUT", token, "/cards/"+card.CardID+"/limits", map[string]interface{}{
+        "allowed_mcc": []string{"54"},
+    }, nil)
+    assert.Equal(t, http.StatusBadRequest, status)
+}
+
+func mustAtoi(s string) int {
+    n, _ := strconv.Atoi(s)
+    return n
+}
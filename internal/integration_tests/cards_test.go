@@ -0,0 +1,355 @@
+package integration_tests
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "regexp"
+    "strings"
+    "testing"
+    "time"
+    "github.com/stretchr/testify/assert"
+    "golang.org/x/crypto/bcrypt"
+)
+
+type cardResponse struct {
+    ID            string `json:"id"`
+    AccountID     string `json:"account_id"`
+    Number        string `json:"number"`
+    MaskedNumber  string `json:"masked_number"`
+    PaymentSystem string `json:"payment_system"`
+    Expiry        string `json:"expiry"`
+    CVV           string `json:"cvv"`
+    Status        string `json:"status"`
+    BlockReason   string `json:"block_reason"`
+    ReplacedBy    string `json:"replaced_by"`
+    PINSet        bool   `json:"pin_set"`
+}
+
+type cardLimitsResponse struct {
+    PerTransaction string   `json:"per_transaction"`
+    Daily          string   `json:"daily"`
+    Monthly        string   `json:"monthly"`
+    OnlineEnabled  bool     `json:"online_enabled"`
+    OfflineEnabled bool     `json:"offline_enabled"`
+    ForeignEnabled bool     `json:"foreign_enabled"`
+    AllowedMCC     []string `json:"allowed_mcc"`
+    BlockedMCC     []string `json:"blocked_mcc"`
+}
+
+// Выпускает карту к новому счету пользователя
+func issueCard(t *testing.T, token, paymentSystem string) cardResponse {
+    return issueCardForAccount(t, token, createAccount(t, token), paymentSystem)
+}
+
+func issueCardForAccount(t *testing.T, token, accountID, paymentSystem string) cardResponse {
+    var card cardResponse
+    body := map[string]string{"account_id": accountID, "payment_system": paymentSystem}
+    status := doJSON(t, "POST", token, "/cards", body, &card)
+    assert.Equal(t, http.StatusOK, status)
+    return card
+}
+
+// Раскрывает полный номер карты с паролем пользователя из authenticateUser
+func revealCardNumber(t *testing.T, token, cardID string) string {
+    var card cardResponse
+    status := doJSON(t, "POST", token, "/cards/"+cardID+"/reveal", map[string]string{"password": "Str0ng!Password"}, &card)
+    assert.Equal(t, http.StatusOK, status)
+    return card.Number
+}
+
+func luhnValid(number string) bool {
+    sum := 0
+    for i := len(number) - 1; i >= 0; i-- {
+        d := int(number[i] - '0')
+        if (len(number)-i)%2 == 0 {
+            d *= 2
+            if d > 9 {
+                d -= 9
+            }
+        }
+        sum += d
+    }
+    return sum%10 == 0
+}
+
+func TestIssueCard(t *testing.T) {
+    token := authenticateUser(t)
+
+    prefixes := map[string]string{"mir": "2200", "visa": "4", "mastercard": "5"}
+    for system, prefix := range prefixes {
+        card := issueCard(t, token, system)
+        assert.Equal(t, system, card.PaymentSystem)
+        assert.Empty(t, card.Number)
+
+        number := revealCardNumber(t, token, card.ID)
+        assert.Len(t, number, 16)
+        assert.True(t, strings.HasPrefix(number, prefix), "%s number %s", system, number)
+        assert.True(t, luhnValid(number), "number %s fails Luhn check", number)
+        assert.Equal(t, number[:6]+"******"+number[12:], card.MaskedNumber)
+        assert.Regexp(t, regexp.MustCompile(`^\d{3}$`), card.CVV)
+
+        // В базе хранится хеш выданного CVV
+        var cvvHash string
+        assert.NoError(t, testDB.QueryRow(`SELECT cvv_hash FROM cards WHERE id = $1`, card.ID).Scan(&cvvHash))
+        assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(cvvHash), []byte(card.CVV)))
+    }
+
+    // Срок действия по умолчанию - 48 месяцев с даты выпуска
+    card := issueCard(t, token, "")
+    assert.Equal(t, "mir", card.PaymentSystem)
+    assert.Equal(t, time.Now().UTC().AddDate(0, 48, 1-time.Now().UTC().Day()).Format("01/06"), card.Expiry)
+
+    status := doJSON(t, "POST", token, "/cards", map[string]string{"payment_system": "amex"}, nil)
+    assert.Equal(t, http.StatusBadRequest, status)
+}
+
+func TestCardLinkedToAccount(t *testing.T) {
+    token := authenticateUser(t)
+    accountID := createAccount(t, token)
+
+    card := issueCardForAccount(t, token, accountID, "visa")
+    assert.Equal(t, accountID, card.AccountID)
+
+    // Карта выпускается только к собственному действующему счету
+    status := doJSON(t, "POST", token, "/cards", map[string]string{}, nil)
+    assert.Equal(t, http.StatusUnprocessableEntity, status)
+
+    stranger := authenticateUser(t)
+    status = doJSON(t, "POST", stranger, "/cards", map[string]string{"account_id": accountID}, nil)
+    assert.Equal(t, http.StatusForbidden, status)
+
+    // Перенос на другой счет той же валюты
+    other := createAccount(t, token)
+    var linked cardResponse
+    status = doJSON(t, "PUT", token, "/cards/"+card.ID+"/account", map[string]string{"account_id": other}, &linked)
+    assert.Equal(t, http.StatusOK, status)
+    assert.Equal(t, other, linked.AccountID)
+
+    status = doJSON(t, "POST", token, "/accounts/"+accountID+"/close", nil, nil)
+    assert.Equal(t, http.StatusOK, status)
+    status = doJSON(t, "PUT", token, "/cards/"+card.ID+"/account", map[string]string{"account_id": accountID}, nil)
+    assert.Equal(t, http.StatusConflict, status)
+}
+
+func TestCardNumbersUnique(t *testing.T) {
+    token := authenticateUser(t)
+
+    numbers := map[string]bool{}
+    for i := 0; i < 20; i++ {
+        card := issueCard(t, token, "visa")
+        number := revealCardNumber(t, token, card.ID)
+        assert.False(t, numbers[number], "duplicate number %s", number)
+        numbers[number] = true
+    }
+
+    // Уникальность номера обеспечивается базой по слепому индексу
+    var userID, numberHash string
+    assert.NoError(t, testDB.QueryRow(`SELECT user_id, number_hash FROM cards LIMIT 1`).Scan(&userID, &numberHash))
+    _, err := testDB.Exec(
+        `INSERT INTO cards (user_id, number_encrypted, number_hash, number_masked, payment_system, expiry, cvv_hash)
+         VALUES ($1, 'x', $2, '427600******0000', 'visa', '01/30', 'x')`,
+        userID, numberHash)
+    assert.Error(t, err)
+}
+
+// CVV не сохраняется для повторной выдачи по Idempotency-Key
+func TestCardCVVShownOnce(t *testing.T) {
+    token := authenticateUser(t)
+    key := fmt.Sprintf("card-%d", time.Now().UnixNano())
+    request := map[string]string{"account_id": createAccount(t, token)}
+
+    resp, body := postIdempotent(t, token, "/cards", key, request)
+    assert.Equal(t, http.StatusOK, resp.StatusCode)
+    assert.Equal(t, "no-store", resp.Header.Get("Cache-Control"))
+    var card cardResponse
+    assert.NoError(t, json.Unmarshal(body, &card))
+    assert.NotEmpty(t, card.CVV)
+
+    resp, body = postIdempotent(t, token, "/cards", key, request)
+    assert.Equal(t, http.StatusConflict, resp.StatusCode)
+    assert.NotContains(t, string(body), card.CVV)
+
+    var count int
+    assert.NoError(t, testDB.QueryRow(
+        `SELECT COUNT(*) FROM cards WHERE user_id = $1`, userIDFromToken(t, token)).Scan(&count))
+    assert.Equal(t, 1, count)
+}
+
+func TestCardNumberEncryptedAtRest(t *testing.T) {
+    token := authenticateUser(t)
+    card := issueCard(t, token, "mir")
+    number := revealCardNumber(t, token, card.ID)
+
+    var plain, encrypted, hash string
+    assert.NoError(t, testDB.QueryRow(
+        `SELECT COALESCE(number, ''), number_encrypted, number_hash FROM cards WHERE id = $1`, card.ID,
+    ).Scan(&plain, &encrypted, &hash))
+    assert.Empty(t, plain)
+    assert.NotContains(t, encrypted, number)
+    assert.NotContains(t, hash, number)
+    assert.Len(t, hash, 64)
+
+    // Раскрытие номера требует пароля и доступно только владельцу
+    status := doJSON(t, "POST", token, "/cards/"+card.ID+"/reveal", map[string]string{"password": "wrong"}, nil)
+    assert.Equal(t, http.StatusUnauthorized, status)
+    stranger := authenticateUser(t)
+    status = doJSON(t, "POST", stranger, "/cards/"+card.ID+"/reveal", map[string]string{"password": "Str0ng!Password"}, nil)
+    assert.Equal(t, http.StatusForbidden, status)
+}
+
+func TestCardBlockAndClose(t *testing.T) {
+    token := authenticateUser(t)
+    card := issueCard(t, token, "visa")
+
+    var got cardResponse
+    status := doJSON(t, "POST", token, "/cards/"+card.ID+"/block", nil, &got)
+    assert.Equal(t, http.StatusOK, status)
+    assert.Equal(t, "blocked", got.Status)
+
+    status = doJSON(t, "POST", token, "/cards/"+card.ID+"/block", nil, nil)
+    assert.Equal(t, http.StatusConflict, status)
+
+    status = doJSON(t, "POST", token, "/cards/"+card.ID+"/unblock", nil, &got)
+    assert.Equal(t, http.StatusOK, status)
+    assert.Equal(t, "active", got.Status)
+
+    status = doJSON(t, "POST", token, "/cards/"+card.ID+"/close", map[string]string{}, nil)
+    assert.Equal(t, http.StatusUnprocessableEntity, status)
+    status = doJSON(t, "POST", token, "/cards/"+card.ID+"/close", map[string]string{"reason": "expired"}, nil)
+    assert.Equal(t, http.StatusBadRequest, status)
+
+    status = doJSON(t, "POST", token, "/cards/"+card.ID+"/close", map[string]string{"reason": "lost"}, &got)
+    assert.Equal(t, http.StatusOK, status)
+    assert.Equal(t, "closed", got.Status)
+    assert.Equal(t, "lost", got.BlockReason)
+
+    // Постоянную блокировку снять нельзя
+    status = doJSON(t, "POST", token, "/cards/"+card.ID+"/unblock", nil, nil)
+    assert.Equal(t, http.StatusConflict, status)
+
+    stranger := authenticateUser(t)
+    status = doJSON(t, "POST", stranger, "/cards/"+card.ID+"/block", nil, nil)
+    assert.Equal(t, http.StatusForbidden, status)
+}
+
+func TestReissueCard(t *testing.T) {
+    token := authenticateUser(t)
+    card := issueCard(t, token, "mastercard")
+    number := revealCardNumber(t, token, card.ID)
+
+    limits := map[string]interface{}{
+        "per_transaction": "5000.00",
+        "daily":           "20000.00",
+        "online_enabled":  false,
+        "blocked_mcc":     []string{"7995"},
+    }
+    status := doJSON(t, "PUT", token, "/cards/"+card.ID+"/limits", limits, nil)
+    assert.Equal(t, http.StatusOK, status)
+
+    var replacement cardResponse
+    status = doJSON(t, "POST", token, "/cards/"+card.ID+"/reissue", nil, &replacement)
+    assert.Equal(t, http.StatusOK, status)
+    assert.NotEqual(t, card.ID, replacement.ID)
+    assert.Equal(t, "mastercard", replacement.PaymentSystem)
+    assert.Equal(t, "active", replacement.Status)
+    assert.NotEmpty(t, replacement.CVV)
+    assert.NotEqual(t, number, revealCardNumber(t, token, replacement.ID))
+
+    var copied cardLimitsResponse
+    status = doJSON(t, "GET", token, "/cards/"+replacement.ID+"/limits", nil, &copied)
+    assert.Equal(t, http.StatusOK, status)
+    assert.Equal(t, "5000.00", copied.PerTransaction)
+    assert.Equal(t, "20000.00", copied.Daily)
+    assert.False(t, copied.OnlineEnabled)
+    assert.True(t, copied.OfflineEnabled)
+    assert.Equal(t, []string{"7995"}, copied.BlockedMCC)
+
+    var old cardResponse
+    status = doJSON(t, "GET", token, "/cards/"+card.ID, nil, &old)
+    assert.Equal(t, http.StatusOK, status)
+    assert.Equal(t, "closed", old.Status)
+    assert.Equal(t, "reissued", old.BlockReason)
+    assert.Equal(t, replacement.ID, old.ReplacedBy)
+
+    status = doJSON(t, "POST", token, "/cards/"+card.ID+"/reissue", nil, nil)
+    assert.Equal(t, http.StatusConflict, status)
+}
+
+func TestCardPIN(t *testing.T) {
+    token := authenticateUser(t)
+    card := issueCard(t, token, "mir")
+    path := "/cards/" + card.ID + "/pin"
+
+    // Формат PIN проверяется как поле запроса, простые комбинации отклоняет сервис
+    for _, pin := range []string{"", "123", "12a4", "12345"} {
+        var body validationErrorResponse
+        status := doJSON(t, "POST", token, path, map[string]string{"pin": pin}, &body)
+        assert.Equal(t, http.StatusUnprocessableEntity, status, "pin %s", pin)
+        assert.NotEmpty(t, body.codes()["pin"], "pin %s", pin)
+    }
+    for _, pin := range []string{"1111", "1234", "4321"} {
+        status := doJSON(t, "POST", token, path, map[string]string{"pin": pin}, nil)
+        assert.Equal(t, http.StatusBadRequest, status, "pin %s", pin)
+    }
+    var invalid validationErrorResponse
+    status := doJSON(t, "PUT", token, path, map[string]string{"old_pin": "48", "new_pin": "73a1"}, &invalid)
+    assert.Equal(t, http.StatusUnprocessableEntity, status)
+    assert.Equal(t, map[string]string{"old_pin": "invalid_pin", "new_pin": "invalid_pin"}, invalid.codes())
+
+    status = doJSON(t, "PUT", token, path, map[string]string{"old_pin": "4829", "new_pin": "7391"}, nil)
+    assert.Equal(t, http.StatusConflict, status)
+
+    status = doJSON(t, "POST", token, path, map[string]string{"pin": "4829"}, nil)
+    assert.Equal(t, http.StatusNoContent, status)
+    status = doJSON(t, "POST", token, path, map[string]string{"pin": "5930"}, nil)
+    assert.Equal(t, http.StatusConflict, status)
+
+    var pinHash string
+    assert.NoError(t, testDB.QueryRow(`SELECT pin_hash FROM cards WHERE id = $1`, card.ID).Scan(&pinHash))
+    assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(pinHash), []byte("4829")))
+
+    status = doJSON(t, "PUT", token, path, map[string]string{"old_pin": "0000", "new_pin": "7391"}, nil)
+    assert.Equal(t, http.StatusForbidden, status)
+    status = doJSON(t, "PUT", token, path, map[string]string{"old_pin": "4829", "new_pin": "7391"}, nil)
+    assert.Equal(t, http.StatusNoContent, status)
+
+    var got cardResponse
+    status = doJSON(t, "GET", token, "/cards/"+card.ID, nil, &got)
+    assert.Equal(t, http.StatusOK, status)
+    assert.True(t, got.PINSet)
+}
+
+// После CARD_MAX_PIN_ATTEMPTS неверных PIN подряд карта закрывается;
+// успешная смена PIN сбрасывает счетчик
+func TestCardPINAttemptsExceeded(t *testing.T) {
+    token := authenticateUser(t)
+    card := issueCard(t, token, "mir")
+    path := "/cards/" + card.ID + "/pin"
+
+    status := doJSON(t, "POST", token, path, map[string]string{"pin": "4829"}, nil)
+    assert.Equal(t, http.StatusNoContent, status)
+
+    for i := 0; i < 2; i++ {
+        status = doJSON(t, "PUT", token, path, map[string]string{"old_pin": "0000", "new_pin": "7391"}, nil)
+        assert.Equal(t, http.StatusForbidden, status)
+    }
+    status = doJSON(t, "PUT", token, path, map[string]string{"old_pin": "4829", "new_pin": "7391"}, nil)
+    assert.Equal(t, http.StatusNoContent, status)
+
+    for i := 0; i < 3; i++ {
+        status = doJSON(t, "PUT", token, path, map[string]string{"old_pin": "0000", "new_pin": "5830"}, nil)
+        assert.Equal(t, http.StatusForbidden, status)
+    }
+
+    var got cardResponse
+    status = doJSON(t, "GET", token, "/cards/"+card.ID, nil, &got)
+    assert.Equal(t, http.StatusOK, status)
+    assert.Equal(t, "closed", got.Status)
+    assert.Equal(t, "too_many_attempts", got.BlockReason)
+
+    status = doJSON(t, "PUT", token, path, map[string]string{"old_pin": "7391", "new_pin": "5830"}, nil)
+    assert.Equal(t, http.StatusConflict, status)
+    status = doJSON(t, "POST", token, "/cards/"+card.ID+"/reissue", nil, nil)
+    assert.Equal(t, http.StatusOK, status)
+}
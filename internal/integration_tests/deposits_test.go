@@ -0,0 +1,172 @@
+package integration_tests
+
+import (
+    "net/http"
+    "testing"
+    "time"
+    "github.com/stretchr/testify/assert"
+)
+
+type depositResponse struct {
+    ID           string `json:"id"`
+    AccountID    string `json:"account_id"`
+    Kind         string `json:"kind"`
+    AnnualRate   string `json:"annual_rate"`
+    Balance      string `json:"balance"`
+    InterestPaid string `json:"interest_paid"`
+    Status       string `json:"status"`
+}
+
+type depositAccrualResponse struct {
+    Date    time.Time `json:"date"`
+    Balance string    `json:"balance"`
+    Amount  string    `json:"amount"`
+}
+
+// Переносит открытие вклада и проводки по его счету на days дней назад,
+// чтобы фоновая задача начислила проценты за прошедшие дни
+func backdateDeposit(t *testing.T, deposit depositResponse, days int) {
+    _, err := testDB.Exec(
+        `UPDATE deposits
+         SET opened_on = opened_on - $2::int,
+             last_accrued_on = last_accrued_on - $2::int,
+             matures_on = matures_on - $2::int
+         WHERE id = $1`, deposit.ID, days)
+    assert.NoError(t, err)
+    _, err = testDB.Exec(
+        `UPDATE postings SET created_at = created_at - make_interval(days => $2) WHERE account_id = $1`,
+        deposit.AccountID, days)
+    assert.NoError(t, err)
+}
+
+func TestOpenTermDeposit(t *testing.T) {
+    token := authenticateUser(t)
+    current := createAccount(t, token)
+    setBalance(t, current, "150000.00")
+
+    var deposit depositResponse
+    status := doJSON(t, "POST", token, "/deposits", map[string]string{
+        "product":      "term_12m",
+        "from_account": current,
+        "amount":       "100000.00",
+    }, &deposit)
+    assert.Equal(t, http.StatusOK, status)
+    assert.Equal(t, "term", deposit.Kind)
+    assert.Equal(t, "active", deposit.Status)
+    assert.Equal(t, "100000.00", deposit.Balance)
+    assert.Equal(t, "50000.00", getBalance(t, current))
+
+    // До окончания срока средства выдаются только при закрытии вклада
+    assert.Equal(t, http.StatusConflict, transfer(t, token, deposit.AccountID, current, "10.00"))
+    status = doJSON(t, "POST", token, "/accounts/"+deposit.AccountID+"/withdraw", map[string]string{"amount": "10.00"}, nil)
+    assert.Equal(t, http.StatusConflict, status)
+    status = doJSON(t, "POST", token, "/scheduled-payments", map[string]string{
+        "from_account": deposit.AccountID,
+        "to_account":   current,
+        "amount":       "10.00",
+        "recurrence":   "daily",
+    }, nil)
+    assert.Equal(t, http.StatusConflict, status)
+
+    stranger := authenticateUser(t)
+    assert.Equal(t, http.StatusForbidden, doJSON(t, "GET", stranger, "/deposits/"+deposit.ID, nil, nil))
+}
+
+func TestDepositBelowMinimum(t *testing.T) {
+    token := authenticateUser(t)
+    current := createAccount(t, token)
+    setBalance(t, current, "5000.00")
+
+    status := doJSON(t, "POST", token, "/deposits", map[string]string{
+        "product":      "term_12m",
+        "from_account": current,
+        "amount":       "5000.00",
+    }, nil)
+    assert.Equal(t, http.StatusBadRequest, status)
+
+    var invalid validationErrorResponse
+    status = doJSON(t, "POST", token, "/deposits", map[string]string{"from_account": current, "amount": "5000.00"}, &invalid)
+    assert.Equal(t, http.StatusUnprocessableEntity, status)
+    assert.Equal(t, map[string]string{"product": "required"}, invalid.codes())
+    assert.Equal(t, "5000.00", getBalance(t, current))
+}
+
+// Проценты начисляются за каждый день ровно один раз и капитализируются в конце месяца;
+// при досрочном закрытии пересчитываются по пониженной ставке
+func TestDepositAccrualAndEarlyClose(t *testing.T) {
+    token := authenticateUser(t)
+    current := createAccount(t, token)
+    setBalance(t, current, "150000.00")
+
+    var deposit depositResponse
+    status := doJSON(t, "POST", token, "/deposits", map[string]string{
+        "product":      "term_12m",
+        "from_account": current,
+        "amount":       "100000.00",
+    }, &deposit)
+    assert.Equal(t, http.StatusOK, status)
+    backdateDeposit(t, deposit, 40)
+
+    var accruals []depositAccrualResponse
+    deadline := time.Now().Add(30 * time.Second)
+    for time.Now().Before(deadline) {
+        doJSON(t, "GET", token, "/deposits/"+deposit.ID+"/accruals", nil, &accruals)
+        if len(accruals) >= 40 {
+            break
+        }
+        time.Sleep(500 * time.Millisecond)
+    }
+    // Несколько запусков задачи не дублируют начисления
+    time.Sleep(2 * time.Second)
+    doJSON(t, "GET", token, "/deposits/"+deposit.ID+"/accruals", nil, &accruals)
+    if assert.Len(t, accruals, 40) {
+        assert.Equal(t, "100000.00", accruals[0].Balance)
+        assert.NotEqual(t, "0.000000", accruals[0].Amount)
+    }
+
+    assert.Equal(t, http.StatusOK, doJSON(t, "GET", token, "/deposits/"+deposit.ID, nil, &deposit))
+    assert.NotEqual(t, "0.00", deposit.InterestPaid)
+    assert.Equal(t, deposit.Balance, getBalance(t, deposit.AccountID))
+    assert.Equal(t, getBalance(t, deposit.AccountID), getLedgerBalance(t, deposit.AccountID))
+    paidBeforeClose := deposit.InterestPaid
+
+    var closed depositResponse
+    status = doJSON(t, "POST", token, "/deposits/"+deposit.ID+"/close", map[string]string{"to_account": current}, &closed)
+    assert.Equal(t, http.StatusOK, status)
+    assert.Equal(t, "closed", closed.Status)
+    assert.Equal(t, "0.00", closed.Balance)
+    assert.NotEqual(t, paidBeforeClose, closed.InterestPaid)
+    assert.Equal(t, getBalance(t, current), getLedgerBalance(t, current))
+
+    status = doJSON(t, "POST", token, "/deposits/"+deposit.ID+"/close", map[string]string{"to_account": current}, nil)
+    assert.Equal(t, http.StatusConflict, status)
+}
+
+// Ставка накопительного счета привязана к ключевой ставке ЦБ
+func TestOnDemandSavingsDeposit(t *testing.T) {
+    token := authenticateUser(t)
+    current := createAccount(t, token)
+    setBalance(t, current, "1000.00")
+
+    var deposit depositResponse
+    status := doJSON(t, "POST", token, "/deposits", map[string]string{
+        "product":      "savings",
+        "from_account": current,
+        "amount":       "600.00",
+    }, &deposit)
+    if status == http.StatusServiceUnavailable {
+        t.Skip("CBR key rate is unavailable")
+    }
+    assert.Equal(t, http.StatusOK, status)
+    assert.Equal(t, "on_demand", deposit.Kind)
+    assert.NotEmpty(t, deposit.AnnualRate)
+
+    // Средства накопительного счета доступны в любой момент
+    assert.Equal(t, http.StatusOK, transfer(t, token, deposit.AccountID, current, "100.00"))
+
+    var closed depositResponse
+    status = doJSON(t, "POST", token, "/deposits/"+deposit.ID+"/close", map[string]string{"to_account": current}, &closed)
+    assert.Equal(t, http.StatusOK, status)
+    assert.Equal(t, "closed", closed.Status)
+    assert.Equal(t, "1000.00", getBalance(t, current))
+}
@@ -0,0 +1,116 @@
+package integration_tests
+
+import (
+    "fmt"
+    "net/http"
+    "testing"
+    "time"
+    "github.com/stretchr/testify/assert"
+)
+
+// Регистрирует пользователя без подтверждения адреса и возвращает его email и токен
+func registerUnverified(t *testing.T) (string, string) {
+    suffix := time.Now().UnixNano()
+    user := map[string]string{
+        "email":    fmt.Sprintf("unverified_%d@example.com", suffix),
+        "username": fmt.Sprintf("unverified%d", suffix),
+        "password": "Str0ng!Password",
+    }
+    assert.Equal(t, http.StatusOK, doJSON(t, "POST", "", "/register", user, nil))
+
+    var result struct {
+        Token string `json:"token"`
+    }
+    status := doJSON(t, "POST", "", "/login", map[string]string{
+        "email":    user["email"],
+        "password": user["password"],
+    }, &result)
+    assert.Equal(t, http.StatusOK, status)
+    return user["email"], result.Token
+}
+
+func TestUnverifiedUserCannotTransfer(t *testing.T) {
+    email, token := registerUnverified(t)
+    from := createAccount(t, token)
+    to := createAccount(t, token)
+    setBalance(t, from, "100.00")
+
+    assert.Equal(t, http.StatusForbidden, transfer(t, token, from, to, "10.00"))
+    status := doJSON(t, "POST", token, "/accounts/"+from+"/withdraw", map[string]string{"amount": "10.00"}, nil)
+    assert.Equal(t, http.StatusForbidden, status)
+    assert.Equal(t, "100.00", getBalance(t, from))
+
+    card := fundedCard(t, token, "100.00")
+    var declined authorizationResponse
+    assert.Equal(t, http.StatusPaymentRequired, authorizeCard(t, card, "10.00", &declined))
+    assert.Equal(t, "email_not_verified", declined.Reason)
+
+    // Повторная отправка письма доступна только до подтверждения
+    assert.Equal(t, http.StatusAccepted, doJSON(t, "POST", token, "/email/verification", nil, nil))
+
+    markEmailVerified(t, email)
+    assert.Equal(t, http.StatusOK, transfer(t, token, from, to, "10.00"))
+    assert.Equal(t, "90.00", getBalance(t, from))
+    assert.Equal(t, http.StatusConflict, doJSON(t, "POST", token, "/email/verification", nil, nil))
+}
+
+// Доверенный пользователь без подтвержденного адреса не может списывать
+// со счета владельца, даже если адрес владельца подтвержден
+func TestUnverifiedDelegateCannotTransfer(t *testing.T) {
+    owner := authenticateUser(t)
+    email, delegate := registerUnverified(t)
+
+    ownerAccount := createAccount(t, owner)
+    delegateAccount := createAccount(t, delegate)
+    setBalance(t, ownerAccount, "100.00")
+    _, err := testDB.Exec(
+        "INSERT INTO account_delegates (account_id, user_id) VALUES ($1, $2)",
+        ownerAccount, userIDFromToken(t, delegate),
+    )
+    assert.NoError(t, err)
+
+    var body struct {
+        Error string `json:"error"`
+    }
+    status := doJSON(t, "POST", delegate, "/transfer", map[string]string{
+        "from_account": ownerAccount,
+        "to_account":   delegateAccount,
+        "amount":       "10.00",
+    }, &body)
+    assert.Equal(t, http.StatusForbidden, status)
+    assert.Equal(t, "email address is not verified", body.Error)
+    assert.Equal(t, "100.00", getBalance(t, ownerAccount))
+
+    markEmailVerified(t, email)
+    assert.Equal(t, http.StatusOK, transfer(t, delegate, ownerAccount, delegateAccount, "10.00"))
+    assert.Equal(t, "90.00", getBalance(t, ownerAccount))
+}
+
+func TestEmailVerificationToken(t *testing.T) {
+    for _, token := range []string{"", "garbage", "bm90LWEtdXVpZDoxNzAwMDAwMDAw.deadbeef"} {
+        status := doJSON(t, "GET", "", "/email/verify?token="+token, nil, nil)
+        assert.Equal(t, http.StatusBadRequest, status, "token %q", token)
+    }
+}
+
+func TestPasswordReset(t *testing.T) {
+    email, _ := registerUnverified(t)
+
+    // Ответ одинаков для известного и неизвестного адреса
+    status := doJSON(t, "POST", "", "/password/forgot", map[string]string{"email": email}, nil)
+    assert.Equal(t, http.StatusAccepted, status)
+    status = doJSON(t, "POST", "", "/password/forgot", map[string]string{"email": "nobody@example.com"}, nil)
+    assert.Equal(t, http.StatusAccepted, status)
+
+    status = doJSON(t, "POST", "", "/password/reset", map[string]string{
+        "token":    "garbage",
+        "password": "N3w!Password",
+    }, nil)
+    assert.Equal(t, http.StatusBadRequest, status)
+
+    status = doJSON(t, "POST", "", "/password/reset", map[string]string{
+        "token":    "garbage",
+        "password": "weak",
+    }, nil)
+    assert.Equal(t, http.StatusUnprocessableEntity, status)
+}
@@ -0,0 +1,64 @@
+package integration_tests
+
+import (
+    "net/http"
+    "testing"
+    "github.com/stretchr/testify/assert"
+)
+
+func createAccountInCurrency(t *testing.T, token, currency string) string {
+    var account struct {
+        ID string `json:"id"`
+    }
+    status := doJSON(t, "POST", token, "/accounts", map[string]string{"currency": currency}, &account)
+    assert.Equal(t, http.StatusOK, status)
+    return account.ID
+}
+
+// Перевод между рублевым и долларовым счетами конвертируется по курсу ЦБ
+func TestCrossCurrencyTransfer(t *testing.T) {
+    token := authenticateUser(t)
+
+    rubAccount := createAccountInCurrency(t, token, "RUB")
+    usdAccount := createAccountInCurrency(t, token, "USD")
+    setBalance(t, rubAccount, "10000.00")
+
+    status := transfer(t, token, rubAccount, usdAccount, "5000.00")
+    if status == http.StatusServiceUnavailable {
+        t.Skip("CBR exchange rates are unavailable")
+    }
+    assert.Equal(t, http.StatusOK, status)
+    assert.Equal(t, "5000.00", getBalance(t, rubAccount))
+    assert.NotEqual(t, "0.00", getBalance(t, usdAccount))
+
+    var page struct {
+        Transactions []struct {
+            Amount            string `json:"amount"`
+            Currency          string `json:"currency"`
+            ExchangeRate      string `json:"exchange_rate"`
+            ConvertedAmount   string `json:"converted_amount"`
+            ConvertedCurrency string `json:"converted_currency"`
+        } `json:"transactions"`
+    }
+    doJSON(t, "GET", token, "/accounts/"+usdAccount+"/transactions", nil, &page)
+    if assert.Len(t, page.Transactions, 1) {
+        tx := page.Transactions[0]
+        assert.Equal(t, "5000.00", tx.Amount)
+        assert.Equal(t, "RUB", tx.Currency)
+        assert.NotEmpty(t, tx.ExchangeRate)
+        assert.Equal(t, getBalance(t, usdAccount), tx.ConvertedAmount)
+        assert.Equal(t, "USD", tx.ConvertedCurrency)
+    }
+
+    // Проводки сбалансированы в каждой валюте
+    var unbalanced int
+    err := testDB.QueryRow(
+        `SELECT COUNT(*) FROM (
+            SELECT entry_id, currency FROM postings
+            GROUP BY entry_id, currency
+            HAVING SUM(CASE WHEN direction = 'credit' THEN amount ELSE -amount END) <> 0
+         ) u`,
+    ).Scan(&unbalanced)
+    assert.NoError(t, err)
+    assert.Equal(t, 0, unbalanced)
+}
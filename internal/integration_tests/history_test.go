@@ -0,0 +1,141 @@
+package integration_tests
+
+import (
+    "net/http"
+    "testing"
+    "time"
+    "github.com/stretchr/testify/assert"
+)
+
+type transactionPage struct {
+    Transactions []struct {
+        ID     string `json:"id"`
+        Amount string `json:"amount"`
+        Type   string `json:"type"`
+    } `json:"transactions"`
+    NextCursor string `json:"next_cursor"`
+}
+
+func TestTransactionHistoryPagination(t *testing.T) {
+    token := authenticateUser(t)
+
+    fromAccount := createAccount(t, token)
+    toAccount := createAccount(t, token)
+    setBalance(t, fromAccount, "100.00")
+
+    for _, amount := range []string{"1.00", "2.00", "3.00"} {
+        assert.Equal(t, http.StatusOK, transfer(t, token, fromAccount, toAccount, amount))
+    }
+
+    var first transactionPage
+    status := doJSON(t, "GET", token, "/accounts/"+fromAccount+"/transactions?limit=2", nil, &first)
+    assert.Equal(t, http.StatusOK, status)
+    assert.Len(t, first.Transactions, 2)
+    assert.NotEmpty(t, first.NextCursor)
+    assert.Equal(t, "3.00", first.Transactions[0].Amount)
+
+    var second transactionPage
+    status = doJSON(t, "GET", token, "/accounts/"+fromAccount+"/transactions?limit=2&cursor="+first.NextCursor, nil, &second)
+    assert.Equal(t, http.StatusOK, status)
+    assert.Len(t, second.Transactions, 1)
+    assert.Empty(t, second.NextCursor)
+    assert.Equal(t, "1.00", second.Transactions[0].Amount)
+}
+
+func TestTransactionHistoryFilters(t *testing.T) {
+    token := authenticateUser(t)
+
+    fromAccount := createAccount(t, token)
+    toAccount := createAccount(t, token)
+    setBalance(t, fromAccount, "100.00")
+
+    for _, amount := range []string{"5.00", "15.00", "25.00"} {
+        assert.Equal(t, http.StatusOK, transfer(t, token, fromAccount, toAccount, amount))
+    }
+
+    var page transactionPage
+    status := doJSON(t, "GET", token,
+        "/accounts/"+toAccount+"/transactions?type=transfer&min_amount=10&max_amount=20&sort=amount", nil, &page)
+    assert.Equal(t, http.StatusOK, status)
+    if assert.Len(t, page.Transactions, 1) {
+        assert.Equal(t, "15.00", page.Transactions[0].Amount)
+        assert.Equal(t, "transfer", page.Transactions[0].Type)
+    }
+
+    status = doJSON(t, "GET", token, "/accounts/"+toAccount+"/transactions?type=unknown", nil, nil)
+    assert.Equal(t, http.StatusBadRequest, status)
+}
+
+func TestTransactionHistoryRequiresOwnership(t *testing.T) {
+    owner := authenticateUser(t)
+    stranger := authenticateUser(t)
+
+    account := createAccount(t, owner)
+
+    status := doJSON(t, "GET", stranger, "/accounts/"+account+"/transactions", nil, nil)
+    assert.Equal(t, http.StatusForbidden, status)
+}
+
+// Выдача и погашение кредита попадают в историю и фильтруются по своему типу
+func TestTransactionHistoryLoanTypes(t *testing.T) {
+    token := authenticateUser(t)
+    account := createAccount(t, token)
+
+    loan := applyForLoan(t, token, map[string]interface{}{
+        "product":     "consumer",
+        "account_id":  account,
+        "amount":      "120000.00",
+        "term_months": 12,
+    })
+    status := doJSON(t, "POST", token, "/loans/"+loan.ID+"/repay", map[string]string{"amount": "1000.00"}, nil)
+    assert.Equal(t, http.StatusOK, status)
+
+    for _, tc := range []struct {
+        txType string
+        amount string
+    }{
+        {"loan_disbursement", "120000.00"},
+        {"loan_repayment", "1000.00"},
+    } {
+        var page transactionPage
+        status := doJSON(t, "GET", token, "/accounts/"+account+"/transactions?type="+tc.txType, nil, &page)
+        assert.Equal(t, http.StatusOK, status, tc.txType)
+        if assert.Len(t, page.Transactions, 1, tc.txType) {
+            assert.Equal(t, tc.txType, page.Transactions[0].Type)
+            assert.Equal(t, tc.amount, page.Transactions[0].Amount)
+        }
+    }
+}
+
+// Капитализированные проценты по вкладу фильтруются по типу interest
+func TestTransactionHistoryInterestType(t *testing.T) {
+    token := authenticateUser(t)
+    current := createAccount(t, token)
+    setBalance(t, current, "150000.00")
+
+    var deposit depositResponse
+    status := doJSON(t, "POST", token, "/deposits", map[string]string{
+        "product":      "term_12m",
+        "from_account": current,
+        "amount":       "100000.00",
+    }, &deposit)
+    assert.Equal(t, http.StatusOK, status)
+    // Сорок дней захватывают хотя бы одну капитализацию в конце месяца
+    backdateDeposit(t, deposit, 40)
+
+    var page transactionPage
+    deadline := time.Now().Add(30 * time.Second)
+    for time.Now().Before(deadline) {
+        status = doJSON(t, "GET", token, "/accounts/"+deposit.AccountID+"/transactions?type=interest", nil, &page)
+        if status != http.StatusOK || len(page.Transactions) > 0 {
+            break
+        }
+        time.Sleep(500 * time.Millisecond)
+    }
+    assert.Equal(t, http.StatusOK, status)
+    if assert.NotEmpty(t, page.Transactions) {
+        for _, tx := range page.Transactions {
+            assert.Equal(t, "interest", tx.Type)
+        }
+    }
+}
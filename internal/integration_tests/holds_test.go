@@ -0,0 +1,151 @@
+package integration_tests
+
+import (
+    "net/http"
+    "testing"
+    "time"
+    "github.com/stretchr/testify/assert"
+)
+
+type holdResponse struct {
+    ID     string `json:"id"`
+    Amount string `json:"amount"`
+    Reason string `json:"reason"`
+    Source string `json:"source"`
+    Status string `json:"status"`
+}
+
+type accountBalances struct {
+    Balance          string `json:"balance"`
+    AvailableBalance string `json:"available_balance"`
+}
+
+func getAccountBalances(t *testing.T, token, accountID string) accountBalances {
+    var account accountBalances
+    status := doJSON(t, "GET", token, "/accounts/"+accountID, nil, &account)
+    assert.Equal(t, http.StatusOK, status)
+    return account
+}
+
+func TestAccountHolds(t *testing.T) {
+    token := authenticateUser(t)
+    accountID := createAccount(t, token)
+    setBalance(t, accountID, "1000.00")
+    setAccountLimit(t, accountID, "overdraft", "0")
+
+    var hold holdResponse
+    status := doJSON(t, "POST", token, "/accounts/"+accountID+"/holds", map[string]string{
+        "amount": "300.00",
+        "reason": "Rent reserve",
+    }, &hold)
+    assert.Equal(t, http.StatusOK, status)
+    assert.Equal(t, "active", hold.Status)
+    assert.Equal(t, "manual", hold.Source)
+
+    // Удержание уменьшает доступный остаток, но не баланс
+    balances := getAccountBalances(t, token, accountID)
+    assert.Equal(t, "1000.00", balances.Balance)
+    assert.Equal(t, "700.00", balances.AvailableBalance)
+
+    status = doJSON(t, "POST", token, "/accounts/"+accountID+"/withdraw", map[string]string{"amount": "800.00"}, nil)
+    assert.Equal(t, http.StatusBadRequest, status)
+    status = doJSON(t, "POST", token, "/accounts/"+accountID+"/holds", map[string]string{
+        "amount": "800.00",
+        "reason": "Too much",
+    }, nil)
+    assert.Equal(t, http.StatusBadRequest, status)
+
+    var limits struct {
+        Available string `json:"available"`
+    }
+    doJSON(t, "GET", token, "/accounts/"+accountID+"/limits", nil, &limits)
+    assert.Equal(t, "700.00", limits.Available)
+
+    status = doJSON(t, "DELETE", token, "/accounts/"+accountID+"/holds/"+hold.ID, nil, &hold)
+    assert.Equal(t, http.StatusOK, status)
+    assert.Equal(t, "released", hold.Status)
+    assert.Equal(t, "1000.00", getAccountBalances(t, token, accountID).AvailableBalance)
+
+    status = doJSON(t, "DELETE", token, "/accounts/"+accountID+"/holds/"+hold.ID, nil, nil)
+    assert.Equal(t, http.StatusConflict, status)
+
+    status = doJSON(t, "POST", token, "/accounts/"+accountID+"/withdraw", map[string]string{"amount": "800.00"}, nil)
+    assert.Equal(t, http.StatusOK, status)
+
+    var holds []holdResponse
+    status = doJSON(t, "GET", token, "/accounts/"+accountID+"/holds", nil, &holds)
+    assert.Equal(t, http.StatusOK, status)
+    assert.Len(t, holds, 1)
+}
+
+func TestHoldValidation(t *testing.T) {
+    token := authenticateUser(t)
+    accountID := createAccount(t, token)
+    setBalance(t, accountID, "100.00")
+
+    body := map[string]interface{}{"amount": "10.00", "reason": "Past", "expires_at": time.Now().Add(-time.Hour).Format(time.RFC3339)}
+    status := doJSON(t, "POST", token, "/accounts/"+accountID+"/holds", body, nil)
+    assert.Equal(t, http.StatusBadRequest, status)
+
+    var invalid validationErrorResponse
+    status = doJSON(t, "POST", token, "/accounts/"+accountID+"/holds", map[string]string{"amount": "0"}, &invalid)
+    assert.Equal(t, http.StatusUnprocessableEntity, status)
+    assert.Equal(t, map[string]string{"amount": "not_positive", "reason": "required"}, invalid.codes())
+
+    otherToken := authenticateUser(t)
+    status = doJSON(t, "GET", otherToken, "/accounts/"+accountID+"/holds", nil, nil)
+    assert.Equal(t, http.StatusForbidden, status)
+}
+
+func TestCloseAccountWithHold(t *testing.T) {
+    token := authenticateUser(t)
+    accountID := createAccount(t, token)
+
+    setBalance(t, accountID, "50.00")
+    var hold holdResponse
+    status := doJSON(t, "POST", token, "/accounts/"+accountID+"/holds", map[string]string{
+        "amount": "50.00",
+        "reason": "Dispute",
+    }, &hold)
+    assert.Equal(t, http.StatusOK, status)
+    setBalance(t, accountID, "0.00")
+
+    status = doJSON(t, "POST", token, "/accounts/"+accountID+"/close", nil, nil)
+    assert.Equal(t, http.StatusConflict, status)
+
+    doJSON(t, "DELETE", token, "/accounts/"+accountID+"/holds/"+hold.ID, nil, nil)
+    status = doJSON(t, "POST", token, "/accounts/"+accountID+"/close", nil, nil)
+    assert.Equal(t, http.StatusOK, status)
+}
+
+func TestCardAuthorizationHold(t *testing.T) {
+    token := authenticateUser(t)
+    card := fundedCard(t, token, "500.00")
+
+    var auth authorizationResponse
+    assert.Equal(t, http.StatusOK, authorizeCard(t, card, "120.00", &auth))
+
+    balances := getAccountBalances(t, token, card.AccountID)
+    assert.Equal(t, "500.00", balances.Balance)
+    assert.Equal(t, "380.00", balances.AvailableBalance)
+
+    var holds []holdResponse
+    doJSON(t, "GET", token, "/accounts/"+card.AccountID+"/holds", nil, &holds)
+    if assert.Len(t, holds, 1) {
+        assert.Equal(t, "card_authorization", holds[0].Source)
+        assert.Equal(t, "120.00", holds[0].Amount)
+
+        // Удержание карточной авторизации снимает только мерчант
+        status := doJSON(t, "DELETE", token, "/accounts/"+card.AccountID+"/holds/"+holds[0].ID, nil, nil)
+        assert.Equal(t, http.StatusConflict, status)
+    }
+
+    status := doJSON(t, "POST", token, "/accounts/"+card.AccountID+"/withdraw", map[string]string{"amount": "400.00"}, nil)
+    assert.Equal(t, http.StatusBadRequest, status)
+
+    status = merchantRequest(t, "POST", "/merchant/authorizations/"+auth.ID+"/capture", map[string]string{"amount": "100.00"}, nil)
+    assert.Equal(t, http.StatusOK, status)
+    balances = getAccountBalances(t, token, card.AccountID)
+    assert.Equal(t, "400.00", balances.Balance)
+    assert.Equal(t, "400.00", balances.AvailableBalance)
+}
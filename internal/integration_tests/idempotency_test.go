@@ -0,0 +1,201 @@
+package integration_tests
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/http"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+    "github.com/stretchr/testify/assert"
+)
+
+// Отправляет POST-запрос с ключом идемпотентности
+func postIdempotent(t *testing.T, token, path, key string, body interface{}) (*http.Response, []byte) {
+    payload, _ := json.Marshal(body)
+    req, _ := http.NewRequest("POST", "http://localhost:8080"+path, bytes.NewBuffer(payload))
+    req.Header.Set("Authorization", "Bearer "+token)
+    req.Header.Set("Content-Type", "application/json")
+    req.Header.Set("Idempotency-Key", key)
+
+    resp, err := http.DefaultClient.Do(req)
+    if !assert.NoError(t, err) {
+        return nil, nil
+    }
+    defer resp.Body.Close()
+
+    var buf bytes.Buffer
+    buf.ReadFrom(resp.Body)
+    return resp, buf.Bytes()
+}
+
+func TestIdempotentTransferReplay(t *testing.T) {
+    token := authenticateUser(t)
+
+    fromAccount := createAccount(t, token)
+    toAccount := createAccount(t, token)
+    setBalance(t, fromAccount, "100.00")
+
+    key := fmt.Sprintf("transfer-%d", time.Now().UnixNano())
+    body := map[string]interface{}{"from_account": fromAccount, "to_account": toAccount, "amount": "10.00"}
+
+    first, firstBody := postIdempotent(t, token, "/transfer", key, body)
+    second, secondBody := postIdempotent(t, token, "/transfer", key, body)
+
+    assert.Equal(t, http.StatusOK, first.StatusCode)
+    assert.Equal(t, first.StatusCode, second.StatusCode)
+    assert.Equal(t, firstBody, secondBody)
+    assert.Equal(t, "true", second.Header.Get("Idempotent-Replayed"))
+    assert.Equal(t, "90.00", getBalance(t, fromAccount))
+}
+
+func TestIdempotencyKeyRejectsDifferentBody(t *testing.T) {
+    token := authenticateUser(t)
+
+    fromAccount := createAccount(t, token)
+    toAccount := createAccount(t, token)
+    setBalance(t, fromAccount, "100.00")
+
+    key := fmt.Sprintf("mismatch-%d", time.Now().UnixNano())
+    first, _ := postIdempotent(t, token, "/transfer", key,
+        map[string]interface{}{"from_account": fromAccount, "to_account": toAccount, "amount": "10.00"})
+    second, _ := postIdempotent(t, token, "/transfer", key,
+        map[string]interface{}{"from_account": fromAccount, "to_account": toAccount, "amount": "20.00"})
+
+    assert.Equal(t, http.StatusOK, first.StatusCode)
+    assert.Equal(t, http.StatusUnprocessableEntity, second.StatusCode)
+    assert.Equal(t, "90.00", getBalance(t, fromAccount))
+}
+
+func TestIdempotentConcurrentDuplicates(t *testing.T) {
+    token := authenticateUser(t)
+
+    fromAccount := createAccount(t, token)
+    toAccount := createAccount(t, token)
+    setBalance(t, fromAccount, "100.00")
+
+    key := fmt.Sprintf("concurrent-%d", time.Now().UnixNano())
+    body := map[string]interface{}{"from_account": fromAccount, "to_account": toAccount, "amount": "10.00"}
+
+    var wg sync.WaitGroup
+    for i := 0; i < 20; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            resp, _ := postIdempotent(t, token, "/transfer", key, body)
+            if resp != nil {
+                assert.Contains(t, []int{http.StatusOK, http.StatusConflict}, resp.StatusCode)
+            }
+        }()
+    }
+    wg.Wait()
+
+    assert.Equal(t, "90.00", getBalance(t, fromAccount))
+    assert.Equal(t, "10.00", getBalance(t, toAccount))
+}
+
+func TestIdempotentAccountCreation(t *testing.T) {
+    token := authenticateUser(t)
+
+    key := fmt.Sprintf("account-%d", time.Now().UnixNano())
+    _, firstBody := postIdempotent(t, token, "/accounts", key, nil)
+    _, secondBody := postIdempotent(t, token, "/accounts", key, nil)
+
+    var first, second struct {
+        ID string `json:"id"`
+    }
+    json.Unmarshal(firstBody, &first)
+    json.Unmarshal(secondBody, &second)
+
+    assert.NotEmpty(t, first.ID)
+    assert.Equal(t, first.ID, second.ID)
+}
+
+// Повтор загрузки отклоненного пакета all_or_nothing возвращает исходный отчет,
+// а не исполняет пакет заново, даже если средств стало достаточно
+func TestIdempotentBulkPaymentReplay(t *testing.T) {
+    token := authenticateUser(t)
+    debtor := createAccount(t, token)
+    creditor := createAccount(t, token)
+    setBalance(t, debtor, "100.00")
+
+    file := pain001(fmt.Sprintf("IDEM-%d", time.Now().UnixNano()), debtor, "180.00",
+        bulkTransfer{"E2E-1", "30.00", creditor},
+        bulkTransfer{"E2E-2", "150.00", creditor},
+    )
+    key := fmt.Sprintf("bulk-%d", time.Now().UnixNano())
+    upload := func() (*http.Response, []byte) {
+        req, _ := http.NewRequest("POST", "http://localhost:8080/payments/bulk?mode=all_or_nothing", strings.NewReader(file))
+        req.Header.Set("Authorization", "Bearer "+token)
+        req.Header.Set("Content-Type", "application/xml")
+        req.Header.Set("Idempotency-Key", key)
+
+        resp, err := http.DefaultClient.Do(req)
+        if !assert.NoError(t, err) {
+            return nil, nil
+        }
+        defer resp.Body.Close()
+        body, _ := io.ReadAll(resp.Body)
+        return resp, body
+    }
+
+    first, firstBody := upload()
+    if !assert.NotNil(t, first) {
+        return
+    }
+    assert.Equal(t, http.StatusOK, first.StatusCode)
+    assert.Contains(t, string(firstBody), "<GrpSts>RJCT</GrpSts>")
+
+    setBalance(t, debtor, "500.00")
+
+    second, secondBody := upload()
+    if !assert.NotNil(t, second) {
+        return
+    }
+    assert.Equal(t, first.StatusCode, second.StatusCode)
+    assert.Equal(t, "true", second.Header.Get("Idempotent-Replayed"))
+    assert.True(t, strings.HasPrefix(second.Header.Get("Content-Type"), "application/xml"))
+    assert.Equal(t, firstBody, secondBody)
+    assert.Equal(t, "500.00", getBalance(t, debtor))
+    assert.Equal(t, "0.00", getBalance(t, creditor))
+}
+
+// Ключ, запрос по которому не сохранил ответ (процесс упал), остается занятым
+// только до конца аренды, а не весь срок хранения
+func TestIdempotencyKeyAbandonedInProgress(t *testing.T) {
+    token := authenticateUser(t)
+
+    fromAccount := createAccount(t, token)
+    toAccount := createAccount(t, token)
+    setBalance(t, fromAccount, "100.00")
+
+    key := fmt.Sprintf("abandoned-%d", time.Now().UnixNano())
+    body := map[string]interface{}{"from_account": fromAccount, "to_account": toAccount, "amount": "10.00"}
+
+    _, err := testDB.Exec(`
+        INSERT INTO idempotency_keys (user_id, key, request_hash, expires_at, locked_until)
+        VALUES ($1, $2, 'abandoned', CURRENT_TIMESTAMP + INTERVAL '1 day', CURRENT_TIMESTAMP + INTERVAL '1 hour')`,
+        userIDFromToken(t, token), key,
+    )
+    assert.NoError(t, err)
+
+    resp, _ := postIdempotent(t, token, "/transfer", key, body)
+    assert.Equal(t, http.StatusConflict, resp.StatusCode)
+    assert.Equal(t, "100.00", getBalance(t, fromAccount))
+
+    _, err = testDB.Exec(
+        "UPDATE idempotency_keys SET locked_until = CURRENT_TIMESTAMP - INTERVAL '1 second' WHERE key = $1", key,
+    )
+    assert.NoError(t, err)
+
+    first, firstBody := postIdempotent(t, token, "/transfer", key, body)
+    second, secondBody := postIdempotent(t, token, "/transfer", key, body)
+    assert.Equal(t, http.StatusOK, first.StatusCode)
+    assert.Equal(t, http.StatusOK, second.StatusCode)
+    assert.Equal(t, firstBody, secondBody)
+    assert.Equal(t, "true", second.Header.Get("Idempotent-Replayed"))
+    assert.Equal(t, "90.00", getBalance(t, fromAccount))
+}
@@ -0,0 +1,52 @@
+package integration_tests
+
+import (
+    "net/http"
+    "testing"
+    "github.com/stretchr/testify/assert"
+)
+
+// Каждый перевод оформляется сбалансированной записью журнала,
+// а кэшированные балансы совпадают с суммой проводок
+func TestTransferCreatesBalancedJournalEntry(t *testing.T) {
+    token := authenticateUser(t)
+
+    fromAccount := createAccount(t, token)
+    toAccount := createAccount(t, token)
+    setBalance(t, fromAccount, "250.00")
+
+    assert.Equal(t, http.StatusOK, transfer(t, token, fromAccount, toAccount, "75.25"))
+
+    var entryType string
+    var debits, credits string
+    err := testDB.QueryRow(
+        `SELECT e.type,
+                SUM(p.amount) FILTER (WHERE p.direction = 'debit')::text,
+                SUM(p.amount) FILTER (WHERE p.direction = 'credit')::text
+         FROM journal_entries e JOIN postings p ON p.entry_id = e.id
+         WHERE e.id = (SELECT entry_id FROM postings WHERE account_id = $1 ORDER BY created_at DESC LIMIT 1)
+         GROUP BY e.id`,
+        toAccount,
+    ).Scan(&entryType, &debits, &credits)
+    assert.NoError(t, err)
+    assert.Equal(t, "transfer", entryType)
+    assert.Equal(t, "75.25", debits)
+    assert.Equal(t, debits, credits)
+
+    for _, account := range []string{fromAccount, toAccount} {
+        assert.Equal(t, getBalance(t, account), getLedgerBalance(t, account))
+    }
+}
+
+func TestLedgerHasNoBalanceMismatches(t *testing.T) {
+    var mismatches int
+    err := testDB.QueryRow(
+        `SELECT COUNT(*) FROM (
+            SELECT a.id FROM accounts a LEFT JOIN postings p ON p.account_id = a.id
+            GROUP BY a.id
+            HAVING a.balance <> COALESCE(SUM(CASE WHEN p.direction = 'credit' THEN p.amount ELSE -p.amount END), 0)
+         ) m`,
+    ).Scan(&mismatches)
+    assert.NoError(t, err)
+    assert.Equal(t, 0, mismatches)
+}
@@ -0,0 +1,170 @@
+package integration_tests
+
+import (
+    "net/http"
+    "testing"
+    "github.com/stretchr/testify/assert"
+)
+
+type limitErrorResponse struct {
+    Error     string `json:"error"`
+    Limit     string `json:"limit"`
+    Amount    string `json:"amount"`
+    Remaining string `json:"remaining"`
+}
+
+func transferBody(from, to, amount string) map[string]string {
+    return map[string]string{
+        "from_account": from,
+        "to_account":   to,
+        "amount":       amount,
+    }
+}
+
+// Текущий счет можно увести в минус не дальше лимита овердрафта
+func TestOverdraftFloor(t *testing.T) {
+    token := authenticateUser(t)
+
+    fromAccount := createAccount(t, token)
+    toAccount := createAccount(t, token)
+    setBalance(t, fromAccount, "100.00")
+
+    assert.Equal(t, http.StatusOK, transfer(t, token, fromAccount, toAccount, "50100.00"))
+    assert.Equal(t, "-50000.00", getBalance(t, fromAccount))
+
+    var body limitErrorResponse
+    status := doJSON(t, "POST", token, "/transfer", transferBody(fromAccount, toAccount, "0.01"), &body)
+    assert.Equal(t, http.StatusBadRequest, status)
+    assert.Equal(t, "overdraft", body.Limit)
+    assert.Equal(t, "50000.00", body.Amount)
+    assert.Equal(t, "0.00", body.Remaining)
+    assert.Equal(t, "-50000.00", getBalance(t, fromAccount))
+}
+
+func TestSavingsAccountHasNoOverdraft(t *testing.T) {
+    token := authenticateUser(t)
+
+    var savings accountResponse
+    status := doJSON(t, "POST", token, "/accounts", map[string]string{"product_type": "savings"}, &savings)
+    assert.Equal(t, http.StatusOK, status)
+    setBalance(t, savings.ID, "10.00")
+
+    var body limitErrorResponse
+    status = doJSON(t, "POST", token, "/accounts/"+savings.ID+"/withdraw", map[string]string{"amount": "10.01"}, &body)
+    assert.Equal(t, http.StatusBadRequest, status)
+    assert.Equal(t, "overdraft", body.Limit)
+    assert.Equal(t, "10.00", body.Remaining)
+}
+
+func TestMaxTransferLimit(t *testing.T) {
+    token := authenticateUser(t)
+
+    fromAccount := createAccount(t, token)
+    toAccount := createAccount(t, token)
+    setBalance(t, fromAccount, "2000000.00")
+
+    var body limitErrorResponse
+    status := doJSON(t, "POST", token, "/transfer", transferBody(fromAccount, toAccount, "1000000.01"), &body)
+    assert.Equal(t, http.StatusUnprocessableEntity, status)
+    assert.Equal(t, "max_transfer", body.Limit)
+    assert.Equal(t, "1000000.00", body.Remaining)
+
+    assert.Equal(t, http.StatusOK, transfer(t, token, fromAccount, toAccount, "1000000.00"))
+
+    // Индивидуальный лимит счета имеет приоритет над значением по умолчанию
+    setAccountLimit(t, fromAccount, "max_transfer", "100.00")
+    status = doJSON(t, "POST", token, "/accounts/"+fromAccount+"/withdraw", map[string]string{"amount": "100.01"}, &body)
+    assert.Equal(t, http.StatusUnprocessableEntity, status)
+    assert.Equal(t, "100.00", body.Remaining)
+}
+
+// Рублевые лимиты не переносятся на валютные счета: для каждой валюты свои значения
+func TestDefaultLimitsPerCurrency(t *testing.T) {
+    token := authenticateUser(t)
+
+    fromAccount := createAccountInCurrency(t, token, "USD")
+    toAccount := createAccountInCurrency(t, token, "USD")
+    setBalance(t, fromAccount, "20000.00")
+
+    var limits struct {
+        MaxTransfer string `json:"max_transfer"`
+        Overdraft   string `json:"overdraft"`
+    }
+    status := doJSON(t, "GET", token, "/accounts/"+fromAccount+"/limits", nil, &limits)
+    assert.Equal(t, http.StatusOK, status)
+    assert.Equal(t, "12000.00", limits.MaxTransfer)
+    assert.Equal(t, "600.00", limits.Overdraft)
+
+    var body limitErrorResponse
+    status = doJSON(t, "POST", token, "/transfer", transferBody(fromAccount, toAccount, "12000.01"), &body)
+    assert.Equal(t, http.StatusUnprocessableEntity, status)
+    assert.Equal(t, "max_transfer", body.Limit)
+    assert.Equal(t, "12000.00", body.Remaining)
+}
+
+// Дневной лимит считается по всем счетам пользователя, кроме переводов между своими счетами
+func TestDailyOutgoingLimit(t *testing.T) {
+    sender := authenticateUser(t)
+    recipient := authenticateUser(t)
+
+    first := createAccount(t, sender)
+    second := createAccount(t, sender)
+    foreign := createAccount(t, recipient)
+    setBalance(t, first, "1000.00")
+    setBalance(t, second, "1000.00")
+    setAccountLimit(t, first, "daily_outgoing", "500.00")
+    setAccountLimit(t, second, "daily_outgoing", "500.00")
+
+    assert.Equal(t, http.StatusOK, transfer(t, sender, first, second, "700.00"))
+    assert.Equal(t, http.StatusOK, transfer(t, sender, first, foreign, "300.00"))
+    assert.Equal(t, http.StatusOK, transfer(t, sender, second, foreign, "150.00"))
+
+    var body limitErrorResponse
+    status := doJSON(t, "POST", sender, "/transfer", transferBody(second, foreign, "50.01"), &body)
+    assert.Equal(t, http.StatusUnprocessableEntity, status)
+    assert.Equal(t, "daily_outgoing", body.Limit)
+    assert.Equal(t, "500.00", body.Amount)
+    assert.Equal(t, "50.00", body.Remaining)
+
+    var limits struct {
+        MaxTransfer    string `json:"max_transfer"`
+        Overdraft      string `json:"overdraft"`
+        DailyOutgoing  string `json:"daily_outgoing"`
+        Available      string `json:"available"`
+        DailyRemaining string `json:"daily_remaining"`
+    }
+    status = doJSON(t, "GET", sender, "/accounts/"+second+"/limits", nil, &limits)
+    assert.Equal(t, http.StatusOK, status)
+    assert.Equal(t, "1000000.00", limits.MaxTransfer)
+    assert.Equal(t, "50000.00", limits.Overdraft)
+    assert.Equal(t, "500.00", limits.DailyOutgoing)
+    assert.Equal(t, "51550.00", limits.Available)
+    assert.Equal(t, "50.00", limits.DailyRemaining)
+}
+
+// Удержание под карточную авторизацию расходует дневной лимит сразу,
+// а списание по ней не учитывается повторно
+func TestDailyOutgoingLimitCountsCardHolds(t *testing.T) {
+    token := authenticateUser(t)
+    card := fundedCard(t, token, "1000.00")
+    setAccountLimit(t, card.AccountID, "daily_outgoing", "500.00")
+
+    var first authorizationResponse
+    assert.Equal(t, http.StatusOK, authorizeCard(t, card, "300.00", &first))
+    assert.Equal(t, "authorized", first.Status)
+
+    var second authorizationResponse
+    assert.Equal(t, http.StatusPaymentRequired, authorizeCard(t, card, "300.00", &second))
+    assert.Equal(t, "limit_exceeded", second.Reason)
+
+    var limits struct {
+        DailyRemaining string `json:"daily_remaining"`
+    }
+    assert.Equal(t, http.StatusOK, doJSON(t, "GET", token, "/accounts/"+card.AccountID+"/limits", nil, &limits))
+    assert.Equal(t, "200.00", limits.DailyRemaining)
+
+    status := merchantRequest(t, "POST", "/merchant/authorizations/"+first.ID+"/capture", map[string]string{"amount": "300.00"}, nil)
+    assert.Equal(t, http.StatusOK, status)
+    assert.Equal(t, http.StatusOK, doJSON(t, "GET", token, "/accounts/"+card.AccountID+"/limits", nil, &limits))
+    assert.Equal(t, "200.00", limits.DailyRemaining)
+}
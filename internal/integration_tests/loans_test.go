@@ -0,0 +1,177 @@
+package integration_tests
+
+import (
+    "net/http"
+    "testing"
+    "time"
+    "github.com/stretchr/testify/assert"
+)
+
+type loanInstallmentResponse struct {
+    Number    int       `json:"number"`
+    DueDate   time.Time `json:"due_date"`
+    Principal string    `json:"principal"`
+    Interest  string    `json:"interest"`
+    Penalty   string    `json:"penalty"`
+    Status    string    `json:"status"`
+}
+
+type loanResponse struct {
+    ID           string                    `json:"id"`
+    Principal    string                    `json:"principal"`
+    Outstanding  string                    `json:"outstanding"`
+    KeyRate      string                    `json:"key_rate"`
+    AnnualRate   string                    `json:"annual_rate"`
+    ScheduleType string                    `json:"schedule_type"`
+    Status       string                    `json:"status"`
+    Installments []loanInstallmentResponse `json:"installments"`
+}
+
+// Оформляет кредит; пропускает тест, если ключевая ставка ЦБ недоступна
+func applyForLoan(t *testing.T, token string, body map[string]interface{}) loanResponse {
+    var loan loanResponse
+    status := doJSON(t, "POST", token, "/loans", body, &loan)
+    if status == http.StatusServiceUnavailable {
+        t.Skip("CBR key rate is unavailable")
+    }
+    assert.Equal(t, http.StatusOK, status)
+    return loan
+}
+
+func TestListLoanProducts(t *testing.T) {
+    token := authenticateUser(t)
+
+    var products []struct {
+        Code          string `json:"code"`
+        MinTermMonths int    `json:"min_term_months"`
+        MaxTermMonths int    `json:"max_term_months"`
+    }
+    assert.Equal(t, http.StatusOK, doJSON(t, "GET", token, "/loan-products", nil, &products))
+    assert.NotEmpty(t, products)
+}
+
+func TestLoanApplicationValidation(t *testing.T) {
+    token := authenticateUser(t)
+    stranger := authenticateUser(t)
+    account := createAccount(t, token)
+
+    cases := []map[string]interface{}{
+        {"product": "mortgage", "account_id": account, "amount": "100000.00", "term_months": 12},
+        // Сумма меньше минимальной
+        {"product": "consumer", "account_id": account, "amount": "100.00", "term_months": 12},
+        // Срок больше максимального
+        {"product": "express", "account_id": account, "amount": "10000.00", "term_months": 36},
+        {"product": "consumer", "account_id": account, "amount": "100000.00", "term_months": 12, "schedule_type": "balloon"},
+    }
+    for _, body := range cases {
+        assert.Equal(t, http.StatusBadRequest, doJSON(t, "POST", token, "/loans", body, nil), "body %v", body)
+    }
+
+    status := doJSON(t, "POST", stranger, "/loans", map[string]interface{}{
+        "product": "consumer", "account_id": account, "amount": "100000.00", "term_months": 12,
+    }, nil)
+    assert.Equal(t, http.StatusForbidden, status)
+}
+
+func TestLoanDisbursement(t *testing.T) {
+    token := authenticateUser(t)
+    stranger := authenticateUser(t)
+    account := createAccount(t, token)
+
+    loan := applyForLoan(t, token, map[string]interface{}{
+        "product":     "consumer",
+        "account_id":  account,
+        "amount":      "120000.00",
+        "term_months": 12,
+    })
+    assert.Equal(t, "active", loan.Status)
+    assert.Equal(t, "annuity", loan.ScheduleType)
+    assert.Equal(t, "120000.00", loan.Outstanding)
+    assert.NotEmpty(t, loan.KeyRate)
+    assert.Len(t, loan.Installments, 12)
+    assert.Equal(t, "120000.00", getBalance(t, account))
+    assert.Equal(t, getBalance(t, account), getLedgerBalance(t, account))
+
+    var got loanResponse
+    assert.Equal(t, http.StatusOK, doJSON(t, "GET", token, "/loans/"+loan.ID, nil, &got))
+    assert.Len(t, got.Installments, 12)
+    assert.Equal(t, http.StatusForbidden, doJSON(t, "GET", stranger, "/loans/"+loan.ID, nil, nil))
+
+    var loans []loanResponse
+    assert.Equal(t, http.StatusOK, doJSON(t, "GET", token, "/loans", nil, &loans))
+    assert.Len(t, loans, 1)
+}
+
+// Досрочное погашение с сокращением срока уменьшает число платежей,
+// а с уменьшением платежа сохраняет срок
+func TestLoanEarlyRepayment(t *testing.T) {
+    token := authenticateUser(t)
+    account := createAccount(t, token)
+
+    loan := applyForLoan(t, token, map[string]interface{}{
+        "product":     "consumer",
+        "account_id":  account,
+        "amount":      "120000.00",
+        "term_months": 12,
+    })
+
+    var repaid loanResponse
+    status := doJSON(t, "POST", token, "/loans/"+loan.ID+"/repay", map[string]string{
+        "amount": "60000.00",
+        "mode":   "reduce_term",
+    }, &repaid)
+    assert.Equal(t, http.StatusOK, status)
+    assert.Equal(t, "60000.00", repaid.Outstanding)
+    assert.Less(t, len(repaid.Installments), 12)
+    assert.Equal(t, "60000.00", getBalance(t, account))
+
+    status = doJSON(t, "POST", token, "/loans/"+loan.ID+"/repay", map[string]string{
+        "amount": "30000.00",
+        "mode":   "reduce_payment",
+    }, &repaid)
+    assert.Equal(t, http.StatusOK, status)
+    assert.Equal(t, "30000.00", repaid.Outstanding)
+
+    status = doJSON(t, "POST", token, "/loans/"+loan.ID+"/repay", map[string]string{"amount": "50000.00"}, nil)
+    assert.Equal(t, http.StatusBadRequest, status)
+
+    status = doJSON(t, "POST", token, "/loans/"+loan.ID+"/repay", map[string]string{"amount": "30000.00"}, &repaid)
+    assert.Equal(t, http.StatusOK, status)
+    assert.Equal(t, "closed", repaid.Status)
+    assert.Equal(t, "0.00", getBalance(t, account))
+    assert.Equal(t, getBalance(t, account), getLedgerBalance(t, account))
+}
+
+// Просроченный платеж списывается фоновой задачей вместе с неустойкой
+func TestLoanOverdueInstallmentCollected(t *testing.T) {
+    token := authenticateUser(t)
+    account := createAccount(t, token)
+
+    loan := applyForLoan(t, token, map[string]interface{}{
+        "product":     "consumer",
+        "account_id":  account,
+        "amount":      "60000.00",
+        "term_months": 6,
+    })
+
+    _, err := testDB.Exec(
+        `UPDATE loan_installments SET due_date = CURRENT_DATE - 3 WHERE loan_id = $1 AND number = 1`, loan.ID)
+    assert.NoError(t, err)
+    _, err = testDB.Exec(`UPDATE loans SET penalty_accrued_on = CURRENT_DATE - 3 WHERE id = $1`, loan.ID)
+    assert.NoError(t, err)
+
+    var got loanResponse
+    deadline := time.Now().Add(30 * time.Second)
+    for time.Now().Before(deadline) {
+        doJSON(t, "GET", token, "/loans/"+loan.ID, nil, &got)
+        if len(got.Installments) > 0 && got.Installments[0].Status == "paid" {
+            break
+        }
+        time.Sleep(500 * time.Millisecond)
+    }
+    if assert.NotEmpty(t, got.Installments) {
+        assert.Equal(t, "paid", got.Installments[0].Status)
+        assert.NotEqual(t, "0.00", got.Installments[0].Penalty)
+    }
+    assert.Equal(t, getBalance(t, account), getLedgerBalance(t, account))
+}
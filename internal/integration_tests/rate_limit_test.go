@@ -0,0 +1,35 @@
+package integration_tests
+
+import (
+    "net/http"
+    "testing"
+    "github.com/stretchr/testify/assert"
+)
+
+// После 100 запросов подряд пользователь получает 429 с Retry-After,
+// лимит другого пользователя при этом не расходуется
+func TestRateLimitPerUser(t *testing.T) {
+    token := authenticateUser(t)
+    other := authenticateUser(t)
+
+    // Пока идут запросы, корзина пополняется, поэтому допускается небольшой запас
+    var limited *http.Response
+    for i := 0; i < 120 && limited == nil; i++ {
+        req, _ := http.NewRequest("GET", "http://localhost:8080/accounts", nil)
+        req.Header.Set("Authorization", "Bearer "+token)
+        resp, err := http.DefaultClient.Do(req)
+        if !assert.NoError(t, err) {
+            return
+        }
+        resp.Body.Close()
+        if resp.StatusCode == http.StatusTooManyRequests {
+            assert.GreaterOrEqual(t, i, 100)
+            limited = resp
+        }
+    }
+    if assert.NotNil(t, limited, "rate limit was not enforced") {
+        assert.NotEmpty(t, limited.Header.Get("Retry-After"))
+    }
+
+    assert.Equal(t, http.StatusOK, doJSON(t, "GET", other, "/accounts", nil, nil))
+}
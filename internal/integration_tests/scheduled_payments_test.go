@@ -0,0 +1,182 @@
+package integration_tests
+
+import (
+    "net/http"
+    "testing"
+    "time"
+    "github.com/stretchr/testify/assert"
+)
+
+type scheduledPaymentResponse struct {
+    ID           string    `json:"id"`
+    Amount       string    `json:"amount"`
+    Recurrence   string    `json:"recurrence"`
+    DayOfMonth   int       `json:"day_of_month"`
+    ScheduledFor time.Time `json:"scheduled_for"`
+    NextRunAt    time.Time `json:"next_run_at"`
+    Attempts     int       `json:"attempts"`
+    Status       string    `json:"status"`
+    LastError    string    `json:"last_error"`
+}
+
+type scheduledRunResponse struct {
+    Attempt int    `json:"attempt"`
+    Status  string `json:"status"`
+    Error   string `json:"error"`
+}
+
+// Ждет, пока фоновый исполнитель обработает перевод
+func waitScheduledRun(t *testing.T, token, id string) scheduledPaymentResponse {
+    var payment scheduledPaymentResponse
+    deadline := time.Now().Add(30 * time.Second)
+    for time.Now().Before(deadline) {
+        doJSON(t, "GET", token, "/scheduled-payments/"+id, nil, &payment)
+        if payment.Status != "active" || payment.Attempts > 0 {
+            return payment
+        }
+        time.Sleep(500 * time.Millisecond)
+    }
+    t.Fatalf("scheduled payment %s was not executed in time", id)
+    return payment
+}
+
+func TestScheduledPaymentValidation(t *testing.T) {
+    token := authenticateUser(t)
+    fromAccount := createAccount(t, token)
+    toAccount := createAccount(t, token)
+
+    cases := []map[string]interface{}{
+        // Разовый перевод без даты
+        {"from_account": fromAccount, "to_account": toAccount, "amount": "10.00", "recurrence": "once"},
+        // Дата в прошлом
+        {"from_account": fromAccount, "to_account": toAccount, "amount": "10.00", "recurrence": "daily",
+            "start_at": time.Now().Add(-time.Hour).Format(time.RFC3339)},
+        // Ежемесячный перевод без дня месяца
+        {"from_account": fromAccount, "to_account": toAccount, "amount": "10.00", "recurrence": "monthly"},
+        {"from_account": fromAccount, "to_account": toAccount, "amount": "10.00", "recurrence": "hourly"},
+    }
+    for _, body := range cases {
+        assert.Equal(t, http.StatusBadRequest, doJSON(t, "POST", token, "/scheduled-payments", body, nil), "body %v", body)
+    }
+}
+
+func TestScheduledPaymentLifecycle(t *testing.T) {
+    token := authenticateUser(t)
+    stranger := authenticateUser(t)
+    fromAccount := createAccount(t, token)
+    toAccount := createAccount(t, token)
+
+    var payment scheduledPaymentResponse
+    status := doJSON(t, "POST", token, "/scheduled-payments", map[string]interface{}{
+        "from_account": fromAccount,
+        "to_account":   toAccount,
+        "amount":       "25.00",
+        "recurrence":   "month_end",
+        "start_at":     time.Date(2030, 2, 10, 9, 0, 0, 0, time.UTC).Format(time.RFC3339),
+    }, &payment)
+    assert.Equal(t, http.StatusOK, status)
+    assert.Equal(t, "active", payment.Status)
+    assert.Equal(t, time.Date(2030, 2, 28, 9, 0, 0, 0, time.UTC), payment.ScheduledFor.UTC())
+
+    var list []scheduledPaymentResponse
+    assert.Equal(t, http.StatusOK, doJSON(t, "GET", token, "/scheduled-payments", nil, &list))
+    assert.Len(t, list, 1)
+
+    assert.Equal(t, http.StatusForbidden, doJSON(t, "GET", stranger, "/scheduled-payments/"+payment.ID, nil, nil))
+    assert.Equal(t, http.StatusForbidden, doJSON(t, "DELETE", stranger, "/scheduled-payments/"+payment.ID, nil, nil))
+
+    status = doJSON(t, "PATCH", token, "/scheduled-payments/"+payment.ID, map[string]string{
+        "amount": "30.00",
+        "status": "paused",
+    }, &payment)
+    assert.Equal(t, http.StatusOK, status)
+    assert.Equal(t, "30.00", payment.Amount)
+    assert.Equal(t, "paused", payment.Status)
+
+    status = doJSON(t, "DELETE", token, "/scheduled-payments/"+payment.ID, nil, &payment)
+    assert.Equal(t, http.StatusOK, status)
+    assert.Equal(t, "cancelled", payment.Status)
+
+    status = doJSON(t, "PATCH", token, "/scheduled-payments/"+payment.ID, map[string]string{"status": "active"}, nil)
+    assert.Equal(t, http.StatusConflict, status)
+}
+
+func TestScheduledPaymentMonthlyDayClampsToMonthEnd(t *testing.T) {
+    token := authenticateUser(t)
+    fromAccount := createAccount(t, token)
+    toAccount := createAccount(t, token)
+
+    var payment scheduledPaymentResponse
+    status := doJSON(t, "POST", token, "/scheduled-payments", map[string]interface{}{
+        "from_account": fromAccount,
+        "to_account":   toAccount,
+        "amount":       "10.00",
+        "recurrence":   "monthly",
+        "day_of_month": 31,
+        "start_at":     time.Date(2030, 4, 1, 12, 0, 0, 0, time.UTC).Format(time.RFC3339),
+    }, &payment)
+    assert.Equal(t, http.StatusOK, status)
+    assert.Equal(t, time.Date(2030, 4, 30, 12, 0, 0, 0, time.UTC), payment.ScheduledFor.UTC())
+}
+
+func TestScheduledPaymentExecutes(t *testing.T) {
+    token := authenticateUser(t)
+    fromAccount := createAccount(t, token)
+    toAccount := createAccount(t, token)
+    setBalance(t, fromAccount, "100.00")
+
+    var payment scheduledPaymentResponse
+    status := doJSON(t, "POST", token, "/scheduled-payments", map[string]interface{}{
+        "from_account": fromAccount,
+        "to_account":   toAccount,
+        "amount":       "40.00",
+        "recurrence":   "once",
+        "start_at":     time.Now().Add(time.Second).Format(time.RFC3339Nano),
+    }, &payment)
+    assert.Equal(t, http.StatusOK, status)
+
+    payment = waitScheduledRun(t, token, payment.ID)
+    assert.Equal(t, "completed", payment.Status)
+    assert.Equal(t, "60.00", getBalance(t, fromAccount))
+    assert.Equal(t, "40.00", getBalance(t, toAccount))
+
+    var runs []scheduledRunResponse
+    assert.Equal(t, http.StatusOK, doJSON(t, "GET", token, "/scheduled-payments/"+payment.ID+"/runs", nil, &runs))
+    if assert.Len(t, runs, 1) {
+        assert.Equal(t, "succeeded", runs[0].Status)
+    }
+}
+
+// При нехватке средств перевод откладывается на повтор, а не отменяется
+func TestScheduledPaymentRetriesOnInsufficientFunds(t *testing.T) {
+    token := authenticateUser(t)
+    fromAccount := createAccount(t, token)
+    toAccount := createAccount(t, token)
+    setBalance(t, fromAccount, "10.00")
+    setAccountLimit(t, fromAccount, "overdraft", "0")
+
+    var payment scheduledPaymentResponse
+    status := doJSON(t, "POST", token, "/scheduled-payments", map[string]interface{}{
+        "from_account": fromAccount,
+        "to_account":   toAccount,
+        "amount":       "40.00",
+        "recurrence":   "daily",
+        "start_at":     time.Now().Add(time.Second).Format(time.RFC3339Nano),
+    }, &payment)
+    assert.Equal(t, http.StatusOK, status)
+    scheduledFor := payment.ScheduledFor
+
+    payment = waitScheduledRun(t, token, payment.ID)
+    assert.Equal(t, "active", payment.Status)
+    assert.Equal(t, 1, payment.Attempts)
+    assert.NotEmpty(t, payment.LastError)
+    assert.True(t, payment.ScheduledFor.Equal(scheduledFor))
+    assert.True(t, payment.NextRunAt.After(time.Now().Add(30*time.Minute)))
+    assert.Equal(t, "10.00", getBalance(t, fromAccount))
+
+    var runs []scheduledRunResponse
+    assert.Equal(t, http.StatusOK, doJSON(t, "GET", token, "/scheduled-payments/"+payment.ID+"/runs", nil, &runs))
+    if assert.Len(t, runs, 1) {
+        assert.Equal(t, "retrying", runs[0].Status)
+    }
+}
@@ -0,0 +1,164 @@
+package integration_tests
+
+import (
+    "encoding/csv"
+    "io"
+    "net/http"
+    "strings"
+    "testing"
+    "time"
+    "github.com/beevik/etree"
+    "github.com/stretchr/testify/assert"
+)
+
+type statementResponse struct {
+    OpeningBalance string `json:"opening_balance"`
+    ClosingBalance string `json:"closing_balance"`
+    TotalCredits   string `json:"total_credits"`
+    TotalDebits    string `json:"total_debits"`
+    CreditCount    int    `json:"credit_count"`
+    DebitCount     int    `json:"debit_count"`
+    Lines          []struct {
+        Direction    string `json:"direction"`
+        Amount       string `json:"amount"`
+        Counterparty string `json:"counterparty"`
+        Balance      string `json:"balance"`
+    } `json:"lines"`
+}
+
+// GET-запрос с ответом не в JSON
+func getRaw(t *testing.T, token, path string) (int, http.Header, string) {
+    req, _ := http.NewRequest("GET", "http://localhost:8080"+path, nil)
+    req.Header.Set("Authorization", "Bearer "+token)
+
+    resp, err := http.DefaultClient.Do(req)
+    if !assert.NoError(t, err) {
+        return 0, nil, ""
+    }
+    defer resp.Body.Close()
+
+    body, _ := io.ReadAll(resp.Body)
+    return resp.StatusCode, resp.Header, string(body)
+}
+
+// Проводки за период сходятся с остатками на границах периода
+func TestMonthlyStatementReconciles(t *testing.T) {
+    token := authenticateUser(t)
+    account := createAccount(t, token)
+    other := createAccount(t, token)
+    setBalance(t, account, "100.00")
+    assert.Equal(t, http.StatusOK, transfer(t, token, account, other, "30.00"))
+    assert.Equal(t, http.StatusOK, transfer(t, token, other, account, "5.50"))
+
+    period := time.Now().UTC().Format("2006-01")
+    var statement statementResponse
+    status := doJSON(t, "GET", token, "/accounts/"+account+"/statements?period="+period, nil, &statement)
+    assert.Equal(t, http.StatusOK, status)
+    assert.Equal(t, "0.00", statement.OpeningBalance)
+    assert.Equal(t, getBalance(t, account), statement.ClosingBalance)
+    assert.Equal(t, "75.50", statement.ClosingBalance)
+    assert.Equal(t, "105.50", statement.TotalCredits)
+    assert.Equal(t, "30.00", statement.TotalDebits)
+    assert.Equal(t, 2, statement.CreditCount)
+    assert.Equal(t, 1, statement.DebitCount)
+    if assert.Len(t, statement.Lines, 3) {
+        assert.Equal(t, other, statement.Lines[1].Counterparty)
+        assert.Equal(t, "70.00", statement.Lines[1].Balance)
+    }
+
+    // Следующий месяц начинается с остатка на конец текущего
+    next := time.Now().UTC().AddDate(0, 1, 0).Format("2006-01")
+    status = doJSON(t, "GET", token, "/accounts/"+account+"/statements?period="+next, nil, &statement)
+    assert.Equal(t, http.StatusOK, status)
+    assert.Equal(t, "75.50", statement.OpeningBalance)
+    assert.Equal(t, "75.50", statement.ClosingBalance)
+    assert.Empty(t, statement.Lines)
+}
+
+func TestStatementDateRange(t *testing.T) {
+    token := authenticateUser(t)
+    account := createAccount(t, token)
+    setBalance(t, account, "10.00")
+
+    today := time.Now().UTC().Format("2006-01-02")
+    var statement statementResponse
+    status := doJSON(t, "GET", token, "/accounts/"+account+"/statements?from="+today+"&to="+today, nil, &statement)
+    assert.Equal(t, http.StatusOK, status)
+    assert.Equal(t, "10.00", statement.ClosingBalance)
+
+    for _, query := range []string{
+        "",
+        "?period=2024-13",
+        "?from=2024-02-01",
+        "?from=2024-03-01&to=2024-02-01",
+        "?from=2020-01-01&to=2024-01-01",
+        "?period=2024-01&format=pdf",
+    } {
+        status := doJSON(t, "GET", token, "/accounts/"+account+"/statements"+query, nil, nil)
+        assert.Equal(t, http.StatusBadRequest, status, "query %s", query)
+    }
+
+    stranger := authenticateUser(t)
+    status = doJSON(t, "GET", stranger, "/accounts/"+account+"/statements?period=2024-01", nil, nil)
+    assert.Equal(t, http.StatusForbidden, status)
+}
+
+func TestStatementCSV(t *testing.T) {
+    token := authenticateUser(t)
+    account := createAccount(t, token)
+    setBalance(t, account, "42.00")
+
+    period := time.Now().UTC().Format("2006-01")
+    status, header, body := getRaw(t, token, "/accounts/"+account+"/statements?period="+period+"&format=csv")
+    assert.Equal(t, http.StatusOK, status)
+    assert.True(t, strings.HasPrefix(header.Get("Content-Type"), "text/csv"))
+    assert.Contains(t, header.Get("Content-Disposition"), "attachment")
+
+    records, err := csv.NewReader(strings.NewReader(body)).ReadAll()
+    assert.NoError(t, err)
+    if assert.Len(t, records, 4) {
+        assert.Equal(t, "opening_balance", records[1][3])
+        assert.Equal(t, "0.00", records[1][9])
+        assert.Equal(t, "42.00", records[2][5])
+        assert.Equal(t, "closing_balance", records[3][3])
+        assert.Equal(t, "42.00", records[3][9])
+    }
+}
+
+func TestStatementCamt053(t *testing.T) {
+    token := authenticateUser(t)
+    account := createAccount(t, token)
+    other := createAccount(t, token)
+    setBalance(t, account, "50.00")
+    assert.Equal(t, http.StatusOK, transfer(t, token, account, other, "20.00"))
+
+    period := time.Now().UTC().Format("2006-01")
+    status, header, body := getRaw(t, token, "/accounts/"+account+"/statements?period="+period+"&format=camt053")
+    assert.Equal(t, http.StatusOK, status)
+    assert.True(t, strings.HasPrefix(header.Get("Content-Type"), "application/xml"))
+
+    doc := etree.NewDocument()
+    if !assert.NoError(t, doc.ReadFromString(body)) {
+        return
+    }
+    stmt := doc.FindElement("/Document/BkToCstmrStmt/Stmt")
+    if !assert.NotNil(t, stmt) {
+        return
+    }
+    assert.Equal(t, account, stmt.FindElement("Acct/Id/Othr/Id").Text())
+
+    balances := map[string]string{}
+    for _, bal := range stmt.SelectElements("Bal") {
+        balances[bal.FindElement("Tp/CdOrPrtry/Cd").Text()] = bal.SelectElement("Amt").Text()
+    }
+    assert.Equal(t, "0.00", balances["OPBD"])
+    assert.Equal(t, "30.00", balances["CLBD"])
+
+    entries := stmt.SelectElements("Ntry")
+    if assert.Len(t, entries, 2) {
+        assert.Equal(t, "CRDT", entries[0].SelectElement("CdtDbtInd").Text())
+        assert.Equal(t, "DBIT", entries[1].SelectElement("CdtDbtInd").Text())
+        assert.Equal(t, "20.00", entries[1].SelectElement("Amt").Text())
+    }
+    assert.Equal(t, "2", stmt.FindElement("TxsSummry/TtlNtries/NbOfNtries").Text())
+}
@@ -0,0 +1,307 @@
+package integration_tests
+
+import (
+    "bytes"
+    "database/sql"
+    "encoding/base64"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+    "testing"
+    "time"
+
+    _ "github.com/lib/pq"
+    "github.com/stretchr/testify/assert"
+)
+
+const migrationsDir = "../../migrations"
+
+var testDB *sql.DB
+
+func TestMain(m *testing.M) {
+    setup()
+    code := m.Run()
+    teardown()
+    os.Exit(code)
+}
+
+func setup() {
+    // 1. Подключение к тестовой БД
+    connStr := fmt.Sprintf(
+        "host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
+        "localhost", 5432, "postgres", "postgres", "bank_test",
+    )
+    
+    var err error
+    testDB, err = sql.Open("postgres", connStr)
+    if err != nil {
+        panic(fmt.Sprintf("DB connection failed: %v", err))
+    }
+
+    // 2. Запуск миграций
+    runMigrations()
+
+    // 3. Очистка тестовых данных
+    cleanTestData()
+}
+
+func teardown() {
+    // 1. Закрытие соединения с БД
+    if testDB != nil {
+        testDB.Close()
+    }
+}
+
+// Пересоздает схему и применяет все up-миграции по порядку
+func runMigrations() {
+    if _, err := testDB.Exec("DROP SCHEMA public CASCADE; CREATE SCHEMA public"); err != nil {
+        panic(fmt.Sprintf("Failed to reset schema: %v", err))
+    }
+
+    files, err := filepath.Glob(filepath.Join(migrationsDir, "*.up.sql"))
+    if err != nil {
+        panic(fmt.Sprintf("Failed to list migrations: %v", err))
+    }
+    sort.Strings(files)
+
+    for _, file := range files {
+        script, err := os.ReadFile(file)
+        if err != nil {
+            panic(fmt.Sprintf("Failed to read migration %s: %v", file, err))
+        }
+        if _, err := testDB.Exec(string(script)); err != nil {
+            panic(fmt.Sprintf("Failed to apply migration %s: %v", file, err))
+        }
+    }
+}
+
+func cleanTestData() {
+    tables := []string{"users", "accounts", "transactions"}
+    for _, table := range tables {
+        _, err := testDB.Exec(fmt.Sprintf("TRUNCATE TABLE %s CASCADE", table))
+        if err != nil {
+            panic(fmt.Sprintf("Failed to truncate table %s: %v", table, err))
+        }
+    }
+}
+
+// Регистрирует нового пользователя с уникальным email и возвращает его токен
+func authenticateUser(t *testing.T) string {
+    suffix := time.Now().UnixNano()
+    user := map[string]string{
+        "email":    fmt.Sprintf("user_%d@example.com", suffix),
+        "username": fmt.Sprintf("user%d", suffix),
+        "password": "Str0ng!Password",
+    }
+    return registerAndLogin(t, user)
+}
+
+func registerAndLogin(t *testing.T, user map[string]string) string {
+    // Регистрация
+    payload, _ := json.Marshal(user)
+    resp, err := http.Post("http://localhost:8080/register", "application/json", bytes.NewBuffer(payload))
+    assert.NoError(t, err)
+    markEmailVerified(t, user["email"])
+    
+    // Логин
+    loginData := map[string]string{
+        "email":    user["email"],
+        "password": user["password"],
+    }
+    payload, _ = json.Marshal(loginData)
+    
+    resp, err = http.Post("http://localhost:8080/login", "application/json", bytes.NewBuffer(payload))
+    assert.NoError(t, err)
+    
+    var result struct {
+        Token string `json:"token"`
+    }
+    json.NewDecoder(resp.Body).Decode(&result)
+    return result.Token
+}
+
+// Подтверждает адрес напрямую в БД: письма в тестах не отправляются
+func markEmailVerified(t *testing.T, email string) {
+    _, err := testDB.Exec("UPDATE users SET email_verified_at = CURRENT_TIMESTAMP WHERE email = $1", email)
+    assert.NoError(t, err)
+}
+
+func createAccount(t *testing.T, token string) string {
+    req, _ := http.NewRequest("POST", "http://localhost:8080/accounts", nil)
+    req.Header.Set("Authorization", "Bearer "+token)
+    
+    client := &http.Client{}
+    resp, err := client.Do(req)
+    assert.NoError(t, err)
+    
+    var account struct {
+        ID string `json:"id"`
+    }
+    json.NewDecoder(resp.Body).Decode(&account)
+    return account.ID
+}
+
+// Извлекает ID пользователя (subject) из JWT без проверки подписи
+func userIDFromToken(t *testing.T, token string) string {
+    parts := strings.Split(token, ".")
+    if !assert.Len(t, parts, 3) {
+        return ""
+    }
+    payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+    assert.NoError(t, err)
+
+    var claims struct {
+        Subject string `json:"sub"`
+    }
+    json.Unmarshal(payload, &claims)
+    return claims.Subject
+}
+
+// Регистрирует n пользователей, которым доверены счета, и возвращает их токены.
+// Лимит частоты запросов действует на пользователя, поэтому параллельные тесты
+// распределяют запросы между владельцем и доверенными пользователями.
+func delegateTokens(t *testing.T, n int, accounts ...string) []string {
+    tokens := make([]string, n)
+    for i := range tokens {
+        tokens[i] = authenticateUser(t)
+        for _, account := range accounts {
+            _, err := testDB.Exec(
+                "INSERT INTO account_delegates (account_id, user_id) VALUES ($1, $2)",
+                account, userIDFromToken(t, tokens[i]),
+            )
+            assert.NoError(t, err)
+        }
+    }
+    return tokens
+}
+
+// Выполняет перевод и возвращает HTTP-статус ответа
+func transfer(t *testing.T, token, from, to string, amount interface{}) int {
+    payload, _ := json.Marshal(map[string]interface{}{
+        "from_account": from,
+        "to_account":   to,
+        "amount":       amount,
+    })
+
+    req, _ := http.NewRequest("POST", "http://localhost:8080/transfer", bytes.NewBuffer(payload))
+    req.Header.Set("Authorization", "Bearer "+token)
+    req.Header.Set("Content-Type", "application/json")
+
+    resp, err := http.DefaultClient.Do(req)
+    if !assert.NoError(t, err) {
+        return 0
+    }
+    defer resp.Body.Close()
+    return resp.StatusCode
+}
+
+// Выполняет авторизованный запрос и декодирует JSON-ответ в out
+func doJSON(t *testing.T, method, token, path string, body interface{}, out interface{}) int {
+    var payload *bytes.Buffer = &bytes.Buffer{}
+    if body != nil {
+        raw, _ := json.Marshal(body)
+        payload = bytes.NewBuffer(raw)
+    }
+
+    req, _ := http.NewRequest(method, "http://localhost:8080"+path, payload)
+    if token != "" {
+        req.Header.Set("Authorization", "Bearer "+token)
+    }
+    req.Header.Set("Content-Type", "application/json")
+
+    resp, err := http.DefaultClient.Do(req)
+    if !assert.NoError(t, err) {
+        return 0
+    }
+    defer resp.Body.Close()
+
+    if out != nil {
+        json.NewDecoder(resp.Body).Decode(out)
+    }
+    return resp.StatusCode
+}
+
+// Устанавливает баланс счета вступительной проводкой журнала
+func setBalance(t *testing.T, accountID string, balance string) {
+    tx, err := testDB.Begin()
+    if !assert.NoError(t, err) {
+        return
+    }
+    defer tx.Rollback()
+
+    var currency, delta string
+    err = tx.QueryRow(
+        "SELECT currency, ($1::numeric - balance)::text FROM accounts WHERE id = $2 FOR UPDATE",
+        balance, accountID,
+    ).Scan(&currency, &delta)
+    if !assert.NoError(t, err) || delta == "0.00" {
+        return
+    }
+
+    var openingID, entryID string
+    _, err = tx.Exec(
+        `INSERT INTO accounts (system_code, currency, balance) VALUES ('opening_balance', $1, 0)
+         ON CONFLICT (system_code, currency) WHERE system_code IS NOT NULL DO NOTHING`,
+        currency,
+    )
+    assert.NoError(t, err)
+    err = tx.QueryRow(
+        "SELECT id FROM accounts WHERE system_code = 'opening_balance' AND currency = $1", currency,
+    ).Scan(&openingID)
+    assert.NoError(t, err)
+    err = tx.QueryRow(
+        "INSERT INTO journal_entries (type, description) VALUES ('opening_balance', 'Test funding') RETURNING id",
+    ).Scan(&entryID)
+    assert.NoError(t, err)
+
+    _, err = tx.Exec(
+        `INSERT INTO postings (entry_id, account_id, direction, amount, currency) VALUES
+            ($1, $2, CASE WHEN $4::numeric > 0 THEN 'credit' ELSE 'debit' END, abs($4::numeric), $5),
+            ($1, $3, CASE WHEN $4::numeric > 0 THEN 'debit' ELSE 'credit' END, abs($4::numeric), $5)`,
+        entryID, accountID, openingID, delta, currency,
+    )
+    assert.NoError(t, err)
+    _, err = tx.Exec("UPDATE accounts SET balance = balance + $1::numeric WHERE id = $2", delta, accountID)
+    assert.NoError(t, err)
+    _, err = tx.Exec("UPDATE accounts SET balance = balance - $1::numeric WHERE id = $2", delta, openingID)
+    assert.NoError(t, err)
+
+    assert.NoError(t, tx.Commit())
+}
+
+// Задает индивидуальный лимит счета, например overdraft или daily_outgoing
+func setAccountLimit(t *testing.T, accountID, limit, value string) {
+    _, err := testDB.Exec(
+        fmt.Sprintf(
+            `INSERT INTO account_limits (account_id, %[1]s) VALUES ($1, $2::numeric)
+             ON CONFLICT (account_id) DO UPDATE SET %[1]s = EXCLUDED.%[1]s`,
+            limit,
+        ),
+        accountID, value,
+    )
+    assert.NoError(t, err)
+}
+
+// Баланс счета, вычисленный по проводкам журнала
+func getLedgerBalance(t *testing.T, accountID string) string {
+    var balance string
+    err := testDB.QueryRow(
+        `SELECT COALESCE(SUM(CASE WHEN direction = 'credit' THEN amount ELSE -amount END), 0)::numeric(15,2)::text
+         FROM postings WHERE account_id = $1`,
+        accountID,
+    ).Scan(&balance)
+    assert.NoError(t, err)
+    return balance
+}
+
+// Читает баланс счета напрямую из БД
+func getBalance(t *testing.T, accountID string) string {
+    var balance string
+    err := testDB.QueryRow("SELECT balance FROM accounts WHERE id = $1", accountID).Scan(&balance)
+    assert.NoError(t, err)
+    return balance
+}
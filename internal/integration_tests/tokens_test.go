@@ -0,0 +1,75 @@
+package integration_tests
+
+import (
+    "fmt"
+    "net/http"
+    "testing"
+    "time"
+    "github.com/stretchr/testify/assert"
+)
+
+type tokenPair struct {
+    Token        string `json:"token"`
+    RefreshToken string `json:"refresh_token"`
+    ExpiresAt    string `json:"expires_at"`
+}
+
+// Регистрирует пользователя и возвращает обе части пары токенов
+func loginWithRefresh(t *testing.T) tokenPair {
+    suffix := time.Now().UnixNano()
+    user := map[string]string{
+        "email":    fmt.Sprintf("session_%d@example.com", suffix),
+        "username": fmt.Sprintf("session%d", suffix),
+        "password": "Str0ng!Password",
+    }
+    status := doJSON(t, "POST", "", "/register", user, nil)
+    assert.Equal(t, http.StatusOK, status)
+
+    var pair tokenPair
+    status = doJSON(t, "POST", "", "/login", map[string]string{
+        "email":    user["email"],
+        "password": user["password"],
+    }, &pair)
+    assert.Equal(t, http.StatusOK, status)
+    return pair
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+    pair := loginWithRefresh(t)
+    assert.NotEmpty(t, pair.Token)
+    assert.NotEmpty(t, pair.RefreshToken)
+
+    expiresAt, err := time.Parse(time.RFC3339, pair.ExpiresAt)
+    if assert.NoError(t, err) {
+        assert.True(t, expiresAt.Before(time.Now().Add(time.Hour)), "access token should be short-lived")
+    }
+
+    var rotated tokenPair
+    status := doJSON(t, "POST", "", "/token/refresh", map[string]string{"refresh_token": pair.RefreshToken}, &rotated)
+    assert.Equal(t, http.StatusOK, status)
+    assert.NotEqual(t, pair.RefreshToken, rotated.RefreshToken)
+    assert.Equal(t, http.StatusOK, doJSON(t, "GET", rotated.Token, "/accounts", nil, nil))
+
+    // Повторное предъявление использованного токена отзывает всю сессию
+    status = doJSON(t, "POST", "", "/token/refresh", map[string]string{"refresh_token": pair.RefreshToken}, nil)
+    assert.Equal(t, http.StatusUnauthorized, status)
+    status = doJSON(t, "POST", "", "/token/refresh", map[string]string{"refresh_token": rotated.RefreshToken}, nil)
+    assert.Equal(t, http.StatusUnauthorized, status)
+    assert.Equal(t, http.StatusUnauthorized, doJSON(t, "GET", rotated.Token, "/accounts", nil, nil))
+    assert.Equal(t, http.StatusUnauthorized, doJSON(t, "GET", pair.Token, "/accounts", nil, nil))
+}
+
+func TestLogout(t *testing.T) {
+    pair := loginWithRefresh(t)
+    assert.Equal(t, http.StatusOK, doJSON(t, "GET", pair.Token, "/accounts", nil, nil))
+
+    status := doJSON(t, "POST", pair.Token, "/logout", nil, nil)
+    assert.Equal(t, http.StatusNoContent, status)
+
+    assert.Equal(t, http.StatusUnauthorized, doJSON(t, "GET", pair.Token, "/accounts", nil, nil))
+    status = doJSON(t, "POST", "", "/token/refresh", map[string]string{"refresh_token": pair.RefreshToken}, nil)
+    assert.Equal(t, http.StatusUnauthorized, status)
+
+    status = doJSON(t, "POST", "", "/token/refresh", map[string]string{"refresh_token": "unknown"}, nil)
+    assert.Equal(t, http.StatusUnauthorized, status)
+}
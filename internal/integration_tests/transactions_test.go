@@ -1,48 +1,177 @@
 package integration_tests
 
 import (
-    "bytes"
-    "encoding/json"
     "net/http"
+    "sync"
     "testing"
     "github.com/stretchr/testify/assert"
 )
 
 func TestMoneyTransfer(t *testing.T) {
-    baseURL := "http://localhost:8080"
     token := authenticateUser(t)
 
     fromAccount := createAccount(t, token)
     toAccount := createAccount(t, token)
+    setBalance(t, fromAccount, "500.00")
 
-    transferData := map[string]interface{}{
-        "from_account": fromAccount,
-        "to_account":   toAccount,
-        "amount":       100.50,
+    status := transfer(t, token, fromAccount, toAccount, 100.50)
+    assert.Equal(t, http.StatusOK, status)
+
+    assert.Equal(t, "399.50", getBalance(t, fromAccount))
+    assert.Equal(t, "100.50", getBalance(t, toAccount))
+}
+
+func TestTransferInsufficientFunds(t *testing.T) {
+    token := authenticateUser(t)
+
+    fromAccount := createAccount(t, token)
+    toAccount := createAccount(t, token)
+    setBalance(t, fromAccount, "50.00")
+    setAccountLimit(t, fromAccount, "overdraft", "0")
+
+    status := transfer(t, token, fromAccount, toAccount, 100)
+    assert.Equal(t, http.StatusBadRequest, status)
+
+    assert.Equal(t, "50.00", getBalance(t, fromAccount))
+    assert.Equal(t, "0.00", getBalance(t, toAccount))
+}
+
+// Встречные параллельные переводы не должны терять или создавать деньги
+func TestConcurrentTransfersConserveBalance(t *testing.T) {
+    token := authenticateUser(t)
+
+    accountA := createAccount(t, token)
+    accountB := createAccount(t, token)
+    setBalance(t, accountA, "1000.00")
+    setBalance(t, accountB, "1000.00")
+    setAccountLimit(t, accountA, "overdraft", "0")
+    setAccountLimit(t, accountB, "overdraft", "0")
+
+    // По 60 запросов на пользователя, в пределах лимита частоты запросов
+    const workers = 300
+    tokens := append(delegateTokens(t, 4, accountA, accountB), token)
+    var (
+        wg          sync.WaitGroup
+        mu          sync.Mutex
+        rateLimited int
+    )
+    for i := 0; i < workers; i++ {
+        wg.Add(1)
+        go func(i int) {
+            defer wg.Done()
+            var status int
+            if i%2 == 0 {
+                status = transfer(t, tokens[i%len(tokens)], accountA, accountB, 7.25)
+            } else {
+                status = transfer(t, tokens[i%len(tokens)], accountB, accountA, 3.10)
+            }
+            if status == http.StatusTooManyRequests {
+                mu.Lock()
+                rateLimited++
+                mu.Unlock()
+            }
+        }(i)
     }
-    payload, _ := json.Marshal(transferData)
-    
-    req, _ := http.NewRequest("POST", baseURL+"/transfer", bytes.NewBuffer(payload))
-    req.Header.Set("Authorization", "Bearer "+token)
-    req.Header.Set("Content-Type", "application/json")
-    
-    client := &http.Client{}
-    resp, err := client.Do(req)
+    wg.Wait()
+    assert.Equal(t, 0, rateLimited)
+
+    var total, negatives int
+    err := testDB.QueryRow(
+        `SELECT (SUM(balance) * 100)::int, COUNT(*) FILTER (WHERE balance < 0)
+         FROM accounts WHERE id IN ($1, $2)`,
+        accountA, accountB,
+    ).Scan(&total, &negatives)
     assert.NoError(t, err)
-    assert.Equal(t, http.StatusOK, resp.StatusCode)
+    assert.Equal(t, 200000, total)
+    assert.Equal(t, 0, negatives)
 }
 
-func createAccount(t *testing.T, token string) string {
-    req, _ := http.NewRequest("POST", "http://localhost:8080/accounts", nil)
-    req.Header.Set("Authorization", "Bearer "+token)
-    
-    client := &http.Client{}
-    resp, err := client.Do(req)
-    assert.NoError(t, err)
-    
-    var account struct {
-        ID string `json:"id"`
+// Параллельные списания с одного счета не должны уводить его в минус
+func TestConcurrentTransfersDoNotOverdraw(t *testing.T) {
+    token := authenticateUser(t)
+
+    source := createAccount(t, token)
+    target := createAccount(t, token)
+    setBalance(t, source, "100.00")
+    setAccountLimit(t, source, "overdraft", "0")
+
+    // По 50 запросов на пользователя, в пределах лимита частоты запросов
+    const workers = 200
+    tokens := append(delegateTokens(t, 3, source), token)
+    var (
+        wg          sync.WaitGroup
+        mu          sync.Mutex
+        succeeded   int
+        rateLimited int
+    )
+    for i := 0; i < workers; i++ {
+        wg.Add(1)
+        go func(i int) {
+            defer wg.Done()
+            status := transfer(t, tokens[i%len(tokens)], source, target, 10)
+            mu.Lock()
+            defer mu.Unlock()
+            switch status {
+            case http.StatusOK:
+                succeeded++
+            case http.StatusTooManyRequests:
+                rateLimited++
+            }
+        }(i)
+    }
+    wg.Wait()
+
+    assert.Equal(t, 0, rateLimited)
+    assert.Equal(t, 10, succeeded)
+    assert.Equal(t, "0.00", getBalance(t, source))
+    assert.Equal(t, "100.00", getBalance(t, target))
+}
+
+// Суммы складываются точно, без погрешности float64
+func TestTransferAmountPrecision(t *testing.T) {
+    token := authenticateUser(t)
+
+    fromAccount := createAccount(t, token)
+    toAccount := createAccount(t, token)
+    setBalance(t, fromAccount, "1000.00")
+
+    assert.Equal(t, http.StatusOK, transfer(t, token, fromAccount, toAccount, "100.10"))
+    assert.Equal(t, http.StatusOK, transfer(t, token, fromAccount, toAccount, 0.20))
+
+    assert.Equal(t, "899.70", getBalance(t, fromAccount))
+    assert.Equal(t, "100.30", getBalance(t, toAccount))
+}
+
+func TestTransferRejectsInvalidAmounts(t *testing.T) {
+    token := authenticateUser(t)
+
+    fromAccount := createAccount(t, token)
+    toAccount := createAccount(t, token)
+    setBalance(t, fromAccount, "1000.00")
+
+    // Сумма, которую не удалось разобрать, возвращается ошибкой поля
+    cases := map[interface{}]string{
+        "1.001": "invalid_amount",
+        0.005:   "invalid_amount",
+        "NaN":   "invalid_amount",
+        "1e2":   "invalid_amount",
+        "":      "invalid_amount",
+        -5:      "not_positive",
+        "-5":    "not_positive",
+        nil:     "required",
+        // Нулевая сумма разбирается, но не проходит проверку полей
+        0:       "not_positive",
+        "0.00":  "not_positive",
+    }
+    for amount, code := range cases {
+        var body validationErrorResponse
+        status := doJSON(t, "POST", token, "/transfer", map[string]interface{}{
+            "from_account": fromAccount,
+            "to_account":   toAccount,
+            "amount":       amount,
+        }, &body)
+        assert.Equal(t, http.StatusUnprocessableEntity, status, "amount %v", amount)
+        assert.Equal(t, map[string]string{"amount": code}, body.codes(), "amount %v", amount)
     }
-    json.NewDecoder(resp.Body).Decode(&account)
-    return account.ID
+    assert.Equal(t, "1000.00", getBalance(t, fromAccount))
 }
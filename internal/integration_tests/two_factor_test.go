@@ -0,0 +1,201 @@
+package integration_tests
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "testing"
+    "time"
+    "github.com/stretchr/testify/assert"
+
+    "github.com/Misha-Glazunov/bank-api/pkg/totp"
+)
+
+type twoFactorLogin struct {
+    Token     string `json:"token"`
+    Challenge *struct {
+        Token string `json:"challenge_token"`
+    } `json:"two_factor_challenge"`
+}
+
+// Выполняет запрос с кодом подтверждения в заголовке X-2FA-Code
+func doJSONWithCode(t *testing.T, method, token, path, code string, body interface{}, out interface{}) int {
+    raw, _ := json.Marshal(body)
+    req, _ := http.NewRequest(method, "http://localhost:8080"+path, bytes.NewBuffer(raw))
+    req.Header.Set("Authorization", "Bearer "+token)
+    req.Header.Set("Content-Type", "application/json")
+    if code != "" {
+        req.Header.Set("X-2FA-Code", code)
+    }
+
+    resp, err := http.DefaultClient.Do(req)
+    if !assert.NoError(t, err) {
+        return 0
+    }
+    defer resp.Body.Close()
+
+    if out != nil {
+        json.NewDecoder(resp.Body).Decode(out)
+    }
+    return resp.StatusCode
+}
+
+// Включает двухфакторную аутентификацию и возвращает резервные коды
+func enableTwoFactor(t *testing.T, token string) []string {
+    var enrollment struct {
+        Secret string `json:"secret"`
+        URI    string `json:"otpauth_uri"`
+    }
+    assert.Equal(t, http.StatusOK, doJSON(t, "POST", token, "/2fa/enroll", nil, &enrollment))
+    assert.NotEmpty(t, enrollment.Secret)
+    assert.Contains(t, enrollment.URI, "otpauth://totp/")
+
+    status := doJSON(t, "POST", token, "/2fa/confirm", map[string]string{"code": "000000"}, nil)
+    assert.Equal(t, http.StatusForbidden, status)
+
+    code, err := totp.Code(enrollment.Secret, totp.Step(time.Now()))
+    assert.NoError(t, err)
+    var backup struct {
+        Codes []string `json:"backup_codes"`
+    }
+    status = doJSON(t, "POST", token, "/2fa/confirm", map[string]string{"code": code}, &backup)
+    assert.Equal(t, http.StatusOK, status)
+    assert.Len(t, backup.Codes, 10)
+    return backup.Codes
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+    suffix := time.Now().UnixNano()
+    user := map[string]string{
+        "email":    fmt.Sprintf("totp_%d@example.com", suffix),
+        "username": fmt.Sprintf("totp%d", suffix),
+        "password": "Str0ng!Password",
+    }
+    token := registerAndLogin(t, user)
+    backup := enableTwoFactor(t, token)
+
+    var status struct {
+        Enabled              bool `json:"enabled"`
+        BackupCodesRemaining int  `json:"backup_codes_remaining"`
+    }
+    assert.Equal(t, http.StatusOK, doJSON(t, "GET", token, "/2fa", nil, &status))
+    assert.True(t, status.Enabled)
+    assert.Equal(t, 10, status.BackupCodesRemaining)
+
+    // Пароль дает только токен второго шага
+    credentials := map[string]string{"email": user["email"], "password": user["password"]}
+    var login twoFactorLogin
+    assert.Equal(t, http.StatusOK, doJSON(t, "POST", "", "/login", credentials, &login))
+    assert.Empty(t, login.Token)
+    if !assert.NotNil(t, login.Challenge) {
+        return
+    }
+
+    second := map[string]string{"challenge_token": login.Challenge.Token, "code": "wrong-code"}
+    assert.Equal(t, http.StatusForbidden, doJSON(t, "POST", "", "/login/2fa", second, nil))
+
+    var pair tokenPair
+    second["code"] = backup[0]
+    assert.Equal(t, http.StatusOK, doJSON(t, "POST", "", "/login/2fa", second, &pair))
+    assert.NotEmpty(t, pair.Token)
+    assert.Equal(t, http.StatusOK, doJSON(t, "GET", pair.Token, "/accounts", nil, nil))
+
+    // Токен второго шага и резервный код одноразовые
+    second["code"] = backup[1]
+    assert.Equal(t, http.StatusUnauthorized, doJSON(t, "POST", "", "/login/2fa", second, nil))
+
+    assert.Equal(t, http.StatusOK, doJSON(t, "POST", "", "/login", credentials, &login))
+    second = map[string]string{"challenge_token": login.Challenge.Token, "code": backup[0]}
+    assert.Equal(t, http.StatusForbidden, doJSON(t, "POST", "", "/login/2fa", second, nil))
+
+    // Отключение требует кода
+    assert.Equal(t, http.StatusForbidden, doJSON(t, "DELETE", token, "/2fa", nil, nil))
+    assert.Equal(t, http.StatusNoContent, doJSONWithCode(t, "DELETE", token, "/2fa", backup[2], nil, nil))
+    assert.Equal(t, http.StatusOK, doJSON(t, "POST", "", "/login", credentials, &login))
+    assert.NotEmpty(t, login.Token)
+}
+
+func TestTwoFactorStepUp(t *testing.T) {
+    token := authenticateUser(t)
+    from := createAccount(t, token)
+    to := createAccount(t, token)
+    setBalance(t, from, "300000.00")
+    backup := enableTwoFactor(t, token)
+
+    // Сумма ниже порога не требует кода
+    assert.Equal(t, http.StatusOK, transfer(t, token, from, to, "100.00"))
+
+    body := map[string]interface{}{"from_account": from, "to_account": to, "amount": "150000.00"}
+    assert.Equal(t, http.StatusForbidden, doJSONWithCode(t, "POST", token, "/transfer", "", body, nil))
+    assert.Equal(t, http.StatusForbidden, doJSONWithCode(t, "POST", token, "/transfer", "abcde-fghij", body, nil))
+    assert.Equal(t, http.StatusOK, doJSONWithCode(t, "POST", token, "/transfer", backup[0], body, nil))
+    assert.Equal(t, "149900.00", getBalance(t, from))
+
+    // Новый набор резервных кодов заменяет прежний
+    var regenerated struct {
+        Codes []string `json:"backup_codes"`
+    }
+    status := doJSONWithCode(t, "POST", token, "/2fa/backup-codes", backup[1], nil, &regenerated)
+    assert.Equal(t, http.StatusOK, status)
+    assert.Len(t, regenerated.Codes, 10)
+    assert.Equal(t, http.StatusForbidden, doJSONWithCode(t, "POST", token, "/transfer", backup[2], body, nil))
+}
+
+func TestTwoFactorStepUpForAccountAndCardOperations(t *testing.T) {
+    token := authenticateUser(t)
+    accountID := createAccount(t, token)
+    setBalance(t, accountID, "300000.00")
+    card := issueCardForAccount(t, token, accountID, "visa")
+    backup := enableTwoFactor(t, token)
+
+    // Снятие ниже порога проходит без кода, от порога требует его
+    small := map[string]string{"amount": "100.00"}
+    assert.Equal(t, http.StatusOK, doJSONWithCode(t, "POST", token, "/accounts/"+accountID+"/withdraw", "", small, nil))
+    large := map[string]string{"amount": "150000.00"}
+    assert.Equal(t, http.StatusForbidden, doJSONWithCode(t, "POST", token, "/accounts/"+accountID+"/withdraw", "", large, nil))
+    assert.Equal(t, http.StatusOK, doJSONWithCode(t, "POST", token, "/accounts/"+accountID+"/withdraw", backup[0], large, nil))
+    assert.Equal(t, "149900.00", getBalance(t, accountID))
+
+    // Операции с картой подтверждаются кодом независимо от суммы
+    cardPath := "/cards/" + card.ID
+    assert.Equal(t, http.StatusOK, doJSON(t, "POST", token, cardPath+"/block", nil, nil))
+    assert.Equal(t, http.StatusNoContent, doJSON(t, "POST", token, cardPath+"/pin", map[string]string{"pin": "1234"}, nil))
+
+    cases := []struct {
+        method string
+        path   string
+        body   interface{}
+        status int
+    }{
+        {"POST", cardPath + "/unblock", nil, http.StatusOK},
+        {"PUT", cardPath + "/pin", map[string]string{"old_pin": "1234", "new_pin": "4321"}, http.StatusNoContent},
+        {"PUT", cardPath + "/limits", map[string]string{"daily": "5000.00"}, http.StatusOK},
+        {"POST", cardPath + "/reveal", map[string]string{"password": "Str0ng!Password"}, http.StatusOK},
+    }
+    for i, tc := range cases {
+        assert.Equal(t, http.StatusForbidden, doJSONWithCode(t, tc.method, token, tc.path, "", tc.body, nil), tc.path)
+        assert.Equal(t, tc.status, doJSONWithCode(t, tc.method, token, tc.path, backup[i+1], tc.body, nil), tc.path)
+    }
+}
+
+// Порог подтверждения берется для валюты счета: 1,500 USD требуют кода,
+// хотя в рублях такая сумма ниже рублевого порога
+func TestTwoFactorStepUpInAccountCurrency(t *testing.T) {
+    token := authenticateUser(t)
+    from := createAccountInCurrency(t, token, "USD")
+    to := createAccountInCurrency(t, token, "USD")
+    setBalance(t, from, "5000.00")
+    backup := enableTwoFactor(t, token)
+
+    assert.Equal(t, http.StatusOK, transfer(t, token, from, to, "100.00"))
+
+    body := map[string]interface{}{"from_account": from, "to_account": to, "amount": "1500.00"}
+    assert.Equal(t, http.StatusForbidden, doJSONWithCode(t, "POST", token, "/transfer", "", body, nil))
+    assert.Equal(t, http.StatusOK, doJSONWithCode(t, "POST", token, "/transfer", backup[0], body, nil))
+
+    withdrawal := map[string]string{"amount": "1500.00"}
+    assert.Equal(t, http.StatusForbidden, doJSONWithCode(t, "POST", token, "/accounts/"+from+"/withdraw", "", withdrawal, nil))
+    assert.Equal(t, http.StatusOK, doJSONWithCode(t, "POST", token, "/accounts/"+from+"/withdraw", backup[1], withdrawal, nil))
+    assert.Equal(t, "1900.00", getBalance(t, from))
+}
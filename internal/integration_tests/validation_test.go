@@ -0,0 +1,124 @@
+package integration_tests
+
+import (
+    "fmt"
+    "net/http"
+    "strings"
+    "testing"
+    "time"
+    "github.com/stretchr/testify/assert"
+)
+
+type validationErrorResponse struct {
+    Error  string `json:"error"`
+    Fields []struct {
+        Field   string `json:"field"`
+        Code    string `json:"code"`
+        Message string `json:"message"`
+    } `json:"fields"`
+}
+
+// Коды ошибок по имени поля
+func (r validationErrorResponse) codes() map[string]string {
+    codes := map[string]string{}
+    for _, field := range r.Fields {
+        codes[field.Field] = field.Code
+    }
+    return codes
+}
+
+func TestRegistrationValidation(t *testing.T) {
+    var body validationErrorResponse
+    status := doJSON(t, "POST", "", "/register", map[string]string{
+        "email":    "not-an-email",
+        "username": "a b",
+        "password": "securepassword123",
+    }, &body)
+    assert.Equal(t, http.StatusUnprocessableEntity, status)
+    assert.Equal(t, map[string]string{
+        "email":    "invalid_email",
+        "username": "invalid_username",
+        "password": "weak_password",
+    }, body.codes())
+
+    body = validationErrorResponse{}
+    status = doJSON(t, "POST", "", "/register", map[string]string{}, &body)
+    assert.Equal(t, http.StatusUnprocessableEntity, status)
+    assert.Equal(t, map[string]string{
+        "email":    "required",
+        "username": "required",
+        "password": "required",
+    }, body.codes())
+
+    suffix := time.Now().UnixNano()
+    status = doJSON(t, "POST", "", "/register", map[string]string{
+        "email":    fmt.Sprintf("valid_%d@example.com", suffix),
+        "username": fmt.Sprintf("valid%d", suffix),
+        "password": "Str0ng!Password",
+    }, nil)
+    assert.Equal(t, http.StatusOK, status)
+}
+
+func TestUnknownFieldsRejected(t *testing.T) {
+    suffix := time.Now().UnixNano()
+    var body validationErrorResponse
+    status := doJSON(t, "POST", "", "/register", map[string]interface{}{
+        "email":    fmt.Sprintf("extra_%d@example.com", suffix),
+        "username": fmt.Sprintf("extra%d", suffix),
+        "password": "Str0ng!Password",
+        "role":     "admin",
+    }, &body)
+    assert.Equal(t, http.StatusUnprocessableEntity, status)
+    assert.Equal(t, map[string]string{"role": "unknown_field"}, body.codes())
+
+    token := authenticateUser(t)
+    fromAccount := createAccount(t, token)
+    toAccount := createAccount(t, token)
+    setBalance(t, fromAccount, "100.00")
+
+    body = validationErrorResponse{}
+    status = doJSON(t, "POST", token, "/transfer", map[string]string{
+        "from_account": fromAccount,
+        "to_account":   toAccount,
+        "amount":       "10.00",
+        "memo":         "lunch",
+    }, &body)
+    assert.Equal(t, http.StatusUnprocessableEntity, status)
+    assert.Equal(t, map[string]string{"memo": "unknown_field"}, body.codes())
+    assert.Equal(t, "100.00", getBalance(t, fromAccount))
+}
+
+func TestOversizedBodyRejected(t *testing.T) {
+    status := doJSON(t, "POST", "", "/login", map[string]string{
+        "email":    "user@example.com",
+        "password": strings.Repeat("x", 100<<10),
+    }, nil)
+    assert.Equal(t, http.StatusRequestEntityTooLarge, status)
+}
+
+func TestFieldFormatValidation(t *testing.T) {
+    token := authenticateUser(t)
+    account := createAccount(t, token)
+
+    var body validationErrorResponse
+    status := doJSON(t, "POST", token, "/transfer", map[string]string{
+        "from_account": "abc",
+        "to_account":   account,
+        "amount":       "0",
+    }, &body)
+    assert.Equal(t, http.StatusUnprocessableEntity, status)
+    assert.Equal(t, map[string]string{
+        "from_account": "invalid_uuid",
+        "amount":       "not_positive",
+    }, body.codes())
+
+    body = validationErrorResponse{}
+    status = doJSON(t, "POST", token, "/loans", map[string]interface{}{
+        "product":     "consumer",
+        "account_id":  account,
+        "amount":      "100000.00",
+        "term_months": "12",
+    }, &body)
+    assert.Equal(t, http.StatusUnprocessableEntity, status)
+    assert.Equal(t, map[string]string{"term_months": "invalid_type"}, body.codes())
+}
@@ -0,0 +1,192 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"embed"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/Misha-Glazunov/bank-api/internal/config"
+)
+
+// Шаблоны писем
+const (
+	TemplateVerifyEmail   = "verify_email"
+	TemplatePasswordReset = "password_reset"
+)
+
+var (
+	ErrNotConfigured   = errors.New("smtp server is not configured")
+	ErrUnknownTemplate = errors.New("unknown email template")
+)
+
+// Время на соединение и диалог с сервером, если SMTP_TIMEOUT не задан
+const defaultTimeout = 10 * time.Second
+
+//go:embed templates/*.tmpl
+var templateFiles embed.FS
+
+// Данные шаблонов со ссылкой на действие: подтверждение адреса или сброс пароля
+type ActionLink struct {
+	Username  string
+	URL       string
+	ExpiresAt time.Time
+}
+
+// Отправка писем по шаблону. Каждый шаблон определяет блоки subject и body.
+type Mailer interface {
+	Send(ctx context.Context, to, name string, data interface{}) error
+}
+
+type SMTPMailer struct {
+	cfg       config.SMTPConfig
+	templates map[string]*template.Template
+	now       func() time.Time
+}
+
+func NewSMTPMailer(cfg config.SMTPConfig) (*SMTPMailer, error) {
+	templates := map[string]*template.Template{}
+	for _, name := range []string{TemplateVerifyEmail, TemplatePasswordReset} {
+		tmpl, err := template.ParseFS(templateFiles, "templates/"+name+".tmpl")
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse email template %s: %w", name, err)
+		}
+		templates[name] = tmpl
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+
+	return &SMTPMailer{
+		cfg:       cfg,
+		templates: templates,
+		now:       time.Now,
+	}, nil
+}
+
+// Отправляет письмо по шаблону name. STARTTLS включается, если сервер его
+// поддерживает; аутентификация выполняется, только если задан SMTP_USER.
+func (m *SMTPMailer) Send(ctx context.Context, to, name string, data interface{}) error {
+	if m.cfg.Host == "" {
+		return ErrNotConfigured
+	}
+	recipient, err := mail.ParseAddress(to)
+	if err != nil {
+		return fmt.Errorf("invalid recipient address: %w", err)
+	}
+	message, err := m.render(recipient, name, data)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.cfg.Timeout)
+	defer cancel()
+
+	addr := net.JoinHostPort(m.cfg.Host, strconv.Itoa(m.cfg.Port))
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("smtp dial failed: %w", err)
+	}
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return fmt.Errorf("smtp deadline: %w", err)
+	}
+
+	client, err := smtp.NewClient(conn, m.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("smtp handshake failed: %w", err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: m.cfg.Host}); err != nil {
+			return fmt.Errorf("smtp starttls failed: %w", err)
+		}
+	}
+	if m.cfg.User != "" {
+		auth := smtp.PlainAuth("", m.cfg.User, m.cfg.Password, m.cfg.Host)
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("smtp auth failed: %w", err)
+		}
+	}
+
+	if err := client.Mail(m.sender().Address); err != nil {
+		return fmt.Errorf("smtp MAIL FROM failed: %w", err)
+	}
+	if err := client.Rcpt(recipient.Address); err != nil {
+		return fmt.Errorf("smtp RCPT TO failed: %w", err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("smtp DATA failed: %w", err)
+	}
+	if _, err := w.Write(message); err != nil {
+		return fmt.Errorf("smtp write failed: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("smtp message rejected: %w", err)
+	}
+	return client.Quit()
+}
+
+// Собирает письмо: тема кодируется по RFC 2047, текст — quoted-printable в UTF-8
+func (m *SMTPMailer) render(to *mail.Address, name string, data interface{}) ([]byte, error) {
+	tmpl, ok := m.templates[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownTemplate, name)
+	}
+
+	var subject, body bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, fmt.Errorf("failed to render email subject: %w", err)
+	}
+	if err := tmpl.ExecuteTemplate(&body, "body", data); err != nil {
+		return nil, fmt.Errorf("failed to render email body: %w", err)
+	}
+
+	var msg bytes.Buffer
+	headers := [][2]string{
+		{"From", m.sender().String()},
+		{"To", to.String()},
+		{"Subject", mime.QEncoding.Encode("utf-8", strings.TrimSpace(subject.String()))},
+		{"Date", m.now().Format(time.RFC1123Z)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "text/plain; charset=UTF-8"},
+		{"Content-Transfer-Encoding", "quoted-printable"},
+	}
+	for _, header := range headers {
+		fmt.Fprintf(&msg, "%s: %s\r\n", header[0], header[1])
+	}
+	msg.WriteString("\r\n")
+
+	qp := quotedprintable.NewWriter(&msg)
+	if _, err := qp.Write(body.Bytes()); err != nil {
+		return nil, fmt.Errorf("failed to encode email body: %w", err)
+	}
+	if err := qp.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode email body: %w", err)
+	}
+	return msg.Bytes(), nil
+}
+
+// Адрес отправителя из SMTP_FROM; при некорректном значении используется как есть
+func (m *SMTPMailer) sender() *mail.Address {
+	if from, err := mail.ParseAddress(m.cfg.From); err == nil {
+		return from
+	}
+	return &mail.Address{Address: m.cfg.From}
+}
@@ -0,0 +1,158 @@
+package mailer
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Misha-Glazunov/bank-api/internal/config"
+)
+
+// Принятое заглушкой письмо
+type envelope struct {
+	from string
+	to   []string
+	data string
+}
+
+// Запускает в процессе минимальный SMTP-сервер без TLS и аутентификации
+// и возвращает его конфигурацию и канал принятых писем
+func startSMTPStub(t *testing.T) (config.SMTPConfig, <-chan envelope) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	received := make(chan envelope, 1)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTP(conn, received)
+		}
+	}()
+
+	addr := listener.Addr().(*net.TCPAddr)
+	return config.SMTPConfig{
+		Host:    addr.IP.String(),
+		Port:    addr.Port,
+		From:    "Bank <noreply@bank.example>",
+		Timeout: 5 * time.Second,
+	}, received
+}
+
+func serveSMTP(conn net.Conn, received chan<- envelope) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+
+	var current envelope
+	reply("220 stub ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command := strings.TrimRight(line, "\r\n")
+		switch verb := strings.ToUpper(strings.SplitN(command, " ", 2)[0]); verb {
+		case "EHLO", "HELO":
+			reply("250 stub")
+		case "MAIL":
+			current = envelope{from: command[len("MAIL FROM:"):]}
+			reply("250 OK")
+		case "RCPT":
+			current.to = append(current.to, command[len("RCPT TO:"):])
+			reply("250 OK")
+		case "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(line, "."))
+			}
+			current.data = data.String()
+			received <- current
+			reply("250 OK")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+func TestSendRendersTemplate(t *testing.T) {
+	cfg, received := startSMTPStub(t)
+	m, err := NewSMTPMailer(cfg)
+	require.NoError(t, err)
+
+	expiresAt := time.Date(2030, 1, 2, 15, 4, 0, 0, time.UTC)
+	link := "http://localhost:8080/email/verify?token=abc.def"
+	err = m.Send(context.Background(), "user@example.com", TemplateVerifyEmail, ActionLink{
+		Username:  "ivan",
+		URL:       link,
+		ExpiresAt: expiresAt,
+	})
+	require.NoError(t, err)
+
+	var got envelope
+	select {
+	case got = <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("message was not delivered to the stub")
+	}
+	assert.Equal(t, "<noreply@bank.example>", got.from)
+	assert.Equal(t, []string{"<user@example.com>"}, got.to)
+
+	msg, err := mail.ReadMessage(strings.NewReader(got.data))
+	require.NoError(t, err)
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	require.NoError(t, err)
+	assert.Equal(t, "Подтверждение адреса электронной почты", subject)
+	assert.Equal(t, "<user@example.com>", msg.Header.Get("To"))
+	assert.Equal(t, "quoted-printable", msg.Header.Get("Content-Transfer-Encoding"))
+
+	body, err := io.ReadAll(quotedprintable.NewReader(msg.Body))
+	require.NoError(t, err)
+	assert.Contains(t, string(body), "Здравствуйте, ivan!")
+	assert.Contains(t, string(body), link)
+	assert.Contains(t, string(body), "02.01.2030 15:04")
+}
+
+func TestSendErrors(t *testing.T) {
+	cfg, received := startSMTPStub(t)
+	m, err := NewSMTPMailer(cfg)
+	require.NoError(t, err)
+
+	err = m.Send(context.Background(), "user@example.com", "unknown", nil)
+	assert.True(t, errors.Is(err, ErrUnknownTemplate))
+
+	err = m.Send(context.Background(), "user@example.com\r\nBcc: other@example.com", TemplatePasswordReset, ActionLink{})
+	assert.Error(t, err)
+
+	disabled, err := NewSMTPMailer(config.SMTPConfig{})
+	require.NoError(t, err)
+	err = disabled.Send(context.Background(), "user@example.com", TemplatePasswordReset, ActionLink{})
+	assert.True(t, errors.Is(err, ErrNotConfigured))
+
+	assert.Len(t, received, 0)
+}
@@ -7,14 +7,23 @@ import (
 	"strings"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/sirupsen/logrus"
+
+	"github.com/Misha-Glazunov/bank-api/internal/models"
+	"github.com/Misha-Glazunov/bank-api/internal/repositories"
 )
 
 type contextKey string
 
-const userIDKey contextKey = "userID"
+const (
+	userIDKey    contextKey = "userID"
+	sessionIDKey contextKey = "sessionID"
+	roleKey      contextKey = "role"
+)
 
-// Возвращает middleware для JWT-аутентификации
-func AuthMiddleware(jwtSecret string) func(http.Handler) http.Handler {
+// Возвращает middleware для JWT-аутентификации. Токены, отозванные
+// при выходе или компрометации сессии, отклоняются по jti.
+func AuthMiddleware(jwtSecret string, tokenRepo repositories.TokenRepository, logger *logrus.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			authHeader := r.Header.Get("Authorization")
@@ -30,14 +39,14 @@ func AuthMiddleware(jwtSecret string) func(http.Handler) http.Handler {
 			}
 			
 			if !strings.HasPrefix(authHeader, "Bearer ") {
-                		respondError(w, http.StatusUnauthorized, "Invalid authorization format")
+                		sendJSONError(w, http.StatusUnauthorized, "Invalid authorization format")
                 		return
             		}
 
 			tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 
 			// Валидация токена
-			claims := &jwt.RegisteredClaims{}
+			claims := &models.AccessClaims{}
 			token, err := jwt.ParseWithClaims(
 				tokenString,
 				claims,
@@ -55,13 +64,31 @@ func AuthMiddleware(jwtSecret string) func(http.Handler) http.Handler {
 			}
 
 			userID := claims.Subject
-			if userID == "" {
+			if userID == "" || claims.ID == "" || claims.SessionID == "" {
 				sendJSONError(w, http.StatusUnauthorized, "Malformed token")
 				return
 			}
 
-			// Добавление userID в контекст
+			revoked, err := tokenRepo.IsAccessTokenRevoked(r.Context(), claims.ID)
+			if err != nil {
+				logger.Errorf("Access token revocation check failed: %v", err)
+				sendJSONError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+			if revoked {
+				sendJSONError(w, http.StatusUnauthorized, "Token has been revoked")
+				return
+			}
+
+			role := claims.Role
+			if role == "" {
+				role = models.RoleCustomer
+			}
+
+			// Добавление userID, сессии и роли в контекст
 			ctx := context.WithValue(r.Context(), userIDKey, userID)
+			ctx = context.WithValue(ctx, sessionIDKey, claims.SessionID)
+			ctx = context.WithValue(ctx, roleKey, role)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
@@ -76,6 +103,24 @@ func GetUserIDFromContext(ctx context.Context) (string, error) {
 	return userID, nil
 }
 
+// Извлекает идентификатор сессии access-токена из контекста
+func GetSessionIDFromContext(ctx context.Context) (string, error) {
+	sessionID, ok := ctx.Value(sessionIDKey).(string)
+	if !ok || sessionID == "" {
+		return "", fmt.Errorf("session ID not found in context")
+	}
+	return sessionID, nil
+}
+
+// Извлекает роль пользователя из контекста
+func GetRoleFromContext(ctx context.Context) (string, error) {
+	role, ok := ctx.Value(roleKey).(string)
+	if !ok || role == "" {
+		return "", fmt.Errorf("role not found in context")
+	}
+	return role, nil
+}
+
 func sendJSONError(w http.ResponseWriter, code int, message string) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(code)
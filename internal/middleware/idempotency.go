@@ -0,0 +1,175 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/Misha-Glazunov/bank-api/internal/models"
+	"github.com/Misha-Glazunov/bank-api/internal/repositories"
+)
+
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	IdempotentReplayedHeader  = "Idempotent-Replayed"
+	maxIdempotencyKeyLength   = 255
+	maxIdempotentRequestBytes = 5 << 20 // не меньше предельного размера файла пакетных платежей
+)
+
+// Возвращает middleware, которое сохраняет первый ответ на запрос с заголовком
+// Idempotency-Key и отдает его при повторах с тем же ключом. Ключи хранятся
+// отдельно для каждого пользователя, поэтому middleware ставится после AuthMiddleware.
+// Пока запрос выполняется, повторы получают 409; если ответ не сохранен за
+// lockTimeout, ключ считается брошенным и его занимает следующий запрос.
+func Idempotency(repo repositories.IdempotencyRepository, retention, lockTimeout time.Duration, logger *logrus.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyKeyHeader)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				sendJSONError(w, http.StatusBadRequest, "Idempotency-Key is too long")
+				return
+			}
+
+			userID, err := GetUserIDFromContext(r.Context())
+			if err != nil {
+				sendJSONError(w, http.StatusUnauthorized, "Unauthorized")
+				return
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentRequestBytes))
+			if err != nil {
+				sendJSONError(w, http.StatusRequestEntityTooLarge, "Request body too large")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			record := &models.IdempotencyRecord{
+				UserID:      userID,
+				Key:         key,
+				RequestHash: requestHash(r, body),
+			}
+
+			reserved, err := repo.Reserve(r.Context(), record, retention, lockTimeout)
+			if err != nil {
+				logger.Errorf("Idempotency key reservation failed: %v", err)
+				sendJSONError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+			if !reserved {
+				replayIdempotent(w, r, repo, record, logger)
+				return
+			}
+
+			recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+			defer func() {
+				// Ответ не сохранен, если обработчик упал или вернул ошибку сервера:
+				// клиент может безопасно повторить запрос. Отказ в доступе и превышение
+				// числа попыток тоже не сохраняются: операция не выполнялась, а повтор
+				// с кодом подтверждения X-2FA-Code должен пройти с тем же ключом.
+				if p := recover(); p != nil {
+					repo.Release(r.Context(), userID, key)
+					panic(p)
+				}
+				if recorder.status >= http.StatusInternalServerError ||
+					recorder.status == http.StatusForbidden ||
+					recorder.status == http.StatusTooManyRequests {
+					if err := repo.Release(r.Context(), userID, key); err != nil {
+						logger.Errorf("Idempotency key release failed: %v", err)
+					}
+					return
+				}
+				// Ответ с одноразовыми данными (Cache-Control: no-store) не сохраняется,
+				// но ключ остается занятым, чтобы повтор не выполнил операцию еще раз
+				body := recorder.body.Bytes()
+				if recorder.Header().Get("Cache-Control") == "no-store" {
+					body = []byte{}
+				}
+				contentType := recorder.Header().Get("Content-Type")
+				if err := repo.Complete(r.Context(), userID, key, recorder.status, contentType, body); err != nil {
+					logger.Errorf("Idempotent response store failed: %v", err)
+				}
+			}()
+
+			next.ServeHTTP(recorder, r)
+		})
+	}
+}
+
+func replayIdempotent(
+	w http.ResponseWriter,
+	r *http.Request,
+	repo repositories.IdempotencyRepository,
+	record *models.IdempotencyRecord,
+	logger *logrus.Logger,
+) {
+	stored, err := repo.Get(r.Context(), record.UserID, record.Key)
+	if err != nil {
+		if errors.Is(err, repositories.ErrIdempotencyKeyNotFound) {
+			// Ключ освободили между попытками резервирования
+			sendJSONError(w, http.StatusConflict, "Request with this Idempotency-Key is in progress")
+			return
+		}
+		logger.Errorf("Idempotency key lookup failed: %v", err)
+		sendJSONError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	switch {
+	case stored.RequestHash != record.RequestHash:
+		sendJSONError(w, http.StatusUnprocessableEntity, "Idempotency-Key was used with a different request")
+	case stored.InProgress():
+		sendJSONError(w, http.StatusConflict, "Request with this Idempotency-Key is in progress")
+	case len(stored.ResponseBody) == 0:
+		sendJSONError(w, http.StatusConflict, "Request with this Idempotency-Key was completed; its response cannot be replayed")
+	default:
+		w.Header().Set("Content-Type", stored.ResponseContentType)
+		w.Header().Set(IdempotentReplayedHeader, "true")
+		w.WriteHeader(stored.ResponseCode)
+		w.Write(stored.ResponseBody)
+	}
+}
+
+// Отпечаток запроса: метод, путь с параметрами и тело
+func requestHash(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method))
+	h.Write([]byte{0})
+	h.Write([]byte(r.URL.Path))
+	h.Write([]byte{0})
+	h.Write([]byte(r.URL.RawQuery))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Пишет ответ клиенту и одновременно сохраняет статус и тело
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	body        bytes.Buffer
+	wroteHeader bool
+}
+
+func (rec *responseRecorder) WriteHeader(code int) {
+	if !rec.wroteHeader {
+		rec.status = code
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	rec.wroteHeader = true
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Misha-Glazunov/bank-api/pkg/crypto"
+)
+
+const (
+	MerchantIDHeader        = "X-Merchant-Id"
+	MerchantTimestampHeader = "X-Timestamp"
+	MerchantSignatureHeader = "X-Signature"
+	maxMerchantRequestBytes = 1 << 20
+)
+
+const merchantIDKey contextKey = "merchantID"
+
+// Строка, которую мерчант подписывает HMAC-SHA256 своим секретом:
+// время запроса в секундах Unix, метод, путь с параметрами и тело через перевод строки
+func MerchantSigningString(timestamp, method, requestURI string, body []byte) string {
+	return timestamp + "\n" + method + "\n" + requestURI + "\n" + string(body)
+}
+
+// Возвращает middleware, которое проверяет подпись запроса мерчанта.
+// Подпись с отметкой времени старше tolerance отклоняется, чтобы ограничить повтор запроса.
+func MerchantAuth(secrets map[string]string, tolerance time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			merchantID := r.Header.Get(MerchantIDHeader)
+			timestamp := r.Header.Get(MerchantTimestampHeader)
+			signature := r.Header.Get(MerchantSignatureHeader)
+			if merchantID == "" || timestamp == "" || signature == "" {
+				sendJSONError(w, http.StatusUnauthorized, "Merchant signature headers required")
+				return
+			}
+
+			secret, ok := secrets[merchantID]
+			if !ok {
+				sendJSONError(w, http.StatusUnauthorized, "Invalid merchant signature")
+				return
+			}
+
+			seconds, err := strconv.ParseInt(timestamp, 10, 64)
+			if err != nil {
+				sendJSONError(w, http.StatusUnauthorized, "Invalid merchant signature")
+				return
+			}
+			if skew := time.Since(time.Unix(seconds, 0)); skew > tolerance || skew < -tolerance {
+				sendJSONError(w, http.StatusUnauthorized, "Request timestamp is outside the allowed window")
+				return
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxMerchantRequestBytes))
+			if err != nil {
+				sendJSONError(w, http.StatusRequestEntityTooLarge, "Request body too large")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			payload := MerchantSigningString(timestamp, r.Method, r.URL.RequestURI(), body)
+			if !crypto.VerifyHMAC(payload, []byte(secret), signature) {
+				sendJSONError(w, http.StatusUnauthorized, "Invalid merchant signature")
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), merchantIDKey, merchantID)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// Извлекает идентификатор мерчанта из контекста
+func GetMerchantIDFromContext(ctx context.Context) (string, error) {
+	merchantID, ok := ctx.Value(merchantIDKey).(string)
+	if !ok || merchantID == "" {
+		return "", fmt.Errorf("merchant ID not found in context")
+	}
+	return merchantID, nil
+}
@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Корзины пользователей, не обращавшихся к API дольше этого срока, удаляются:
+// за это время корзина в любом случае заполнилась бы полностью
+const rateLimitIdleTTL = 2 * time.Minute
+
+// Возвращает middleware, ограничивающее число запросов пользователя в минуту.
+// Лимит действует как корзина токенов: за минуту без запросов можно сделать
+// requestsPerMinute запросов подряд, дальше - по одному каждые 60/requestsPerMinute
+// секунд. Счетчики хранятся в памяти процесса отдельно для каждого пользователя,
+// поэтому middleware ставится после AuthMiddleware.
+func RateLimit(requestsPerMinute int) func(http.Handler) http.Handler {
+	limiter := &rateLimiter{
+		capacity: float64(requestsPerMinute),
+		rate:     float64(requestsPerMinute) / time.Minute.Seconds(),
+		buckets:  make(map[string]*tokenBucket),
+		now:      time.Now,
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, err := GetUserIDFromContext(r.Context())
+			if err != nil {
+				sendJSONError(w, http.StatusUnauthorized, "Unauthorized")
+				return
+			}
+
+			if wait, ok := limiter.allow(userID); !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				sendJSONError(w, http.StatusTooManyRequests, "Too many requests")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+type rateLimiter struct {
+	mu        sync.Mutex
+	capacity  float64
+	rate      float64 // токенов в секунду
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// Списывает токен из корзины пользователя. Если токенов нет, возвращает false
+// и время до появления следующего.
+func (l *rateLimiter) allow(key string) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastSweep) > rateLimitIdleTTL {
+		for k, b := range l.buckets {
+			if now.Sub(b.updated) > rateLimitIdleTTL {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: l.capacity, updated: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.capacity, b.tokens+now.Sub(b.updated).Seconds()*l.rate)
+	b.updated = now
+
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / l.rate * float64(time.Second)), false
+	}
+	b.tokens--
+	return 0, true
+}
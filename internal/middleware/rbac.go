@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"net/http"
+)
+
+// Возвращает middleware, пропускающее только пользователей с одной из ролей.
+// Подключается после AuthMiddleware, которое кладет роль в контекст.
+func RequireRole(roles ...string) func(http.Handler) http.Handler {
+	allowed := make(map[string]bool, len(roles))
+	for _, role := range roles {
+		allowed[role] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			role, err := GetRoleFromContext(r.Context())
+			if err != nil {
+				sendJSONError(w, http.StatusUnauthorized, "Unauthorized")
+				return
+			}
+			if !allowed[role] {
+				sendJSONError(w, http.StatusForbidden, "Insufficient role")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -1,11 +1,46 @@
 package models
 
-import "time"
+import (
+	"time"
 
+	"github.com/Misha-Glazunov/bank-api/pkg/money"
+)
+
+// Статусы счета
+const (
+	AccountStatusActive = "active"
+	AccountStatusClosed = "closed"
+)
+
+// Типы продуктов, под которые открывается счет
+const (
+	ProductTypeCurrent = "current"
+	ProductTypeSavings = "savings"
+	// Счет срочного вклада; списания до окончания срока запрещены
+	ProductTypeTermDeposit = "term_deposit"
+)
+
+// Balance - баланс по главной книге; AvailableBalance - баланс за вычетом
+// действующих удержаний, из которого выполняются списания
 type Account struct {
-	ID        string    `json:"id" db:"id"`
-	UserID    string    `json:"user_id" db:"user_id"`
-	Balance   float64   `json:"balance" db:"balance"`
-	Currency  string    `json:"currency" db:"currency"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	ID               string      `json:"id" db:"id"`
+	UserID           string      `json:"user_id" db:"user_id"`
+	Balance          money.Money `json:"balance" db:"balance"`
+	AvailableBalance money.Money `json:"available_balance"`
+	Currency         string      `json:"currency" db:"currency"`
+	ProductType      string      `json:"product_type" db:"product_type"`
+	Status           string      `json:"status" db:"status"`
+	CreatedAt        time.Time   `json:"created_at" db:"created_at"`
+	ClosedAt         *time.Time  `json:"closed_at,omitempty" db:"closed_at"`
+	// Дата заморозки сотрудником банка; замороженный счет принимает зачисления,
+	// но списания с него запрещены
+	FrozenAt *time.Time `json:"frozen_at,omitempty" db:"frozen_at"`
+}
+
+func (a *Account) IsClosed() bool {
+	return a.Status == AccountStatusClosed
+}
+
+func (a *Account) IsFrozen() bool {
+	return a.FrozenAt != nil
 }
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"time"
+
+	"github.com/Misha-Glazunov/bank-api/pkg/money"
+)
+
+// Действия сотрудников, которые пишутся в журнал аудита
+const (
+	AuditActionSearchUsers     = "user.search"
+	AuditActionViewUser        = "user.view"
+	AuditActionChangeRole      = "user.change_role"
+	AuditActionViewAccount     = "account.view"
+	AuditActionFreezeAccount   = "account.freeze"
+	AuditActionUnfreezeAccount = "account.unfreeze"
+	AuditActionAdjustBalance   = "account.adjust"
+	AuditActionSetLimits       = "account.set_limits"
+	AuditActionFreezeCard      = "card.freeze"
+	AuditActionUnfreezeCard    = "card.unfreeze"
+	AuditActionReverseEntry    = "ledger.reverse"
+	AuditActionReconcile       = "ledger.reconcile"
+	AuditActionViewAudit       = "audit.view"
+)
+
+// Типы объектов действий сотрудников
+const (
+	AuditTargetUser    = "user"
+	AuditTargetAccount = "account"
+	AuditTargetCard    = "card"
+	AuditTargetEntry   = "journal_entry"
+	AuditTargetLedger  = "ledger"
+	AuditTargetAudit   = "audit_log"
+)
+
+// Запись журнала аудита. Для поиска пользователей объектом служит строка поиска.
+type AuditRecord struct {
+	ID         string            `json:"id"`
+	ActorID    string            `json:"actor_id"`
+	Action     string            `json:"action"`
+	TargetType string            `json:"target_type"`
+	TargetID   string            `json:"target_id"`
+	Reason     string            `json:"reason,omitempty"`
+	Details    map[string]string `json:"details,omitempty"`
+	CreatedAt  time.Time         `json:"created_at"`
+}
+
+// Параметры выборки журнала аудита; пустые поля не ограничивают выборку
+type AuditFilter struct {
+	ActorID    string
+	TargetType string
+	TargetID   string
+	Before     *time.Time
+	Limit      int
+}
+
+// Карточка клиента для сотрудника банка
+type UserOverview struct {
+	User     *User      `json:"user"`
+	Accounts []*Account `json:"accounts"`
+	Cards    []*Card    `json:"cards"`
+}
+
+// Ручная корректировка баланса: зачисление (credit) или списание (debit) суммы
+type BalanceAdjustment struct {
+	Direction string      `json:"direction"`
+	Amount    money.Money `json:"amount"`
+	Reason    string      `json:"reason"`
+}
@@ -0,0 +1,172 @@
+package models
+
+import (
+	"time"
+
+	"github.com/Misha-Glazunov/bank-api/pkg/money"
+)
+
+// Режимы исполнения пакета платежей
+const (
+	// Пакет исполняется целиком в одной транзакции либо отклоняется полностью
+	BulkModeAllOrNothing = "all_or_nothing"
+	// Каждый перевод исполняется независимо, отклоняются только ошибочные
+	BulkModeBestEffort = "best_effort"
+)
+
+// Статусы ISO 20022 для отчета pain.002
+const (
+	PaymentStatusAccepted          = "ACSC"
+	PaymentStatusPartiallyAccepted = "PART"
+	PaymentStatusRejected          = "RJCT"
+)
+
+// Коды причин отклонения ISO 20022 (ExternalStatusReason1Code)
+const (
+	ReasonIncorrectAccountNumber = "AC01"
+	ReasonInvalidCreditorAccount = "AC03"
+	ReasonClosedAccount          = "AC04"
+	ReasonTransactionForbidden   = "AG01"
+	ReasonNotAllowedAmount       = "AM02"
+	ReasonNotAllowedCurrency     = "AM03"
+	ReasonInsufficientFunds      = "AM04"
+	ReasonDuplication            = "AM05"
+	ReasonInvalidControlSum      = "AM10"
+	ReasonInvalidAmount          = "AM12"
+	ReasonInvalidNumberOfTxs     = "AM18"
+	ReasonInvalidFileFormat      = "FF01"
+	ReasonNarrative              = "NARR"
+)
+
+// Платежное поручение из файла pain.001
+type BulkPayment struct {
+	MessageID            string
+	NumberOfTransactions string
+	ControlSum           string
+	Instructions         []*BulkInstruction
+}
+
+// Блок PmtInf: переводы с одного счета плательщика
+type BulkInstruction struct {
+	PaymentInfoID        string
+	DebtorAccount        string
+	NumberOfTransactions string
+	ControlSum           string
+	Transfers            []*BulkTransfer
+}
+
+// Перевод CdtTrfTxInf. Amount пуст, если сумму не удалось разобрать.
+type BulkTransfer struct {
+	InstructionID   string
+	EndToEndID      string
+	Amount          *money.Money
+	CreditorAccount string
+	CreditorName    string
+	RemittanceInfo  string
+}
+
+// Отчет о статусе пакета для ответа pain.002
+type BulkPaymentReport struct {
+	MessageID            string                   `json:"message_id"`
+	Mode                 string                   `json:"mode"`
+	Status               string                   `json:"status"`
+	Reason               string                   `json:"reason,omitempty"`
+	Details              string                   `json:"details,omitempty"`
+	NumberOfTransactions int                      `json:"number_of_transactions"`
+	ControlSum           string                   `json:"control_sum"`
+	CreatedAt            time.Time                `json:"created_at"`
+	Instructions         []*BulkInstructionStatus `json:"instructions"`
+}
+
+type BulkInstructionStatus struct {
+	PaymentInfoID string                `json:"payment_info_id"`
+	Status        string                `json:"status"`
+	Transfers     []*BulkTransferStatus `json:"transfers"`
+}
+
+type BulkTransferStatus struct {
+	InstructionID string `json:"instruction_id,omitempty"`
+	EndToEndID    string `json:"end_to_end_id"`
+	Status        string `json:"status"`
+	Reason        string `json:"reason,omitempty"`
+	Details       string `json:"details,omitempty"`
+}
+
+// Запись об импортированном пакете; защищает от повторного исполнения файла
+type BulkPaymentBatch struct {
+	ID                   string
+	UserID               string
+	MessageID            string
+	Mode                 string
+	Status               string
+	NumberOfTransactions int
+	ControlSum           money.Money
+	CreatedAt            time.Time
+}
+
+// Отклоняет пакет целиком на уровне группы
+func (r *BulkPaymentReport) Reject(reason, details string) {
+	r.Status = PaymentStatusRejected
+	r.Reason = reason
+	r.Details = details
+	for _, instruction := range r.Instructions {
+		instruction.Status = PaymentStatusRejected
+		for _, transfer := range instruction.Transfers {
+			transfer.Status = PaymentStatusRejected
+		}
+	}
+}
+
+// Отклоняет переводы, которые не были исполнены или были откачены вместе с пакетом
+func (r *BulkPaymentReport) RejectPending(details string) {
+	for _, instruction := range r.Instructions {
+		for _, transfer := range instruction.Transfers {
+			if transfer.Status != PaymentStatusRejected {
+				transfer.Reject(ReasonNarrative, details)
+			}
+		}
+	}
+	r.Summarize()
+}
+
+// Выводит статусы блоков PmtInf и группы из статусов переводов
+func (r *BulkPaymentReport) Summarize() {
+	var accepted, total int
+	for _, instruction := range r.Instructions {
+		instruction.Status = summaryStatus(instruction.Transfers)
+		for _, transfer := range instruction.Transfers {
+			if transfer.Status == PaymentStatusAccepted {
+				accepted++
+			}
+			total++
+		}
+	}
+	r.Status = statusFromCounts(accepted, total)
+}
+
+func (s *BulkTransferStatus) Reject(reason, details string) {
+	s.Status = PaymentStatusRejected
+	s.Reason = reason
+	s.Details = details
+}
+
+func summaryStatus(transfers []*BulkTransferStatus) string {
+	accepted := 0
+	for _, transfer := range transfers {
+		if transfer.Status == PaymentStatusAccepted {
+			accepted++
+		}
+	}
+	return statusFromCounts(accepted, len(transfers))
+}
+
+func statusFromCounts(accepted, total int) string {
+	switch {
+	case accepted == 0:
+		return PaymentStatusRejected
+	case accepted == total:
+		return PaymentStatusAccepted
+	default:
+		return PaymentStatusPartiallyAccepted
+	}
+}
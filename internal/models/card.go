@@ -1,12 +1,89 @@
 package models
 
-import "time"
+import (
+    "time"
+
+    "github.com/Misha-Glazunov/bank-api/pkg/money"
+)
+
+// Статусы карты
+const (
+    CardStatusActive = "active"
+    // Временная блокировка владельцем, снимается разблокировкой
+    CardStatusBlocked = "blocked"
+    // Постоянная блокировка: карта утеряна, украдена или перевыпущена
+    CardStatusClosed = "closed"
+)
+
+// Причины постоянной блокировки карты
+const (
+    CardBlockReasonLost     = "lost"
+    CardBlockReasonStolen   = "stolen"
+    CardBlockReasonReissued = "reissued"
+    // Превышено число неверных PIN или реквизитов карты подряд
+    CardBlockReasonTooManyAttempts = "too_many_attempts"
+)
 
 type Card struct {
-    ID        string    `json:"id" db:"id"`
-    UserID    string    `json:"user_id" db:"user_id"`
-    Number    string    `json:"number" db:"number"`
-    Expiry    string    `json:"expiry" db:"expiry"`
-    CVV       string    `json:"-"`
-    CreatedAt time.Time `json:"created_at" db:"created_at"`
+    ID              string     `json:"id" db:"id"`
+    UserID          string     `json:"user_id" db:"user_id"`
+    // Счет, с которого списываются операции по карте
+    AccountID       string     `json:"account_id,omitempty" db:"account_id"`
+    // Полный номер заполняется только в ответе привилегированного API раскрытия номера
+    Number          string     `json:"number,omitempty"`
+    MaskedNumber    string     `json:"masked_number" db:"number_masked"`
+    PaymentSystem   string     `json:"payment_system" db:"payment_system"`
+    Expiry          string     `json:"expiry" db:"expiry"`
+    Status          string     `json:"status" db:"status"`
+    BlockReason     string     `json:"block_reason,omitempty" db:"block_reason"`
+    StatusChangedAt *time.Time `json:"status_changed_at,omitempty" db:"status_changed_at"`
+    // Карта, выпущенная взамен этой
+    ReplacedBy      string     `json:"replaced_by,omitempty" db:"replaced_by"`
+    PINSet          bool       `json:"pin_set"`
+    PINHash         string     `json:"-" db:"pin_hash"`
+    // Неверные PIN подряд; сбрасывается при смене PIN
+    PINAttempts     int        `json:"-" db:"pin_failed_attempts"`
+    // Заполняется только в ответе на выпуск карты; в базе хранится хеш
+    CVV             string     `json:"cvv,omitempty"`
+    CVVHash         string     `json:"-" db:"cvv_hash"`
+    // Авторизации подряд с неверными сроком действия или CVV
+    CVVAttempts     int        `json:"-" db:"cvv_failed_attempts"`
+    CreatedAt       time.Time  `json:"created_at" db:"created_at"`
+    // Дата заморозки сотрудником банка; снимается только сотрудником
+    FrozenAt        *time.Time `json:"frozen_at,omitempty" db:"frozen_at"`
+}
+
+func (c *Card) IsFrozen() bool {
+    return c.FrozenAt != nil
 }
+
+// Карта действует до конца месяца, указанного в сроке MM/YY
+func (c *Card) IsExpired(now time.Time) bool {
+    expiry, err := time.Parse("01/06", c.Expiry)
+    if err != nil {
+        return true
+    }
+    return !now.Before(expiry.AddDate(0, 1, 0))
+}
+
+// Лимиты и ограничения расходных операций по карте. Пустая сумма означает
+// отсутствие ограничения, незаданный переключатель - разрешенные операции.
+type CardLimits struct {
+    PerTransaction *money.Money `json:"per_transaction,omitempty"`
+    Daily          *money.Money `json:"daily,omitempty"`
+    Monthly        *money.Money `json:"monthly,omitempty"`
+    OnlineEnabled  *bool        `json:"online_enabled"`
+    OfflineEnabled *bool        `json:"offline_enabled"`
+    ForeignEnabled *bool        `json:"foreign_enabled"`
+    // Если список разрешенных MCC не пуст, операции с другими кодами отклоняются
+    AllowedMCC     []string     `json:"allowed_mcc"`
+    BlockedMCC     []string     `json:"blocked_mcc"`
+}
+
+// Каналы карточной операции
+const (
+    // Оплата без карты: интернет-магазины, подписки
+    CardChannelOnline = "online"
+    // Оплата картой в терминале
+    CardChannelOffline = "offline"
+)
@@ -0,0 +1,103 @@
+package models
+
+import (
+	"time"
+
+	"github.com/Misha-Glazunov/bank-api/pkg/money"
+)
+
+// Статусы авторизации карточного платежа
+const (
+	// Средства удерживаются на счете до списания, отмены или истечения срока
+	CardAuthorizationAuthorized = "authorized"
+	CardAuthorizationCaptured   = "captured"
+	CardAuthorizationVoided     = "voided"
+	// Списанная сумма полностью возвращена
+	CardAuthorizationRefunded = "refunded"
+)
+
+// Причины отказа в авторизации, возвращаемые мерчанту
+const (
+	DeclineInvalidCard       = "invalid_card"
+	DeclineInvalidExpiry     = "invalid_expiry"
+	DeclineInvalidCVV        = "invalid_cvv"
+	DeclineExpiredCard       = "expired_card"
+	DeclineCardBlocked       = "card_blocked"
+	DeclineCardClosed        = "card_closed"
+	DeclineAccountClosed     = "account_closed"
+	DeclineAccountFrozen     = "account_frozen"
+	DeclineCurrencyMismatch  = "currency_mismatch"
+	DeclineInsufficientFunds = "insufficient_funds"
+	DeclineLimitExceeded     = "limit_exceeded"
+	DeclineEmailNotVerified  = "email_not_verified"
+	// Ограничения, установленные владельцем карты
+	DeclineCardTransactionLimit = "card_transaction_limit"
+	DeclineCardDailyLimit       = "card_daily_limit"
+	DeclineCardMonthlyLimit     = "card_monthly_limit"
+	DeclineOnlineDisabled       = "online_disabled"
+	DeclineOfflineDisabled      = "offline_disabled"
+	DeclineForeignDisabled      = "foreign_disabled"
+	DeclineMCCNotAllowed        = "mcc_not_allowed"
+	DeclineMCCBlocked           = "mcc_blocked"
+)
+
+// Запрос мерчанта на авторизацию платежа по реквизитам карты.
+// Сумма без валюты считается суммой в валюте счета карты, операция без канала -
+// онлайн-операцией, без страны - операцией в стране банка.
+type CardAuthorizationRequest struct {
+	PAN         string      `json:"pan"`
+	Expiry      string      `json:"expiry"`
+	CVV         string      `json:"cvv"`
+	Amount      money.Money `json:"amount"`
+	Currency    string      `json:"currency"`
+	Reference   string      `json:"reference"`
+	Description string      `json:"description"`
+	MCC         string      `json:"mcc"`
+	Channel     string      `json:"channel"`
+	Country     string      `json:"country"`
+}
+
+// Авторизация карточного платежа; reference уникален в пределах мерчанта
+type CardAuthorization struct {
+	ID             string      `json:"id" db:"id"`
+	CardID         string      `json:"-" db:"card_id"`
+	AccountID      string      `json:"-" db:"account_id"`
+	HoldID         string      `json:"-" db:"hold_id"`
+	MaskedNumber   string      `json:"masked_number"`
+	MerchantID     string      `json:"merchant_id" db:"merchant_id"`
+	Reference      string      `json:"reference" db:"reference"`
+	Description    string      `json:"description,omitempty" db:"description"`
+	MCC            string      `json:"mcc,omitempty" db:"mcc"`
+	Channel        string      `json:"channel" db:"channel"`
+	Country        string      `json:"country,omitempty" db:"country"`
+	Amount         money.Money `json:"amount" db:"amount"`
+	CapturedAmount money.Money `json:"captured_amount" db:"captured_amount"`
+	RefundedAmount money.Money `json:"refunded_amount" db:"refunded_amount"`
+	Currency       string      `json:"currency" db:"currency"`
+	Status         string      `json:"status" db:"status"`
+	ExpiresAt      time.Time   `json:"expires_at" db:"expires_at"`
+	CreatedAt      time.Time   `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time   `json:"updated_at" db:"updated_at"`
+}
+
+// Запрос мерчанта на возврат. Reference уникален в пределах авторизации;
+// без суммы возвращается весь остаток списанной суммы.
+type CardRefundRequest struct {
+	Reference string       `json:"reference"`
+	Amount    *money.Money `json:"amount"`
+}
+
+// Возврат по карточному платежу
+type CardRefund struct {
+	ID              string      `json:"id" db:"id"`
+	AuthorizationID string      `json:"authorization_id" db:"authorization_id"`
+	Reference       string      `json:"reference" db:"reference"`
+	Amount          money.Money `json:"amount" db:"amount"`
+	EntryID         string      `json:"-" db:"entry_id"`
+	CreatedAt       time.Time   `json:"created_at" db:"created_at"`
+}
+
+// Удерживает ли авторизация средства на момент now
+func (a *CardAuthorization) IsHeld(now time.Time) bool {
+	return a.Status == CardAuthorizationAuthorized && now.Before(a.ExpiresAt)
+}
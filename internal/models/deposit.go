@@ -0,0 +1,72 @@
+package models
+
+import (
+	"time"
+
+	"github.com/Misha-Glazunov/bank-api/pkg/money"
+)
+
+// Виды вкладов
+const (
+	DepositKindTerm     = "term"
+	DepositKindOnDemand = "on_demand"
+)
+
+// Статусы вклада
+const (
+	DepositStatusActive  = "active"
+	DepositStatusMatured = "matured"
+	DepositStatusClosed  = "closed"
+)
+
+// Продукт вклада. Задана либо фиксированная ставка Rate,
+// либо надбавка KeyRateMargin к ключевой ставке ЦБ.
+type DepositProduct struct {
+	Code                string      `json:"code"`
+	Name                string      `json:"name"`
+	Kind                string      `json:"kind"`
+	Rate                string      `json:"rate,omitempty"`
+	KeyRateMargin       string      `json:"key_rate_margin,omitempty"`
+	TermMonths          int         `json:"term_months,omitempty"`
+	MinAmount           money.Money `json:"min_amount"`
+	EarlyWithdrawalRate string      `json:"early_withdrawal_rate"`
+}
+
+// Рассчитывается ли ставка от ключевой ставки ЦБ
+func (p *DepositProduct) KeyRatePegged() bool {
+	return p.Rate == ""
+}
+
+// Заявка на открытие вклада с переводом суммы с другого счета
+type DepositApplication struct {
+	ProductCode   string
+	FromAccountID string
+	Amount        money.Money
+}
+
+type Deposit struct {
+	ID            string      `json:"id"`
+	UserID        string      `json:"user_id"`
+	AccountID     string      `json:"account_id"`
+	ProductCode   string      `json:"product_code"`
+	Kind          string      `json:"kind"`
+	AnnualRate    string      `json:"annual_rate"`
+	Balance       money.Money `json:"balance"`
+	Accrued       string      `json:"accrued_interest"`
+	InterestPaid  money.Money `json:"interest_paid"`
+	OpenedOn      time.Time   `json:"opened_on"`
+	MaturesOn     *time.Time  `json:"matures_on,omitempty"`
+	LastAccruedOn time.Time   `json:"-"`
+	Status        string      `json:"status"`
+	CreatedAt     time.Time   `json:"created_at"`
+	ClosedAt      *time.Time  `json:"closed_at,omitempty"`
+}
+
+// Начисление процентов за один день на остаток на конец дня
+type DepositAccrual struct {
+	DepositID  string      `json:"-"`
+	Date       time.Time   `json:"date"`
+	Balance    money.Money `json:"balance"`
+	AnnualRate string      `json:"annual_rate"`
+	Amount     string      `json:"amount"`
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	"github.com/Misha-Glazunov/bank-api/pkg/money"
+)
+
+// Статусы удержания средств на счете
+const (
+	HoldStatusActive   = "active"
+	HoldStatusReleased = "released"
+	HoldStatusExpired  = "expired"
+)
+
+// Источники удержания
+const (
+	// Резерв, установленный владельцем счета
+	HoldSourceManual = "manual"
+	// Удержание под авторизацию карточного платежа; снимается при списании или отмене
+	HoldSourceCardAuthorization = "card_authorization"
+)
+
+// Запрос на удержание; без срока удержание действует до снятия
+type HoldRequest struct {
+	Amount    money.Money `json:"amount"`
+	Reason    string      `json:"reason"`
+	ExpiresAt *time.Time  `json:"expires_at"`
+}
+
+// Удержание уменьшает доступный остаток счета, но не его баланс
+type Hold struct {
+	ID         string      `json:"id" db:"id"`
+	AccountID  string      `json:"account_id" db:"account_id"`
+	Amount     money.Money `json:"amount" db:"amount"`
+	Currency   string      `json:"currency" db:"currency"`
+	Reason     string      `json:"reason" db:"reason"`
+	Source     string      `json:"source" db:"source"`
+	Status     string      `json:"status" db:"status"`
+	ExpiresAt  *time.Time  `json:"expires_at,omitempty" db:"expires_at"`
+	CreatedAt  time.Time   `json:"created_at" db:"created_at"`
+	ReleasedAt *time.Time  `json:"released_at,omitempty" db:"released_at"`
+}
+
+func (h *Hold) IsActive() bool {
+	return h.Status == HoldStatusActive
+}
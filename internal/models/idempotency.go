@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// Сохраненный результат запроса с ключом идемпотентности
+type IdempotencyRecord struct {
+	UserID              string
+	Key                 string
+	RequestHash         string
+	ResponseCode        int
+	ResponseContentType string
+	ResponseBody        []byte
+	CreatedAt           time.Time
+	ExpiresAt           time.Time
+}
+
+// Запрос еще обрабатывается, ответ не сохранен
+func (r *IdempotencyRecord) InProgress() bool {
+	return r.ResponseCode == 0
+}
@@ -0,0 +1,83 @@
+package models
+
+import (
+	"time"
+
+	"github.com/Misha-Glazunov/bank-api/pkg/money"
+)
+
+// Типы проводок журнала
+const (
+	EntryTypeTransfer   = "transfer"
+	EntryTypeDeposit    = "deposit"
+	EntryTypeWithdrawal = "withdrawal"
+	EntryTypeFee        = "fee"
+	EntryTypeInterest   = "interest"
+	EntryTypeReversal   = "reversal"
+	EntryTypeOpening    = "opening_balance"
+
+	EntryTypeLoanDisbursement = "loan_disbursement"
+	EntryTypeLoanRepayment    = "loan_repayment"
+
+	EntryTypeCardPayment = "card_payment"
+	EntryTypeCardRefund  = "card_refund"
+
+	EntryTypeAdjustment = "adjustment"
+)
+
+// Сторона проводки. Баланс счета равен сумме кредитов минус сумма дебетов.
+const (
+	PostingDebit  = "debit"
+	PostingCredit = "credit"
+)
+
+// Коды внутренних счетов банка, которые создаются по одному на валюту
+const (
+	SystemAccountCash            = "cash"
+	SystemAccountFeeIncome       = "fee_income"
+	SystemAccountInterestExpense = "interest_expense"
+	SystemAccountOpening         = "opening_balance"
+	SystemAccountFXPosition      = "fx_position"
+	SystemAccountLoanPortfolio   = "loan_portfolio"
+	SystemAccountInterestIncome  = "interest_income"
+	SystemAccountPenaltyIncome   = "penalty_income"
+	// Расчеты с платежными системами по карточным операциям
+	SystemAccountCardSettlement = "card_settlement"
+	// Ручные корректировки балансов клиентов
+	SystemAccountAdjustments = "adjustments"
+)
+
+// Запись журнала: набор сбалансированных проводок по счетам
+type JournalEntry struct {
+	ID          string    `json:"id" db:"id"`
+	Type        string    `json:"type" db:"type"`
+	Description string    `json:"description" db:"description"`
+	ReversalOf  string    `json:"reversal_of,omitempty" db:"reversal_of"`
+	ReversedBy  string    `json:"reversed_by,omitempty"`
+	Postings    []Posting `json:"postings"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
+
+type Posting struct {
+	ID        string      `json:"id" db:"id"`
+	EntryID   string      `json:"entry_id" db:"entry_id"`
+	AccountID string      `json:"account_id" db:"account_id"`
+	Direction string      `json:"direction" db:"direction"`
+	Amount    money.Money `json:"amount" db:"amount"`
+	CreatedAt time.Time   `json:"created_at" db:"created_at"`
+}
+
+// Изменение баланса счета от проводки
+func (p Posting) Signed() money.Money {
+	if p.Direction == PostingDebit {
+		return p.Amount.Neg()
+	}
+	return p.Amount
+}
+
+// Расхождение кэшированного баланса счета с суммой его проводок
+type BalanceMismatch struct {
+	AccountID     string      `json:"account_id"`
+	CachedBalance money.Money `json:"cached_balance"`
+	LedgerBalance money.Money `json:"ledger_balance"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import "github.com/Misha-Glazunov/bank-api/pkg/money"
+
+// Виды лимитов на исходящие операции
+const (
+	LimitMaxTransfer     = "max_transfer"
+	LimitOverdraft       = "overdraft"
+	LimitDailyOutgoing   = "daily_outgoing"
+	LimitMonthlyOutgoing = "monthly_outgoing"
+)
+
+// Лимиты счета в его валюте. Пустое значение означает отсутствие ограничения,
+// для овердрафта — нулевой овердрафт.
+type AccountLimits struct {
+	MaxTransfer     *money.Money `json:"max_transfer,omitempty"`
+	Overdraft       *money.Money `json:"overdraft,omitempty"`
+	DailyOutgoing   *money.Money `json:"daily_outgoing,omitempty"`
+	MonthlyOutgoing *money.Money `json:"monthly_outgoing,omitempty"`
+}
+
+// Индивидуальные лимиты счета, задаваемые сотрудником с обязательной причиной.
+// Незаданный лимит возвращается к значению по умолчанию.
+type AccountLimitsUpdate struct {
+	AccountLimits
+	Reason string `json:"reason"`
+}
+
+// Действующие лимиты счета и остаток по ним на текущий период
+type LimitsStatus struct {
+	AccountLimits
+	Available        money.Money  `json:"available"`
+	DailyRemaining   *money.Money `json:"daily_remaining,omitempty"`
+	MonthlyRemaining *money.Money `json:"monthly_remaining,omitempty"`
+}
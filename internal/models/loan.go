@@ -0,0 +1,95 @@
+package models
+
+import (
+	"time"
+
+	"github.com/Misha-Glazunov/bank-api/pkg/money"
+)
+
+// Виды графика платежей
+const (
+	LoanScheduleAnnuity        = "annuity"
+	LoanScheduleDifferentiated = "differentiated"
+)
+
+// Статусы кредита
+const (
+	LoanStatusActive = "active"
+	LoanStatusClosed = "closed"
+)
+
+// Статусы платежа по графику
+const (
+	InstallmentPending = "pending"
+	InstallmentOverdue = "overdue"
+	InstallmentPaid    = "paid"
+)
+
+// Способ пересчета графика после досрочного погашения
+const (
+	RepaymentReducePayment = "reduce_payment"
+	RepaymentReduceTerm    = "reduce_term"
+)
+
+// Кредитный продукт. Ставки — годовые проценты в виде десятичной строки.
+type LoanProduct struct {
+	Code          string      `json:"code"`
+	Name          string      `json:"name"`
+	Margin        string      `json:"margin"`
+	MinAmount     money.Money `json:"min_amount"`
+	MaxAmount     money.Money `json:"max_amount"`
+	MinTermMonths int         `json:"min_term_months"`
+	MaxTermMonths int         `json:"max_term_months"`
+	PenaltyRate   string      `json:"penalty_rate"`
+}
+
+// Заявка на кредит
+type LoanApplication struct {
+	ProductCode  string
+	AccountID    string
+	Amount       money.Money
+	TermMonths   int
+	ScheduleType string
+}
+
+type Loan struct {
+	ID               string             `json:"id"`
+	UserID           string             `json:"user_id"`
+	AccountID        string             `json:"account_id"`
+	ProductCode      string             `json:"product_code"`
+	Principal        money.Money        `json:"principal"`
+	Outstanding      money.Money        `json:"outstanding"`
+	Currency         string             `json:"currency"`
+	KeyRate          string             `json:"key_rate"`
+	AnnualRate       string             `json:"annual_rate"`
+	PenaltyRate      string             `json:"penalty_rate"`
+	ScheduleType     string             `json:"schedule_type"`
+	TermMonths       int                `json:"term_months"`
+	Status           string             `json:"status"`
+	DisbursedOn      time.Time          `json:"disbursed_on"`
+	PenaltyAccruedOn time.Time          `json:"-"`
+	CreatedAt        time.Time          `json:"created_at"`
+	ClosedAt         *time.Time         `json:"closed_at,omitempty"`
+	Installments     []*LoanInstallment `json:"installments,omitempty"`
+}
+
+// Платеж по графику и погашенные по нему суммы
+type LoanInstallment struct {
+	ID            string      `json:"id"`
+	LoanID        string      `json:"loan_id"`
+	Number        int         `json:"number"`
+	DueDate       time.Time   `json:"due_date"`
+	Principal     money.Money `json:"principal"`
+	Interest      money.Money `json:"interest"`
+	Penalty       money.Money `json:"penalty"`
+	PaidPrincipal money.Money `json:"paid_principal"`
+	PaidInterest  money.Money `json:"paid_interest"`
+	PaidPenalty   money.Money `json:"paid_penalty"`
+	Status        string      `json:"status"`
+	PaidAt        *time.Time  `json:"paid_at,omitempty"`
+}
+
+// Непогашенный остаток платежа: неустойка, проценты и основной долг
+func (i *LoanInstallment) Due() (penalty, interest, principal money.Money) {
+	return i.Penalty.Sub(i.PaidPenalty), i.Interest.Sub(i.PaidInterest), i.Principal.Sub(i.PaidPrincipal)
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"time"
+
+	"github.com/Misha-Glazunov/bank-api/pkg/money"
+)
+
+// Периодичность регулярного перевода
+const (
+	RecurrenceOnce     = "once"
+	RecurrenceDaily    = "daily"
+	RecurrenceWeekly   = "weekly"
+	RecurrenceMonthly  = "monthly"
+	RecurrenceMonthEnd = "month_end"
+)
+
+// Статусы регулярного перевода
+const (
+	ScheduledPaymentActive    = "active"
+	ScheduledPaymentPaused    = "paused"
+	ScheduledPaymentCompleted = "completed"
+	ScheduledPaymentCancelled = "cancelled"
+	ScheduledPaymentFailed    = "failed"
+)
+
+// Результаты исполнения
+const (
+	ScheduledRunSucceeded = "succeeded"
+	ScheduledRunRetrying  = "retrying"
+	ScheduledRunFailed    = "failed"
+)
+
+// Отложенный или регулярный перевод. ScheduledFor — плановая дата текущего
+// исполнения, NextRunAt — время следующей попытки с учетом повторов.
+type ScheduledPayment struct {
+	ID           string      `json:"id"`
+	UserID       string      `json:"user_id"`
+	FromAccount  string      `json:"from_account"`
+	ToAccount    string      `json:"to_account"`
+	Amount       money.Money `json:"amount"`
+	Currency     string      `json:"currency"`
+	Recurrence   string      `json:"recurrence"`
+	DayOfMonth   int         `json:"day_of_month,omitempty"`
+	ScheduledFor time.Time   `json:"scheduled_for"`
+	NextRunAt    time.Time   `json:"next_run_at"`
+	EndAt        *time.Time  `json:"end_at,omitempty"`
+	Attempts     int         `json:"attempts"`
+	Status       string      `json:"status"`
+	LastError    string      `json:"last_error,omitempty"`
+	CreatedAt    time.Time   `json:"created_at"`
+	UpdatedAt    time.Time   `json:"updated_at"`
+}
+
+// Запись об исполнении регулярного перевода
+type ScheduledPaymentRun struct {
+	ID                 string    `json:"id"`
+	ScheduledPaymentID string    `json:"scheduled_payment_id"`
+	ScheduledFor       time.Time `json:"scheduled_for"`
+	Attempt            int       `json:"attempt"`
+	Status             string    `json:"status"`
+	Error              string    `json:"error,omitempty"`
+	CreatedAt          time.Time `json:"created_at"`
+}
+
+// Изменение регулярного перевода; nil-поля не меняются
+type ScheduledPaymentUpdate struct {
+	Amount *money.Money
+	Status *string
+	EndAt  *time.Time
+}
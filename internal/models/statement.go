@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"github.com/Misha-Glazunov/bank-api/pkg/money"
+)
+
+// Направления проводок по счету
+const (
+	DirectionCredit = "credit"
+	DirectionDebit  = "debit"
+)
+
+// Выписка по счету за период [From, To). Входящий остаток плюс поступления
+// минус списания равен исходящему остатку.
+type Statement struct {
+	AccountID      string           `json:"account_id"`
+	Currency       string           `json:"currency"`
+	From           time.Time        `json:"from"`
+	To             time.Time        `json:"to"`
+	OpeningBalance money.Money      `json:"opening_balance"`
+	ClosingBalance money.Money      `json:"closing_balance"`
+	TotalCredits   money.Money      `json:"total_credits"`
+	TotalDebits    money.Money      `json:"total_debits"`
+	CreditCount    int              `json:"credit_count"`
+	DebitCount     int              `json:"debit_count"`
+	Lines          []*StatementLine `json:"lines"`
+	GeneratedAt    time.Time        `json:"generated_at"`
+}
+
+// Строка выписки — проводка журнала по счету
+type StatementLine struct {
+	EntryID       string      `json:"entry_id"`
+	TransactionID string      `json:"transaction_id,omitempty"`
+	Type          string      `json:"type"`
+	Description   string      `json:"description"`
+	Direction     string      `json:"direction"`
+	Amount        money.Money `json:"amount"`
+	Counterparty  string      `json:"counterparty,omitempty"`
+	BookedAt      time.Time   `json:"booked_at"`
+	Balance       money.Money `json:"balance"`
+}
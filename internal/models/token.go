@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Утверждения access-токена. ID (jti) используется для отзыва токена,
+// SessionID - для отзыва всей сессии, к которой он выдан. Role - роль
+// пользователя на момент выдачи; токен без роли принадлежит клиенту.
+type AccessClaims struct {
+	SessionID string `json:"sid"`
+	Role      string `json:"role,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Токены, выдаваемые при входе и обновлении сессии
+type TokenPair struct {
+	AccessToken      string    `json:"token"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	RefreshToken     string    `json:"refresh_token"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+// Refresh-токен сессии; сам токен не хранится, только его хеш.
+// FamilyID совпадает с идентификатором сессии в access-токенах.
+type RefreshToken struct {
+	ID              string
+	UserID          string
+	FamilyID        string
+	TokenHash       string
+	AccessTokenID   string
+	AccessExpiresAt time.Time
+	ExpiresAt       time.Time
+	CreatedAt       time.Time
+	UsedAt          *time.Time
+	RevokedAt       *time.Time
+}
@@ -1,12 +1,65 @@
 package models
 
-import "time"
+import (
+    "time"
+
+    "github.com/Misha-Glazunov/bank-api/pkg/money"
+)
+
+// Типы операций по счету
+const (
+    TransactionTypeTransfer         = "transfer"
+    TransactionTypeDeposit          = "deposit"
+    TransactionTypeWithdrawal       = "withdrawal"
+    TransactionTypeLoanDisbursement = "loan_disbursement"
+    TransactionTypeLoanRepayment    = "loan_repayment"
+    TransactionTypeInterest         = "interest"
+    TransactionTypeCardPayment      = "card_payment"
+    TransactionTypeCardRefund       = "card_refund"
+    TransactionTypeAdjustment       = "adjustment"
+)
 
 type Transaction struct {
-    ID          string    `json:"id" db:"id"`
-    FromAccount string    `json:"from_account" db:"from_account"`
-    ToAccount   string    `json:"to_account" db:"to_account"`
-    Amount      float64   `json:"amount" db:"amount"`
-    Type        string    `json:"type" db:"type"`
-    CreatedAt   time.Time `json:"created_at" db:"created_at"`
+    ID          string      `json:"id" db:"id"`
+    FromAccount string      `json:"from_account,omitempty" db:"from_account"`
+    ToAccount   string      `json:"to_account,omitempty" db:"to_account"`
+    Amount      money.Money `json:"amount" db:"amount"`
+    Currency    string      `json:"currency" db:"currency"`
+    Type        string      `json:"type" db:"type"`
+    EntryID     string      `json:"entry_id,omitempty" db:"entry_id"`
+    CreatedAt   time.Time   `json:"created_at" db:"created_at"`
+
+    // Заполняются для переводов между счетами в разных валютах
+    ExchangeRate      string       `json:"exchange_rate,omitempty" db:"exchange_rate"`
+    ConvertedAmount   *money.Money `json:"converted_amount,omitempty" db:"converted_amount"`
+    ConvertedCurrency string       `json:"converted_currency,omitempty" db:"converted_currency"`
+}
+
+// Поля, по которым можно сортировать историю операций
+const (
+    TransactionSortCreatedAt = "created_at"
+    TransactionSortAmount    = "amount"
+)
+
+// Параметры выборки истории операций по счету
+type TransactionFilter struct {
+    AccountID string
+    From      *time.Time
+    To        *time.Time
+    Types     []string
+    MinAmount *money.Money
+    MaxAmount *money.Money
+    SortBy    string
+    SortDesc  bool
+    Limit     int
+
+    // Ключ последней записи предыдущей страницы
+    AfterValue string
+    AfterID    string
+}
+
+// Страница истории операций с курсором на следующую страницу
+type TransactionPage struct {
+    Transactions []*Transaction `json:"transactions"`
+    NextCursor   string         `json:"next_cursor,omitempty"`
 }
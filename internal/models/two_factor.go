@@ -0,0 +1,59 @@
+package models
+
+import "time"
+
+// Секрет TOTP пользователя. Секрет действует только после подтверждения кодом.
+type TOTP struct {
+	UserID         string
+	Secret         string
+	ConfirmedAt    *time.Time
+	LastUsedStep   int64
+	FailedAttempts int
+	LockedUntil    *time.Time
+	CreatedAt      time.Time
+}
+
+func (t *TOTP) IsConfirmed() bool {
+	return t.ConfirmedAt != nil
+}
+
+// Данные для добавления секрета в приложение-аутентификатор
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+// Состояние двухфакторной аутентификации пользователя
+type TwoFactorStatus struct {
+	Enabled              bool       `json:"enabled"`
+	EnabledAt            *time.Time `json:"enabled_at,omitempty"`
+	BackupCodesRemaining int        `json:"backup_codes_remaining"`
+}
+
+// Резервные коды показываются один раз: в базе хранятся только их хеши
+type BackupCodes struct {
+	Codes []string `json:"backup_codes"`
+}
+
+// Второй шаг входа; хранится хеш токена
+type LoginChallenge struct {
+	ID        string
+	UserID    string
+	TokenHash string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+	UsedAt    *time.Time
+}
+
+// Токен второго шага входа, выдаваемый клиенту
+type TwoFactorChallenge struct {
+	Token     string    `json:"challenge_token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Результат проверки пароля: пара токенов или, если включена
+// двухфакторная аутентификация, токен второго шага
+type LoginResult struct {
+	*TokenPair
+	Challenge *TwoFactorChallenge `json:"two_factor_challenge,omitempty"`
+}
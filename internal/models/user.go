@@ -2,10 +2,34 @@ package models
 
 import "time"
 
+// Роли пользователей. Операционист просматривает данные клиентов и замораживает
+// счета и карты; администратору доступны также корректировки баланса и смена ролей.
+const (
+    RoleCustomer = "customer"
+    RoleOperator = "operator"
+    RoleAdmin    = "admin"
+)
+
 type User struct {
-    ID           string    `json:"id"`
-    Email        string    `json:"email" validate:"required,email"`
-    Username     string    `json:"username" validate:"required,alphanum"`
-    PasswordHash string    `json:"-"`
-    CreatedAt    time.Time `json:"created_at"`
+    ID              string     `json:"id"`
+    Email           string     `json:"email" validate:"required,email"`
+    Username        string     `json:"username" validate:"required,alphanum"`
+    PasswordHash    string     `json:"-"`
+    Role            string     `json:"role"`
+    CreatedAt       time.Time  `json:"created_at"`
+    EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+}
+
+// Пользователь подтвердил адрес электронной почты
+func (u *User) IsEmailVerified() bool {
+    return u.EmailVerifiedAt != nil
+}
+
+// Сотрудник банка: операционист или администратор
+func IsStaffRole(role string) bool {
+    return role == RoleOperator || role == RoleAdmin
+}
+
+func IsValidRole(role string) bool {
+    return role == RoleCustomer || IsStaffRole(role)
 }
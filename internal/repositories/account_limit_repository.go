@@ -0,0 +1,122 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/Misha-Glazunov/bank-api/internal/models"
+	"github.com/Misha-Glazunov/bank-api/pkg/money"
+)
+
+type AccountLimitRepository interface {
+	Get(ctx context.Context, accountID, currency string) (*models.AccountLimits, error)
+	Upsert(ctx context.Context, accountID string, limits *models.AccountLimits) error
+	LockOwner(ctx context.Context, userID string) error
+}
+
+type PostgresAccountLimitRepository struct {
+	db *sql.DB
+}
+
+func NewAccountLimitRepository(db *sql.DB) *PostgresAccountLimitRepository {
+	return &PostgresAccountLimitRepository{db: db}
+}
+
+// Возвращает индивидуальные лимиты счета; отсутствующие поля остаются nil
+func (r *PostgresAccountLimitRepository) Get(ctx context.Context, accountID, currency string) (*models.AccountLimits, error) {
+	query := `
+		SELECT
+			max_transfer::text,
+			overdraft::text,
+			daily_outgoing::text,
+			monthly_outgoing::text
+		FROM account_limits
+		WHERE account_id = $1`
+
+	var maxTransfer, overdraft, daily, monthly sql.NullString
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, accountID).Scan(
+		&maxTransfer,
+		&overdraft,
+		&daily,
+		&monthly,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &models.AccountLimits{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get account limits: %w", err)
+	}
+
+	limits := &models.AccountLimits{}
+	for _, f := range []struct {
+		src sql.NullString
+		dst **money.Money
+	}{
+		{maxTransfer, &limits.MaxTransfer},
+		{overdraft, &limits.Overdraft},
+		{daily, &limits.DailyOutgoing},
+		{monthly, &limits.MonthlyOutgoing},
+	} {
+		if !f.src.Valid {
+			continue
+		}
+		value, err := money.Parse(f.src.String, currency)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse account limit: %w", err)
+		}
+		*f.dst = &value
+	}
+
+	return limits, nil
+}
+
+// Сохраняет индивидуальные лимиты; nil-поля сбрасываются к значениям по умолчанию
+func (r *PostgresAccountLimitRepository) Upsert(ctx context.Context, accountID string, limits *models.AccountLimits) error {
+	query := `
+		INSERT INTO account_limits (
+			account_id,
+			max_transfer,
+			overdraft,
+			daily_outgoing,
+			monthly_outgoing
+		)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (account_id) DO UPDATE SET
+			max_transfer = EXCLUDED.max_transfer,
+			overdraft = EXCLUDED.overdraft,
+			daily_outgoing = EXCLUDED.daily_outgoing,
+			monthly_outgoing = EXCLUDED.monthly_outgoing,
+			updated_at = CURRENT_TIMESTAMP`
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, query,
+		accountID,
+		nullMoney(limits.MaxTransfer),
+		nullMoney(limits.Overdraft),
+		nullMoney(limits.DailyOutgoing),
+		nullMoney(limits.MonthlyOutgoing),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save account limits: %w", err)
+	}
+	return nil
+}
+
+// Сериализует проверки лимитов пользователя до конца текущей транзакции,
+// чтобы параллельные списания с разных счетов не превысили общий лимит
+func (r *PostgresAccountLimitRepository) LockOwner(ctx context.Context, userID string) error {
+	query := `SELECT pg_advisory_xact_lock(hashtext('limits:' || $1))`
+
+	if _, err := conn(ctx, r.db).ExecContext(ctx, query, userID); err != nil {
+		return fmt.Errorf("failed to lock user limits: %w", err)
+	}
+	return nil
+}
+
+func nullMoney(m *money.Money) interface{} {
+	if m == nil {
+		return nil
+	}
+	return *m
+}
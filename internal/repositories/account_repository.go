@@ -18,8 +18,12 @@ var (
 type AccountRepository interface {
 	Create(ctx context.Context, account *models.Account) error
 	GetByID(ctx context.Context, id string) (*models.Account, error)
+	GetByIDForUpdate(ctx context.Context, id string) (*models.Account, error)
 	GetByUserID(ctx context.Context, userID string) ([]*models.Account, error)
-	UpdateBalance(ctx context.Context, accountID string, amount float64) error
+	IsDelegate(ctx context.Context, accountID, userID string) (bool, error)
+	UpdateStatus(ctx context.Context, id, status string) error
+	UpdateProductType(ctx context.Context, id, productType string) error
+	SetFrozen(ctx context.Context, id string, frozen bool) error
 }
 
 type PostgresAccountRepository struct {
@@ -30,21 +34,75 @@ func NewAccountRepository(db *sql.DB) *PostgresAccountRepository {
 	return &PostgresAccountRepository{db: db}
 }
 
+// Колонки счета в порядке, ожидаемом scanAccount
+const accountColumns = `
+			id, 
+			COALESCE(user_id::text, ''), 
+			balance, 
+			balance - COALESCE((
+				SELECT SUM(h.amount) FROM account_holds h
+				WHERE h.account_id = accounts.id AND h.status = 'active'
+			), 0),
+			currency, 
+			product_type,
+			status,
+			created_at,
+			closed_at,
+			frozen_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAccount(row rowScanner) (*models.Account, error) {
+	var account models.Account
+	var closedAt, frozenAt sql.NullTime
+	err := row.Scan(
+		&account.ID,
+		&account.UserID,
+		&account.Balance,
+		&account.AvailableBalance,
+		&account.Currency,
+		&account.ProductType,
+		&account.Status,
+		&account.CreatedAt,
+		&closedAt,
+		&frozenAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	account.Balance.Currency = account.Currency
+	account.AvailableBalance.Currency = account.Currency
+	if closedAt.Valid {
+		account.ClosedAt = &closedAt.Time
+	}
+	if frozenAt.Valid {
+		account.FrozenAt = &frozenAt.Time
+	}
+	return &account, nil
+}
+
 func (r *PostgresAccountRepository) Create(ctx context.Context, account *models.Account) error {
 	query := `
 		INSERT INTO accounts (
 			user_id, 
 			balance, 
 			currency, 
+			product_type,
+			status,
 			created_at
 		) 
-		VALUES ($1, $2, $3, $4) 
+		VALUES ($1, $2, $3, $4, $5, $6) 
 		RETURNING id, created_at`
 
-	err := r.db.QueryRowContext(ctx, query,
+	err := conn(ctx, r.db).QueryRowContext(ctx, query,
 		account.UserID,
 		account.Balance,
 		account.Currency,
+		account.ProductType,
+		account.Status,
 		time.Now(),
 	).Scan(&account.ID, &account.CreatedAt)
 
@@ -56,25 +114,25 @@ func (r *PostgresAccountRepository) Create(ctx context.Context, account *models.
 }
 
 func (r *PostgresAccountRepository) GetByID(ctx context.Context, id string) (*models.Account, error) {
+	return r.getByID(ctx, id, false)
+}
+
+// Читает счет и блокирует строку до конца текущей транзакции
+func (r *PostgresAccountRepository) GetByIDForUpdate(ctx context.Context, id string) (*models.Account, error) {
+	return r.getByID(ctx, id, true)
+}
+
+func (r *PostgresAccountRepository) getByID(ctx context.Context, id string, forUpdate bool) (*models.Account, error) {
 	query := `
-		SELECT 
-			id, 
-			user_id, 
-			balance, 
-			currency, 
-			created_at 
+		SELECT ` + accountColumns + ` 
 		FROM accounts 
 		WHERE id = $1`
+	if forUpdate {
+		query += `
+		FOR UPDATE`
+	}
 
-	var account models.Account
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
-		&account.ID,
-		&account.UserID,
-		&account.Balance,
-		&account.Currency,
-		&account.CreatedAt,
-	)
-
+	account, err := scanAccount(conn(ctx, r.db).QueryRowContext(ctx, query, id))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrAccountNotFound
@@ -82,21 +140,17 @@ func (r *PostgresAccountRepository) GetByID(ctx context.Context, id string) (*mo
 		return nil, fmt.Errorf("failed to get account: %w", err)
 	}
 
-	return &account, nil
+	return account, nil
 }
 
 func (r *PostgresAccountRepository) GetByUserID(ctx context.Context, userID string) ([]*models.Account, error) {
 	query := `
-		SELECT 
-			id, 
-			user_id, 
-			balance, 
-			currency, 
-			created_at 
+		SELECT ` + accountColumns + ` 
 		FROM accounts 
-		WHERE user_id = $1`
+		WHERE user_id = $1
+		ORDER BY created_at, id`
 
-	rows, err := r.db.QueryContext(ctx, query, userID)
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, userID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query accounts: %w", err)
 	}
@@ -104,17 +158,11 @@ func (r *PostgresAccountRepository) GetByUserID(ctx context.Context, userID stri
 
 	var accounts []*models.Account
 	for rows.Next() {
-		var account models.Account
-		if err := rows.Scan(
-			&account.ID,
-			&account.UserID,
-			&account.Balance,
-			&account.Currency,
-			&account.CreatedAt,
-		); err != nil {
+		account, err := scanAccount(rows)
+		if err != nil {
 			return nil, fmt.Errorf("failed to scan account: %w", err)
 		}
-		accounts = append(accounts, &account)
+		accounts = append(accounts, account)
 	}
 
 	if err := rows.Err(); err != nil {
@@ -124,22 +172,80 @@ func (r *PostgresAccountRepository) GetByUserID(ctx context.Context, userID stri
 	return accounts, nil
 }
 
-func (r *PostgresAccountRepository) UpdateBalance(ctx context.Context, accountID string, amount float64) error {
+// Проверяет, доверил ли владелец счета управление им пользователю
+func (r *PostgresAccountRepository) IsDelegate(ctx context.Context, accountID, userID string) (bool, error) {
+	query := `SELECT EXISTS(SELECT 1 FROM account_delegates WHERE account_id = $1 AND user_id = $2)`
+
+	var exists bool
+	if err := conn(ctx, r.db).QueryRowContext(ctx, query, accountID, userID).Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to check account delegate: %w", err)
+	}
+	return exists, nil
+}
+
+// Меняет статус счета; при закрытии фиксирует дату закрытия
+func (r *PostgresAccountRepository) UpdateStatus(ctx context.Context, id, status string) error {
 	query := `
-		UPDATE accounts 
-		SET balance = balance + $1 
+		UPDATE accounts
+		SET status = $1,
+			closed_at = CASE WHEN $1 = 'closed' THEN CURRENT_TIMESTAMP ELSE closed_at END
 		WHERE id = $2`
 
-	result, err := r.db.ExecContext(ctx, query, amount, accountID)
+	result, err := conn(ctx, r.db).ExecContext(ctx, query, status, id)
 	if err != nil {
-		return fmt.Errorf("failed to update balance: %w", err)
+		return fmt.Errorf("failed to update account status: %w", err)
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
 		return fmt.Errorf("failed to get rows affected: %w", err)
 	}
+	if rowsAffected == 0 {
+		return ErrAccountNotFound
+	}
+
+	return nil
+}
+
+// Переводит счет на другой продукт, например срочный вклад по окончании срока
+func (r *PostgresAccountRepository) UpdateProductType(ctx context.Context, id, productType string) error {
+	query := `
+		UPDATE accounts
+		SET product_type = $1
+		WHERE id = $2`
+
+	result, err := conn(ctx, r.db).ExecContext(ctx, query, productType, id)
+	if err != nil {
+		return fmt.Errorf("failed to update account product type: %w", err)
+	}
 
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrAccountNotFound
+	}
+
+	return nil
+}
+
+// Замораживает счет или снимает заморозку; повторная заморозка не меняет ее дату
+func (r *PostgresAccountRepository) SetFrozen(ctx context.Context, id string, frozen bool) error {
+	query := `
+		UPDATE accounts
+		SET frozen_at = CASE WHEN $1 THEN COALESCE(frozen_at, CURRENT_TIMESTAMP) END
+		WHERE id = $2`
+
+	result, err := conn(ctx, r.db).ExecContext(ctx, query, frozen, id)
+	if err != nil {
+		return fmt.Errorf("failed to update account freeze: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
 	if rowsAffected == 0 {
 		return ErrAccountNotFound
 	}
@@ -0,0 +1,137 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/Misha-Glazunov/bank-api/internal/models"
+)
+
+type AuditRepository interface {
+	Create(ctx context.Context, record *models.AuditRecord) error
+	List(ctx context.Context, filter models.AuditFilter) ([]*models.AuditRecord, error)
+}
+
+type PostgresAuditRepository struct {
+	db *sql.DB
+}
+
+func NewAuditRepository(db *sql.DB) *PostgresAuditRepository {
+	return &PostgresAuditRepository{db: db}
+}
+
+func (r *PostgresAuditRepository) Create(ctx context.Context, record *models.AuditRecord) error {
+	var details interface{}
+	if len(record.Details) > 0 {
+		raw, err := json.Marshal(record.Details)
+		if err != nil {
+			return fmt.Errorf("failed to encode audit details: %w", err)
+		}
+		details = string(raw)
+	}
+
+	query := `
+		INSERT INTO audit_log (
+			actor_id,
+			action,
+			target_type,
+			target_id,
+			reason,
+			details
+		)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at`
+
+	err := conn(ctx, r.db).QueryRowContext(ctx, query,
+		record.ActorID,
+		record.Action,
+		record.TargetType,
+		record.TargetID,
+		nullString(record.Reason),
+		details,
+	).Scan(&record.ID, &record.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create audit record: %w", err)
+	}
+	return nil
+}
+
+// Записи журнала от новых к старым
+func (r *PostgresAuditRepository) List(ctx context.Context, filter models.AuditFilter) ([]*models.AuditRecord, error) {
+	var conditions []string
+	var args []interface{}
+	addCondition := func(format string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(format, len(args)))
+	}
+
+	if filter.ActorID != "" {
+		addCondition("actor_id = $%d", filter.ActorID)
+	}
+	if filter.TargetType != "" {
+		addCondition("target_type = $%d", filter.TargetType)
+	}
+	if filter.TargetID != "" {
+		addCondition("target_id = $%d", filter.TargetID)
+	}
+	if filter.Before != nil {
+		addCondition("created_at < $%d", *filter.Before)
+	}
+
+	query := `
+		SELECT
+			id,
+			actor_id,
+			action,
+			target_type,
+			target_id,
+			reason,
+			details,
+			created_at
+		FROM audit_log`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	args = append(args, filter.Limit)
+	query += fmt.Sprintf(" ORDER BY created_at DESC, id DESC LIMIT $%d", len(args))
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit records: %w", err)
+	}
+	defer rows.Close()
+
+	records := []*models.AuditRecord{}
+	for rows.Next() {
+		var record models.AuditRecord
+		var reason, details sql.NullString
+		err := rows.Scan(
+			&record.ID,
+			&record.ActorID,
+			&record.Action,
+			&record.TargetType,
+			&record.TargetID,
+			&reason,
+			&details,
+			&record.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan audit record: %w", err)
+		}
+
+		record.Reason = reason.String
+		if details.Valid {
+			if err := json.Unmarshal([]byte(details.String), &record.Details); err != nil {
+				return nil, fmt.Errorf("failed to decode audit details: %w", err)
+			}
+		}
+		records = append(records, &record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list audit records: %w", err)
+	}
+	return records, nil
+}
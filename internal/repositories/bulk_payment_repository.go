@@ -0,0 +1,67 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/Misha-Glazunov/bank-api/internal/models"
+)
+
+type BulkPaymentRepository interface {
+	CreateBatch(ctx context.Context, batch *models.BulkPaymentBatch) (bool, error)
+	UpdateBatchStatus(ctx context.Context, id, status string) error
+}
+
+type PostgresBulkPaymentRepository struct {
+	db *sql.DB
+}
+
+func NewBulkPaymentRepository(db *sql.DB) *PostgresBulkPaymentRepository {
+	return &PostgresBulkPaymentRepository{db: db}
+}
+
+// Регистрирует пакет; возвращает false, если сообщение с таким MsgId уже импортировано
+func (r *PostgresBulkPaymentRepository) CreateBatch(ctx context.Context, batch *models.BulkPaymentBatch) (bool, error) {
+	query := `
+		INSERT INTO bulk_payment_batches (
+			user_id,
+			message_id,
+			mode,
+			status,
+			number_of_transactions,
+			control_sum
+		)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (user_id, message_id) DO NOTHING
+		RETURNING id, created_at`
+
+	err := conn(ctx, r.db).QueryRowContext(ctx, query,
+		batch.UserID,
+		batch.MessageID,
+		batch.Mode,
+		batch.Status,
+		batch.NumberOfTransactions,
+		batch.ControlSum,
+	).Scan(&batch.ID, &batch.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to create bulk payment batch: %w", err)
+	}
+	return true, nil
+}
+
+func (r *PostgresBulkPaymentRepository) UpdateBatchStatus(ctx context.Context, id, status string) error {
+	query := `
+		UPDATE bulk_payment_batches
+		SET status = $2
+		WHERE id = $1`
+
+	if _, err := conn(ctx, r.db).ExecContext(ctx, query, id, status); err != nil {
+		return fmt.Errorf("failed to update bulk payment batch: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,273 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+
+	"github.com/Misha-Glazunov/bank-api/internal/models"
+	"github.com/Misha-Glazunov/bank-api/pkg/money"
+)
+
+var (
+	ErrCardAuthorizationNotFound = errors.New("card authorization not found")
+	ErrDuplicateAuthorization    = errors.New("authorization reference already exists")
+	ErrCardRefundNotFound        = errors.New("card refund not found")
+	ErrDuplicateRefund           = errors.New("refund reference already exists")
+)
+
+type CardAuthorizationRepository interface {
+	Create(ctx context.Context, authorization *models.CardAuthorization) error
+	Get(ctx context.Context, merchantID, id string) (*models.CardAuthorization, error)
+	GetForUpdate(ctx context.Context, merchantID, id string) (*models.CardAuthorization, error)
+	Update(ctx context.Context, authorization *models.CardAuthorization) error
+	SumSpent(ctx context.Context, cardID, currency, period string) (money.Money, error)
+	CreateRefund(ctx context.Context, refund *models.CardRefund) error
+	GetRefund(ctx context.Context, authorizationID, reference string) (*models.CardRefund, error)
+}
+
+type PostgresCardAuthorizationRepository struct {
+	db *sql.DB
+}
+
+func NewCardAuthorizationRepository(db *sql.DB) *PostgresCardAuthorizationRepository {
+	return &PostgresCardAuthorizationRepository{db: db}
+}
+
+const cardAuthorizationColumns = `
+			a.id,
+			a.card_id,
+			a.account_id,
+			COALESCE(a.hold_id::text, ''),
+			c.number_masked,
+			a.merchant_id,
+			a.reference,
+			a.description,
+			a.mcc,
+			a.channel,
+			a.country,
+			a.amount,
+			a.captured_amount,
+			a.refunded_amount,
+			a.currency,
+			a.status,
+			a.expires_at,
+			a.created_at,
+			a.updated_at`
+
+func scanCardAuthorization(row rowScanner) (*models.CardAuthorization, error) {
+	var a models.CardAuthorization
+	err := row.Scan(
+		&a.ID,
+		&a.CardID,
+		&a.AccountID,
+		&a.HoldID,
+		&a.MaskedNumber,
+		&a.MerchantID,
+		&a.Reference,
+		&a.Description,
+		&a.MCC,
+		&a.Channel,
+		&a.Country,
+		&a.Amount,
+		&a.CapturedAmount,
+		&a.RefundedAmount,
+		&a.Currency,
+		&a.Status,
+		&a.ExpiresAt,
+		&a.CreatedAt,
+		&a.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	a.Amount.Currency = a.Currency
+	a.CapturedAmount.Currency = a.Currency
+	a.RefundedAmount.Currency = a.Currency
+	return &a, nil
+}
+
+func (r *PostgresCardAuthorizationRepository) Create(ctx context.Context, a *models.CardAuthorization) error {
+	query := `
+		INSERT INTO card_authorizations (
+			card_id,
+			account_id,
+			hold_id,
+			merchant_id,
+			reference,
+			description,
+			mcc,
+			channel,
+			country,
+			amount,
+			currency,
+			status,
+			expires_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		RETURNING id, created_at, updated_at`
+
+	err := conn(ctx, r.db).QueryRowContext(ctx, query,
+		a.CardID,
+		a.AccountID,
+		nullString(a.HoldID),
+		a.MerchantID,
+		a.Reference,
+		a.Description,
+		a.MCC,
+		a.Channel,
+		a.Country,
+		a.Amount,
+		a.Currency,
+		a.Status,
+		a.ExpiresAt,
+	).Scan(&a.ID, &a.CreatedAt, &a.UpdatedAt)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return ErrDuplicateAuthorization
+		}
+		return fmt.Errorf("failed to create card authorization: %w", err)
+	}
+
+	a.CapturedAmount = money.Zero(a.Currency)
+	a.RefundedAmount = money.Zero(a.Currency)
+	return nil
+}
+
+// Авторизация мерчанта; чужие авторизации не видны
+func (r *PostgresCardAuthorizationRepository) Get(ctx context.Context, merchantID, id string) (*models.CardAuthorization, error) {
+	return r.get(ctx, merchantID, id, false)
+}
+
+func (r *PostgresCardAuthorizationRepository) GetForUpdate(ctx context.Context, merchantID, id string) (*models.CardAuthorization, error) {
+	return r.get(ctx, merchantID, id, true)
+}
+
+func (r *PostgresCardAuthorizationRepository) get(ctx context.Context, merchantID, id string, forUpdate bool) (*models.CardAuthorization, error) {
+	query := `SELECT` + cardAuthorizationColumns + `
+		FROM card_authorizations a
+		JOIN cards c ON c.id = a.card_id
+		WHERE a.merchant_id = $1 AND a.id = $2`
+	if forUpdate {
+		query += `
+		FOR UPDATE OF a`
+	}
+
+	a, err := scanCardAuthorization(conn(ctx, r.db).QueryRowContext(ctx, query, merchantID, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrCardAuthorizationNotFound
+		}
+		return nil, fmt.Errorf("failed to get card authorization: %w", err)
+	}
+	return a, nil
+}
+
+func (r *PostgresCardAuthorizationRepository) Update(ctx context.Context, a *models.CardAuthorization) error {
+	query := `
+		UPDATE card_authorizations
+		SET status = $2,
+			captured_amount = $3,
+			refunded_amount = $4,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING updated_at`
+
+	err := conn(ctx, r.db).QueryRowContext(ctx, query,
+		a.ID,
+		a.Status,
+		a.CapturedAmount,
+		a.RefundedAmount,
+	).Scan(&a.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to update card authorization: %w", err)
+	}
+	return nil
+}
+
+// Расходы по карте с начала текущих суток или месяца: действующие удержания
+// и списанные суммы без учета возвратов
+func (r *PostgresCardAuthorizationRepository) SumSpent(ctx context.Context, cardID, currency, period string) (money.Money, error) {
+	query := `
+		SELECT COALESCE(SUM(CASE WHEN a.status = 'authorized' THEN a.amount ELSE a.captured_amount END), 0)
+		FROM card_authorizations a
+		LEFT JOIN account_holds h ON h.id = a.hold_id
+		WHERE a.card_id = $1
+		  AND a.currency = $2
+		  AND a.created_at >= date_trunc($3, LOCALTIMESTAMP)
+		  AND (a.status IN ('captured', 'refunded') OR (a.status = 'authorized' AND h.status = 'active'))`
+
+	spent := money.Zero(currency)
+	if err := conn(ctx, r.db).QueryRowContext(ctx, query, cardID, currency, period).Scan(&spent); err != nil {
+		return money.Money{}, fmt.Errorf("failed to sum card spending: %w", err)
+	}
+	return spent, nil
+}
+
+func (r *PostgresCardAuthorizationRepository) CreateRefund(ctx context.Context, refund *models.CardRefund) error {
+	query := `
+		INSERT INTO card_refunds (
+			authorization_id,
+			reference,
+			amount,
+			currency,
+			entry_id
+		)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`
+
+	err := conn(ctx, r.db).QueryRowContext(ctx, query,
+		refund.AuthorizationID,
+		refund.Reference,
+		refund.Amount,
+		refund.Amount.Currency,
+		refund.EntryID,
+	).Scan(&refund.ID, &refund.CreatedAt)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return ErrDuplicateRefund
+		}
+		return fmt.Errorf("failed to create card refund: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresCardAuthorizationRepository) GetRefund(ctx context.Context, authorizationID, reference string) (*models.CardRefund, error) {
+	query := `
+		SELECT
+			id,
+			authorization_id,
+			reference,
+			amount,
+			currency,
+			entry_id,
+			created_at
+		FROM card_refunds
+		WHERE authorization_id = $1 AND reference = $2`
+
+	var refund models.CardRefund
+	var currency string
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, authorizationID, reference).Scan(
+		&refund.ID,
+		&refund.AuthorizationID,
+		&refund.Reference,
+		&refund.Amount,
+		&currency,
+		&refund.EntryID,
+		&refund.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrCardRefundNotFound
+		}
+		return nil, fmt.Errorf("failed to get card refund: %w", err)
+	}
+	refund.Amount.Currency = currency
+	return &refund, nil
+}
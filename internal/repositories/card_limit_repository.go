@@ -0,0 +1,143 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+
+	"github.com/Misha-Glazunov/bank-api/internal/models"
+	"github.com/Misha-Glazunov/bank-api/pkg/money"
+)
+
+type CardLimitRepository interface {
+	Get(ctx context.Context, cardID, currency string) (*models.CardLimits, error)
+	Upsert(ctx context.Context, cardID string, limits *models.CardLimits) error
+}
+
+type PostgresCardLimitRepository struct {
+	db *sql.DB
+}
+
+func NewCardLimitRepository(db *sql.DB) *PostgresCardLimitRepository {
+	return &PostgresCardLimitRepository{db: db}
+}
+
+// Возвращает лимиты карты; отсутствующие поля остаются nil
+func (r *PostgresCardLimitRepository) Get(ctx context.Context, cardID, currency string) (*models.CardLimits, error) {
+	query := `
+		SELECT
+			per_transaction::text,
+			daily::text,
+			monthly::text,
+			online_enabled,
+			offline_enabled,
+			foreign_enabled,
+			allowed_mcc,
+			blocked_mcc
+		FROM card_limits
+		WHERE card_id = $1`
+
+	var perTransaction, daily, monthly sql.NullString
+	online, offline, foreign := true, true, true
+	limits := &models.CardLimits{
+		OnlineEnabled:  &online,
+		OfflineEnabled: &offline,
+		ForeignEnabled: &foreign,
+		AllowedMCC:     []string{},
+		BlockedMCC:     []string{},
+	}
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, cardID).Scan(
+		&perTransaction,
+		&daily,
+		&monthly,
+		&online,
+		&offline,
+		&foreign,
+		(*pq.StringArray)(&limits.AllowedMCC),
+		(*pq.StringArray)(&limits.BlockedMCC),
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return limits, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get card limits: %w", err)
+	}
+
+	for _, f := range []struct {
+		src sql.NullString
+		dst **money.Money
+	}{
+		{perTransaction, &limits.PerTransaction},
+		{daily, &limits.Daily},
+		{monthly, &limits.Monthly},
+	} {
+		if !f.src.Valid {
+			continue
+		}
+		value, err := money.Parse(f.src.String, currency)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse card limit: %w", err)
+		}
+		*f.dst = &value
+	}
+
+	return limits, nil
+}
+
+// Сохраняет лимиты карты; nil-суммы снимают ограничение, nil-переключатели разрешают операции
+func (r *PostgresCardLimitRepository) Upsert(ctx context.Context, cardID string, limits *models.CardLimits) error {
+	query := `
+		INSERT INTO card_limits (
+			card_id,
+			per_transaction,
+			daily,
+			monthly,
+			online_enabled,
+			offline_enabled,
+			foreign_enabled,
+			allowed_mcc,
+			blocked_mcc
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (card_id) DO UPDATE SET
+			per_transaction = EXCLUDED.per_transaction,
+			daily = EXCLUDED.daily,
+			monthly = EXCLUDED.monthly,
+			online_enabled = EXCLUDED.online_enabled,
+			offline_enabled = EXCLUDED.offline_enabled,
+			foreign_enabled = EXCLUDED.foreign_enabled,
+			allowed_mcc = EXCLUDED.allowed_mcc,
+			blocked_mcc = EXCLUDED.blocked_mcc,
+			updated_at = CURRENT_TIMESTAMP`
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, query,
+		cardID,
+		nullMoney(limits.PerTransaction),
+		nullMoney(limits.Daily),
+		nullMoney(limits.Monthly),
+		enabled(limits.OnlineEnabled),
+		enabled(limits.OfflineEnabled),
+		enabled(limits.ForeignEnabled),
+		pq.StringArray(nonNilStrings(limits.AllowedMCC)),
+		pq.StringArray(nonNilStrings(limits.BlockedMCC)),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save card limits: %w", err)
+	}
+	return nil
+}
+
+// Незаданный переключатель разрешает операции
+func enabled(flag *bool) bool {
+	return flag == nil || *flag
+}
+
+func nonNilStrings(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
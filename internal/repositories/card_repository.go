@@ -8,86 +8,228 @@ import (
 	"time"
 
 	"github.com/Misha-Glazunov/bank-api/internal/models"
+	"github.com/Misha-Glazunov/bank-api/pkg/card"
+	"github.com/Misha-Glazunov/bank-api/pkg/crypto"
+	"github.com/lib/pq"
 	"golang.org/x/crypto/bcrypt"
 )
 
 var (
-	ErrCardNotFound = fmt.Errorf("card not found")
+	ErrCardNotFound        = fmt.Errorf("card not found")
+	ErrDuplicateCardNumber = fmt.Errorf("card number already exists")
 )
 
+// Код ошибки PostgreSQL unique_violation
+const uniqueViolation = "23505"
+
 type CardRepository interface {
 	Create(ctx context.Context, card *models.Card) error
+	GetByID(ctx context.Context, id string) (*models.Card, error)
+	GetByIDForUpdate(ctx context.Context, id string) (*models.Card, error)
 	GetByUserID(ctx context.Context, userID string) ([]*models.Card, error)
+	GetByNumber(ctx context.Context, number string) (*models.Card, error)
+	RevealNumber(ctx context.Context, id string) (string, error)
+	EncryptPlaintextBatch(ctx context.Context, limit int) (int, error)
+	UpdateStatus(ctx context.Context, card *models.Card) error
+	SetPINHash(ctx context.Context, id, pinHash string) error
+	SetPINFailedAttempts(ctx context.Context, id string, attempts int) error
+	SetCVVFailedAttempts(ctx context.Context, id string, attempts int) error
+	UpdateAccount(ctx context.Context, id, accountID string) error
+	SetFrozen(ctx context.Context, id string, frozen bool) error
 }
 
+// Номер карты хранится зашифрованным AES-GCM; для поиска по номеру и контроля
+// уникальности используется слепой индекс HMAC-SHA256. Открытый номер из базы
+// возвращает только RevealNumber.
 type PostgresCardRepository struct {
-	db *sql.DB
+	db            *sql.DB
+	encryptionKey []byte
+	hmacSecret    []byte
+}
+
+func NewCardRepository(db *sql.DB, encryptionKey, hmacSecret []byte) *PostgresCardRepository {
+	return &PostgresCardRepository{
+		db:            db,
+		encryptionKey: encryptionKey,
+		hmacSecret:    hmacSecret,
+	}
+}
+
+const cardColumns = `
+            id,
+            user_id,
+            COALESCE(account_id::text, ''),
+            number_masked,
+            payment_system,
+            expiry,
+            status,
+            block_reason,
+            status_changed_at,
+            replaced_by,
+            pin_hash,
+            pin_failed_attempts,
+            cvv_hash,
+            cvv_failed_attempts,
+            created_at,
+            frozen_at`
+
+func scanCard(row rowScanner) (*models.Card, error) {
+	var c models.Card
+	var blockReason, replacedBy, pinHash sql.NullString
+	var statusChangedAt, frozenAt sql.NullTime
+	err := row.Scan(
+		&c.ID,
+		&c.UserID,
+		&c.AccountID,
+		&c.MaskedNumber,
+		&c.PaymentSystem,
+		&c.Expiry,
+		&c.Status,
+		&blockReason,
+		&statusChangedAt,
+		&replacedBy,
+		&pinHash,
+		&c.PINAttempts,
+		&c.CVVHash,
+		&c.CVVAttempts,
+		&c.CreatedAt,
+		&frozenAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	c.BlockReason = blockReason.String
+	c.ReplacedBy = replacedBy.String
+	c.PINHash = pinHash.String
+	c.PINSet = pinHash.Valid
+	if statusChangedAt.Valid {
+		c.StatusChangedAt = &statusChangedAt.Time
+	}
+	if frozenAt.Valid {
+		c.FrozenAt = &frozenAt.Time
+	}
+	return &c, nil
 }
 
-func NewCardRepository(db *sql.DB) *PostgresCardRepository {
-	return &PostgresCardRepository{db: db}
+// Слепой индекс номера карты
+func (r *PostgresCardRepository) numberHash(number string) string {
+	return crypto.GenerateHMAC(number, r.hmacSecret)
 }
 
-func (r *PostgresCardRepository) Create(ctx context.Context, card *models.Card) error {
+func (r *PostgresCardRepository) Create(ctx context.Context, c *models.Card) error {
 	// Хеширование CVV
-	cvvHash, err := bcrypt.GenerateFromPassword([]byte(card.CVV), bcrypt.DefaultCost)
+	cvvHash, err := bcrypt.GenerateFromPassword([]byte(c.CVV), bcrypt.DefaultCost)
 	if err != nil {
 		return fmt.Errorf("failed to hash CVV: %w", err)
 	}
 
+	encrypted, err := crypto.EncryptAES([]byte(c.Number), r.encryptionKey)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt card number: %w", err)
+	}
+	c.MaskedNumber = card.MaskPAN(c.Number)
+	c.CVVHash = string(cvvHash)
+
 	query := `
         INSERT INTO cards (
             user_id,
-            number,
+            account_id,
+            number_encrypted,
+            number_hash,
+            number_masked,
+            payment_system,
             expiry,
             cvv_hash,
             created_at
         )
-        VALUES ($1, $2, $3, $4, $5)
-        RETURNING id`
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+        RETURNING id, status, created_at`
 
-	return r.db.QueryRowContext(ctx, query,
-		card.UserID,
-		card.Number,
-		card.Expiry,
+	err = conn(ctx, r.db).QueryRowContext(ctx, query,
+		c.UserID,
+		c.AccountID,
+		encrypted,
+		r.numberHash(c.Number),
+		c.MaskedNumber,
+		c.PaymentSystem,
+		c.Expiry,
 		string(cvvHash), // Используем хешированный CVV
 		time.Now(),
-	).Scan(&card.ID)
+	).Scan(&c.ID, &c.Status, &c.CreatedAt)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation &&
+			(pqErr.Constraint == "cards_number_hash_key" || pqErr.Constraint == "cards_number_key") {
+			return ErrDuplicateCardNumber
+		}
+		return fmt.Errorf("failed to create card: %w", err)
+	}
+	return nil
 }
 
-func (r *PostgresCardRepository) GetByUserID(ctx context.Context, userID string) ([]*models.Card, error) {
-	query := `
-        SELECT 
-            id, 
-            user_id, 
-            number, 
-            expiry, 
-            created_at 
-        FROM cards 
-        WHERE user_id = $1`
-
-	rows, err := r.db.QueryContext(ctx, query, userID)
+func (r *PostgresCardRepository) GetByID(ctx context.Context, id string) (*models.Card, error) {
+	return r.getByID(ctx, id, false)
+}
+
+func (r *PostgresCardRepository) GetByIDForUpdate(ctx context.Context, id string) (*models.Card, error) {
+	return r.getByID(ctx, id, true)
+}
+
+func (r *PostgresCardRepository) getByID(ctx context.Context, id string, forUpdate bool) (*models.Card, error) {
+	query := `SELECT` + cardColumns + `
+        FROM cards
+        WHERE id = $1`
+	if forUpdate {
+		query += `
+        FOR UPDATE`
+	}
+
+	c, err := scanCard(conn(ctx, r.db).QueryRowContext(ctx, query, id))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrCardNotFound
 		}
+		return nil, fmt.Errorf("failed to get card: %w", err)
+	}
+	return c, nil
+}
+
+// Поиск карты по номеру через слепой индекс
+func (r *PostgresCardRepository) GetByNumber(ctx context.Context, number string) (*models.Card, error) {
+	query := `SELECT` + cardColumns + `
+        FROM cards
+        WHERE number_hash = $1`
+
+	c, err := scanCard(conn(ctx, r.db).QueryRowContext(ctx, query, r.numberHash(number)))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrCardNotFound
+		}
+		return nil, fmt.Errorf("failed to get card: %w", err)
+	}
+	return c, nil
+}
+
+func (r *PostgresCardRepository) GetByUserID(ctx context.Context, userID string) ([]*models.Card, error) {
+	query := `SELECT` + cardColumns + `
+        FROM cards
+        WHERE user_id = $1
+        ORDER BY created_at, id`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, userID)
+	if err != nil {
 		return nil, fmt.Errorf("failed to query cards: %w", err)
 	}
 	defer rows.Close()
 
 	var cards []*models.Card
 	for rows.Next() {
-		var card models.Card
-		if err := rows.Scan(
-			&card.ID,
-			&card.UserID,
-			&card.Number,
-			&card.Expiry,
-			&card.CreatedAt,
-		); err != nil {
+		c, err := scanCard(rows)
+		if err != nil {
 			return nil, fmt.Errorf("failed to scan card: %w", err)
 		}
-		cards = append(cards, &card)
+		cards = append(cards, c)
 	}
 
 	if err := rows.Err(); err != nil {
@@ -96,3 +238,188 @@ func (r *PostgresCardRepository) GetByUserID(ctx context.Context, userID string)
 
 	return cards, nil
 }
+
+// Расшифровывает номер карты. Вызывается только из привилегированного API.
+func (r *PostgresCardRepository) RevealNumber(ctx context.Context, id string) (string, error) {
+	query := `
+        SELECT number_encrypted
+        FROM cards
+        WHERE id = $1`
+
+	var encrypted string
+	if err := conn(ctx, r.db).QueryRowContext(ctx, query, id).Scan(&encrypted); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrCardNotFound
+		}
+		return "", fmt.Errorf("failed to get card number: %w", err)
+	}
+
+	number, err := crypto.DecryptAES(encrypted, r.encryptionKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt card number: %w", err)
+	}
+	return string(number), nil
+}
+
+// Шифрует до limit номеров, сохраненных открытым текстом до включения шифрования,
+// и возвращает число зашифрованных карт. Вызывается внутри транзакции.
+func (r *PostgresCardRepository) EncryptPlaintextBatch(ctx context.Context, limit int) (int, error) {
+	rows, err := conn(ctx, r.db).QueryContext(ctx, `
+        SELECT id, number
+        FROM cards
+        WHERE number IS NOT NULL
+        ORDER BY id
+        LIMIT $1
+        FOR UPDATE SKIP LOCKED`, limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query plaintext card numbers: %w", err)
+	}
+
+	numbers := map[string]string{}
+	for rows.Next() {
+		var id, number string
+		if err := rows.Scan(&id, &number); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan card number: %w", err)
+		}
+		numbers[id] = number
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	for id, number := range numbers {
+		encrypted, err := crypto.EncryptAES([]byte(number), r.encryptionKey)
+		if err != nil {
+			return 0, fmt.Errorf("failed to encrypt card number: %w", err)
+		}
+		_, err = conn(ctx, r.db).ExecContext(ctx, `
+            UPDATE cards
+            SET number = NULL,
+                number_encrypted = $2,
+                number_hash = $3,
+                number_masked = $4
+            WHERE id = $1`,
+			id, encrypted, r.numberHash(number), card.MaskPAN(number))
+		if err != nil {
+			return 0, fmt.Errorf("failed to store encrypted card number: %w", err)
+		}
+	}
+
+	return len(numbers), nil
+}
+
+func (r *PostgresCardRepository) UpdateStatus(ctx context.Context, c *models.Card) error {
+	query := `
+        UPDATE cards
+        SET status = $2,
+            block_reason = $3,
+            status_changed_at = $4,
+            replaced_by = $5
+        WHERE id = $1`
+
+	result, err := conn(ctx, r.db).ExecContext(ctx, query,
+		c.ID,
+		c.Status,
+		nullString(c.BlockReason),
+		nullTime(c.StatusChangedAt),
+		nullString(c.ReplacedBy),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update card status: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrCardNotFound
+	}
+
+	return nil
+}
+
+// Сохраняет хеш нового PIN и сбрасывает счетчик неверных попыток
+func (r *PostgresCardRepository) SetPINHash(ctx context.Context, id, pinHash string) error {
+	query := `
+        UPDATE cards
+        SET pin_hash = $2,
+            pin_failed_attempts = 0
+        WHERE id = $1`
+
+	if _, err := conn(ctx, r.db).ExecContext(ctx, query, id, pinHash); err != nil {
+		return fmt.Errorf("failed to set card PIN: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresCardRepository) SetPINFailedAttempts(ctx context.Context, id string, attempts int) error {
+	query := `
+        UPDATE cards
+        SET pin_failed_attempts = $2
+        WHERE id = $1`
+
+	if _, err := conn(ctx, r.db).ExecContext(ctx, query, id, attempts); err != nil {
+		return fmt.Errorf("failed to record card PIN attempt: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresCardRepository) SetCVVFailedAttempts(ctx context.Context, id string, attempts int) error {
+	query := `
+        UPDATE cards
+        SET cvv_failed_attempts = $2
+        WHERE id = $1`
+
+	if _, err := conn(ctx, r.db).ExecContext(ctx, query, id, attempts); err != nil {
+		return fmt.Errorf("failed to record card CVV attempt: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresCardRepository) UpdateAccount(ctx context.Context, id, accountID string) error {
+	query := `
+        UPDATE cards
+        SET account_id = $2
+        WHERE id = $1`
+
+	result, err := conn(ctx, r.db).ExecContext(ctx, query, id, accountID)
+	if err != nil {
+		return fmt.Errorf("failed to link card to account: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrCardNotFound
+	}
+
+	return nil
+}
+
+// Замораживает карту или снимает заморозку; повторная заморозка не меняет ее дату
+func (r *PostgresCardRepository) SetFrozen(ctx context.Context, id string, frozen bool) error {
+	query := `
+        UPDATE cards
+        SET frozen_at = CASE WHEN $2 THEN COALESCE(frozen_at, CURRENT_TIMESTAMP) END
+        WHERE id = $1`
+
+	result, err := conn(ctx, r.db).ExecContext(ctx, query, id, frozen)
+	if err != nil {
+		return fmt.Errorf("failed to update card freeze: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrCardNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,397 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Misha-Glazunov/bank-api/internal/models"
+	"github.com/Misha-Glazunov/bank-api/pkg/money"
+)
+
+var (
+	ErrDepositNotFound        = errors.New("deposit not found")
+	ErrDepositProductNotFound = errors.New("deposit product not found")
+)
+
+// Даты начислений хранятся в колонках DATE
+type DepositRepository interface {
+	ListProducts(ctx context.Context) ([]*models.DepositProduct, error)
+	GetProduct(ctx context.Context, code string) (*models.DepositProduct, error)
+	Create(ctx context.Context, deposit *models.Deposit) error
+	GetByID(ctx context.Context, id string) (*models.Deposit, error)
+	GetByIDForUpdate(ctx context.Context, id string) (*models.Deposit, error)
+	GetByUserID(ctx context.Context, userID string) ([]*models.Deposit, error)
+	Update(ctx context.Context, deposit *models.Deposit) error
+	ListDueForAccrual(ctx context.Context, day time.Time, limit int) ([]string, error)
+	CreateAccrual(ctx context.Context, accrual *models.DepositAccrual) (bool, error)
+	ListAccruals(ctx context.Context, depositID string) ([]*models.DepositAccrual, error)
+}
+
+type PostgresDepositRepository struct {
+	db *sql.DB
+}
+
+func NewDepositRepository(db *sql.DB) *PostgresDepositRepository {
+	return &PostgresDepositRepository{db: db}
+}
+
+const depositProductColumns = `
+			code,
+			name,
+			kind,
+			COALESCE(rate::text, ''),
+			COALESCE(key_rate_margin::text, ''),
+			COALESCE(term_months, 0),
+			min_amount,
+			early_withdrawal_rate::text`
+
+func scanDepositProduct(row rowScanner) (*models.DepositProduct, error) {
+	var p models.DepositProduct
+	err := row.Scan(
+		&p.Code,
+		&p.Name,
+		&p.Kind,
+		&p.Rate,
+		&p.KeyRateMargin,
+		&p.TermMonths,
+		&p.MinAmount,
+		&p.EarlyWithdrawalRate,
+	)
+	if err != nil {
+		return nil, err
+	}
+	// Вклады открываются только в рублях
+	p.MinAmount.Currency = money.DefaultCurrency
+	return &p, nil
+}
+
+func (r *PostgresDepositRepository) ListProducts(ctx context.Context) ([]*models.DepositProduct, error) {
+	query := `SELECT` + depositProductColumns + `
+		FROM deposit_products
+		ORDER BY code`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query deposit products: %w", err)
+	}
+	defer rows.Close()
+
+	var products []*models.DepositProduct
+	for rows.Next() {
+		product, err := scanDepositProduct(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan deposit product: %w", err)
+		}
+		products = append(products, product)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return products, nil
+}
+
+func (r *PostgresDepositRepository) GetProduct(ctx context.Context, code string) (*models.DepositProduct, error) {
+	query := `SELECT` + depositProductColumns + `
+		FROM deposit_products
+		WHERE code = $1`
+
+	product, err := scanDepositProduct(conn(ctx, r.db).QueryRowContext(ctx, query, code))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrDepositProductNotFound
+		}
+		return nil, fmt.Errorf("failed to get deposit product: %w", err)
+	}
+	return product, nil
+}
+
+// Колонки вклада в порядке, ожидаемом scanDeposit; баланс берется со счета вклада
+const depositColumns = `
+			d.id,
+			d.user_id,
+			d.account_id,
+			d.product_code,
+			p.kind,
+			d.annual_rate::text,
+			a.balance,
+			a.currency,
+			d.accrued::text,
+			d.interest_paid,
+			d.opened_on,
+			d.matures_on,
+			d.last_accrued_on,
+			d.status,
+			d.created_at,
+			d.closed_at`
+
+const depositFrom = `
+		FROM deposits d
+		JOIN deposit_products p ON p.code = d.product_code
+		JOIN accounts a ON a.id = d.account_id`
+
+func scanDeposit(row rowScanner) (*models.Deposit, error) {
+	var d models.Deposit
+	var currency string
+	var maturesOn, closedAt sql.NullTime
+	err := row.Scan(
+		&d.ID,
+		&d.UserID,
+		&d.AccountID,
+		&d.ProductCode,
+		&d.Kind,
+		&d.AnnualRate,
+		&d.Balance,
+		&currency,
+		&d.Accrued,
+		&d.InterestPaid,
+		&d.OpenedOn,
+		&maturesOn,
+		&d.LastAccruedOn,
+		&d.Status,
+		&d.CreatedAt,
+		&closedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	d.Balance.Currency = currency
+	d.InterestPaid.Currency = currency
+	d.OpenedOn = d.OpenedOn.UTC()
+	d.LastAccruedOn = d.LastAccruedOn.UTC()
+	if maturesOn.Valid {
+		t := maturesOn.Time.UTC()
+		d.MaturesOn = &t
+	}
+	if closedAt.Valid {
+		d.ClosedAt = &closedAt.Time
+	}
+	return &d, nil
+}
+
+func (r *PostgresDepositRepository) Create(ctx context.Context, deposit *models.Deposit) error {
+	query := `
+		INSERT INTO deposits (
+			user_id,
+			account_id,
+			product_code,
+			annual_rate,
+			opened_on,
+			matures_on,
+			status,
+			last_accrued_on
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, accrued::text, created_at`
+
+	err := conn(ctx, r.db).QueryRowContext(ctx, query,
+		deposit.UserID,
+		deposit.AccountID,
+		deposit.ProductCode,
+		deposit.AnnualRate,
+		deposit.OpenedOn,
+		nullTime(deposit.MaturesOn),
+		deposit.Status,
+		deposit.LastAccruedOn,
+	).Scan(&deposit.ID, &deposit.Accrued, &deposit.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create deposit: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresDepositRepository) GetByID(ctx context.Context, id string) (*models.Deposit, error) {
+	return r.getByID(ctx, id, false)
+}
+
+// Читает вклад и блокирует строку до конца текущей транзакции
+func (r *PostgresDepositRepository) GetByIDForUpdate(ctx context.Context, id string) (*models.Deposit, error) {
+	return r.getByID(ctx, id, true)
+}
+
+func (r *PostgresDepositRepository) getByID(ctx context.Context, id string, forUpdate bool) (*models.Deposit, error) {
+	query := `SELECT` + depositColumns + depositFrom + `
+		WHERE d.id = $1`
+	if forUpdate {
+		query += `
+		FOR UPDATE OF d`
+	}
+
+	deposit, err := scanDeposit(conn(ctx, r.db).QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrDepositNotFound
+		}
+		return nil, fmt.Errorf("failed to get deposit: %w", err)
+	}
+	return deposit, nil
+}
+
+func (r *PostgresDepositRepository) GetByUserID(ctx context.Context, userID string) ([]*models.Deposit, error) {
+	query := `SELECT` + depositColumns + depositFrom + `
+		WHERE d.user_id = $1
+		ORDER BY d.created_at, d.id`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query deposits: %w", err)
+	}
+	defer rows.Close()
+
+	var deposits []*models.Deposit
+	for rows.Next() {
+		deposit, err := scanDeposit(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan deposit: %w", err)
+		}
+		deposits = append(deposits, deposit)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return deposits, nil
+}
+
+// Сохраняет ставку, начисленные проценты, дату начисления и статус
+func (r *PostgresDepositRepository) Update(ctx context.Context, deposit *models.Deposit) error {
+	query := `
+		UPDATE deposits
+		SET
+			annual_rate = $2,
+			accrued = $3,
+			interest_paid = $4,
+			last_accrued_on = $5,
+			status = $6,
+			closed_at = $7
+		WHERE id = $1`
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, query,
+		deposit.ID,
+		deposit.AnnualRate,
+		deposit.Accrued,
+		deposit.InterestPaid,
+		deposit.LastAccruedOn,
+		deposit.Status,
+		nullTime(deposit.ClosedAt),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update deposit: %w", err)
+	}
+	return nil
+}
+
+// Возвращает ID действующих вкладов, по которым не начислены проценты за день day
+func (r *PostgresDepositRepository) ListDueForAccrual(ctx context.Context, day time.Time, limit int) ([]string, error) {
+	query := `
+		SELECT id
+		FROM deposits
+		WHERE status = 'active' AND last_accrued_on < $1
+		ORDER BY last_accrued_on, id
+		LIMIT $2`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, day, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query deposits due for accrual: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan deposit id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return ids, nil
+}
+
+// Записывает начисление за день; возвращает false, если день уже начислен
+func (r *PostgresDepositRepository) CreateAccrual(ctx context.Context, accrual *models.DepositAccrual) (bool, error) {
+	query := `
+		INSERT INTO deposit_accruals (
+			deposit_id,
+			accrual_date,
+			balance,
+			annual_rate,
+			amount
+		)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (deposit_id, accrual_date) DO NOTHING`
+
+	result, err := conn(ctx, r.db).ExecContext(ctx, query,
+		accrual.DepositID,
+		accrual.Date,
+		accrual.Balance,
+		accrual.AnnualRate,
+		accrual.Amount,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to create deposit accrual: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return rowsAffected > 0, nil
+}
+
+func (r *PostgresDepositRepository) ListAccruals(ctx context.Context, depositID string) ([]*models.DepositAccrual, error) {
+	query := `
+		SELECT
+			c.deposit_id,
+			c.accrual_date,
+			c.balance,
+			a.currency,
+			c.annual_rate::text,
+			c.amount::text
+		FROM deposit_accruals c
+		JOIN deposits d ON d.id = c.deposit_id
+		JOIN accounts a ON a.id = d.account_id
+		WHERE c.deposit_id = $1
+		ORDER BY c.accrual_date`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, depositID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query deposit accruals: %w", err)
+	}
+	defer rows.Close()
+
+	var accruals []*models.DepositAccrual
+	for rows.Next() {
+		var accrual models.DepositAccrual
+		var currency string
+		if err := rows.Scan(
+			&accrual.DepositID,
+			&accrual.Date,
+			&accrual.Balance,
+			&currency,
+			&accrual.AnnualRate,
+			&accrual.Amount,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan deposit accrual: %w", err)
+		}
+		accrual.Date = accrual.Date.UTC()
+		accrual.Balance.Currency = currency
+		accruals = append(accruals, &accrual)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return accruals, nil
+}
@@ -0,0 +1,188 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Misha-Glazunov/bank-api/internal/models"
+)
+
+var (
+	ErrHoldNotFound = errors.New("hold not found")
+)
+
+type HoldRepository interface {
+	Create(ctx context.Context, hold *models.Hold) error
+	GetForUpdate(ctx context.Context, accountID, id string) (*models.Hold, error)
+	ListByAccount(ctx context.Context, accountID string) ([]*models.Hold, error)
+	Finish(ctx context.Context, id, status string) (*models.Hold, error)
+	ExpireDue(ctx context.Context, at time.Time, limit int) ([]*models.Hold, error)
+}
+
+type PostgresHoldRepository struct {
+	db *sql.DB
+}
+
+func NewHoldRepository(db *sql.DB) *PostgresHoldRepository {
+	return &PostgresHoldRepository{db: db}
+}
+
+const holdColumns = `
+			id,
+			account_id,
+			amount,
+			currency,
+			reason,
+			source,
+			status,
+			expires_at,
+			created_at,
+			released_at`
+
+func scanHold(row rowScanner) (*models.Hold, error) {
+	var h models.Hold
+	var expiresAt, releasedAt sql.NullTime
+	err := row.Scan(
+		&h.ID,
+		&h.AccountID,
+		&h.Amount,
+		&h.Currency,
+		&h.Reason,
+		&h.Source,
+		&h.Status,
+		&expiresAt,
+		&h.CreatedAt,
+		&releasedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	h.Amount.Currency = h.Currency
+	if expiresAt.Valid {
+		h.ExpiresAt = &expiresAt.Time
+	}
+	if releasedAt.Valid {
+		h.ReleasedAt = &releasedAt.Time
+	}
+	return &h, nil
+}
+
+func (r *PostgresHoldRepository) Create(ctx context.Context, h *models.Hold) error {
+	query := `
+		INSERT INTO account_holds (
+			account_id,
+			amount,
+			currency,
+			reason,
+			source,
+			status,
+			expires_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at`
+
+	err := conn(ctx, r.db).QueryRowContext(ctx, query,
+		h.AccountID,
+		h.Amount,
+		h.Currency,
+		h.Reason,
+		h.Source,
+		h.Status,
+		nullTime(h.ExpiresAt),
+	).Scan(&h.ID, &h.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create hold: %w", err)
+	}
+	return nil
+}
+
+// Читает удержание счета и блокирует строку до конца текущей транзакции
+func (r *PostgresHoldRepository) GetForUpdate(ctx context.Context, accountID, id string) (*models.Hold, error) {
+	query := `SELECT` + holdColumns + `
+		FROM account_holds
+		WHERE account_id = $1 AND id = $2
+		FOR UPDATE`
+
+	h, err := scanHold(conn(ctx, r.db).QueryRowContext(ctx, query, accountID, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrHoldNotFound
+		}
+		return nil, fmt.Errorf("failed to get hold: %w", err)
+	}
+	return h, nil
+}
+
+// Удержания счета, сначала новые
+func (r *PostgresHoldRepository) ListByAccount(ctx context.Context, accountID string) ([]*models.Hold, error) {
+	query := `SELECT` + holdColumns + `
+		FROM account_holds
+		WHERE account_id = $1
+		ORDER BY created_at DESC, id`
+
+	return r.list(ctx, query, accountID)
+}
+
+// Снимает действующее удержание с указанным итоговым статусом
+func (r *PostgresHoldRepository) Finish(ctx context.Context, id, status string) (*models.Hold, error) {
+	query := `
+		UPDATE account_holds
+		SET status = $2,
+			released_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND status = 'active'
+		RETURNING` + holdColumns
+
+	h, err := scanHold(conn(ctx, r.db).QueryRowContext(ctx, query, id, status))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrHoldNotFound
+		}
+		return nil, fmt.Errorf("failed to finish hold: %w", err)
+	}
+	return h, nil
+}
+
+// Переводит в статус expired не больше limit удержаний со сроком до at
+func (r *PostgresHoldRepository) ExpireDue(ctx context.Context, at time.Time, limit int) ([]*models.Hold, error) {
+	query := `
+		UPDATE account_holds
+		SET status = 'expired',
+			released_at = $1
+		WHERE id IN (
+			SELECT id FROM account_holds
+			WHERE status = 'active' AND expires_at <= $1
+			ORDER BY expires_at, id
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING` + holdColumns
+
+	return r.list(ctx, query, at, limit)
+}
+
+func (r *PostgresHoldRepository) list(ctx context.Context, query string, args ...interface{}) ([]*models.Hold, error) {
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query holds: %w", err)
+	}
+	defer rows.Close()
+
+	var holds []*models.Hold
+	for rows.Next() {
+		h, err := scanHold(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan hold: %w", err)
+		}
+		holds = append(holds, h)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return holds, nil
+}
@@ -0,0 +1,148 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Misha-Glazunov/bank-api/internal/models"
+)
+
+var (
+	ErrIdempotencyKeyNotFound = errors.New("idempotency key not found")
+)
+
+type IdempotencyRepository interface {
+	Reserve(ctx context.Context, record *models.IdempotencyRecord, ttl, lease time.Duration) (bool, error)
+	Get(ctx context.Context, userID, key string) (*models.IdempotencyRecord, error)
+	Complete(ctx context.Context, userID, key string, code int, contentType string, body []byte) error
+	Release(ctx context.Context, userID, key string) error
+	DeleteExpired(ctx context.Context) (int64, error)
+}
+
+type PostgresIdempotencyRepository struct {
+	db *sql.DB
+}
+
+func NewIdempotencyRepository(db *sql.DB) *PostgresIdempotencyRepository {
+	return &PostgresIdempotencyRepository{db: db}
+}
+
+// Занимает ключ за запросом на время ttl, а выполнение запроса - на время аренды lease.
+// Истекший ключ и ключ, запрос по которому не сохранил ответ до конца аренды
+// (например, процесс упал), занимаются заново. Возвращает false, если ключ занят.
+func (r *PostgresIdempotencyRepository) Reserve(ctx context.Context, record *models.IdempotencyRecord, ttl, lease time.Duration) (bool, error) {
+	query := `
+		INSERT INTO idempotency_keys (
+			user_id,
+			key,
+			request_hash,
+			expires_at,
+			locked_until
+		)
+		VALUES (
+			$1, $2, $3,
+			CURRENT_TIMESTAMP + make_interval(secs => $4),
+			CURRENT_TIMESTAMP + make_interval(secs => $5)
+		)
+		ON CONFLICT (user_id, key) DO UPDATE
+		SET
+			request_hash = EXCLUDED.request_hash,
+			response_code = NULL,
+			response_content_type = NULL,
+			response_body = NULL,
+			created_at = CURRENT_TIMESTAMP,
+			expires_at = EXCLUDED.expires_at,
+			locked_until = EXCLUDED.locked_until
+		WHERE idempotency_keys.expires_at < CURRENT_TIMESTAMP
+			OR (idempotency_keys.response_code IS NULL AND idempotency_keys.locked_until < CURRENT_TIMESTAMP)
+		RETURNING created_at, expires_at`
+
+	err := conn(ctx, r.db).QueryRowContext(ctx, query,
+		record.UserID,
+		record.Key,
+		record.RequestHash,
+		ttl.Seconds(),
+		lease.Seconds(),
+	).Scan(&record.CreatedAt, &record.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to reserve idempotency key: %w", err)
+	}
+
+	return true, nil
+}
+
+func (r *PostgresIdempotencyRepository) Get(ctx context.Context, userID, key string) (*models.IdempotencyRecord, error) {
+	query := `
+		SELECT
+			user_id,
+			key,
+			request_hash,
+			COALESCE(response_code, 0),
+			COALESCE(response_content_type, 'application/json'),
+			response_body,
+			created_at,
+			expires_at
+		FROM idempotency_keys
+		WHERE user_id = $1 AND key = $2`
+
+	var record models.IdempotencyRecord
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, userID, key).Scan(
+		&record.UserID,
+		&record.Key,
+		&record.RequestHash,
+		&record.ResponseCode,
+		&record.ResponseContentType,
+		&record.ResponseBody,
+		&record.CreatedAt,
+		&record.ExpiresAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrIdempotencyKeyNotFound
+		}
+		return nil, fmt.Errorf("failed to get idempotency key: %w", err)
+	}
+
+	return &record, nil
+}
+
+// Сохраняет ответ, который будет возвращаться при повторах
+func (r *PostgresIdempotencyRepository) Complete(ctx context.Context, userID, key string, code int, contentType string, body []byte) error {
+	query := `
+		UPDATE idempotency_keys
+		SET response_code = $1, response_content_type = $2, response_body = $3
+		WHERE user_id = $4 AND key = $5`
+
+	if _, err := conn(ctx, r.db).ExecContext(ctx, query, code, contentType, body, userID, key); err != nil {
+		return fmt.Errorf("failed to store idempotent response: %w", err)
+	}
+	return nil
+}
+
+// Освобождает ключ, чтобы запрос можно было повторить
+func (r *PostgresIdempotencyRepository) Release(ctx context.Context, userID, key string) error {
+	query := `
+		DELETE FROM idempotency_keys
+		WHERE user_id = $1 AND key = $2 AND response_code IS NULL`
+
+	if _, err := conn(ctx, r.db).ExecContext(ctx, query, userID, key); err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresIdempotencyRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	query := `DELETE FROM idempotency_keys WHERE expires_at < CURRENT_TIMESTAMP`
+
+	result, err := conn(ctx, r.db).ExecContext(ctx, query)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired idempotency keys: %w", err)
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,424 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/Misha-Glazunov/bank-api/internal/models"
+	"github.com/Misha-Glazunov/bank-api/pkg/money"
+)
+
+var (
+	ErrUnbalancedEntry = errors.New("journal entry is not balanced")
+	ErrEntryNotFound   = errors.New("journal entry not found")
+	ErrPostingRejected = errors.New("account is missing, closed or in another currency")
+)
+
+// Журнал двойной записи. Балансы счетов меняются только проводками,
+// кэшированный баланс в accounts обновляется в той же транзакции.
+type LedgerRepository interface {
+	Post(ctx context.Context, entry *models.JournalEntry) error
+	GetEntry(ctx context.Context, id string) (*models.JournalEntry, error)
+	SystemAccount(ctx context.Context, code, currency string) (*models.Account, error)
+	LedgerBalance(ctx context.Context, accountID string) (money.Money, error)
+	BalanceBefore(ctx context.Context, accountID string, at time.Time) (money.Money, error)
+	ListAccountPostings(ctx context.Context, accountID string, from, to time.Time) ([]*models.StatementLine, error)
+	FindMismatches(ctx context.Context) ([]*models.BalanceMismatch, error)
+}
+
+type PostgresLedgerRepository struct {
+	db        *sql.DB
+	txManager TxManager
+}
+
+func NewLedgerRepository(db *sql.DB) *PostgresLedgerRepository {
+	return &PostgresLedgerRepository{
+		db:        db,
+		txManager: NewTxManager(db),
+	}
+}
+
+func (r *PostgresLedgerRepository) Post(ctx context.Context, entry *models.JournalEntry) error {
+	if err := validateEntry(entry); err != nil {
+		return err
+	}
+
+	return r.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		query := `
+			INSERT INTO journal_entries (
+				type,
+				description,
+				reversal_of
+			)
+			VALUES ($1, $2, $3)
+			RETURNING id, created_at`
+
+		err := conn(ctx, r.db).QueryRowContext(ctx, query,
+			entry.Type,
+			entry.Description,
+			nullString(entry.ReversalOf),
+		).Scan(&entry.ID, &entry.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to create journal entry: %w", err)
+		}
+
+		for i := range entry.Postings {
+			posting := &entry.Postings[i]
+			posting.EntryID = entry.ID
+
+			query := `
+				INSERT INTO postings (
+					entry_id,
+					account_id,
+					direction,
+					amount,
+					currency
+				)
+				VALUES ($1, $2, $3, $4, $5)
+				RETURNING id, created_at`
+
+			err := conn(ctx, r.db).QueryRowContext(ctx, query,
+				posting.EntryID,
+				posting.AccountID,
+				posting.Direction,
+				posting.Amount,
+				posting.Amount.Currency,
+			).Scan(&posting.ID, &posting.CreatedAt)
+			if err != nil {
+				return fmt.Errorf("failed to create posting: %w", err)
+			}
+		}
+
+		return r.applyBalances(ctx, entry.Postings)
+	})
+}
+
+// Обновляет кэш балансов в порядке возрастания ID счетов
+func (r *PostgresLedgerRepository) applyBalances(ctx context.Context, postings []models.Posting) error {
+	deltas := make(map[string]money.Money)
+	for _, p := range postings {
+		deltas[p.AccountID] = deltas[p.AccountID].Add(p.Signed())
+	}
+
+	ids := make([]string, 0, len(deltas))
+	for id := range deltas {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		query := `
+			UPDATE accounts
+			SET balance = balance + $1
+			WHERE id = $2 AND currency = $3 AND status <> 'closed'`
+
+		result, err := conn(ctx, r.db).ExecContext(ctx, query, deltas[id], id, deltas[id].Currency)
+		if err != nil {
+			return fmt.Errorf("failed to update balance: %w", err)
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to get rows affected: %w", err)
+		}
+		if rowsAffected == 0 {
+			return ErrPostingRejected
+		}
+	}
+	return nil
+}
+
+func (r *PostgresLedgerRepository) GetEntry(ctx context.Context, id string) (*models.JournalEntry, error) {
+	query := `
+		SELECT
+			e.id,
+			e.type,
+			e.description,
+			COALESCE(e.reversal_of::text, ''),
+			COALESCE((SELECT r.id::text FROM journal_entries r WHERE r.reversal_of = e.id), ''),
+			e.created_at
+		FROM journal_entries e
+		WHERE e.id = $1`
+
+	var entry models.JournalEntry
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, id).Scan(
+		&entry.ID,
+		&entry.Type,
+		&entry.Description,
+		&entry.ReversalOf,
+		&entry.ReversedBy,
+		&entry.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrEntryNotFound
+		}
+		return nil, fmt.Errorf("failed to get journal entry: %w", err)
+	}
+
+	query = `
+		SELECT
+			id,
+			entry_id,
+			account_id,
+			direction,
+			amount,
+			currency,
+			created_at
+		FROM postings
+		WHERE entry_id = $1
+		ORDER BY created_at, id`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query postings: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p models.Posting
+		var currency string
+		if err := rows.Scan(
+			&p.ID,
+			&p.EntryID,
+			&p.AccountID,
+			&p.Direction,
+			&p.Amount,
+			&currency,
+			&p.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan posting: %w", err)
+		}
+		p.Amount.Currency = currency
+		entry.Postings = append(entry.Postings, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return &entry, nil
+}
+
+// Возвращает внутренний счет банка, создавая его при первом обращении
+func (r *PostgresLedgerRepository) SystemAccount(ctx context.Context, code, currency string) (*models.Account, error) {
+	query := `
+		INSERT INTO accounts (
+			system_code,
+			currency,
+			balance
+		)
+		VALUES ($1, $2, 0)
+		ON CONFLICT (system_code, currency) WHERE system_code IS NOT NULL DO NOTHING`
+
+	if _, err := conn(ctx, r.db).ExecContext(ctx, query, code, currency); err != nil {
+		return nil, fmt.Errorf("failed to create system account: %w", err)
+	}
+
+	query = `
+		SELECT
+			id,
+			balance,
+			currency,
+			created_at
+		FROM accounts
+		WHERE system_code = $1 AND currency = $2`
+
+	var account models.Account
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, code, currency).Scan(
+		&account.ID,
+		&account.Balance,
+		&account.Currency,
+		&account.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get system account: %w", err)
+	}
+	account.Balance.Currency = account.Currency
+
+	return &account, nil
+}
+
+// Баланс счета, вычисленный по проводкам
+func (r *PostgresLedgerRepository) LedgerBalance(ctx context.Context, accountID string) (money.Money, error) {
+	query := `
+		SELECT
+			a.currency,
+			COALESCE(SUM(CASE WHEN p.direction = 'credit' THEN p.amount ELSE -p.amount END), 0)
+		FROM accounts a
+		LEFT JOIN postings p ON p.account_id = a.id
+		WHERE a.id = $1
+		GROUP BY a.id`
+
+	var currency string
+	var balance money.Money
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, accountID).Scan(&currency, &balance)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return money.Money{}, ErrAccountNotFound
+		}
+		return money.Money{}, fmt.Errorf("failed to compute ledger balance: %w", err)
+	}
+	balance.Currency = currency
+
+	return balance, nil
+}
+
+// Баланс счета по проводкам, созданным до момента at
+func (r *PostgresLedgerRepository) BalanceBefore(ctx context.Context, accountID string, at time.Time) (money.Money, error) {
+	query := `
+		SELECT
+			a.currency,
+			COALESCE(SUM(CASE WHEN p.direction = 'credit' THEN p.amount ELSE -p.amount END), 0)
+		FROM accounts a
+		LEFT JOIN postings p ON p.account_id = a.id AND p.created_at < $2
+		WHERE a.id = $1
+		GROUP BY a.id`
+
+	var currency string
+	var balance money.Money
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, accountID, at.UTC()).Scan(&currency, &balance)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return money.Money{}, ErrAccountNotFound
+		}
+		return money.Money{}, fmt.Errorf("failed to compute balance: %w", err)
+	}
+	balance.Currency = currency
+
+	return balance, nil
+}
+
+// Проводки по счету за период [from, to) вместе со связанной операцией
+func (r *PostgresLedgerRepository) ListAccountPostings(ctx context.Context, accountID string, from, to time.Time) ([]*models.StatementLine, error) {
+	query := `
+		SELECT
+			p.entry_id,
+			e.type,
+			e.description,
+			p.direction,
+			p.amount,
+			p.currency,
+			p.created_at,
+			COALESCE(t.id::text, ''),
+			COALESCE(CASE WHEN t.from_account = $1 THEN t.to_account ELSE t.from_account END::text, '')
+		FROM postings p
+		JOIN journal_entries e ON e.id = p.entry_id
+		LEFT JOIN LATERAL (
+			SELECT id, from_account, to_account
+			FROM transactions
+			WHERE entry_id = p.entry_id
+			LIMIT 1
+		) t ON true
+		WHERE p.account_id = $1 AND p.created_at >= $2 AND p.created_at < $3
+		ORDER BY p.created_at, p.id`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, accountID, from.UTC(), to.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query account postings: %w", err)
+	}
+	defer rows.Close()
+
+	var lines []*models.StatementLine
+	for rows.Next() {
+		var line models.StatementLine
+		var currency string
+		if err := rows.Scan(
+			&line.EntryID,
+			&line.Type,
+			&line.Description,
+			&line.Direction,
+			&line.Amount,
+			&currency,
+			&line.BookedAt,
+			&line.TransactionID,
+			&line.Counterparty,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan account posting: %w", err)
+		}
+		line.Amount.Currency = currency
+		lines = append(lines, &line)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return lines, nil
+}
+
+// Находит счета, чей кэшированный баланс не совпадает с суммой проводок
+func (r *PostgresLedgerRepository) FindMismatches(ctx context.Context) ([]*models.BalanceMismatch, error) {
+	query := `
+		SELECT
+			a.id,
+			a.currency,
+			a.balance,
+			COALESCE(SUM(CASE WHEN p.direction = 'credit' THEN p.amount ELSE -p.amount END), 0) AS ledger_balance
+		FROM accounts a
+		LEFT JOIN postings p ON p.account_id = a.id
+		GROUP BY a.id
+		HAVING a.balance <> COALESCE(SUM(CASE WHEN p.direction = 'credit' THEN p.amount ELSE -p.amount END), 0)`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query balance mismatches: %w", err)
+	}
+	defer rows.Close()
+
+	var mismatches []*models.BalanceMismatch
+	for rows.Next() {
+		var m models.BalanceMismatch
+		var currency string
+		if err := rows.Scan(
+			&m.AccountID,
+			&currency,
+			&m.CachedBalance,
+			&m.LedgerBalance,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan balance mismatch: %w", err)
+		}
+		m.CachedBalance.Currency = currency
+		m.LedgerBalance.Currency = currency
+		mismatches = append(mismatches, &m)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return mismatches, nil
+}
+
+// Проверяет, что в каждой валюте сумма дебетов равна сумме кредитов
+func validateEntry(entry *models.JournalEntry) error {
+	if len(entry.Postings) < 2 {
+		return fmt.Errorf("%w: at least two postings required", ErrUnbalancedEntry)
+	}
+
+	totals := make(map[string]int64)
+	for _, p := range entry.Postings {
+		if !p.Amount.IsPositive() || p.Amount.Currency == "" {
+			return fmt.Errorf("%w: posting amount must be positive with currency", ErrUnbalancedEntry)
+		}
+		if p.Direction != models.PostingDebit && p.Direction != models.PostingCredit {
+			return fmt.Errorf("%w: unknown direction %q", ErrUnbalancedEntry, p.Direction)
+		}
+		totals[p.Amount.Currency] += p.Signed().Amount
+	}
+
+	for currency, total := range totals {
+		if total != 0 {
+			return fmt.Errorf("%w: %s differs by %d", ErrUnbalancedEntry, currency, total)
+		}
+	}
+	return nil
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -0,0 +1,467 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Misha-Glazunov/bank-api/internal/models"
+	"github.com/Misha-Glazunov/bank-api/pkg/money"
+)
+
+var (
+	ErrLoanNotFound        = errors.New("loan not found")
+	ErrLoanProductNotFound = errors.New("loan product not found")
+)
+
+// Даты графика хранятся в колонках DATE
+type LoanRepository interface {
+	ListProducts(ctx context.Context) ([]*models.LoanProduct, error)
+	GetProduct(ctx context.Context, code string) (*models.LoanProduct, error)
+	Create(ctx context.Context, loan *models.Loan) error
+	GetByID(ctx context.Context, id string) (*models.Loan, error)
+	GetByIDForUpdate(ctx context.Context, id string) (*models.Loan, error)
+	GetByUserID(ctx context.Context, userID string) ([]*models.Loan, error)
+	Update(ctx context.Context, loan *models.Loan) error
+	ListWithDueInstallments(ctx context.Context, today time.Time, limit int) ([]string, error)
+	CreateInstallments(ctx context.Context, installments []*models.LoanInstallment) error
+	ListInstallments(ctx context.Context, loanID string) ([]*models.LoanInstallment, error)
+	UpdateInstallment(ctx context.Context, installment *models.LoanInstallment) error
+	DeleteInstallmentsAfter(ctx context.Context, loanID string, date time.Time) error
+}
+
+type PostgresLoanRepository struct {
+	db *sql.DB
+}
+
+func NewLoanRepository(db *sql.DB) *PostgresLoanRepository {
+	return &PostgresLoanRepository{db: db}
+}
+
+const loanProductColumns = `
+			code,
+			name,
+			margin::text,
+			min_amount,
+			max_amount,
+			min_term_months,
+			max_term_months,
+			penalty_rate::text`
+
+func scanLoanProduct(row rowScanner) (*models.LoanProduct, error) {
+	var p models.LoanProduct
+	err := row.Scan(
+		&p.Code,
+		&p.Name,
+		&p.Margin,
+		&p.MinAmount,
+		&p.MaxAmount,
+		&p.MinTermMonths,
+		&p.MaxTermMonths,
+		&p.PenaltyRate,
+	)
+	if err != nil {
+		return nil, err
+	}
+	// Кредиты выдаются только в рублях
+	p.MinAmount.Currency = money.DefaultCurrency
+	p.MaxAmount.Currency = money.DefaultCurrency
+	return &p, nil
+}
+
+func (r *PostgresLoanRepository) ListProducts(ctx context.Context) ([]*models.LoanProduct, error) {
+	query := `SELECT` + loanProductColumns + `
+		FROM loan_products
+		ORDER BY code`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query loan products: %w", err)
+	}
+	defer rows.Close()
+
+	var products []*models.LoanProduct
+	for rows.Next() {
+		product, err := scanLoanProduct(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan loan product: %w", err)
+		}
+		products = append(products, product)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return products, nil
+}
+
+func (r *PostgresLoanRepository) GetProduct(ctx context.Context, code string) (*models.LoanProduct, error) {
+	query := `SELECT` + loanProductColumns + `
+		FROM loan_products
+		WHERE code = $1`
+
+	product, err := scanLoanProduct(conn(ctx, r.db).QueryRowContext(ctx, query, code))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrLoanProductNotFound
+		}
+		return nil, fmt.Errorf("failed to get loan product: %w", err)
+	}
+	return product, nil
+}
+
+// Колонки кредита в порядке, ожидаемом scanLoan
+const loanColumns = `
+			id,
+			user_id,
+			account_id,
+			product_code,
+			principal,
+			outstanding,
+			currency,
+			key_rate::text,
+			annual_rate::text,
+			penalty_rate::text,
+			schedule_type,
+			term_months,
+			status,
+			disbursed_on,
+			penalty_accrued_on,
+			created_at,
+			closed_at`
+
+func scanLoan(row rowScanner) (*models.Loan, error) {
+	var loan models.Loan
+	var closedAt sql.NullTime
+	err := row.Scan(
+		&loan.ID,
+		&loan.UserID,
+		&loan.AccountID,
+		&loan.ProductCode,
+		&loan.Principal,
+		&loan.Outstanding,
+		&loan.Currency,
+		&loan.KeyRate,
+		&loan.AnnualRate,
+		&loan.PenaltyRate,
+		&loan.ScheduleType,
+		&loan.TermMonths,
+		&loan.Status,
+		&loan.DisbursedOn,
+		&loan.PenaltyAccruedOn,
+		&loan.CreatedAt,
+		&closedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	loan.Principal.Currency = loan.Currency
+	loan.Outstanding.Currency = loan.Currency
+	loan.DisbursedOn = loan.DisbursedOn.UTC()
+	loan.PenaltyAccruedOn = loan.PenaltyAccruedOn.UTC()
+	if closedAt.Valid {
+		loan.ClosedAt = &closedAt.Time
+	}
+	return &loan, nil
+}
+
+func (r *PostgresLoanRepository) Create(ctx context.Context, loan *models.Loan) error {
+	query := `
+		INSERT INTO loans (
+			user_id,
+			account_id,
+			product_code,
+			principal,
+			outstanding,
+			currency,
+			key_rate,
+			annual_rate,
+			penalty_rate,
+			schedule_type,
+			term_months,
+			status,
+			disbursed_on,
+			penalty_accrued_on
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+		RETURNING id, created_at`
+
+	err := conn(ctx, r.db).QueryRowContext(ctx, query,
+		loan.UserID,
+		loan.AccountID,
+		loan.ProductCode,
+		loan.Principal,
+		loan.Outstanding,
+		loan.Currency,
+		loan.KeyRate,
+		loan.AnnualRate,
+		loan.PenaltyRate,
+		loan.ScheduleType,
+		loan.TermMonths,
+		loan.Status,
+		loan.DisbursedOn,
+		loan.PenaltyAccruedOn,
+	).Scan(&loan.ID, &loan.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create loan: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresLoanRepository) GetByID(ctx context.Context, id string) (*models.Loan, error) {
+	return r.getByID(ctx, id, false)
+}
+
+// Читает кредит и блокирует строку до конца текущей транзакции
+func (r *PostgresLoanRepository) GetByIDForUpdate(ctx context.Context, id string) (*models.Loan, error) {
+	return r.getByID(ctx, id, true)
+}
+
+func (r *PostgresLoanRepository) getByID(ctx context.Context, id string, forUpdate bool) (*models.Loan, error) {
+	query := `SELECT` + loanColumns + `
+		FROM loans
+		WHERE id = $1`
+	if forUpdate {
+		query += `
+		FOR UPDATE`
+	}
+
+	loan, err := scanLoan(conn(ctx, r.db).QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrLoanNotFound
+		}
+		return nil, fmt.Errorf("failed to get loan: %w", err)
+	}
+	return loan, nil
+}
+
+func (r *PostgresLoanRepository) GetByUserID(ctx context.Context, userID string) ([]*models.Loan, error) {
+	query := `SELECT` + loanColumns + `
+		FROM loans
+		WHERE user_id = $1
+		ORDER BY created_at, id`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query loans: %w", err)
+	}
+	defer rows.Close()
+
+	var loans []*models.Loan
+	for rows.Next() {
+		loan, err := scanLoan(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan loan: %w", err)
+		}
+		loans = append(loans, loan)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return loans, nil
+}
+
+// Сохраняет остаток долга, статус и дату начисления неустойки
+func (r *PostgresLoanRepository) Update(ctx context.Context, loan *models.Loan) error {
+	query := `
+		UPDATE loans
+		SET
+			outstanding = $2,
+			status = $3,
+			penalty_accrued_on = $4,
+			closed_at = $5
+		WHERE id = $1`
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, query,
+		loan.ID,
+		loan.Outstanding,
+		loan.Status,
+		loan.PenaltyAccruedOn,
+		nullTime(loan.ClosedAt),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update loan: %w", err)
+	}
+	return nil
+}
+
+// Возвращает ID активных кредитов с наступившими непогашенными платежами
+func (r *PostgresLoanRepository) ListWithDueInstallments(ctx context.Context, today time.Time, limit int) ([]string, error) {
+	query := `
+		SELECT l.id
+		FROM loans l
+		WHERE l.status = 'active'
+		  AND EXISTS (
+			SELECT 1 FROM loan_installments i
+			WHERE i.loan_id = l.id AND i.status <> 'paid' AND i.due_date <= $1
+		  )
+		ORDER BY l.id
+		LIMIT $2`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, today, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query loans with due installments: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan loan id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return ids, nil
+}
+
+func (r *PostgresLoanRepository) CreateInstallments(ctx context.Context, installments []*models.LoanInstallment) error {
+	query := `
+		INSERT INTO loan_installments (
+			loan_id,
+			number,
+			due_date,
+			principal,
+			interest,
+			status
+		)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id`
+
+	for _, inst := range installments {
+		err := conn(ctx, r.db).QueryRowContext(ctx, query,
+			inst.LoanID,
+			inst.Number,
+			inst.DueDate,
+			inst.Principal,
+			inst.Interest,
+			inst.Status,
+		).Scan(&inst.ID)
+		if err != nil {
+			return fmt.Errorf("failed to create loan installment: %w", err)
+		}
+	}
+	return nil
+}
+
+func (r *PostgresLoanRepository) ListInstallments(ctx context.Context, loanID string) ([]*models.LoanInstallment, error) {
+	query := `
+		SELECT
+			i.id,
+			i.loan_id,
+			i.number,
+			i.due_date,
+			i.principal,
+			i.interest,
+			i.penalty,
+			i.paid_principal,
+			i.paid_interest,
+			i.paid_penalty,
+			i.status,
+			i.paid_at,
+			l.currency
+		FROM loan_installments i
+		JOIN loans l ON l.id = i.loan_id
+		WHERE i.loan_id = $1
+		ORDER BY i.number`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, loanID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query loan installments: %w", err)
+	}
+	defer rows.Close()
+
+	var installments []*models.LoanInstallment
+	for rows.Next() {
+		var inst models.LoanInstallment
+		var paidAt sql.NullTime
+		var currency string
+		if err := rows.Scan(
+			&inst.ID,
+			&inst.LoanID,
+			&inst.Number,
+			&inst.DueDate,
+			&inst.Principal,
+			&inst.Interest,
+			&inst.Penalty,
+			&inst.PaidPrincipal,
+			&inst.PaidInterest,
+			&inst.PaidPenalty,
+			&inst.Status,
+			&paidAt,
+			&currency,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan loan installment: %w", err)
+		}
+
+		inst.DueDate = inst.DueDate.UTC()
+		for _, m := range []*money.Money{
+			&inst.Principal, &inst.Interest, &inst.Penalty,
+			&inst.PaidPrincipal, &inst.PaidInterest, &inst.PaidPenalty,
+		} {
+			m.Currency = currency
+		}
+		if paidAt.Valid {
+			inst.PaidAt = &paidAt.Time
+		}
+		installments = append(installments, &inst)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return installments, nil
+}
+
+// Сохраняет неустойку, погашенные суммы и статус платежа
+func (r *PostgresLoanRepository) UpdateInstallment(ctx context.Context, inst *models.LoanInstallment) error {
+	query := `
+		UPDATE loan_installments
+		SET
+			penalty = $2,
+			paid_principal = $3,
+			paid_interest = $4,
+			paid_penalty = $5,
+			status = $6,
+			paid_at = $7
+		WHERE id = $1`
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, query,
+		inst.ID,
+		inst.Penalty,
+		inst.PaidPrincipal,
+		inst.PaidInterest,
+		inst.PaidPenalty,
+		inst.Status,
+		nullTime(inst.PaidAt),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update loan installment: %w", err)
+	}
+	return nil
+}
+
+// Удаляет будущие платежи графика перед его пересчетом
+func (r *PostgresLoanRepository) DeleteInstallmentsAfter(ctx context.Context, loanID string, date time.Time) error {
+	query := `
+		DELETE FROM loan_installments
+		WHERE loan_id = $1 AND due_date > $2 AND status = 'pending'`
+
+	if _, err := conn(ctx, r.db).ExecContext(ctx, query, loanID, date); err != nil {
+		return fmt.Errorf("failed to delete loan installments: %w", err)
+	}
+	return nil
+}
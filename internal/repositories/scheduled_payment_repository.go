@@ -0,0 +1,355 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Misha-Glazunov/bank-api/internal/models"
+)
+
+var (
+	ErrScheduledPaymentNotFound = errors.New("scheduled payment not found")
+)
+
+// Время хранится в колонках TIMESTAMP в UTC
+type ScheduledPaymentRepository interface {
+	Create(ctx context.Context, payment *models.ScheduledPayment) error
+	GetByID(ctx context.Context, id string) (*models.ScheduledPayment, error)
+	GetByIDForUpdate(ctx context.Context, id string) (*models.ScheduledPayment, error)
+	GetByUserID(ctx context.Context, userID string) ([]*models.ScheduledPayment, error)
+	Update(ctx context.Context, payment *models.ScheduledPayment) error
+	ListDue(ctx context.Context, now time.Time, limit int) ([]string, error)
+	ClaimDue(ctx context.Context, id string, now time.Time) (*models.ScheduledPayment, error)
+	CreateRun(ctx context.Context, run *models.ScheduledPaymentRun) error
+	ListRuns(ctx context.Context, paymentID string) ([]*models.ScheduledPaymentRun, error)
+}
+
+type PostgresScheduledPaymentRepository struct {
+	db *sql.DB
+}
+
+func NewScheduledPaymentRepository(db *sql.DB) *PostgresScheduledPaymentRepository {
+	return &PostgresScheduledPaymentRepository{db: db}
+}
+
+// Колонки перевода в порядке, ожидаемом scanScheduledPayment
+const scheduledPaymentColumns = `
+			id,
+			user_id,
+			from_account,
+			to_account,
+			amount,
+			currency,
+			recurrence,
+			COALESCE(day_of_month, 0),
+			scheduled_for,
+			next_run_at,
+			end_at,
+			attempts,
+			status,
+			COALESCE(last_error, ''),
+			created_at,
+			updated_at`
+
+func scanScheduledPayment(row rowScanner) (*models.ScheduledPayment, error) {
+	var p models.ScheduledPayment
+	var endAt sql.NullTime
+	err := row.Scan(
+		&p.ID,
+		&p.UserID,
+		&p.FromAccount,
+		&p.ToAccount,
+		&p.Amount,
+		&p.Currency,
+		&p.Recurrence,
+		&p.DayOfMonth,
+		&p.ScheduledFor,
+		&p.NextRunAt,
+		&endAt,
+		&p.Attempts,
+		&p.Status,
+		&p.LastError,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	p.Amount.Currency = p.Currency
+	p.ScheduledFor = p.ScheduledFor.UTC()
+	p.NextRunAt = p.NextRunAt.UTC()
+	if endAt.Valid {
+		t := endAt.Time.UTC()
+		p.EndAt = &t
+	}
+	return &p, nil
+}
+
+func (r *PostgresScheduledPaymentRepository) Create(ctx context.Context, payment *models.ScheduledPayment) error {
+	query := `
+		INSERT INTO scheduled_payments (
+			user_id,
+			from_account,
+			to_account,
+			amount,
+			currency,
+			recurrence,
+			day_of_month,
+			scheduled_for,
+			next_run_at,
+			end_at,
+			status
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING id, created_at, updated_at`
+
+	err := conn(ctx, r.db).QueryRowContext(ctx, query,
+		payment.UserID,
+		payment.FromAccount,
+		payment.ToAccount,
+		payment.Amount,
+		payment.Currency,
+		payment.Recurrence,
+		nullDay(payment.DayOfMonth),
+		payment.ScheduledFor.UTC(),
+		payment.NextRunAt.UTC(),
+		nullTime(payment.EndAt),
+		payment.Status,
+	).Scan(&payment.ID, &payment.CreatedAt, &payment.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create scheduled payment: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresScheduledPaymentRepository) GetByID(ctx context.Context, id string) (*models.ScheduledPayment, error) {
+	query := `SELECT` + scheduledPaymentColumns + `
+		FROM scheduled_payments
+		WHERE id = $1`
+
+	payment, err := scanScheduledPayment(conn(ctx, r.db).QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrScheduledPaymentNotFound
+		}
+		return nil, fmt.Errorf("failed to get scheduled payment: %w", err)
+	}
+	return payment, nil
+}
+
+// Блокирует перевод до конца транзакции; вызывается внутри TxManager.WithinTx
+func (r *PostgresScheduledPaymentRepository) GetByIDForUpdate(ctx context.Context, id string) (*models.ScheduledPayment, error) {
+	query := `SELECT` + scheduledPaymentColumns + `
+		FROM scheduled_payments
+		WHERE id = $1
+		FOR UPDATE`
+
+	payment, err := scanScheduledPayment(conn(ctx, r.db).QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrScheduledPaymentNotFound
+		}
+		return nil, fmt.Errorf("failed to lock scheduled payment: %w", err)
+	}
+	return payment, nil
+}
+
+func (r *PostgresScheduledPaymentRepository) GetByUserID(ctx context.Context, userID string) ([]*models.ScheduledPayment, error) {
+	query := `SELECT` + scheduledPaymentColumns + `
+		FROM scheduled_payments
+		WHERE user_id = $1
+		ORDER BY created_at, id`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query scheduled payments: %w", err)
+	}
+	defer rows.Close()
+
+	var payments []*models.ScheduledPayment
+	for rows.Next() {
+		payment, err := scanScheduledPayment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan scheduled payment: %w", err)
+		}
+		payments = append(payments, payment)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return payments, nil
+}
+
+// Сохраняет изменяемые поля перевода: сумму, расписание, статус и состояние повторов
+func (r *PostgresScheduledPaymentRepository) Update(ctx context.Context, payment *models.ScheduledPayment) error {
+	query := `
+		UPDATE scheduled_payments
+		SET
+			amount = $2,
+			recurrence = $3,
+			day_of_month = $4,
+			scheduled_for = $5,
+			next_run_at = $6,
+			end_at = $7,
+			attempts = $8,
+			status = $9,
+			last_error = $10,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING updated_at`
+
+	err := conn(ctx, r.db).QueryRowContext(ctx, query,
+		payment.ID,
+		payment.Amount,
+		payment.Recurrence,
+		nullDay(payment.DayOfMonth),
+		payment.ScheduledFor.UTC(),
+		payment.NextRunAt.UTC(),
+		nullTime(payment.EndAt),
+		payment.Attempts,
+		payment.Status,
+		nullString(payment.LastError),
+	).Scan(&payment.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrScheduledPaymentNotFound
+		}
+		return fmt.Errorf("failed to update scheduled payment: %w", err)
+	}
+	return nil
+}
+
+// Возвращает ID активных переводов, время попытки которых наступило
+func (r *PostgresScheduledPaymentRepository) ListDue(ctx context.Context, now time.Time, limit int) ([]string, error) {
+	query := `
+		SELECT id
+		FROM scheduled_payments
+		WHERE status = 'active' AND next_run_at <= $1
+		ORDER BY next_run_at, id
+		LIMIT $2`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, now.UTC(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query due scheduled payments: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan scheduled payment id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return ids, nil
+}
+
+// Блокирует перевод до конца транзакции, если он все еще к исполнению.
+// Перевод, который обрабатывает другой исполнитель, пропускается.
+func (r *PostgresScheduledPaymentRepository) ClaimDue(ctx context.Context, id string, now time.Time) (*models.ScheduledPayment, error) {
+	query := `SELECT` + scheduledPaymentColumns + `
+		FROM scheduled_payments
+		WHERE id = $1 AND status = 'active' AND next_run_at <= $2
+		FOR UPDATE SKIP LOCKED`
+
+	payment, err := scanScheduledPayment(conn(ctx, r.db).QueryRowContext(ctx, query, id, now.UTC()))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrScheduledPaymentNotFound
+		}
+		return nil, fmt.Errorf("failed to claim scheduled payment: %w", err)
+	}
+	return payment, nil
+}
+
+func (r *PostgresScheduledPaymentRepository) CreateRun(ctx context.Context, run *models.ScheduledPaymentRun) error {
+	query := `
+		INSERT INTO scheduled_payment_runs (
+			scheduled_payment_id,
+			scheduled_for,
+			attempt,
+			status,
+			error
+		)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`
+
+	err := conn(ctx, r.db).QueryRowContext(ctx, query,
+		run.ScheduledPaymentID,
+		run.ScheduledFor.UTC(),
+		run.Attempt,
+		run.Status,
+		nullString(run.Error),
+	).Scan(&run.ID, &run.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create scheduled payment run: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresScheduledPaymentRepository) ListRuns(ctx context.Context, paymentID string) ([]*models.ScheduledPaymentRun, error) {
+	query := `
+		SELECT
+			id,
+			scheduled_payment_id,
+			scheduled_for,
+			attempt,
+			status,
+			COALESCE(error, ''),
+			created_at
+		FROM scheduled_payment_runs
+		WHERE scheduled_payment_id = $1
+		ORDER BY created_at, id`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, paymentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query scheduled payment runs: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []*models.ScheduledPaymentRun
+	for rows.Next() {
+		var run models.ScheduledPaymentRun
+		if err := rows.Scan(
+			&run.ID,
+			&run.ScheduledPaymentID,
+			&run.ScheduledFor,
+			&run.Attempt,
+			&run.Status,
+			&run.Error,
+			&run.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan scheduled payment run: %w", err)
+		}
+		run.ScheduledFor = run.ScheduledFor.UTC()
+		runs = append(runs, &run)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return runs, nil
+}
+
+func nullDay(day int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(day), Valid: day != 0}
+}
+
+func nullTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: t.UTC(), Valid: true}
+}
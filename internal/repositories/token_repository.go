@@ -0,0 +1,251 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Misha-Glazunov/bank-api/internal/models"
+)
+
+var (
+	ErrRefreshTokenNotFound = errors.New("refresh token not found")
+	ErrChallengeNotFound    = errors.New("login challenge not found")
+)
+
+type TokenRepository interface {
+	Create(ctx context.Context, token *models.RefreshToken) error
+	GetByHashForUpdate(ctx context.Context, hash string) (*models.RefreshToken, error)
+	MarkUsed(ctx context.Context, id string) error
+	RevokeFamily(ctx context.Context, userID, familyID string) error
+	RevokeAll(ctx context.Context, userID string) error
+	IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error)
+	DeleteExpired(ctx context.Context, at time.Time) (int64, error)
+	CreateChallenge(ctx context.Context, challenge *models.LoginChallenge) error
+	GetChallenge(ctx context.Context, hash string) (*models.LoginChallenge, error)
+	MarkChallengeUsed(ctx context.Context, id string) error
+}
+
+type PostgresTokenRepository struct {
+	db *sql.DB
+}
+
+func NewTokenRepository(db *sql.DB) *PostgresTokenRepository {
+	return &PostgresTokenRepository{db: db}
+}
+
+func (r *PostgresTokenRepository) Create(ctx context.Context, t *models.RefreshToken) error {
+	query := `
+		INSERT INTO refresh_tokens (
+			user_id,
+			family_id,
+			token_hash,
+			access_token_id,
+			access_expires_at,
+			expires_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at`
+
+	err := conn(ctx, r.db).QueryRowContext(ctx, query,
+		t.UserID,
+		t.FamilyID,
+		t.TokenHash,
+		t.AccessTokenID,
+		t.AccessExpiresAt,
+		t.ExpiresAt,
+	).Scan(&t.ID, &t.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create refresh token: %w", err)
+	}
+	return nil
+}
+
+// Находит refresh-токен по хешу и блокирует строку, чтобы токен нельзя было
+// обменять дважды параллельными запросами
+func (r *PostgresTokenRepository) GetByHashForUpdate(ctx context.Context, hash string) (*models.RefreshToken, error) {
+	query := `
+		SELECT
+			id,
+			user_id,
+			family_id,
+			token_hash,
+			access_token_id,
+			access_expires_at,
+			expires_at,
+			created_at,
+			used_at,
+			revoked_at
+		FROM refresh_tokens
+		WHERE token_hash = $1
+		FOR UPDATE`
+
+	var t models.RefreshToken
+	var usedAt, revokedAt sql.NullTime
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, hash).Scan(
+		&t.ID,
+		&t.UserID,
+		&t.FamilyID,
+		&t.TokenHash,
+		&t.AccessTokenID,
+		&t.AccessExpiresAt,
+		&t.ExpiresAt,
+		&t.CreatedAt,
+		&usedAt,
+		&revokedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRefreshTokenNotFound
+		}
+		return nil, fmt.Errorf("failed to get refresh token: %w", err)
+	}
+
+	if usedAt.Valid {
+		t.UsedAt = &usedAt.Time
+	}
+	if revokedAt.Valid {
+		t.RevokedAt = &revokedAt.Time
+	}
+	return &t, nil
+}
+
+func (r *PostgresTokenRepository) MarkUsed(ctx context.Context, id string) error {
+	query := `UPDATE refresh_tokens SET used_at = CURRENT_TIMESTAMP WHERE id = $1`
+
+	if _, err := conn(ctx, r.db).ExecContext(ctx, query, id); err != nil {
+		return fmt.Errorf("failed to mark refresh token used: %w", err)
+	}
+	return nil
+}
+
+// Отзывает все refresh-токены сессии и вносит выданные с ними access-токены в список отозванных
+func (r *PostgresTokenRepository) RevokeFamily(ctx context.Context, userID, familyID string) error {
+	query := `
+		WITH revoked AS (
+			UPDATE refresh_tokens
+			SET revoked_at = CURRENT_TIMESTAMP
+			WHERE user_id = $1 AND family_id = $2 AND revoked_at IS NULL
+			RETURNING access_token_id, access_expires_at
+		)
+		INSERT INTO revoked_access_tokens (jti, expires_at)
+		SELECT access_token_id, access_expires_at FROM revoked
+		ON CONFLICT (jti) DO NOTHING`
+
+	if _, err := conn(ctx, r.db).ExecContext(ctx, query, userID, familyID); err != nil {
+		return fmt.Errorf("failed to revoke token family: %w", err)
+	}
+	return nil
+}
+
+// Завершает все сессии пользователя, например после смены пароля
+func (r *PostgresTokenRepository) RevokeAll(ctx context.Context, userID string) error {
+	query := `
+		WITH revoked AS (
+			UPDATE refresh_tokens
+			SET revoked_at = CURRENT_TIMESTAMP
+			WHERE user_id = $1 AND revoked_at IS NULL
+			RETURNING access_token_id, access_expires_at
+		)
+		INSERT INTO revoked_access_tokens (jti, expires_at)
+		SELECT access_token_id, access_expires_at FROM revoked
+		ON CONFLICT (jti) DO NOTHING`
+
+	if _, err := conn(ctx, r.db).ExecContext(ctx, query, userID); err != nil {
+		return fmt.Errorf("failed to revoke user sessions: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresTokenRepository) IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	query := `SELECT EXISTS(SELECT 1 FROM revoked_access_tokens WHERE jti = $1)`
+
+	var revoked bool
+	if err := conn(ctx, r.db).QueryRowContext(ctx, query, jti).Scan(&revoked); err != nil {
+		return false, fmt.Errorf("failed to check access token revocation: %w", err)
+	}
+	return revoked, nil
+}
+
+// Удаляет истекшие refresh-токены, записи об отзыве токенов и токены второго шага входа
+func (r *PostgresTokenRepository) DeleteExpired(ctx context.Context, at time.Time) (int64, error) {
+	var deleted int64
+	for _, query := range []string{
+		`DELETE FROM refresh_tokens WHERE expires_at <= $1`,
+		`DELETE FROM revoked_access_tokens WHERE expires_at <= $1`,
+		`DELETE FROM login_challenges WHERE expires_at <= $1`,
+	} {
+		result, err := conn(ctx, r.db).ExecContext(ctx, query, at)
+		if err != nil {
+			return deleted, fmt.Errorf("failed to delete expired tokens: %w", err)
+		}
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return deleted, fmt.Errorf("failed to get rows affected: %w", err)
+		}
+		deleted += rows
+	}
+	return deleted, nil
+}
+
+func (r *PostgresTokenRepository) CreateChallenge(ctx context.Context, c *models.LoginChallenge) error {
+	query := `
+		INSERT INTO login_challenges (user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at`
+
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, c.UserID, c.TokenHash, c.ExpiresAt).Scan(&c.ID, &c.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create login challenge: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresTokenRepository) GetChallenge(ctx context.Context, hash string) (*models.LoginChallenge, error) {
+	query := `
+		SELECT id, user_id, token_hash, expires_at, created_at, used_at
+		FROM login_challenges
+		WHERE token_hash = $1`
+
+	var c models.LoginChallenge
+	var usedAt sql.NullTime
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, hash).Scan(
+		&c.ID,
+		&c.UserID,
+		&c.TokenHash,
+		&c.ExpiresAt,
+		&c.CreatedAt,
+		&usedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrChallengeNotFound
+		}
+		return nil, fmt.Errorf("failed to get login challenge: %w", err)
+	}
+
+	if usedAt.Valid {
+		c.UsedAt = &usedAt.Time
+	}
+	return &c, nil
+}
+
+// Отмечает второй шаг входа завершенным; уже использованный токен дает ErrChallengeNotFound
+func (r *PostgresTokenRepository) MarkChallengeUsed(ctx context.Context, id string) error {
+	query := `UPDATE login_challenges SET used_at = CURRENT_TIMESTAMP WHERE id = $1 AND used_at IS NULL`
+
+	result, err := conn(ctx, r.db).ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to mark login challenge used: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return ErrChallengeNotFound
+	}
+	return nil
+}
@@ -4,13 +4,18 @@ import (
     "context"
     "fmt"
     "database/sql"
+    "strings"
+
+    "github.com/lib/pq"
 
     "github.com/Misha-Glazunov/bank-api/internal/models"
+    "github.com/Misha-Glazunov/bank-api/pkg/money"
 )
 
 type TransactionRepository interface {
     Create(ctx context.Context, transaction *models.Transaction) error
-    GetByAccountID(ctx context.Context, accountID string) ([]*models.Transaction, error)
+    List(ctx context.Context, filter models.TransactionFilter) ([]*models.Transaction, error)
+    SumOutgoing(ctx context.Context, userID, currency, period string) (money.Money, error)
 }
 
 type PostgresTransactionRepository struct {
@@ -27,26 +32,100 @@ func (r *PostgresTransactionRepository) Create(ctx context.Context, transaction
             from_account, 
             to_account, 
             amount, 
-            type
+            currency,
+            type,
+            entry_id,
+            exchange_rate,
+            converted_amount,
+            converted_currency
         ) 
-        VALUES ($1, $2, $3, $4)`
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+        RETURNING id, created_at`
+
+    var convertedAmount interface{}
+    if transaction.ConvertedAmount != nil {
+        convertedAmount = *transaction.ConvertedAmount
+    }
 
-    _, err := r.db.ExecContext(ctx, query,
-        transaction.FromAccount,
-        transaction.ToAccount,
+    err := conn(ctx, r.db).QueryRowContext(ctx, query,
+        nullString(transaction.FromAccount),
+        nullString(transaction.ToAccount),
         transaction.Amount,
+        transaction.Currency,
         transaction.Type,
-    )
-    return err
+        nullString(transaction.EntryID),
+        nullString(transaction.ExchangeRate),
+        convertedAmount,
+        nullString(transaction.ConvertedCurrency),
+    ).Scan(&transaction.ID, &transaction.CreatedAt)
+    if err != nil {
+        return fmt.Errorf("failed to create transaction: %w", err)
+    }
+    return nil
 }
 
-func (r *PostgresTransactionRepository) GetByAccountID(ctx context.Context, accountID string) ([]*models.Transaction, error) {
-    query := `
-        SELECT id, from_account, to_account, amount, type, created_at 
-        FROM transactions 
-        WHERE from_account = $1 OR to_account = $1`
+// Возвращает операции по счету с keyset-пагинацией по (поле сортировки, id)
+func (r *PostgresTransactionRepository) List(ctx context.Context, filter models.TransactionFilter) ([]*models.Transaction, error) {
+    sortColumn := "created_at"
+    if filter.SortBy == models.TransactionSortAmount {
+        sortColumn = "amount"
+    }
+    direction, comparison := "ASC", ">"
+    if filter.SortDesc {
+        direction, comparison = "DESC", "<"
+    }
+
+    conditions := []string{"(from_account = $1 OR to_account = $1)"}
+    args := []interface{}{filter.AccountID}
+    addCondition := func(format string, value interface{}) {
+        args = append(args, value)
+        conditions = append(conditions, fmt.Sprintf(format, len(args)))
+    }
+
+    if filter.From != nil {
+        addCondition("created_at >= $%d", *filter.From)
+    }
+    if filter.To != nil {
+        addCondition("created_at < $%d", *filter.To)
+    }
+    if len(filter.Types) > 0 {
+        addCondition("type = ANY($%d)", pq.Array(filter.Types))
+    }
+    if filter.MinAmount != nil {
+        addCondition("amount >= $%d", *filter.MinAmount)
+    }
+    if filter.MaxAmount != nil {
+        addCondition("amount <= $%d", *filter.MaxAmount)
+    }
+    if filter.AfterID != "" {
+        args = append(args, filter.AfterValue, filter.AfterID)
+        conditions = append(conditions, fmt.Sprintf(
+            "(%s, id) %s ($%d, $%d)", sortColumn, comparison, len(args)-1, len(args),
+        ))
+    }
 
-    rows, err := r.db.QueryContext(ctx, query, accountID)
+    args = append(args, filter.Limit)
+    query := fmt.Sprintf(`
+        SELECT
+            id,
+            COALESCE(from_account::text, ''),
+            COALESCE(to_account::text, ''),
+            amount,
+            currency,
+            type,
+            COALESCE(entry_id::text, ''),
+            created_at,
+            COALESCE(exchange_rate::text, ''),
+            converted_amount,
+            COALESCE(converted_currency, '')
+        FROM transactions
+        WHERE %s
+        ORDER BY %s %s, id %s
+        LIMIT $%d`,
+        strings.Join(conditions, " AND "), sortColumn, direction, direction, len(args),
+    )
+
+    rows, err := conn(ctx, r.db).QueryContext(ctx, query, args...)
     if err != nil {
         return nil, fmt.Errorf("failed to query transactions: %w", err)
     }
@@ -55,19 +134,69 @@ func (r *PostgresTransactionRepository) GetByAccountID(ctx context.Context, acco
     var transactions []*models.Transaction
     for rows.Next() {
         var t models.Transaction
+        var convertedAmount money.Money
         err := rows.Scan(
             &t.ID,
             &t.FromAccount,
             &t.ToAccount,
             &t.Amount,
+            &t.Currency,
             &t.Type,
+            &t.EntryID,
             &t.CreatedAt,
+            &t.ExchangeRate,
+            &convertedAmount,
+            &t.ConvertedCurrency,
         )
         if err != nil {
             return nil, fmt.Errorf("failed to scan transaction: %w", err)
         }
+        t.Amount.Currency = t.Currency
+        if t.ConvertedCurrency != "" {
+            convertedAmount.Currency = t.ConvertedCurrency
+            t.ConvertedAmount = &convertedAmount
+        }
         transactions = append(transactions, &t)
     }
+
+    if err := rows.Err(); err != nil {
+        return nil, fmt.Errorf("rows iteration error: %w", err)
+    }
     
     return transactions, nil
 }
+
+// Сумма исходящих переводов, снятий и карточных платежей пользователя в валюте с начала периода ("day" или "month").
+// Переводы между собственными счетами пользователя не учитываются. Действующие удержания
+// под карточные авторизации периода учитываются сразу: при списании удержание снимается
+// и вместо него учитывается платеж. Ручные удержания - резерв собственных средств, не расход.
+func (r *PostgresTransactionRepository) SumOutgoing(ctx context.Context, userID, currency, period string) (money.Money, error) {
+    query := `
+        SELECT
+            (SELECT COALESCE(SUM(t.amount), 0)
+             FROM transactions t
+             JOIN accounts a ON a.id = t.from_account
+             WHERE a.user_id = $1
+               AND t.currency = $2
+               AND t.created_at >= date_trunc($3, LOCALTIMESTAMP)
+               AND t.type IN ('transfer', 'withdrawal', 'card_payment')
+               AND NOT EXISTS (
+                   SELECT 1 FROM accounts d
+                   WHERE d.id = t.to_account AND d.user_id = a.user_id
+               ))
+            +
+            (SELECT COALESCE(SUM(h.amount), 0)
+             FROM account_holds h
+             JOIN accounts a ON a.id = h.account_id
+             WHERE a.user_id = $1
+               AND h.currency = $2
+               AND h.created_at >= date_trunc($3, LOCALTIMESTAMP)
+               AND h.source = 'card_authorization'
+               AND h.status = 'active')`
+
+    sum := money.Zero(currency)
+    if err := conn(ctx, r.db).QueryRowContext(ctx, query, userID, currency, period).Scan(&sum); err != nil {
+        return money.Money{}, fmt.Errorf("failed to sum outgoing transactions: %w", err)
+    }
+    return sum, nil
+}
@@ -0,0 +1,223 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/Misha-Glazunov/bank-api/internal/models"
+	"github.com/Misha-Glazunov/bank-api/pkg/crypto"
+)
+
+var (
+	ErrTOTPNotFound = errors.New("totp secret not found")
+)
+
+type TwoFactorRepository interface {
+	Get(ctx context.Context, userID string) (*models.TOTP, error)
+	GetForUpdate(ctx context.Context, userID string) (*models.TOTP, error)
+	SavePending(ctx context.Context, userID, secret string) error
+	Confirm(ctx context.Context, userID string, step int64) error
+	RecordUse(ctx context.Context, userID string, step int64) error
+	RecordFailure(ctx context.Context, userID string, attempts int, lockedUntil *time.Time) error
+	Delete(ctx context.Context, userID string) error
+	ReplaceBackupCodes(ctx context.Context, userID string, hashes []string) error
+	UseBackupCode(ctx context.Context, userID, hash string) (bool, error)
+	CountBackupCodes(ctx context.Context, userID string) (int, error)
+}
+
+type PostgresTwoFactorRepository struct {
+	db            *sql.DB
+	encryptionKey []byte
+}
+
+func NewTwoFactorRepository(db *sql.DB, encryptionKey []byte) *PostgresTwoFactorRepository {
+	return &PostgresTwoFactorRepository{db: db, encryptionKey: encryptionKey}
+}
+
+const totpColumns = `
+	user_id,
+	secret_encrypted,
+	confirmed_at,
+	last_used_step,
+	failed_attempts,
+	locked_until,
+	created_at`
+
+func (r *PostgresTwoFactorRepository) Get(ctx context.Context, userID string) (*models.TOTP, error) {
+	query := `SELECT` + totpColumns + ` FROM user_totp WHERE user_id = $1`
+	return r.scan(conn(ctx, r.db).QueryRowContext(ctx, query, userID))
+}
+
+// Блокирует секрет пользователя, чтобы параллельные проверки не приняли один код дважды
+// и не потеряли счетчик неудачных попыток
+func (r *PostgresTwoFactorRepository) GetForUpdate(ctx context.Context, userID string) (*models.TOTP, error) {
+	query := `SELECT` + totpColumns + ` FROM user_totp WHERE user_id = $1 FOR UPDATE`
+	return r.scan(conn(ctx, r.db).QueryRowContext(ctx, query, userID))
+}
+
+// Сохраняет новый неподтвержденный секрет. Подтвержденный секрет не заменяется.
+func (r *PostgresTwoFactorRepository) SavePending(ctx context.Context, userID, secret string) error {
+	encrypted, err := crypto.EncryptAES([]byte(secret), r.encryptionKey)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt totp secret: %w", err)
+	}
+
+	query := `
+		INSERT INTO user_totp (user_id, secret_encrypted)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET
+			secret_encrypted = EXCLUDED.secret_encrypted,
+			last_used_step = 0,
+			failed_attempts = 0,
+			locked_until = NULL,
+			created_at = CURRENT_TIMESTAMP
+		WHERE user_totp.confirmed_at IS NULL`
+
+	if _, err := conn(ctx, r.db).ExecContext(ctx, query, userID, encrypted); err != nil {
+		return fmt.Errorf("failed to save totp secret: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresTwoFactorRepository) Confirm(ctx context.Context, userID string, step int64) error {
+	query := `
+		UPDATE user_totp
+		SET confirmed_at = CURRENT_TIMESTAMP, last_used_step = $2, failed_attempts = 0, locked_until = NULL
+		WHERE user_id = $1`
+
+	return r.exec(ctx, "failed to confirm totp secret", query, userID, step)
+}
+
+// Фиксирует успешную проверку: шаг кода больше не принимается, счетчик ошибок сбрасывается.
+// Для резервного кода step равен нулю и последний шаг не меняется.
+func (r *PostgresTwoFactorRepository) RecordUse(ctx context.Context, userID string, step int64) error {
+	query := `
+		UPDATE user_totp
+		SET last_used_step = GREATEST(last_used_step, $2), failed_attempts = 0, locked_until = NULL
+		WHERE user_id = $1`
+
+	return r.exec(ctx, "failed to record totp use", query, userID, step)
+}
+
+func (r *PostgresTwoFactorRepository) RecordFailure(ctx context.Context, userID string, attempts int, lockedUntil *time.Time) error {
+	query := `UPDATE user_totp SET failed_attempts = $2, locked_until = $3 WHERE user_id = $1`
+
+	return r.exec(ctx, "failed to record totp failure", query, userID, attempts, nullTime(lockedUntil))
+}
+
+// Удаляет секрет и резервные коды пользователя
+func (r *PostgresTwoFactorRepository) Delete(ctx context.Context, userID string) error {
+	for _, query := range []string{
+		`DELETE FROM backup_codes WHERE user_id = $1`,
+		`DELETE FROM user_totp WHERE user_id = $1`,
+	} {
+		if _, err := conn(ctx, r.db).ExecContext(ctx, query, userID); err != nil {
+			return fmt.Errorf("failed to delete two-factor settings: %w", err)
+		}
+	}
+	return nil
+}
+
+// Заменяет все резервные коды пользователя новым набором
+func (r *PostgresTwoFactorRepository) ReplaceBackupCodes(ctx context.Context, userID string, hashes []string) error {
+	if _, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM backup_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete backup codes: %w", err)
+	}
+
+	query := `
+		INSERT INTO backup_codes (user_id, code_hash)
+		SELECT $1, unnest($2::varchar[])`
+
+	if _, err := conn(ctx, r.db).ExecContext(ctx, query, userID, pq.StringArray(hashes)); err != nil {
+		return fmt.Errorf("failed to create backup codes: %w", err)
+	}
+	return nil
+}
+
+// Отмечает резервный код использованным; false, если кода нет или он уже использован
+func (r *PostgresTwoFactorRepository) UseBackupCode(ctx context.Context, userID, hash string) (bool, error) {
+	query := `
+		UPDATE backup_codes
+		SET used_at = CURRENT_TIMESTAMP
+		WHERE id = (
+			SELECT id FROM backup_codes
+			WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+			LIMIT 1
+			FOR UPDATE
+		)`
+
+	result, err := conn(ctx, r.db).ExecContext(ctx, query, userID, hash)
+	if err != nil {
+		return false, fmt.Errorf("failed to use backup code: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return rows > 0, nil
+}
+
+func (r *PostgresTwoFactorRepository) CountBackupCodes(ctx context.Context, userID string) (int, error) {
+	query := `SELECT COUNT(*) FROM backup_codes WHERE user_id = $1 AND used_at IS NULL`
+
+	var count int
+	if err := conn(ctx, r.db).QueryRowContext(ctx, query, userID).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count backup codes: %w", err)
+	}
+	return count, nil
+}
+
+func (r *PostgresTwoFactorRepository) exec(ctx context.Context, message, query string, args ...interface{}) error {
+	result, err := conn(ctx, r.db).ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", message, err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return ErrTOTPNotFound
+	}
+	return nil
+}
+
+func (r *PostgresTwoFactorRepository) scan(row rowScanner) (*models.TOTP, error) {
+	var t models.TOTP
+	var encrypted string
+	var confirmedAt, lockedUntil sql.NullTime
+	err := row.Scan(
+		&t.UserID,
+		&encrypted,
+		&confirmedAt,
+		&t.LastUsedStep,
+		&t.FailedAttempts,
+		&lockedUntil,
+		&t.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrTOTPNotFound
+		}
+		return nil, fmt.Errorf("failed to get totp secret: %w", err)
+	}
+
+	secret, err := crypto.DecryptAES(encrypted, r.encryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt totp secret: %w", err)
+	}
+	t.Secret = string(secret)
+
+	if confirmedAt.Valid {
+		t.ConfirmedAt = &confirmedAt.Time
+	}
+	if lockedUntil.Valid {
+		t.LockedUntil = &lockedUntil.Time
+	}
+	return &t, nil
+}
@@ -5,6 +5,7 @@ import (
     "database/sql"
     "errors"
     "fmt"
+    "strings"
 
     "github.com/Misha-Glazunov/bank-api/internal/models"
 )
@@ -16,8 +17,13 @@ var (
 type UserRepository interface {
     Create(ctx context.Context, user *models.User) error
     GetByEmail(ctx context.Context, email string) (*models.User, error)
+    GetByID(ctx context.Context, id string) (*models.User, error)
     EmailExists(ctx context.Context, email string) (bool, error)
     UsernameExists(ctx context.Context, username string) (bool, error)
+    MarkEmailVerified(ctx context.Context, id string) error
+    UpdatePassword(ctx context.Context, id, oldHash, newHash string) error
+    Search(ctx context.Context, query string, limit int) ([]*models.User, error)
+    UpdateRole(ctx context.Context, id, role string) error
 }
 
 type PostgresUserRepository struct {
@@ -28,10 +34,13 @@ func NewUserRepository(db *sql.DB) *PostgresUserRepository {
     return &PostgresUserRepository{db: db}
 }
 
+// Колонки пользователя в порядке, ожидаемом scanUser
+const userColumns = `id, email, username, password_hash, role, created_at, email_verified_at`
+
 func (r *PostgresUserRepository) Create(ctx context.Context, user *models.User) error {
     query := `INSERT INTO users (email, username, password_hash)
               VALUES ($1, $2, $3) RETURNING id, created_at`
-    return r.db.QueryRowContext(
+    return conn(ctx, r.db).QueryRowContext(
         ctx,
         query,
         user.Email,
@@ -41,38 +50,132 @@ func (r *PostgresUserRepository) Create(ctx context.Context, user *models.User)
 }
 
 func (r *PostgresUserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
-    query := `SELECT id, email, username, password_hash, created_at 
-              FROM users WHERE email = $1`
-    row := r.db.QueryRowContext(ctx, query, email)
+    query := `SELECT ` + userColumns + ` FROM users WHERE email = $1`
+    row := conn(ctx, r.db).QueryRowContext(ctx, query, email)
     
+    return scanUser(row)
+}
+
+func (r *PostgresUserRepository) GetByID(ctx context.Context, id string) (*models.User, error) {
+    query := `SELECT ` + userColumns + ` FROM users WHERE id = $1`
+    row := conn(ctx, r.db).QueryRowContext(ctx, query, id)
+
+    return scanUser(row)
+}
+
+func (r *PostgresUserRepository) EmailExists(ctx context.Context, email string) (bool, error) {
+    query := `SELECT EXISTS(SELECT 1 FROM users WHERE email = $1)`
+    var exists bool
+    err := conn(ctx, r.db).QueryRowContext(ctx, query, email).Scan(&exists)
+    return exists, err
+}
+
+func (r *PostgresUserRepository) UsernameExists(ctx context.Context, username string) (bool, error) {
+    query := `SELECT EXISTS(SELECT 1 FROM users WHERE username = $1)`
+    var exists bool
+    err := conn(ctx, r.db).QueryRowContext(ctx, query, username).Scan(&exists)
+    return exists, err
+}
+
+// Отмечает адрес пользователя подтвержденным; повторное подтверждение не меняет дату
+func (r *PostgresUserRepository) MarkEmailVerified(ctx context.Context, id string) error {
+    query := `UPDATE users SET email_verified_at = COALESCE(email_verified_at, CURRENT_TIMESTAMP)
+              WHERE id = $1`
+    result, err := conn(ctx, r.db).ExecContext(ctx, query, id)
+    if err != nil {
+        return fmt.Errorf("failed to mark email verified: %w", err)
+    }
+    return requireUserUpdated(result)
+}
+
+// Меняет хеш пароля, только если текущий хеш равен oldHash: из двух
+// параллельных смен по одной ссылке сброса проходит одна
+func (r *PostgresUserRepository) UpdatePassword(ctx context.Context, id, oldHash, newHash string) error {
+    query := `UPDATE users SET password_hash = $3 WHERE id = $1 AND password_hash = $2`
+    result, err := conn(ctx, r.db).ExecContext(ctx, query, id, oldHash, newHash)
+    if err != nil {
+        return fmt.Errorf("failed to update password: %w", err)
+    }
+    return requireUserUpdated(result)
+}
+
+// Ищет пользователей по идентификатору, точному адресу или части имени
+// пользователя либо адреса без учета регистра
+func (r *PostgresUserRepository) Search(ctx context.Context, query string, limit int) ([]*models.User, error) {
+    sqlQuery := `SELECT ` + userColumns + `
+              FROM users
+              WHERE id::text = $1
+                 OR email ILIKE '%' || $2 || '%'
+                 OR username ILIKE '%' || $2 || '%'
+              ORDER BY (id::text = $1 OR lower(email) = lower($1)) DESC, created_at, id
+              LIMIT $3`
+
+    rows, err := conn(ctx, r.db).QueryContext(ctx, sqlQuery, query, escapeLike(query), limit)
+    if err != nil {
+        return nil, fmt.Errorf("failed to search users: %w", err)
+    }
+    defer rows.Close()
+
+    users := []*models.User{}
+    for rows.Next() {
+        user, err := scanUser(rows)
+        if err != nil {
+            return nil, err
+        }
+        users = append(users, user)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, fmt.Errorf("failed to search users: %w", err)
+    }
+    return users, nil
+}
+
+func (r *PostgresUserRepository) UpdateRole(ctx context.Context, id, role string) error {
+    query := `UPDATE users SET role = $2 WHERE id = $1`
+    result, err := conn(ctx, r.db).ExecContext(ctx, query, id, role)
+    if err != nil {
+        return fmt.Errorf("failed to update user role: %w", err)
+    }
+    return requireUserUpdated(result)
+}
+
+// Экранирует символы шаблона LIKE, чтобы строка поиска сравнивалась буквально
+func escapeLike(s string) string {
+    return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+func requireUserUpdated(result sql.Result) error {
+    rows, err := result.RowsAffected()
+    if err != nil {
+        return fmt.Errorf("failed to get rows affected: %w", err)
+    }
+    if rows == 0 {
+        return ErrUserNotFound
+    }
+    return nil
+}
+
+func scanUser(row rowScanner) (*models.User, error) {
     var user models.User
+    var verifiedAt sql.NullTime
     err := row.Scan(
         &user.ID,
         &user.Email,
         &user.Username,
         &user.PasswordHash,
+        &user.Role,
         &user.CreatedAt,
+        &verifiedAt,
     )
-    
+
     if errors.Is(err, sql.ErrNoRows) {
         return nil, ErrUserNotFound
     }
     if err != nil {
         return nil, fmt.Errorf("db scan error: %w", err)
     }
+    if verifiedAt.Valid {
+        user.EmailVerifiedAt = &verifiedAt.Time
+    }
     return &user, nil
 }
-
-func (r *PostgresUserRepository) EmailExists(ctx context.Context, email string) (bool, error) {
-    query := `SELECT EXISTS(SELECT 1 FROM users WHERE email = $1)`
-    var exists bool
-    err := r.db.QueryRowContext(ctx, query, email).Scan(&exists)
-    return exists, err
-}
-
-func (r *PostgresUserRepository) UsernameExists(ctx context.Context, username string) (bool, error) {
-    query := `SELECT EXISTS(SELECT 1 FROM users WHERE username = $1)`
-    var exists bool
-    err := r.db.QueryRowContext(ctx, query, username).Scan(&exists)
-    return exists, err
-}
@@ -1,23 +1,118 @@
 package routes
 
 import (
+    "net/http"
+
     "github.com/gorilla/mux"
     "github.com/Misha-Glazunov/bank-api/internal/handlers"
     "github.com/Misha-Glazunov/bank-api/internal/middleware"
+    "github.com/Misha-Glazunov/bank-api/internal/models"
 )
 
-func NewRouter(h *handlers.Handlers, jwtSecret string) *mux.Router {
+func NewRouter(h *handlers.Handlers, auth, rateLimit, idempotency, merchantAuth func(http.Handler) http.Handler) *mux.Router {
     r := mux.NewRouter()
     
     r.HandleFunc("/healthcheck", h.HealthCheck).Methods("GET")
     r.HandleFunc("/register", h.Register).Methods("POST")
     r.HandleFunc("/login", h.Login).Methods("POST")
+    r.HandleFunc("/login/2fa", h.CompleteLogin).Methods("POST")
+    r.HandleFunc("/token/refresh", h.RefreshToken).Methods("POST")
+    r.HandleFunc("/email/verify", h.VerifyEmail).Methods("GET")
+    r.HandleFunc("/password/forgot", h.ForgotPassword).Methods("POST")
+    r.HandleFunc("/password/reset", h.ResetPassword).Methods("POST")
+    
+    // API мерчантов аутентифицируется подписью HMAC вместо JWT
+    merchantRouter := r.PathPrefix("/merchant").Subrouter()
+    merchantRouter.Use(merchantAuth)
+    merchantRouter.HandleFunc("/authorizations", h.AuthorizeCardPayment).Methods("POST")
+    merchantRouter.HandleFunc("/authorizations/{id}", h.GetCardAuthorization).Methods("GET")
+    merchantRouter.HandleFunc("/authorizations/{id}/capture", h.CaptureCardPayment).Methods("POST")
+    merchantRouter.HandleFunc("/authorizations/{id}/void", h.VoidCardPayment).Methods("POST")
+    merchantRouter.HandleFunc("/authorizations/{id}/refund", h.RefundCardPayment).Methods("POST")
     
     authRouter := r.PathPrefix("/").Subrouter()
-    authRouter.Use(middleware.AuthMiddleware(jwtSecret))
+    // Частота запросов ограничивается для каждого пользователя, поэтому после аутентификации
+    authRouter.Use(auth, rateLimit)
+    authRouter.HandleFunc("/logout", h.Logout).Methods("POST")
+    authRouter.HandleFunc("/email/verification", h.ResendVerification).Methods("POST")
+    authRouter.HandleFunc("/2fa", h.GetTwoFactorStatus).Methods("GET")
+    authRouter.HandleFunc("/2fa", h.DisableTwoFactor).Methods("DELETE")
+    authRouter.HandleFunc("/2fa/enroll", h.EnrollTwoFactor).Methods("POST")
+    authRouter.HandleFunc("/2fa/confirm", h.ConfirmTwoFactor).Methods("POST")
+    authRouter.HandleFunc("/2fa/backup-codes", h.RegenerateBackupCodes).Methods("POST")
     
-    authRouter.HandleFunc("/accounts", h.CreateAccount).Methods("POST")
-    authRouter.HandleFunc("/transfer", h.TransferFunds).Methods("POST")
+    // Создание ресурсов и движение денег принимают заголовок Idempotency-Key
+    authRouter.Handle("/accounts", idempotency(http.HandlerFunc(h.CreateAccount))).Methods("POST")
+    authRouter.Handle("/cards", idempotency(http.HandlerFunc(h.CreateCard))).Methods("POST")
+    authRouter.Handle("/transfer", idempotency(http.HandlerFunc(h.TransferFunds))).Methods("POST")
+    authRouter.Handle("/accounts/{id}/deposit", idempotency(http.HandlerFunc(h.Deposit))).Methods("POST")
+    authRouter.Handle("/accounts/{id}/withdraw", idempotency(http.HandlerFunc(h.Withdraw))).Methods("POST")
+    authRouter.Handle("/accounts/{id}/holds", idempotency(http.HandlerFunc(h.CreateHold))).Methods("POST")
+    authRouter.Handle("/scheduled-payments", idempotency(http.HandlerFunc(h.CreateScheduledPayment))).Methods("POST")
+    authRouter.Handle("/loans", idempotency(http.HandlerFunc(h.ApplyForLoan))).Methods("POST")
+    authRouter.Handle("/loans/{id}/repay", idempotency(http.HandlerFunc(h.RepayLoan))).Methods("POST")
+    authRouter.Handle("/deposits", idempotency(http.HandlerFunc(h.OpenDeposit))).Methods("POST")
+    authRouter.Handle("/deposits/{id}/close", idempotency(http.HandlerFunc(h.CloseDeposit))).Methods("POST")
+    authRouter.Handle("/cards/{id}/reissue", idempotency(http.HandlerFunc(h.ReissueCard))).Methods("POST")
+
+    authRouter.HandleFunc("/cards", h.ListCards).Methods("GET")
+    authRouter.HandleFunc("/cards/{id}", h.GetCard).Methods("GET")
+    authRouter.HandleFunc("/cards/{id}/reveal", h.RevealCardNumber).Methods("POST")
+    authRouter.HandleFunc("/cards/{id}/account", h.LinkCardAccount).Methods("PUT")
+    authRouter.HandleFunc("/cards/{id}/block", h.BlockCard).Methods("POST")
+    authRouter.HandleFunc("/cards/{id}/unblock", h.UnblockCard).Methods("POST")
+    authRouter.HandleFunc("/cards/{id}/close", h.CloseCard).Methods("POST")
+    authRouter.HandleFunc("/cards/{id}/pin", h.SetCardPIN).Methods("POST")
+    authRouter.HandleFunc("/cards/{id}/pin", h.ChangeCardPIN).Methods("PUT")
+    authRouter.HandleFunc("/cards/{id}/limits", h.GetCardLimits).Methods("GET")
+    authRouter.HandleFunc("/cards/{id}/limits", h.UpdateCardLimits).Methods("PUT")
+
+    authRouter.HandleFunc("/accounts", h.ListAccounts).Methods("GET")
+    authRouter.HandleFunc("/accounts/{id}", h.GetAccount).Methods("GET")
+    authRouter.HandleFunc("/accounts/{id}/close", h.CloseAccount).Methods("POST")
+    authRouter.HandleFunc("/accounts/{id}/transactions", h.GetTransactions).Methods("GET")
+    authRouter.HandleFunc("/accounts/{id}/limits", h.GetAccountLimits).Methods("GET")
+    authRouter.HandleFunc("/accounts/{id}/statements", h.GetStatement).Methods("GET")
+    authRouter.HandleFunc("/accounts/{id}/holds", h.ListHolds).Methods("GET")
+    authRouter.HandleFunc("/accounts/{id}/holds/{holdId}", h.ReleaseHold).Methods("DELETE")
+
+    authRouter.HandleFunc("/scheduled-payments", h.ListScheduledPayments).Methods("GET")
+    authRouter.HandleFunc("/scheduled-payments/{id}", h.GetScheduledPayment).Methods("GET")
+    authRouter.HandleFunc("/scheduled-payments/{id}", h.UpdateScheduledPayment).Methods("PATCH")
+    authRouter.HandleFunc("/scheduled-payments/{id}", h.CancelScheduledPayment).Methods("DELETE")
+    authRouter.HandleFunc("/scheduled-payments/{id}/runs", h.ListScheduledPaymentRuns).Methods("GET")
+
+    authRouter.HandleFunc("/loan-products", h.ListLoanProducts).Methods("GET")
+    authRouter.HandleFunc("/loans", h.ListLoans).Methods("GET")
+    authRouter.HandleFunc("/loans/{id}", h.GetLoan).Methods("GET")
+
+    authRouter.HandleFunc("/deposit-products", h.ListDepositProducts).Methods("GET")
+    authRouter.HandleFunc("/deposits", h.ListDeposits).Methods("GET")
+    authRouter.HandleFunc("/deposits/{id}", h.GetDeposit).Methods("GET")
+    authRouter.HandleFunc("/deposits/{id}/accruals", h.ListDepositAccruals).Methods("GET")
+
+    // Повтор с тем же Idempotency-Key возвращает исходный отчет pain.002;
+    // повторная загрузка исполненного MsgId без ключа отклоняется сервисом
+    authRouter.Handle("/payments/bulk", idempotency(http.HandlerFunc(h.ImportPaymentFile))).Methods("POST")
+
+    // API сотрудников банка. Операционисту доступны просмотр и заморозка,
+    // корректировки баланса и смена ролей - только администратору.
+    adminRouter := authRouter.PathPrefix("/admin").Subrouter()
+    adminRouter.Use(middleware.RequireRole(models.RoleOperator, models.RoleAdmin))
+    adminOnly := middleware.RequireRole(models.RoleAdmin)
+    adminRouter.HandleFunc("/users", h.AdminSearchUsers).Methods("GET")
+    adminRouter.HandleFunc("/users/{id}", h.AdminGetUser).Methods("GET")
+    adminRouter.Handle("/users/{id}/role", adminOnly(http.HandlerFunc(h.AdminChangeRole))).Methods("PUT")
+    adminRouter.HandleFunc("/accounts/{id}", h.AdminGetAccount).Methods("GET")
+    adminRouter.HandleFunc("/accounts/{id}/freeze", h.AdminFreezeAccount).Methods("POST")
+    adminRouter.HandleFunc("/accounts/{id}/unfreeze", h.AdminUnfreezeAccount).Methods("POST")
+    adminRouter.Handle("/accounts/{id}/limits", adminOnly(http.HandlerFunc(h.AdminSetAccountLimits))).Methods("PUT")
+    adminRouter.Handle("/accounts/{id}/adjustments", idempotency(adminOnly(http.HandlerFunc(h.AdminAdjustBalance)))).Methods("POST")
+    adminRouter.HandleFunc("/cards/{id}/freeze", h.AdminFreezeCard).Methods("POST")
+    adminRouter.HandleFunc("/cards/{id}/unfreeze", h.AdminUnfreezeCard).Methods("POST")
+    adminRouter.HandleFunc("/audit", h.AdminListAudit).Methods("GET")
+    adminRouter.Handle("/ledger/entries/{id}/reversal", idempotency(adminOnly(http.HandlerFunc(h.AdminReverseEntry)))).Methods("POST")
+    adminRouter.Handle("/ledger/reconciliation", adminOnly(http.HandlerFunc(h.AdminReconcileLedger))).Methods("GET")
     
     return r
 }
@@ -0,0 +1,98 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Фоновая задача; получает контекст, который отменяется при остановке планировщика
+type Job func(ctx context.Context) error
+
+type job struct {
+	name     string
+	interval time.Duration
+	run      Job
+}
+
+// Запускает зарегистрированные задачи с заданным интервалом.
+// Запуски одной задачи не пересекаются; Stop дожидается завершения текущих запусков.
+type Scheduler struct {
+	logger *logrus.Logger
+	jobs   []job
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func New(logger *logrus.Logger) *Scheduler {
+	return &Scheduler{logger: logger}
+}
+
+// Регистрирует задачу; вызывается до Start
+func (s *Scheduler) Register(name string, interval time.Duration, run Job) {
+	s.jobs = append(s.jobs, job{name: name, interval: interval, run: run})
+}
+
+func (s *Scheduler) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+
+	for _, j := range s.jobs {
+		s.wg.Add(1)
+		go s.loop(ctx, j)
+	}
+	s.logger.Infof("Scheduler started with %d jobs", len(s.jobs))
+}
+
+// Останавливает планировщик и ждет завершения задач, но не дольше ctx
+func (s *Scheduler) Stop(ctx context.Context) error {
+	if s.cancel == nil {
+		return nil
+	}
+	s.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		s.logger.Info("Scheduler stopped")
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Scheduler) loop(ctx context.Context, j job) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		s.runOnce(ctx, j)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Scheduler) runOnce(ctx context.Context, j job) {
+	defer func() {
+		if p := recover(); p != nil {
+			s.logger.WithField("job", j.name).Errorf("Scheduled job panicked: %v", p)
+		}
+	}()
+
+	if err := j.run(ctx); err != nil && ctx.Err() == nil {
+		s.logger.WithField("job", j.name).Errorf("Scheduled job failed: %v", err)
+	}
+}
@@ -1,58 +1,248 @@
 package services
 
 import (
-    "context"
-    "fmt"
+	"context"
 
-    "github.com/Misha-Glazunov/bank-api/internal/models"
-    "github.com/Misha-Glazunov/bank-api/internal/repositories"
+	"github.com/Misha-Glazunov/bank-api/internal/config"
+	"github.com/Misha-Glazunov/bank-api/internal/models"
+	"github.com/Misha-Glazunov/bank-api/internal/repositories"
+	"github.com/Misha-Glazunov/bank-api/pkg/money"
 )
 
+// Валюты, в которых можно открыть счет
+var supportedCurrencies = map[string]bool{
+	"RUB": true,
+	"USD": true,
+	"EUR": true,
+	"CNY": true,
+}
+
+var productTypes = map[string]bool{
+	models.ProductTypeCurrent: true,
+	models.ProductTypeSavings: true,
+}
+
 type accountServiceImpl struct {
-    repo repositories.AccountRepository
-}
-
-func NewAccountService(repo repositories.AccountRepository) AccountService {
-    return &accountServiceImpl{repo: repo}
-}
-
-func (s *accountServiceImpl) CreateAccount(ctx context.Context, userID string) (*models.Account, error) {
-    account := &models.Account{
-        UserID:  userID,
-        Balance: 0.0,
-    }
-    err := s.repo.Create(ctx, account)
-    return account, err
-}
-
-func (s *accountServiceImpl) GetBalance(ctx context.Context, accountID string) (float64, error) {
-    account, err := s.repo.GetByID(ctx, accountID)
-    if err != nil {
-        return 0, ErrAccountNotFound
-    }
-    return account.Balance, nil
-}
-
-func (s *accountServiceImpl) Deposit(ctx context.Context, accountID string, amount float64) error {
-    if amount <= 0 {
-        return fmt.Errorf("invalid deposit amount")
-    }
-    return s.repo.UpdateBalance(ctx, accountID, amount)
-}
-
-func (s *accountServiceImpl) Withdraw(ctx context.Context, accountID string, amount float64) error {
-    if amount <= 0 {
-        return fmt.Errorf("invalid withdrawal amount")
-    }
-    
-    balance, err := s.GetBalance(ctx, accountID)
-    if err != nil {
-        return err
-    }
-    
-    if balance < amount {
-        return ErrInsufficientFunds
-    }
-    
-    return s.repo.UpdateBalance(ctx, accountID, -amount)
+	txManager       repositories.TxManager
+	authorizer      Authorizer
+	repo            repositories.AccountRepository
+	ledgerRepo      repositories.LedgerRepository
+	transactionRepo repositories.TransactionRepository
+	limits          *limitsEngine
+}
+
+func NewAccountService(
+	txManager repositories.TxManager,
+	authorizer Authorizer,
+	repo repositories.AccountRepository,
+	ledgerRepo repositories.LedgerRepository,
+	transactionRepo repositories.TransactionRepository,
+	userRepo repositories.UserRepository,
+	limitRepo repositories.AccountLimitRepository,
+	limits config.LimitsConfig,
+) AccountService {
+	return &accountServiceImpl{
+		txManager:       txManager,
+		authorizer:      authorizer,
+		repo:            repo,
+		ledgerRepo:      ledgerRepo,
+		transactionRepo: transactionRepo,
+		limits:          newLimitsEngine(limits, limitRepo, transactionRepo, userRepo),
+	}
+}
+
+// Открывает счет; пустые валюта и тип продукта заменяются значениями по умолчанию
+func (s *accountServiceImpl) CreateAccount(ctx context.Context, userID, currency, productType string) (*models.Account, error) {
+	if currency == "" {
+		currency = money.DefaultCurrency
+	}
+	if productType == "" {
+		productType = models.ProductTypeCurrent
+	}
+	if !supportedCurrencies[currency] {
+		return nil, ErrUnsupportedCurrency
+	}
+	if !productTypes[productType] {
+		return nil, ErrUnsupportedProduct
+	}
+
+	account := &models.Account{
+		UserID:           userID,
+		Balance:          money.Zero(currency),
+		AvailableBalance: money.Zero(currency),
+		Currency:         currency,
+		ProductType:      productType,
+		Status:           models.AccountStatusActive,
+	}
+	if err := s.repo.Create(ctx, account); err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+func (s *accountServiceImpl) ListAccounts(ctx context.Context, userID string) ([]*models.Account, error) {
+	accounts, err := s.repo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if accounts == nil {
+		accounts = []*models.Account{}
+	}
+	return accounts, nil
+}
+
+func (s *accountServiceImpl) GetAccount(ctx context.Context, userID, accountID string) (*models.Account, error) {
+	return s.authorizer.AuthorizeAccount(ctx, userID, accountID)
+}
+
+func (s *accountServiceImpl) GetBalance(ctx context.Context, userID, accountID string) (money.Money, error) {
+	account, err := s.authorizer.AuthorizeAccount(ctx, userID, accountID)
+	if err != nil {
+		return money.Money{}, err
+	}
+	return account.Balance, nil
+}
+
+func (s *accountServiceImpl) Deposit(ctx context.Context, userID, accountID string, amount money.Money) error {
+	if !amount.IsPositive() {
+		return ErrInvalidAmount
+	}
+	if _, err := s.authorizer.AuthorizeAccount(ctx, userID, accountID); err != nil {
+		return err
+	}
+
+	return s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		accounts, err := lockAccounts(ctx, s.repo, accountID)
+		if err != nil {
+			return err
+		}
+
+		account := accounts[accountID]
+		if account.IsClosed() {
+			return ErrAccountClosed
+		}
+		amount, err := inAccountCurrency(amount, account)
+		if err != nil {
+			return err
+		}
+
+		entry, err := postWithSystemAccount(ctx, s.ledgerRepo,
+			models.EntryTypeDeposit, models.SystemAccountCash, "Cash deposit",
+			accountID, amount,
+		)
+		if err != nil {
+			return err
+		}
+
+		return s.transactionRepo.Create(ctx, &models.Transaction{
+			ToAccount: accountID,
+			Amount:    amount,
+			Currency:  amount.Currency,
+			Type:      models.TransactionTypeDeposit,
+			EntryID:   entry.ID,
+		})
+	})
+}
+
+// Списывает средства, удерживая блокировку счета между проверкой и изменением баланса
+func (s *accountServiceImpl) Withdraw(ctx context.Context, userID, accountID string, amount money.Money) error {
+	if !amount.IsPositive() {
+		return ErrInvalidAmount
+	}
+	owner, err := s.authorizer.AuthorizeAccountOwner(ctx, userID, accountID)
+	if err != nil {
+		return err
+	}
+
+	return s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.limits.Lock(ctx, owner.UserID); err != nil {
+			return err
+		}
+		accounts, err := lockAccounts(ctx, s.repo, accountID)
+		if err != nil {
+			return err
+		}
+
+		account := accounts[accountID]
+		if account.IsClosed() {
+			return ErrAccountClosed
+		}
+		// Средства срочного вклада выдаются только при его закрытии
+		if account.ProductType == models.ProductTypeTermDeposit {
+			return ErrDepositLocked
+		}
+		amount, err := inAccountCurrency(amount, account)
+		if err != nil {
+			return err
+		}
+
+		if err := s.limits.CheckOutgoing(ctx, userID, account, amount, false); err != nil {
+			return err
+		}
+
+		entry, err := postWithSystemAccount(ctx, s.ledgerRepo,
+			models.EntryTypeWithdrawal, models.SystemAccountCash, "Cash withdrawal",
+			accountID, amount.Neg(),
+		)
+		if err != nil {
+			return err
+		}
+
+		return s.transactionRepo.Create(ctx, &models.Transaction{
+			FromAccount: accountID,
+			Amount:      amount,
+			Currency:    amount.Currency,
+			Type:        models.TransactionTypeWithdrawal,
+			EntryID:     entry.ID,
+		})
+	})
+}
+
+// Закрывает счет с нулевым балансом; после закрытия проводки по нему невозможны
+func (s *accountServiceImpl) CloseAccount(ctx context.Context, userID, accountID string) (*models.Account, error) {
+	if _, err := s.authorizer.AuthorizeAccountOwner(ctx, userID, accountID); err != nil {
+		return nil, err
+	}
+
+	var closed *models.Account
+	err := s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		accounts, err := lockAccounts(ctx, s.repo, accountID)
+		if err != nil {
+			return err
+		}
+
+		account := accounts[accountID]
+		if account.IsClosed() {
+			return ErrAccountClosed
+		}
+		if account.IsFrozen() {
+			return ErrAccountFrozen
+		}
+		if !account.Balance.IsZero() {
+			return ErrAccountBalanceNotZero
+		}
+		if !account.AvailableBalance.IsZero() {
+			return ErrAccountHasHolds
+		}
+
+		if err := s.repo.UpdateStatus(ctx, accountID, models.AccountStatusClosed); err != nil {
+			return err
+		}
+
+		closed, err = s.repo.GetByID(ctx, accountID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return closed, nil
+}
+
+// Действующие лимиты счета и доступные остатки
+func (s *accountServiceImpl) GetLimits(ctx context.Context, userID, accountID string) (*models.LimitsStatus, error) {
+	account, err := s.authorizer.AuthorizeAccount(ctx, userID, accountID)
+	if err != nil {
+		return nil, err
+	}
+	return s.limits.Status(ctx, account)
 }
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Misha-Glazunov/bank-api/pkg/crypto"
+	"github.com/Misha-Glazunov/bank-api/pkg/utils"
+)
+
+// Назначения токенов из писем; токен одного назначения не принимается для другого
+const (
+	actionVerifyEmail   = "verify_email"
+	actionPasswordReset = "password_reset"
+)
+
+// Токен действия из письма: base64url("userID:срок в секундах Unix") и HMAC-SHA256
+// от назначения, нагрузки и привязки. Привязка — значение, смена которого
+// аннулирует токен: адрес для подтверждения, хеш пароля для сброса.
+type actionToken struct {
+	payload   string
+	signature string
+	userID    string
+	expiresAt time.Time
+}
+
+func signActionToken(secret, action, userID, binding string, expiresAt time.Time) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(userID + ":" + strconv.FormatInt(expiresAt.Unix(), 10)))
+	return payload + "." + crypto.GenerateHMAC(actionSigningString(action, payload, binding), []byte(secret))
+}
+
+// Разбирает токен без проверки подписи: привязка известна только после загрузки пользователя
+func parseActionToken(token string) (*actionToken, error) {
+	payload, signature, ok := strings.Cut(token, ".")
+	if !ok || payload == "" || signature == "" {
+		return nil, ErrInvalidActionToken
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, ErrInvalidActionToken
+	}
+	userID, expires, ok := strings.Cut(string(raw), ":")
+	if !ok || !utils.IsValidUUID(userID) {
+		return nil, ErrInvalidActionToken
+	}
+	seconds, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidActionToken
+	}
+
+	return &actionToken{
+		payload:   payload,
+		signature: signature,
+		userID:    userID,
+		expiresAt: time.Unix(seconds, 0).UTC(),
+	}, nil
+}
+
+func (t *actionToken) verify(secret, action, binding string, now time.Time) error {
+	if !crypto.VerifyHMAC(actionSigningString(action, t.payload, binding), []byte(secret), t.signature) {
+		return ErrInvalidActionToken
+	}
+	if !now.Before(t.expiresAt) {
+		return ErrInvalidActionToken
+	}
+	return nil
+}
+
+func actionSigningString(action, payload, binding string) string {
+	return action + "\n" + payload + "\n" + binding
+}
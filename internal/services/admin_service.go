@@ -0,0 +1,575 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/Misha-Glazunov/bank-api/internal/models"
+	"github.com/Misha-Glazunov/bank-api/internal/repositories"
+	"github.com/Misha-Glazunov/bank-api/pkg/money"
+)
+
+type adminServiceImpl struct {
+	txManager       repositories.TxManager
+	userRepo        repositories.UserRepository
+	accountRepo     repositories.AccountRepository
+	cardRepo        repositories.CardRepository
+	ledgerRepo      repositories.LedgerRepository
+	transactionRepo repositories.TransactionRepository
+	limitRepo       repositories.AccountLimitRepository
+	tokenRepo       repositories.TokenRepository
+	auditRepo       repositories.AuditRepository
+	ledger          LedgerService
+	logger          *logrus.Logger
+}
+
+func NewAdminService(
+	txManager repositories.TxManager,
+	userRepo repositories.UserRepository,
+	accountRepo repositories.AccountRepository,
+	cardRepo repositories.CardRepository,
+	ledgerRepo repositories.LedgerRepository,
+	transactionRepo repositories.TransactionRepository,
+	limitRepo repositories.AccountLimitRepository,
+	tokenRepo repositories.TokenRepository,
+	auditRepo repositories.AuditRepository,
+	ledger LedgerService,
+	logger *logrus.Logger,
+) AdminService {
+	return &adminServiceImpl{
+		txManager:       txManager,
+		userRepo:        userRepo,
+		accountRepo:     accountRepo,
+		cardRepo:        cardRepo,
+		ledgerRepo:      ledgerRepo,
+		transactionRepo: transactionRepo,
+		limitRepo:       limitRepo,
+		tokenRepo:       tokenRepo,
+		auditRepo:       auditRepo,
+		ledger:          ledger,
+		logger:          logger,
+	}
+}
+
+// Ищет пользователей по идентификатору, адресу или имени
+func (s *adminServiceImpl) SearchUsers(ctx context.Context, actorID, query string, limit int) ([]*models.User, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, ErrQueryRequired
+	}
+	if limit <= 0 || limit > maxPageSize {
+		limit = defaultPageSize
+	}
+
+	users, err := s.userRepo.Search(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	err = s.audit(ctx, &models.AuditRecord{
+		ActorID:    actorID,
+		Action:     models.AuditActionSearchUsers,
+		TargetType: models.AuditTargetUser,
+		TargetID:   query,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// Карточка клиента со всеми его счетами и картами
+func (s *adminServiceImpl) GetUser(ctx context.Context, actorID, userID string) (*models.UserOverview, error) {
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	accounts, err := s.accountRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	cards, err := s.cardRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.audit(ctx, &models.AuditRecord{
+		ActorID:    actorID,
+		Action:     models.AuditActionViewUser,
+		TargetType: models.AuditTargetUser,
+		TargetID:   userID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if accounts == nil {
+		accounts = []*models.Account{}
+	}
+	if cards == nil {
+		cards = []*models.Card{}
+	}
+	return &models.UserOverview{User: user, Accounts: accounts, Cards: cards}, nil
+}
+
+// Меняет роль пользователя и завершает его сессии, чтобы новая роль
+// вступила в силу сразу. Собственную роль сменить нельзя.
+func (s *adminServiceImpl) ChangeRole(ctx context.Context, actorID, userID, role, reason string) (*models.User, error) {
+	if !models.IsValidRole(role) {
+		return nil, ErrInvalidRole
+	}
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, ErrReasonRequired
+	}
+	if actorID == userID {
+		return nil, ErrAccessDenied
+	}
+
+	var user *models.User
+	err := s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		if user, err = s.getUser(ctx, userID); err != nil {
+			return err
+		}
+		previous := user.Role
+
+		if err := s.userRepo.UpdateRole(ctx, userID, role); err != nil {
+			return err
+		}
+		if err := s.tokenRepo.RevokeAll(ctx, userID); err != nil {
+			return err
+		}
+		user.Role = role
+
+		return s.audit(ctx, &models.AuditRecord{
+			ActorID:    actorID,
+			Action:     models.AuditActionChangeRole,
+			TargetType: models.AuditTargetUser,
+			TargetID:   userID,
+			Reason:     reason,
+			Details:    map[string]string{"from": previous, "to": role},
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// Любой клиентский счет независимо от владельца
+func (s *adminServiceImpl) GetAccount(ctx context.Context, actorID, accountID string) (*models.Account, error) {
+	account, err := s.accountRepo.GetByID(ctx, accountID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrAccountNotFound) {
+			return nil, ErrAccountNotFound
+		}
+		return nil, err
+	}
+	// Внутренние счета банка через API не выдаются
+	if account.UserID == "" {
+		return nil, ErrAccountNotFound
+	}
+
+	err = s.audit(ctx, &models.AuditRecord{
+		ActorID:    actorID,
+		Action:     models.AuditActionViewAccount,
+		TargetType: models.AuditTargetAccount,
+		TargetID:   accountID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// Запрещает списания со счета; зачисления продолжают проходить
+func (s *adminServiceImpl) FreezeAccount(ctx context.Context, actorID, accountID, reason string) (*models.Account, error) {
+	return s.setAccountFrozen(ctx, actorID, accountID, reason, true)
+}
+
+func (s *adminServiceImpl) UnfreezeAccount(ctx context.Context, actorID, accountID, reason string) (*models.Account, error) {
+	return s.setAccountFrozen(ctx, actorID, accountID, reason, false)
+}
+
+// Запрещает авторизации по карте. Заморозку не снимает разблокировка владельцем,
+// а перевыпуск замороженной карты запрещен.
+func (s *adminServiceImpl) FreezeCard(ctx context.Context, actorID, cardID, reason string) (*models.Card, error) {
+	return s.setCardFrozen(ctx, actorID, cardID, reason, true)
+}
+
+func (s *adminServiceImpl) UnfreezeCard(ctx context.Context, actorID, cardID, reason string) (*models.Card, error) {
+	return s.setCardFrozen(ctx, actorID, cardID, reason, false)
+}
+
+// Ручное зачисление или списание с проводкой через внутренний счет корректировок.
+// Лимиты и заморозка не проверяются: корректировка исправляет ошибки банка,
+// поэтому списание может увести баланс в минус.
+func (s *adminServiceImpl) AdjustBalance(ctx context.Context, actorID, accountID string, adjustment models.BalanceAdjustment) (*models.Account, error) {
+	reason := strings.TrimSpace(adjustment.Reason)
+	if reason == "" {
+		return nil, ErrReasonRequired
+	}
+	if adjustment.Direction != models.PostingCredit && adjustment.Direction != models.PostingDebit {
+		return nil, ErrInvalidDirection
+	}
+	if !adjustment.Amount.IsPositive() {
+		return nil, ErrInvalidAmount
+	}
+
+	var account *models.Account
+	err := s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		if account, err = s.lockClientAccount(ctx, accountID); err != nil {
+			return err
+		}
+		if account.IsClosed() {
+			return ErrAccountClosed
+		}
+		amount, err := inAccountCurrency(adjustment.Amount, account)
+		if err != nil {
+			return err
+		}
+
+		transaction := &models.Transaction{
+			Amount:   amount,
+			Currency: amount.Currency,
+			Type:     models.TransactionTypeAdjustment,
+		}
+		signed := amount
+		if adjustment.Direction == models.PostingDebit {
+			signed = amount.Neg()
+			transaction.FromAccount = accountID
+		} else {
+			transaction.ToAccount = accountID
+		}
+
+		entry, err := postWithSystemAccount(ctx, s.ledgerRepo,
+			models.EntryTypeAdjustment, models.SystemAccountAdjustments, "Manual adjustment: "+reason,
+			accountID, signed,
+		)
+		if err != nil {
+			return err
+		}
+		transaction.EntryID = entry.ID
+		if err := s.transactionRepo.Create(ctx, transaction); err != nil {
+			return err
+		}
+
+		err = s.audit(ctx, &models.AuditRecord{
+			ActorID:    actorID,
+			Action:     models.AuditActionAdjustBalance,
+			TargetType: models.AuditTargetAccount,
+			TargetID:   accountID,
+			Reason:     reason,
+			Details: map[string]string{
+				"direction": adjustment.Direction,
+				"amount":    amount.String(),
+				"currency":  amount.Currency,
+				"entry_id":  entry.ID,
+			},
+		})
+		if err != nil {
+			return err
+		}
+
+		account, err = s.accountRepo.GetByID(ctx, accountID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// Задает индивидуальные лимиты счета в его валюте. Лимиты, не указанные
+// в запросе, возвращаются к значениям по умолчанию.
+func (s *adminServiceImpl) SetAccountLimits(ctx context.Context, actorID, accountID string, update models.AccountLimitsUpdate) (*models.AccountLimits, error) {
+	reason := strings.TrimSpace(update.Reason)
+	if reason == "" {
+		return nil, ErrReasonRequired
+	}
+
+	var limits *models.AccountLimits
+	err := s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		account, err := s.lockClientAccount(ctx, accountID)
+		if err != nil {
+			return err
+		}
+		if account.IsClosed() {
+			return ErrAccountClosed
+		}
+
+		details := map[string]string{}
+		for _, f := range []struct {
+			name  string
+			value **money.Money
+		}{
+			{models.LimitMaxTransfer, &update.MaxTransfer},
+			{models.LimitOverdraft, &update.Overdraft},
+			{models.LimitDailyOutgoing, &update.DailyOutgoing},
+			{models.LimitMonthlyOutgoing, &update.MonthlyOutgoing},
+		} {
+			if *f.value == nil {
+				details[f.name] = "default"
+				continue
+			}
+			value, err := inAccountCurrency(**f.value, account)
+			if err != nil {
+				return err
+			}
+			*f.value = &value
+			details[f.name] = value.String()
+		}
+
+		if err := s.limitRepo.Upsert(ctx, accountID, &update.AccountLimits); err != nil {
+			return err
+		}
+		err = s.audit(ctx, &models.AuditRecord{
+			ActorID:    actorID,
+			Action:     models.AuditActionSetLimits,
+			TargetType: models.AuditTargetAccount,
+			TargetID:   accountID,
+			Reason:     reason,
+			Details:    details,
+		})
+		if err != nil {
+			return err
+		}
+
+		limits, err = s.limitRepo.Get(ctx, accountID, account.Currency)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return limits, nil
+}
+
+// Журнал действий сотрудников от новых записей к старым; просмотр журнала тоже аудируется
+func (s *adminServiceImpl) ListAudit(ctx context.Context, actorID string, filter models.AuditFilter) ([]*models.AuditRecord, error) {
+	if filter.Limit <= 0 || filter.Limit > maxPageSize {
+		filter.Limit = defaultPageSize
+	}
+	records, err := s.auditRepo.List(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	details := map[string]string{"limit": strconv.Itoa(filter.Limit)}
+	if filter.ActorID != "" {
+		details["actor_id"] = filter.ActorID
+	}
+	if filter.TargetType != "" {
+		details["target_type"] = filter.TargetType
+	}
+	if filter.TargetID != "" {
+		details["target_id"] = filter.TargetID
+	}
+	if filter.Before != nil {
+		details["before"] = filter.Before.Format(time.RFC3339Nano)
+	}
+	err = s.audit(ctx, &models.AuditRecord{
+		ActorID:    actorID,
+		Action:     models.AuditActionViewAudit,
+		TargetType: models.AuditTargetAudit,
+		TargetID:   "records",
+		Details:    details,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// Сторнирует запись журнала; сторно и аудит выполняются в одной транзакции
+func (s *adminServiceImpl) ReverseEntry(ctx context.Context, actorID, entryID, reason string) (*models.JournalEntry, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, ErrReasonRequired
+	}
+
+	var reversal *models.JournalEntry
+	err := s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		if reversal, err = s.ledger.Reverse(ctx, entryID, reason); err != nil {
+			return err
+		}
+		return s.audit(ctx, &models.AuditRecord{
+			ActorID:    actorID,
+			Action:     models.AuditActionReverseEntry,
+			TargetType: models.AuditTargetEntry,
+			TargetID:   entryID,
+			Reason:     reason,
+			Details:    map[string]string{"reversal_id": reversal.ID},
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reversal, nil
+}
+
+// Счета, у которых кэшированный баланс расходится с журналом
+func (s *adminServiceImpl) Reconcile(ctx context.Context, actorID string) ([]*models.BalanceMismatch, error) {
+	mismatches, err := s.ledger.Reconcile(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = s.audit(ctx, &models.AuditRecord{
+		ActorID:    actorID,
+		Action:     models.AuditActionReconcile,
+		TargetType: models.AuditTargetLedger,
+		TargetID:   "balances",
+		Details:    map[string]string{"mismatches": strconv.Itoa(len(mismatches))},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if mismatches == nil {
+		mismatches = []*models.BalanceMismatch{}
+	}
+	return mismatches, nil
+}
+
+func (s *adminServiceImpl) setAccountFrozen(ctx context.Context, actorID, accountID, reason string, frozen bool) (*models.Account, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, ErrReasonRequired
+	}
+
+	var account *models.Account
+	err := s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		if account, err = s.lockClientAccount(ctx, accountID); err != nil {
+			return err
+		}
+		switch {
+		case frozen && account.IsClosed():
+			return ErrAccountClosed
+		case frozen && account.IsFrozen():
+			return ErrAccountFrozen
+		case !frozen && !account.IsFrozen():
+			return ErrAccountNotFrozen
+		}
+
+		if err := s.accountRepo.SetFrozen(ctx, accountID, frozen); err != nil {
+			return err
+		}
+		action := models.AuditActionFreezeAccount
+		if !frozen {
+			action = models.AuditActionUnfreezeAccount
+		}
+		err = s.audit(ctx, &models.AuditRecord{
+			ActorID:    actorID,
+			Action:     action,
+			TargetType: models.AuditTargetAccount,
+			TargetID:   accountID,
+			Reason:     reason,
+		})
+		if err != nil {
+			return err
+		}
+
+		account, err = s.accountRepo.GetByID(ctx, accountID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+func (s *adminServiceImpl) setCardFrozen(ctx context.Context, actorID, cardID, reason string, frozen bool) (*models.Card, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, ErrReasonRequired
+	}
+
+	var c *models.Card
+	err := s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		c, err = s.cardRepo.GetByIDForUpdate(ctx, cardID)
+		if err != nil {
+			if errors.Is(err, repositories.ErrCardNotFound) {
+				return ErrCardNotFound
+			}
+			return err
+		}
+		switch {
+		case frozen && c.Status == models.CardStatusClosed:
+			return ErrCardClosed
+		case frozen && c.IsFrozen():
+			return ErrCardFrozen
+		case !frozen && !c.IsFrozen():
+			return ErrCardNotFrozen
+		}
+
+		if err := s.cardRepo.SetFrozen(ctx, cardID, frozen); err != nil {
+			return err
+		}
+		action := models.AuditActionFreezeCard
+		if !frozen {
+			action = models.AuditActionUnfreezeCard
+		}
+		err = s.audit(ctx, &models.AuditRecord{
+			ActorID:    actorID,
+			Action:     action,
+			TargetType: models.AuditTargetCard,
+			TargetID:   cardID,
+			Reason:     reason,
+		})
+		if err != nil {
+			return err
+		}
+
+		c, err = s.cardRepo.GetByID(ctx, cardID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (s *adminServiceImpl) getUser(ctx context.Context, userID string) (*models.User, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrUserNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+// Блокирует клиентский счет; внутренние счета банка считаются несуществующими
+func (s *adminServiceImpl) lockClientAccount(ctx context.Context, accountID string) (*models.Account, error) {
+	accounts, err := lockAccounts(ctx, s.accountRepo, accountID)
+	if err != nil {
+		return nil, err
+	}
+	account := accounts[accountID]
+	if account.UserID == "" {
+		return nil, ErrAccountNotFound
+	}
+	return account, nil
+}
+
+// Записывает действие в журнал аудита. Для изменений вызывается в той же
+// транзакции, что и само изменение: без записи в журнале изменение не сохраняется.
+func (s *adminServiceImpl) audit(ctx context.Context, record *models.AuditRecord) error {
+	if err := s.auditRepo.Create(ctx, record); err != nil {
+		return err
+	}
+	s.logger.WithFields(logrus.Fields{
+		"actor_id":    record.ActorID,
+		"action":      record.Action,
+		"target_type": record.TargetType,
+		"target_id":   record.TargetID,
+	}).Info("Admin action")
+	return nil
+}
@@ -2,29 +2,80 @@ package services
 
 import (
     "context"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/hex"
+    "errors"
     "fmt"
+    "net/url"
     "time"
 
+    "github.com/Misha-Glazunov/bank-api/internal/config"
+    "github.com/Misha-Glazunov/bank-api/internal/mailer"
     "github.com/Misha-Glazunov/bank-api/internal/models"
     "github.com/Misha-Glazunov/bank-api/internal/repositories"
+    "github.com/Misha-Glazunov/bank-api/pkg/utils"
     "github.com/golang-jwt/jwt/v5"
+    "github.com/sirupsen/logrus"
     "golang.org/x/crypto/bcrypt"
 )
 
 
 type authServiceImpl struct {
+    txManager repositories.TxManager
     userRepo  repositories.UserRepository
-    jwtSecret string
+    tokenRepo repositories.TokenRepository
+    twoFactor *twoFactorVerifier
+    mailer    mailer.Mailer
+    jwt       config.JWTConfig
+    email     config.EmailConfig
+    challenge time.Duration
+    publicURL string
+    logger    *logrus.Logger
+    now       func() time.Time
 }
 
-func NewAuthService(userRepo repositories.UserRepository, jwtSecret string) AuthService {
+func NewAuthService(
+    txManager repositories.TxManager,
+    userRepo repositories.UserRepository,
+    tokenRepo repositories.TokenRepository,
+    twoFactorRepo repositories.TwoFactorRepository,
+    sender mailer.Mailer,
+    jwtConfig config.JWTConfig,
+    emailConfig config.EmailConfig,
+    twoFactorConfig config.TwoFactorConfig,
+    publicURL string,
+    logger *logrus.Logger,
+) AuthService {
     return &authServiceImpl{
+        txManager: txManager,
         userRepo:  userRepo,
-        jwtSecret: jwtSecret,
+        tokenRepo: tokenRepo,
+        twoFactor: newTwoFactorVerifier(txManager, twoFactorRepo, twoFactorConfig, logger),
+        mailer:    sender,
+        jwt:       jwtConfig,
+        email:     emailConfig,
+        challenge: twoFactorConfig.ChallengeLifetime,
+        publicURL: publicURL,
+        logger:    logger,
+        now:       func() time.Time { return time.Now().UTC() },
     }
 }
 
+// Регистрирует пользователя и отправляет письмо для подтверждения адреса.
+// До подтверждения списания со счетов недоступны.
 func (s *authServiceImpl) Register(ctx context.Context, email, username, password string) error {
+    if !utils.IsValidEmail(email) {
+        return ErrInvalidEmail
+    }
+    if !utils.IsValidUsername(username) {
+        return ErrInvalidUsername
+    }
+    if !utils.IsStrongPassword(password) {
+        return ErrWeakPassword
+    }
+
     exists, err := s.userRepo.EmailExists(ctx, email)
     if err != nil {
         return fmt.Errorf("email check failed: %w", err)
@@ -52,27 +103,375 @@ func (s *authServiceImpl) Register(ctx context.Context, email, username, passwor
         PasswordHash: string(hashedPassword),
     }
 
-    return s.userRepo.Create(ctx, user)
+    if err := s.userRepo.Create(ctx, user); err != nil {
+        return err
+    }
+    s.sendVerification(user)
+    return nil
+}
+
+// Подтверждает адрес по токену из письма. Повторный переход по ссылке не считается ошибкой.
+func (s *authServiceImpl) VerifyEmail(ctx context.Context, token string) error {
+    user, err := s.userByActionToken(ctx, token, actionVerifyEmail, func(u *models.User) string {
+        return u.Email
+    })
+    if err != nil {
+        return err
+    }
+    if user.IsEmailVerified() {
+        return nil
+    }
+    return s.userRepo.MarkEmailVerified(ctx, user.ID)
 }
 
-func (s *authServiceImpl) Login(ctx context.Context, email, password string) (string, error) {
+// Повторно отправляет письмо для подтверждения адреса
+func (s *authServiceImpl) ResendVerification(ctx context.Context, userID string) error {
+    user, err := s.userRepo.GetByID(ctx, userID)
+    if err != nil {
+        return err
+    }
+    if user.IsEmailVerified() {
+        return ErrEmailAlreadyVerified
+    }
+    s.sendVerification(user)
+    return nil
+}
+
+// Отправляет ссылку для сброса пароля. Для неизвестного адреса ошибка не
+// возвращается, чтобы по ответу нельзя было проверить наличие пользователя.
+func (s *authServiceImpl) RequestPasswordReset(ctx context.Context, email string) error {
     user, err := s.userRepo.GetByEmail(ctx, email)
     if err != nil {
-        return "", ErrInvalidCredentials
+        if errors.Is(err, repositories.ErrUserNotFound) {
+            return nil
+        }
+        return err
+    }
+
+    expiresAt := s.now().Add(s.email.PasswordResetLifetime)
+    token := signActionToken(s.email.TokenSecret, actionPasswordReset, user.ID, user.PasswordHash, expiresAt)
+    s.send(user.Email, mailer.TemplatePasswordReset, mailer.ActionLink{
+        Username:  user.Username,
+        URL:       s.link("/password/reset", token),
+        ExpiresAt: expiresAt,
+    })
+    return nil
+}
+
+// Устанавливает новый пароль по токену из письма и завершает все сессии.
+// Токен привязан к хешу прежнего пароля, поэтому действует один раз.
+// Получение письма подтверждает и сам адрес.
+func (s *authServiceImpl) ResetPassword(ctx context.Context, token, password string) error {
+    if !utils.IsStrongPassword(password) {
+        return ErrWeakPassword
+    }
+    user, err := s.userByActionToken(ctx, token, actionPasswordReset, func(u *models.User) string {
+        return u.PasswordHash
+    })
+    if err != nil {
+        return err
+    }
+
+    hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+    if err != nil {
+        return fmt.Errorf("password hashing failed: %w", err)
+    }
+
+    return s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+        err := s.userRepo.UpdatePassword(ctx, user.ID, user.PasswordHash, string(hashedPassword))
+        if err != nil {
+            if errors.Is(err, repositories.ErrUserNotFound) {
+                return ErrInvalidActionToken
+            }
+            return err
+        }
+        if !user.IsEmailVerified() {
+            if err := s.userRepo.MarkEmailVerified(ctx, user.ID); err != nil {
+                return err
+            }
+        }
+        return s.tokenRepo.RevokeAll(ctx, user.ID)
+    })
+}
+
+// Проверяет пароль и открывает новую сессию. При включенной двухфакторной
+// аутентификации вместо токенов возвращается токен второго шага входа.
+func (s *authServiceImpl) Login(ctx context.Context, email, password string) (*models.LoginResult, error) {
+    user, err := s.userRepo.GetByEmail(ctx, email)
+    if err != nil {
+        return nil, ErrInvalidCredentials
     }
 
     if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
-        return "", ErrInvalidCredentials
+        return nil, ErrInvalidCredentials
+    }
+
+    enabled, err := s.twoFactor.Enabled(ctx, user.ID)
+    if err != nil {
+        return nil, err
+    }
+    if enabled {
+        challenge, err := s.startChallenge(ctx, user.ID)
+        if err != nil {
+            return nil, err
+        }
+        return &models.LoginResult{Challenge: challenge}, nil
+    }
+
+    pair, err := s.openSession(ctx, user.ID)
+    if err != nil {
+        return nil, err
+    }
+    return &models.LoginResult{TokenPair: pair}, nil
+}
+
+// Второй шаг входа: обменивает токен второго шага и код TOTP или резервный код
+// на пару токенов. Токен действует до истечения срока или первого успешного входа.
+func (s *authServiceImpl) CompleteLogin(ctx context.Context, challengeToken, code string) (*models.TokenPair, error) {
+    if challengeToken == "" {
+        return nil, ErrInvalidChallenge
+    }
+    challenge, err := s.tokenRepo.GetChallenge(ctx, hashToken(challengeToken))
+    if err != nil {
+        if errors.Is(err, repositories.ErrChallengeNotFound) {
+            return nil, ErrInvalidChallenge
+        }
+        return nil, err
+    }
+    if challenge.UsedAt != nil || !s.now().Before(challenge.ExpiresAt) {
+        return nil, ErrInvalidChallenge
+    }
+
+    if err := s.twoFactor.Verify(ctx, challenge.UserID, code); err != nil {
+        // Двухфакторная аутентификация отключена между шагами: нужен повторный вход
+        if errors.Is(err, ErrTwoFactorNotEnabled) {
+            return nil, ErrInvalidChallenge
+        }
+        return nil, err
+    }
+
+    var pair *models.TokenPair
+    err = s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+        if err := s.tokenRepo.MarkChallengeUsed(ctx, challenge.ID); err != nil {
+            if errors.Is(err, repositories.ErrChallengeNotFound) {
+                return ErrInvalidChallenge
+            }
+            return err
+        }
+        pair, err = s.openSession(ctx, challenge.UserID)
+        return err
+    })
+    if err != nil {
+        return nil, err
+    }
+    return pair, nil
+}
+
+// Обменивает refresh-токен на новую пару токенов той же сессии. Использованный
+// токен повторно не принимается: его предъявление означает утечку, поэтому
+// сессия отзывается целиком.
+func (s *authServiceImpl) Refresh(ctx context.Context, refreshToken string) (*models.TokenPair, error) {
+    if refreshToken == "" {
+        return nil, ErrInvalidRefreshToken
     }
 
-    return GenerateJWTToken(user.ID, s.jwtSecret)
+    var pair *models.TokenPair
+    var reused *models.RefreshToken
+    err := s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+        token, err := s.tokenRepo.GetByHashForUpdate(ctx, hashToken(refreshToken))
+        if err != nil {
+            if errors.Is(err, repositories.ErrRefreshTokenNotFound) {
+                return ErrInvalidRefreshToken
+            }
+            return err
+        }
+
+        switch {
+        case token.RevokedAt != nil:
+            return ErrInvalidRefreshToken
+        case token.UsedAt != nil:
+            // Отзыв фиксируется, а клиент получает ту же ошибку, что и для неизвестного токена
+            reused = token
+            return s.tokenRepo.RevokeFamily(ctx, token.UserID, token.FamilyID)
+        case !s.now().Before(token.ExpiresAt):
+            return ErrInvalidRefreshToken
+        }
+
+        if err := s.tokenRepo.MarkUsed(ctx, token.ID); err != nil {
+            return err
+        }
+        pair, err = s.issue(ctx, token.UserID, token.FamilyID)
+        return err
+    })
+    if err != nil {
+        return nil, err
+    }
+    if reused != nil {
+        s.logger.WithFields(logrus.Fields{
+            "user_id":    reused.UserID,
+            "session_id": reused.FamilyID,
+        }).Warn("Refresh token reuse detected, session revoked")
+        return nil, ErrInvalidRefreshToken
+    }
+    return pair, nil
+}
+
+// Завершает сессию: отзывает ее refresh-токены и выданные с ними access-токены
+func (s *authServiceImpl) Logout(ctx context.Context, userID, sessionID string) error {
+    return s.tokenRepo.RevokeFamily(ctx, userID, sessionID)
 }
 
-func GenerateJWTToken(userID string, secret string) (string, error) {
-    claims := jwt.RegisteredClaims{
-        Subject:   userID,
-        ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+func (s *authServiceImpl) openSession(ctx context.Context, userID string) (*models.TokenPair, error) {
+    sessionID, err := newUUID()
+    if err != nil {
+        return nil, err
+    }
+    return s.issue(ctx, userID, sessionID)
+}
+
+func (s *authServiceImpl) startChallenge(ctx context.Context, userID string) (*models.TwoFactorChallenge, error) {
+    token, err := generateToken()
+    if err != nil {
+        return nil, err
+    }
+    challenge := &models.LoginChallenge{
+        UserID:    userID,
+        TokenHash: hashToken(token),
+        ExpiresAt: s.now().Add(s.challenge),
+    }
+    if err := s.tokenRepo.CreateChallenge(ctx, challenge); err != nil {
+        return nil, err
+    }
+    return &models.TwoFactorChallenge{Token: token, ExpiresAt: challenge.ExpiresAt}, nil
+}
+
+// Выдает access-токен и refresh-токен сессии sessionID. Роль читается из базы,
+// поэтому ее смена вступает в силу при следующем обновлении токенов.
+func (s *authServiceImpl) issue(ctx context.Context, userID, sessionID string) (*models.TokenPair, error) {
+    user, err := s.userRepo.GetByID(ctx, userID)
+    if err != nil {
+        return nil, err
+    }
+
+    now := s.now()
+    tokenID, err := newUUID()
+    if err != nil {
+        return nil, err
+    }
+    expiresAt := now.Add(s.jwt.Lifetime)
+    accessToken, err := GenerateJWTToken(userID, user.Role, sessionID, tokenID, s.jwt.Secret, now, expiresAt)
+    if err != nil {
+        return nil, fmt.Errorf("access token signing failed: %w", err)
+    }
+
+    refreshToken, err := generateToken()
+    if err != nil {
+        return nil, err
+    }
+    refresh := &models.RefreshToken{
+        UserID:          userID,
+        FamilyID:        sessionID,
+        TokenHash:       hashToken(refreshToken),
+        AccessTokenID:   tokenID,
+        AccessExpiresAt: expiresAt,
+        ExpiresAt:       now.Add(s.jwt.RefreshLifetime),
+    }
+    if err := s.tokenRepo.Create(ctx, refresh); err != nil {
+        return nil, err
+    }
+
+    return &models.TokenPair{
+        AccessToken:      accessToken,
+        ExpiresAt:        expiresAt,
+        RefreshToken:     refreshToken,
+        RefreshExpiresAt: refresh.ExpiresAt,
+    }, nil
+}
+
+// Проверяет токен действия и возвращает его пользователя
+func (s *authServiceImpl) userByActionToken(ctx context.Context, token, action string, binding func(*models.User) string) (*models.User, error) {
+    parsed, err := parseActionToken(token)
+    if err != nil {
+        return nil, err
+    }
+    user, err := s.userRepo.GetByID(ctx, parsed.userID)
+    if err != nil {
+        if errors.Is(err, repositories.ErrUserNotFound) {
+            return nil, ErrInvalidActionToken
+        }
+        return nil, err
+    }
+    if err := parsed.verify(s.email.TokenSecret, action, binding(user), s.now()); err != nil {
+        return nil, err
+    }
+    return user, nil
+}
+
+func (s *authServiceImpl) sendVerification(user *models.User) {
+    expiresAt := s.now().Add(s.email.VerificationLifetime)
+    token := signActionToken(s.email.TokenSecret, actionVerifyEmail, user.ID, user.Email, expiresAt)
+    s.send(user.Email, mailer.TemplateVerifyEmail, mailer.ActionLink{
+        Username:  user.Username,
+        URL:       s.link("/email/verify", token),
+        ExpiresAt: expiresAt,
+    })
+}
+
+// Письма отправляются в фоне: сбой SMTP не должен ломать запрос, а время
+// ответа — выдавать, существует ли адрес
+func (s *authServiceImpl) send(to, template string, data interface{}) {
+    go func() {
+        err := s.mailer.Send(context.Background(), to, template, data)
+        switch {
+        case errors.Is(err, mailer.ErrNotConfigured):
+            s.logger.WithField("template", template).Warn("Email not sent: SMTP is not configured")
+        case err != nil:
+            s.logger.WithError(err).WithField("template", template).Error("Failed to send email")
+        }
+    }()
+}
+
+func (s *authServiceImpl) link(path, token string) string {
+    return s.publicURL + path + "?token=" + url.QueryEscape(token)
+}
+
+func GenerateJWTToken(userID, role, sessionID, tokenID, secret string, issuedAt, expiresAt time.Time) (string, error) {
+    claims := models.AccessClaims{
+        SessionID: sessionID,
+        Role:      role,
+        RegisteredClaims: jwt.RegisteredClaims{
+            ID:        tokenID,
+            Subject:   userID,
+            IssuedAt:  jwt.NewNumericDate(issuedAt),
+            ExpiresAt: jwt.NewNumericDate(expiresAt),
+        },
     }
     token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
     return token.SignedString([]byte(secret))
 }
+
+// Непрозрачный токен из 32 случайных байт для refresh-токенов и второго шага входа
+func generateToken() (string, error) {
+    raw := make([]byte, 32)
+    if _, err := rand.Read(raw); err != nil {
+        return "", fmt.Errorf("token generation failed: %w", err)
+    }
+    return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// Случайный UUID версии 4 для идентификаторов сессии и токена
+func newUUID() (string, error) {
+    b := make([]byte, 16)
+    if _, err := rand.Read(b); err != nil {
+        return "", fmt.Errorf("uuid generation failed: %w", err)
+    }
+    b[6] = b[6]&0x0f | 0x40
+    b[8] = b[8]&0x3f | 0x80
+    return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// В базе хранится SHA-256 токена: токен случайный, поэтому соль не нужна
+func hashToken(token string) string {
+    sum := sha256.Sum256([]byte(token))
+    return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/Misha-Glazunov/bank-api/internal/models"
+	"github.com/Misha-Glazunov/bank-api/internal/repositories"
+)
+
+// Проверяет права пользователя на счета и карты.
+// Несуществующий ресурс дает ErrAccountNotFound/ErrCardNotFound (404),
+// чужой — ErrAccessDenied (403); отказы пишутся в лог.
+//
+// Доверенный пользователь счета может смотреть счет, историю, выписки, лимиты
+// и удержания, пополнять счет и переводить с него (в том числе регулярными
+// переводами и на вклады). Снятие наличных, закрытие счета, выпуск и привязка
+// карт, кредиты и ручные удержания доступны только владельцу.
+type Authorizer interface {
+	AuthorizeAccount(ctx context.Context, userID, accountID string) (*models.Account, error)
+	AuthorizeAccountOwner(ctx context.Context, userID, accountID string) (*models.Account, error)
+	AuthorizeCard(ctx context.Context, userID, cardID string) (*models.Card, error)
+}
+
+type authorizerImpl struct {
+	accountRepo repositories.AccountRepository
+	cardRepo    repositories.CardRepository
+	logger      *logrus.Logger
+}
+
+func NewAuthorizer(
+	accountRepo repositories.AccountRepository,
+	cardRepo repositories.CardRepository,
+	logger *logrus.Logger,
+) Authorizer {
+	return &authorizerImpl{
+		accountRepo: accountRepo,
+		cardRepo:    cardRepo,
+		logger:      logger,
+	}
+}
+
+// Доступ к счету есть у владельца и у пользователей, которым он доверил счет
+func (a *authorizerImpl) AuthorizeAccount(ctx context.Context, userID, accountID string) (*models.Account, error) {
+	account, err := a.accountRepo.GetByID(ctx, accountID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrAccountNotFound) {
+			return nil, ErrAccountNotFound
+		}
+		return nil, err
+	}
+
+	if account.UserID == userID {
+		return account, nil
+	}
+
+	delegated, err := a.accountRepo.IsDelegate(ctx, accountID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !delegated {
+		a.logger.WithFields(logrus.Fields{
+			"user_id":    userID,
+			"account_id": accountID,
+		}).Warn("Account access denied")
+		return nil, ErrAccessDenied
+	}
+
+	return account, nil
+}
+
+// Доступ только для владельца счета, без доверенных пользователей
+func (a *authorizerImpl) AuthorizeAccountOwner(ctx context.Context, userID, accountID string) (*models.Account, error) {
+	account, err := a.AuthorizeAccount(ctx, userID, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	if account.UserID != userID {
+		a.logger.WithFields(logrus.Fields{
+			"user_id":    userID,
+			"account_id": accountID,
+		}).Warn("Account owner operation denied to delegate")
+		return nil, ErrAccessDenied
+	}
+
+	return account, nil
+}
+
+func (a *authorizerImpl) AuthorizeCard(ctx context.Context, userID, cardID string) (*models.Card, error) {
+	card, err := a.cardRepo.GetByID(ctx, cardID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrCardNotFound) {
+			return nil, ErrCardNotFound
+		}
+		return nil, err
+	}
+
+	if card.UserID != userID {
+		a.logger.WithFields(logrus.Fields{
+			"user_id": userID,
+			"card_id": cardID,
+		}).Warn("Card access denied")
+		return nil, ErrAccessDenied
+	}
+
+	return card, nil
+}
@@ -0,0 +1,362 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/Misha-Glazunov/bank-api/internal/models"
+	"github.com/Misha-Glazunov/bank-api/internal/repositories"
+	"github.com/Misha-Glazunov/bank-api/pkg/money"
+	"github.com/Misha-Glazunov/bank-api/pkg/utils"
+)
+
+type bulkPaymentServiceImpl struct {
+	txManager repositories.TxManager
+	repo      repositories.BulkPaymentRepository
+	payments  PaymentService
+	logger    *logrus.Logger
+}
+
+func NewBulkPaymentService(
+	txManager repositories.TxManager,
+	repo repositories.BulkPaymentRepository,
+	payments PaymentService,
+	logger *logrus.Logger,
+) BulkPaymentService {
+	return &bulkPaymentServiceImpl{
+		txManager: txManager,
+		repo:      repo,
+		payments:  payments,
+		logger:    logger,
+	}
+}
+
+// Проверяет файл pain.001 и исполняет переводы со счетов плательщика.
+// Ошибка возвращается только для неразбираемого файла и сбоев сервера;
+// отклонения пакета и отдельных переводов передаются в отчете.
+func (s *bulkPaymentServiceImpl) Import(ctx context.Context, userID string, raw []byte, mode string) (*models.BulkPaymentReport, error) {
+	if mode == "" {
+		mode = models.BulkModeAllOrNothing
+	}
+	if mode != models.BulkModeAllOrNothing && mode != models.BulkModeBestEffort {
+		return nil, ErrInvalidBulkMode
+	}
+
+	payment, err := parsePain001(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	report, statuses := newBulkReport(payment, mode)
+	if reason, details := validateBulkGroup(payment); reason != "" {
+		report.Reject(reason, details)
+		return report, nil
+	}
+
+	valid := true
+	i := 0
+	for _, instruction := range payment.Instructions {
+		for _, transfer := range instruction.Transfers {
+			if reason, details := validateBulkTransfer(instruction.DebtorAccount, transfer); reason != "" {
+				statuses[i].Reject(reason, details)
+				valid = false
+			}
+			i++
+		}
+	}
+
+	controlSum, _ := money.Parse(report.ControlSum, "")
+	batch := &models.BulkPaymentBatch{
+		UserID:               userID,
+		MessageID:            payment.MessageID,
+		Mode:                 mode,
+		Status:               models.PaymentStatusRejected,
+		NumberOfTransactions: report.NumberOfTransactions,
+		ControlSum:           controlSum,
+	}
+
+	if mode == models.BulkModeAllOrNothing {
+		err = s.executeAll(ctx, userID, payment, report, statuses, batch, valid)
+	} else {
+		err = s.executeEach(ctx, userID, payment, report, statuses, batch)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id":    userID,
+		"message_id": payment.MessageID,
+		"mode":       mode,
+		"status":     report.Status,
+	}).Info("Bulk payment file processed")
+	return report, nil
+}
+
+// Все переводы исполняются в одной транзакции; первый отказ откатывает пакет.
+// Отклоненный пакет не регистрируется, исправленный файл можно отправить повторно.
+func (s *bulkPaymentServiceImpl) executeAll(
+	ctx context.Context,
+	userID string,
+	payment *models.BulkPayment,
+	report *models.BulkPaymentReport,
+	statuses []*models.BulkTransferStatus,
+	batch *models.BulkPaymentBatch,
+	valid bool,
+) error {
+	if !valid {
+		report.RejectPending("rejected with batch")
+		return nil
+	}
+
+	errRejected := errors.New("bulk payment rejected")
+	err := s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		batch.Status = models.PaymentStatusAccepted
+		created, err := s.repo.CreateBatch(ctx, batch)
+		if err != nil {
+			return err
+		}
+		if !created {
+			report.Reject(models.ReasonDuplication, "message "+payment.MessageID+" has already been imported")
+			return errRejected
+		}
+
+		i := 0
+		for _, instruction := range payment.Instructions {
+			for _, transfer := range instruction.Transfers {
+				err := s.payments.Transfer(ctx, userID, instruction.DebtorAccount, transfer.CreditorAccount, *transfer.Amount)
+				if err != nil {
+					reason, ok := bulkRejectReason(err)
+					if !ok {
+						return err
+					}
+					statuses[i].Reject(reason, err.Error())
+					return errRejected
+				}
+				i++
+			}
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errRejected) {
+		return err
+	}
+
+	switch {
+	case err == nil:
+		for _, status := range statuses {
+			status.Status = models.PaymentStatusAccepted
+		}
+		report.Summarize()
+	case report.Reason == "":
+		report.RejectPending("rejected with batch")
+	}
+	return nil
+}
+
+// Каждый перевод исполняется отдельно; отказ одного не влияет на остальные
+func (s *bulkPaymentServiceImpl) executeEach(
+	ctx context.Context,
+	userID string,
+	payment *models.BulkPayment,
+	report *models.BulkPaymentReport,
+	statuses []*models.BulkTransferStatus,
+	batch *models.BulkPaymentBatch,
+) error {
+	created, err := s.repo.CreateBatch(ctx, batch)
+	if err != nil {
+		return err
+	}
+	if !created {
+		report.Reject(models.ReasonDuplication, "message "+payment.MessageID+" has already been imported")
+		return nil
+	}
+
+	i := 0
+	for _, instruction := range payment.Instructions {
+		for _, transfer := range instruction.Transfers {
+			status := statuses[i]
+			i++
+			if status.Status == models.PaymentStatusRejected {
+				continue
+			}
+
+			err := s.payments.Transfer(ctx, userID, instruction.DebtorAccount, transfer.CreditorAccount, *transfer.Amount)
+			if err == nil {
+				status.Status = models.PaymentStatusAccepted
+				continue
+			}
+
+			reason, ok := bulkRejectReason(err)
+			if !ok {
+				s.logger.WithFields(logrus.Fields{
+					"message_id":    payment.MessageID,
+					"end_to_end_id": transfer.EndToEndID,
+				}).Errorf("Bulk transfer failed: %v", err)
+				status.Reject(models.ReasonNarrative, "internal error")
+				continue
+			}
+			status.Reject(reason, err.Error())
+		}
+	}
+
+	report.Summarize()
+	return s.repo.UpdateBatchStatus(ctx, batch.ID, report.Status)
+}
+
+// Проверки заголовка группы: идентификатор, число переводов и контрольные суммы
+func validateBulkGroup(payment *models.BulkPayment) (string, string) {
+	if payment.MessageID == "" || len(payment.MessageID) > 35 {
+		return models.ReasonInvalidFileFormat, "GrpHdr/MsgId is missing or longer than 35 characters"
+	}
+	if len(payment.Instructions) == 0 {
+		return models.ReasonInvalidFileFormat, "file contains no PmtInf blocks"
+	}
+
+	transfers := allTransfers(payment)
+	if reason, details := checkTotals("GrpHdr", payment.NumberOfTransactions, payment.ControlSum, transfers, true); reason != "" {
+		return reason, details
+	}
+	for _, instruction := range payment.Instructions {
+		if len(instruction.Transfers) == 0 {
+			return models.ReasonInvalidFileFormat, "PmtInf " + instruction.PaymentInfoID + " contains no transfers"
+		}
+		scope := "PmtInf " + instruction.PaymentInfoID
+		if reason, details := checkTotals(scope, instruction.NumberOfTransactions, instruction.ControlSum, instruction.Transfers, false); reason != "" {
+			return reason, details
+		}
+	}
+	return "", ""
+}
+
+// Сверяет NbOfTxs и CtrlSum с фактическими переводами; CtrlSum необязателен
+func checkTotals(scope, count, controlSum string, transfers []*models.BulkTransfer, countRequired bool) (string, string) {
+	if count != "" || countRequired {
+		n, err := strconv.Atoi(count)
+		if err != nil || n != len(transfers) {
+			return models.ReasonInvalidNumberOfTxs,
+				fmt.Sprintf("%s NbOfTxs %q does not match %d transactions", scope, count, len(transfers))
+		}
+	}
+
+	if controlSum == "" {
+		return "", ""
+	}
+	expected, ok := new(big.Rat).SetString(controlSum)
+	if !ok {
+		return models.ReasonInvalidControlSum, fmt.Sprintf("%s CtrlSum %q is not a number", scope, controlSum)
+	}
+	if actual := sumTransfers(transfers); actual.Cmp(expected) != 0 {
+		return models.ReasonInvalidControlSum,
+			fmt.Sprintf("%s CtrlSum %s does not match transactions total %s", scope, controlSum, actual.FloatString(2))
+	}
+	return "", ""
+}
+
+// Проверки отдельного перевода до исполнения
+func validateBulkTransfer(debtor string, transfer *models.BulkTransfer) (string, string) {
+	if transfer.EndToEndID == "" {
+		return models.ReasonNarrative, "PmtId/EndToEndId is missing"
+	}
+	if transfer.Amount == nil || !transfer.Amount.IsPositive() {
+		return models.ReasonInvalidAmount, "InstdAmt must be a positive amount with currency"
+	}
+	if reason, details := checkAccountIdentifier(debtor, models.ReasonIncorrectAccountNumber, "debtor"); reason != "" {
+		return reason, details
+	}
+	return checkAccountIdentifier(transfer.CreditorAccount, models.ReasonInvalidCreditorAccount, "creditor")
+}
+
+// Счета банка адресуются идентификатором счета в Othr/Id. Корректный IBAN
+// указывает на счет в другом банке, а внешние переводы не поддерживаются.
+func checkAccountIdentifier(id, reason, role string) (string, string) {
+	switch {
+	case id == "":
+		return reason, role + " account identifier is missing"
+	case utils.IsValidUUID(id):
+		return "", ""
+	case utils.IsValidIBAN(id):
+		return reason, role + " IBAN " + id + " is not held at this bank"
+	default:
+		return reason, role + " account identifier " + id + " is neither an account ID nor a valid IBAN"
+	}
+}
+
+// Коды причин для отказов исполнения; false для сбоев, не зависящих от данных перевода
+func bulkRejectReason(err error) (string, bool) {
+	switch {
+	case errors.Is(err, ErrInsufficientFunds):
+		return models.ReasonInsufficientFunds, true
+	case errors.Is(err, ErrLimitExceeded):
+		return models.ReasonNotAllowedAmount, true
+	case errors.Is(err, ErrAccountNotFound):
+		return models.ReasonIncorrectAccountNumber, true
+	case errors.Is(err, ErrDestinationNotFound):
+		return models.ReasonInvalidCreditorAccount, true
+	case errors.Is(err, ErrAccountClosed), errors.Is(err, ErrPostingRejected):
+		return models.ReasonClosedAccount, true
+	case errors.Is(err, ErrAccessDenied), errors.Is(err, ErrDepositLocked), errors.Is(err, ErrEmailNotVerified),
+		errors.Is(err, ErrAccountFrozen):
+		return models.ReasonTransactionForbidden, true
+	case errors.Is(err, ErrCurrencyMismatch), errors.Is(err, ErrUnsupportedCurrencyPair),
+		errors.Is(err, ErrExchangeRateUnavailable):
+		return models.ReasonNotAllowedCurrency, true
+	case errors.Is(err, ErrInvalidAmount):
+		return models.ReasonInvalidAmount, true
+	case errors.Is(err, ErrSameAccount):
+		return models.ReasonNarrative, true
+	}
+	return "", false
+}
+
+func allTransfers(payment *models.BulkPayment) []*models.BulkTransfer {
+	var transfers []*models.BulkTransfer
+	for _, instruction := range payment.Instructions {
+		transfers = append(transfers, instruction.Transfers...)
+	}
+	return transfers
+}
+
+// Сумма переводов без учета валюты, как в CtrlSum
+func sumTransfers(transfers []*models.BulkTransfer) *big.Rat {
+	sum := new(big.Rat)
+	for _, transfer := range transfers {
+		if transfer.Amount != nil {
+			sum.Add(sum, transfer.Amount.Rat())
+		}
+	}
+	return sum
+}
+
+// Отчет с записью статуса для каждого перевода в порядке файла
+func newBulkReport(payment *models.BulkPayment, mode string) (*models.BulkPaymentReport, []*models.BulkTransferStatus) {
+	transfers := allTransfers(payment)
+	report := &models.BulkPaymentReport{
+		MessageID:            payment.MessageID,
+		Mode:                 mode,
+		NumberOfTransactions: len(transfers),
+		ControlSum:           sumTransfers(transfers).FloatString(2),
+		CreatedAt:            time.Now().UTC(),
+	}
+
+	var statuses []*models.BulkTransferStatus
+	for _, instruction := range payment.Instructions {
+		info := &models.BulkInstructionStatus{PaymentInfoID: instruction.PaymentInfoID}
+		for _, transfer := range instruction.Transfers {
+			status := &models.BulkTransferStatus{
+				InstructionID: transfer.InstructionID,
+				EndToEndID:    transfer.EndToEndID,
+			}
+			info.Transfers = append(info.Transfers, status)
+			statuses = append(statuses, status)
+		}
+		report.Instructions = append(report.Instructions, info)
+	}
+	return report, statuses
+}
@@ -0,0 +1,594 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/Misha-Glazunov/bank-api/internal/config"
+	"github.com/Misha-Glazunov/bank-api/internal/models"
+	"github.com/Misha-Glazunov/bank-api/internal/repositories"
+	"github.com/Misha-Glazunov/bank-api/pkg/card"
+	"github.com/Misha-Glazunov/bank-api/pkg/money"
+	"github.com/Misha-Glazunov/bank-api/pkg/utils"
+)
+
+// Отказ в авторизации с причиной, которая возвращается мерчанту
+type CardDeclinedError struct {
+	Reason string
+}
+
+func (e *CardDeclinedError) Error() string {
+	return fmt.Sprintf("card authorization declined: %s", e.Reason)
+}
+
+func (e *CardDeclinedError) Is(target error) bool {
+	return target == ErrCardDeclined
+}
+
+type cardPaymentServiceImpl struct {
+	txManager       repositories.TxManager
+	accountRepo     repositories.AccountRepository
+	cardRepo        repositories.CardRepository
+	cardLimitRepo   repositories.CardLimitRepository
+	repo            repositories.CardAuthorizationRepository
+	holdRepo        repositories.HoldRepository
+	ledgerRepo      repositories.LedgerRepository
+	transactionRepo repositories.TransactionRepository
+	limits          *limitsEngine
+	holdPeriod      time.Duration
+	homeCountry     string
+	maxCVVAttempts  int
+	logger          *logrus.Logger
+	now             func() time.Time
+}
+
+func NewCardPaymentService(
+	txManager repositories.TxManager,
+	accountRepo repositories.AccountRepository,
+	cardRepo repositories.CardRepository,
+	cardLimitRepo repositories.CardLimitRepository,
+	repo repositories.CardAuthorizationRepository,
+	holdRepo repositories.HoldRepository,
+	ledgerRepo repositories.LedgerRepository,
+	transactionRepo repositories.TransactionRepository,
+	userRepo repositories.UserRepository,
+	limitRepo repositories.AccountLimitRepository,
+	limits config.LimitsConfig,
+	cards config.CardsConfig,
+	logger *logrus.Logger,
+) CardPaymentService {
+	return &cardPaymentServiceImpl{
+		txManager:       txManager,
+		accountRepo:     accountRepo,
+		cardRepo:        cardRepo,
+		cardLimitRepo:   cardLimitRepo,
+		repo:            repo,
+		holdRepo:        holdRepo,
+		ledgerRepo:      ledgerRepo,
+		transactionRepo: transactionRepo,
+		limits:          newLimitsEngine(limits, limitRepo, transactionRepo, userRepo),
+		holdPeriod:      cards.AuthorizationHold,
+		homeCountry:     cards.HomeCountry,
+		maxCVVAttempts:  cards.MaxCVVAttempts,
+		logger:          logger,
+		now:             func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Проверяет реквизиты и статус карты и удерживает сумму на счете карты.
+// Удержание уменьшает доступный остаток счета до списания, отмены
+// или истечения срока авторизации.
+func (s *cardPaymentServiceImpl) Authorize(ctx context.Context, merchantID string, req models.CardAuthorizationRequest) (*models.CardAuthorization, error) {
+	if !req.Amount.IsPositive() {
+		return nil, ErrInvalidAmount
+	}
+	if req.Reference == "" {
+		return nil, ErrReferenceRequired
+	}
+	if req.Channel == "" {
+		req.Channel = models.CardChannelOnline
+	}
+	if req.Channel != models.CardChannelOnline && req.Channel != models.CardChannelOffline {
+		return nil, ErrInvalidChannel
+	}
+	if req.MCC != "" && !mccPattern.MatchString(req.MCC) {
+		return nil, ErrInvalidMCC
+	}
+	req.Country = strings.ToUpper(req.Country)
+	if req.Country != "" && len(req.Country) != 2 {
+		return nil, ErrInvalidCountry
+	}
+
+	authorization, err := s.authorize(ctx, merchantID, req)
+	if err != nil {
+		if errors.Is(err, ErrCardDeclined) {
+			s.logger.WithFields(logrus.Fields{
+				"merchant_id": merchantID,
+				"reference":   req.Reference,
+				"number":      card.MaskPAN(req.PAN),
+			}).WithError(err).Warn("Card authorization declined")
+		}
+		return nil, err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"merchant_id":      merchantID,
+		"authorization_id": authorization.ID,
+		"card_id":          authorization.CardID,
+		"amount":           authorization.Amount.String(),
+	}).Info("Card payment authorized")
+	return authorization, nil
+}
+
+func (s *cardPaymentServiceImpl) authorize(ctx context.Context, merchantID string, req models.CardAuthorizationRequest) (*models.CardAuthorization, error) {
+	c, err := s.verifyCard(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	linked, err := s.accountRepo.GetByID(ctx, c.AccountID)
+	if err != nil {
+		return nil, err
+	}
+	limits, err := s.cardLimitRepo.Get(ctx, c.ID, linked.Currency)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkControls(req, limits); err != nil {
+		return nil, err
+	}
+
+	var authorization *models.CardAuthorization
+	err = s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.limits.Lock(ctx, linked.UserID); err != nil {
+			return err
+		}
+		accounts, err := lockAccounts(ctx, s.accountRepo, linked.ID)
+		if err != nil {
+			return err
+		}
+
+		account := accounts[linked.ID]
+		if account.IsClosed() {
+			return &CardDeclinedError{Reason: models.DeclineAccountClosed}
+		}
+		if req.Currency != "" {
+			req.Amount.Currency = req.Currency
+		}
+		amount, err := inAccountCurrency(req.Amount, account)
+		if err != nil {
+			return &CardDeclinedError{Reason: models.DeclineCurrencyMismatch}
+		}
+
+		if err := s.checkCardLimits(ctx, c.ID, limits, amount); err != nil {
+			return err
+		}
+		if err := s.limits.CheckOutgoing(ctx, c.UserID, account, amount, false); err != nil {
+			switch {
+			case errors.Is(err, ErrInsufficientFunds):
+				return &CardDeclinedError{Reason: models.DeclineInsufficientFunds}
+			case errors.Is(err, ErrLimitExceeded):
+				return &CardDeclinedError{Reason: models.DeclineLimitExceeded}
+			case errors.Is(err, ErrAccountFrozen):
+				return &CardDeclinedError{Reason: models.DeclineAccountFrozen}
+			case errors.Is(err, ErrEmailNotVerified):
+				return &CardDeclinedError{Reason: models.DeclineEmailNotVerified}
+			}
+			return err
+		}
+
+		expiresAt := s.now().Add(s.holdPeriod)
+		hold, err := placeHold(ctx, s.holdRepo, account.ID, amount,
+			"Card authorization "+req.Reference, models.HoldSourceCardAuthorization, &expiresAt)
+		if err != nil {
+			return err
+		}
+
+		authorization = &models.CardAuthorization{
+			CardID:       c.ID,
+			AccountID:    account.ID,
+			HoldID:       hold.ID,
+			MaskedNumber: c.MaskedNumber,
+			MerchantID:   merchantID,
+			Reference:    req.Reference,
+			Description:  req.Description,
+			MCC:          req.MCC,
+			Channel:      req.Channel,
+			Country:      req.Country,
+			Amount:       amount,
+			Currency:     amount.Currency,
+			Status:       models.CardAuthorizationAuthorized,
+			ExpiresAt:    expiresAt,
+		}
+		if err := s.repo.Create(ctx, authorization); err != nil {
+			if errors.Is(err, repositories.ErrDuplicateAuthorization) {
+				return ErrDuplicateAuthorization
+			}
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return authorization, nil
+}
+
+func (s *cardPaymentServiceImpl) Get(ctx context.Context, merchantID, authorizationID string) (*models.CardAuthorization, error) {
+	if !utils.IsValidUUID(authorizationID) {
+		return nil, ErrCardAuthorizationNotFound
+	}
+	authorization, err := s.repo.Get(ctx, merchantID, authorizationID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrCardAuthorizationNotFound) {
+			return nil, ErrCardAuthorizationNotFound
+		}
+		return nil, err
+	}
+	return authorization, nil
+}
+
+// Списывает удержанную сумму или ее часть; остаток удержания освобождается.
+// Без суммы списывается вся авторизованная сумма.
+func (s *cardPaymentServiceImpl) Capture(ctx context.Context, merchantID, authorizationID string, amount *money.Money) (*models.CardAuthorization, error) {
+	authorization, err := s.settle(ctx, merchantID, authorizationID, func(ctx context.Context, a *models.CardAuthorization) error {
+		if a.Status != models.CardAuthorizationAuthorized {
+			return ErrAuthorizationNotPending
+		}
+		if !a.IsHeld(s.now()) {
+			return ErrAuthorizationExpired
+		}
+		captured, err := settlementAmount(amount, a.Amount)
+		if err != nil {
+			return err
+		}
+		if err := releaseHold(ctx, s.holdRepo, a.HoldID); err != nil {
+			return err
+		}
+
+		entry, err := s.post(ctx, models.EntryTypeCardPayment, "Card payment "+a.Reference, a.AccountID, captured.Neg())
+		if err != nil {
+			return err
+		}
+		if err := s.transactionRepo.Create(ctx, &models.Transaction{
+			FromAccount: a.AccountID,
+			Amount:      captured,
+			Currency:    captured.Currency,
+			Type:        models.TransactionTypeCardPayment,
+			EntryID:     entry.ID,
+		}); err != nil {
+			return err
+		}
+
+		a.CapturedAmount = captured
+		a.Status = models.CardAuthorizationCaptured
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"merchant_id":      merchantID,
+		"authorization_id": authorizationID,
+		"amount":           authorization.CapturedAmount.String(),
+	}).Info("Card payment captured")
+	return authorization, nil
+}
+
+// Отменяет авторизацию до списания и освобождает удержание
+func (s *cardPaymentServiceImpl) Void(ctx context.Context, merchantID, authorizationID string) (*models.CardAuthorization, error) {
+	authorization, err := s.settle(ctx, merchantID, authorizationID, func(ctx context.Context, a *models.CardAuthorization) error {
+		if a.Status != models.CardAuthorizationAuthorized {
+			return ErrAuthorizationNotPending
+		}
+		if err := releaseHold(ctx, s.holdRepo, a.HoldID); err != nil {
+			return err
+		}
+		a.Status = models.CardAuthorizationVoided
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"merchant_id":      merchantID,
+		"authorization_id": authorizationID,
+	}).Info("Card authorization voided")
+	return authorization, nil
+}
+
+// Возвращает списанную сумму или ее часть на счет карты. Возвратов может быть
+// несколько, пока их сумма не достигнет списанной. Повтор возврата с тем же
+// reference не выполняет его еще раз и возвращает текущее состояние авторизации.
+func (s *cardPaymentServiceImpl) Refund(ctx context.Context, merchantID, authorizationID string, req models.CardRefundRequest) (*models.CardAuthorization, error) {
+	if req.Reference == "" {
+		return nil, ErrReferenceRequired
+	}
+
+	var (
+		refunded money.Money
+		replayed bool
+	)
+	authorization, err := s.settle(ctx, merchantID, authorizationID, func(ctx context.Context, a *models.CardAuthorization) error {
+		// Авторизация заблокирована, поэтому повторы с одним reference выполняются по очереди
+		existing, err := s.repo.GetRefund(ctx, a.ID, req.Reference)
+		if err != nil && !errors.Is(err, repositories.ErrCardRefundNotFound) {
+			return err
+		}
+		if existing != nil {
+			if req.Amount != nil && req.Amount.Amount != existing.Amount.Amount {
+				return ErrRefundReferenceConflict
+			}
+			replayed = true
+			return nil
+		}
+
+		if a.Status != models.CardAuthorizationCaptured {
+			return ErrAuthorizationNotCaptured
+		}
+		refunded, err = settlementAmount(req.Amount, a.CapturedAmount.Sub(a.RefundedAmount))
+		if err != nil {
+			return err
+		}
+
+		entry, err := s.post(ctx, models.EntryTypeCardRefund, "Card refund "+a.Reference, a.AccountID, refunded)
+		if err != nil {
+			return err
+		}
+		if err := s.transactionRepo.Create(ctx, &models.Transaction{
+			ToAccount: a.AccountID,
+			Amount:    refunded,
+			Currency:  refunded.Currency,
+			Type:      models.TransactionTypeCardRefund,
+			EntryID:   entry.ID,
+		}); err != nil {
+			return err
+		}
+		if err := s.repo.CreateRefund(ctx, &models.CardRefund{
+			AuthorizationID: a.ID,
+			Reference:       req.Reference,
+			Amount:          refunded,
+			EntryID:         entry.ID,
+		}); err != nil {
+			return err
+		}
+
+		a.RefundedAmount = a.RefundedAmount.Add(refunded)
+		if a.RefundedAmount.Cmp(a.CapturedAmount) == 0 {
+			a.Status = models.CardAuthorizationRefunded
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if replayed {
+		return authorization, nil
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"merchant_id":      merchantID,
+		"authorization_id": authorizationID,
+		"reference":        req.Reference,
+		"amount":           refunded.String(),
+	}).Info("Card payment refunded")
+	return authorization, nil
+}
+
+// Находит карту по номеру и проверяет срок действия, CVV и статус
+func (s *cardPaymentServiceImpl) verifyCard(ctx context.Context, req models.CardAuthorizationRequest) (*models.Card, error) {
+	// CVV неверного формата не сравнивается с хешем
+	if !card.ValidCVV(req.CVV) {
+		return nil, &CardDeclinedError{Reason: models.DeclineInvalidCVV}
+	}
+
+	c, err := s.cardRepo.GetByNumber(ctx, req.PAN)
+	if err != nil {
+		if errors.Is(err, repositories.ErrCardNotFound) {
+			return nil, &CardDeclinedError{Reason: models.DeclineInvalidCard}
+		}
+		return nil, err
+	}
+
+	if c.AccountID == "" {
+		return nil, &CardDeclinedError{Reason: models.DeclineInvalidCard}
+	}
+
+	reason := ""
+	switch {
+	case req.Expiry != c.Expiry:
+		reason = models.DeclineInvalidExpiry
+	case bcrypt.CompareHashAndPassword([]byte(c.CVVHash), []byte(req.CVV)) != nil:
+		reason = models.DeclineInvalidCVV
+	}
+	if reason != "" {
+		if err := s.recordVerificationFailure(ctx, c.ID); err != nil {
+			return nil, err
+		}
+		return nil, &CardDeclinedError{Reason: reason}
+	}
+	if c.CVVAttempts > 0 {
+		if err := s.cardRepo.SetCVVFailedAttempts(ctx, c.ID, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case c.Status == models.CardStatusClosed:
+		return nil, &CardDeclinedError{Reason: models.DeclineCardClosed}
+	case c.Status == models.CardStatusBlocked, c.IsFrozen():
+		return nil, &CardDeclinedError{Reason: models.DeclineCardBlocked}
+	case c.IsExpired(s.now()):
+		return nil, &CardDeclinedError{Reason: models.DeclineExpiredCard}
+	}
+	return c, nil
+}
+
+// Учитывает неверные срок действия или CVV; после maxCVVAttempts ошибок подряд
+// карта закрывается. Выполняется в отдельной транзакции: отказ в авторизации
+// не должен отменять учет попытки.
+func (s *cardPaymentServiceImpl) recordVerificationFailure(ctx context.Context, cardID string) error {
+	return s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		c, err := s.cardRepo.GetByIDForUpdate(ctx, cardID)
+		if err != nil {
+			return err
+		}
+		if c.Status == models.CardStatusClosed {
+			return nil
+		}
+
+		attempts := c.CVVAttempts + 1
+		if err := s.cardRepo.SetCVVFailedAttempts(ctx, c.ID, attempts); err != nil {
+			return err
+		}
+		if attempts < s.maxCVVAttempts {
+			return nil
+		}
+
+		now := s.now()
+		c.Status = models.CardStatusClosed
+		c.BlockReason = models.CardBlockReasonTooManyAttempts
+		c.StatusChangedAt = &now
+		if err := s.cardRepo.UpdateStatus(ctx, c); err != nil {
+			return err
+		}
+		s.logger.WithFields(logrus.Fields{
+			"user_id": c.UserID,
+			"card_id": c.ID,
+		}).Warn("Card closed after too many invalid expiry or CVV attempts")
+		return nil
+	})
+}
+
+// Проверяет ограничения, которые владелец установил для карты: канал операции,
+// страну и категорию мерчанта. Если ограничение задано, а мерчант не передал
+// страну или MCC, операция отклоняется: проверить ее невозможно.
+func (s *cardPaymentServiceImpl) checkControls(req models.CardAuthorizationRequest, limits *models.CardLimits) error {
+	switch {
+	case req.Channel == models.CardChannelOnline && !enabled(limits.OnlineEnabled):
+		return &CardDeclinedError{Reason: models.DeclineOnlineDisabled}
+	case req.Channel == models.CardChannelOffline && !enabled(limits.OfflineEnabled):
+		return &CardDeclinedError{Reason: models.DeclineOfflineDisabled}
+	case req.Country != s.homeCountry && !enabled(limits.ForeignEnabled):
+		return &CardDeclinedError{Reason: models.DeclineForeignDisabled}
+	case len(limits.BlockedMCC) > 0 && req.MCC == "":
+		return &CardDeclinedError{Reason: models.DeclineMCCBlocked}
+	case containsString(limits.BlockedMCC, req.MCC):
+		return &CardDeclinedError{Reason: models.DeclineMCCBlocked}
+	case len(limits.AllowedMCC) > 0 && !containsString(limits.AllowedMCC, req.MCC):
+		return &CardDeclinedError{Reason: models.DeclineMCCNotAllowed}
+	}
+	return nil
+}
+
+// Проверяет лимиты карты на операцию, сутки и месяц. Вызывается под блокировкой
+// лимитов владельца, чтобы параллельные авторизации не превысили лимит.
+func (s *cardPaymentServiceImpl) checkCardLimits(ctx context.Context, cardID string, limits *models.CardLimits, amount money.Money) error {
+	if limits.PerTransaction != nil && limits.PerTransaction.LessThan(amount) {
+		return &CardDeclinedError{Reason: models.DeclineCardTransactionLimit}
+	}
+
+	for _, period := range []struct {
+		limit  *money.Money
+		trunc  string
+		reason string
+	}{
+		{limits.Daily, "day", models.DeclineCardDailyLimit},
+		{limits.Monthly, "month", models.DeclineCardMonthlyLimit},
+	} {
+		if period.limit == nil {
+			continue
+		}
+		spent, err := s.repo.SumSpent(ctx, cardID, amount.Currency, period.trunc)
+		if err != nil {
+			return err
+		}
+		if period.limit.LessThan(spent.Add(amount)) {
+			return &CardDeclinedError{Reason: period.reason}
+		}
+	}
+	return nil
+}
+
+// Незаданный переключатель разрешает операции
+func enabled(flag *bool) bool {
+	return flag == nil || *flag
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Меняет авторизацию под блокировкой строки и сохраняет результат apply
+func (s *cardPaymentServiceImpl) settle(
+	ctx context.Context,
+	merchantID, authorizationID string,
+	apply func(ctx context.Context, a *models.CardAuthorization) error,
+) (*models.CardAuthorization, error) {
+	if !utils.IsValidUUID(authorizationID) {
+		return nil, ErrCardAuthorizationNotFound
+	}
+
+	var authorization *models.CardAuthorization
+	err := s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		authorization, err = s.repo.GetForUpdate(ctx, merchantID, authorizationID)
+		if err != nil {
+			if errors.Is(err, repositories.ErrCardAuthorizationNotFound) {
+				return ErrCardAuthorizationNotFound
+			}
+			return err
+		}
+		if err := apply(ctx, authorization); err != nil {
+			return err
+		}
+		return s.repo.Update(ctx, authorization)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return authorization, nil
+}
+
+// Проводка между счетом карты и расчетным счетом банка; счет блокируется до проводки
+func (s *cardPaymentServiceImpl) post(ctx context.Context, entryType, description, accountID string, amount money.Money) (*models.JournalEntry, error) {
+	accounts, err := lockAccounts(ctx, s.accountRepo, accountID)
+	if err != nil {
+		return nil, err
+	}
+	if accounts[accountID].IsClosed() {
+		return nil, ErrAccountClosed
+	}
+	return postWithSystemAccount(ctx, s.ledgerRepo, entryType, models.SystemAccountCardSettlement, description, accountID, amount)
+}
+
+// Сумма списания или возврата: не больше остатка, без суммы - весь остаток
+func settlementAmount(amount *money.Money, remaining money.Money) (money.Money, error) {
+	if amount == nil {
+		return remaining, nil
+	}
+	if amount.Currency != "" && amount.Currency != remaining.Currency {
+		return money.Money{}, ErrCurrencyMismatch
+	}
+	value := *amount
+	value.Currency = remaining.Currency
+	if !value.IsPositive() {
+		return money.Money{}, ErrInvalidAmount
+	}
+	if remaining.LessThan(value) {
+		return money.Money{}, ErrAmountExceedsAuthorization
+	}
+	return value, nil
+}
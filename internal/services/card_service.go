@@ -2,25 +2,642 @@ package services
 
 import (
     "context"
-    
+    "crypto/rand"
+    "errors"
+    "fmt"
+    "math/big"
+    "regexp"
+    "time"
+
+    "github.com/sirupsen/logrus"
+    "golang.org/x/crypto/bcrypt"
+
+    "github.com/Misha-Glazunov/bank-api/internal/config"
     "github.com/Misha-Glazunov/bank-api/internal/models"
     "github.com/Misha-Glazunov/bank-api/internal/repositories"
+    "github.com/Misha-Glazunov/bank-api/pkg/card"
+    "github.com/Misha-Glazunov/bank-api/pkg/money"
 )
 
+// Число попыток подобрать свободный номер карты
+const maxPANAttempts = 5
+
+// Код категории мерчанта (MCC) по ISO 18245
+var mccPattern = regexp.MustCompile(`^[0-9]{4}$`)
+
 type cardServiceImpl struct {
-    repo repositories.CardRepository
+    txManager   repositories.TxManager
+    authorizer  Authorizer
+    accountRepo repositories.AccountRepository
+    repo        repositories.CardRepository
+    limitRepo   repositories.CardLimitRepository
+    userRepo    repositories.UserRepository
+    config      config.CardsConfig
+    batchSize   int
+    logger      *logrus.Logger
+    now         func() time.Time
 }
 
-func NewCardService(repo repositories.CardRepository) CardService {
-    return &cardServiceImpl{repo: repo}
+func NewCardService(
+    txManager repositories.TxManager,
+    authorizer Authorizer,
+    accountRepo repositories.AccountRepository,
+    repo repositories.CardRepository,
+    limitRepo repositories.CardLimitRepository,
+    userRepo repositories.UserRepository,
+    cfg config.CardsConfig,
+    batchSize int,
+    logger *logrus.Logger,
+) CardService {
+    return &cardServiceImpl{
+        txManager:   txManager,
+        authorizer:  authorizer,
+        accountRepo: accountRepo,
+        repo:        repo,
+        limitRepo:   limitRepo,
+        userRepo:    userRepo,
+        config:      cfg,
+        batchSize:   batchSize,
+        logger:      logger,
+        now:         func() time.Time { return time.Now().UTC() },
+    }
 }
 
-func (s *cardServiceImpl) CreateCard(ctx context.Context, userID string) (*models.Card, error) {
-    card := &models.Card{
-        UserID: userID,
-        Number: "4111111111111111",
-        Expiry: "12/30",
+// Выпускает карту к собственному счету пользователя: номер из диапазона BIN
+// платежной системы, срок действия от даты выпуска, случайный CVV.
+// CVV возвращается только в этом ответе, номер - в маскированном виде.
+func (s *cardServiceImpl) CreateCard(ctx context.Context, userID, accountID, paymentSystem string) (*models.Card, error) {
+    if paymentSystem == "" {
+        paymentSystem = s.config.DefaultPaymentSystem
+    }
+    if len(s.config.BINRanges[paymentSystem]) == 0 {
+        return nil, ErrUnsupportedPaymentSystem
+    }
+    if _, err := s.cardAccount(ctx, userID, accountID); err != nil {
+        return nil, err
+    }
+    return s.issue(ctx, userID, accountID, paymentSystem)
+}
+
+func (s *cardServiceImpl) List(ctx context.Context, userID string) ([]*models.Card, error) {
+    cards, err := s.repo.GetByUserID(ctx, userID)
+    if err != nil {
+        return nil, err
+    }
+    if cards == nil {
+        cards = []*models.Card{}
+    }
+    return cards, nil
+}
+
+func (s *cardServiceImpl) Get(ctx context.Context, userID, cardID string) (*models.Card, error) {
+    return s.authorizer.AuthorizeCard(ctx, userID, cardID)
+}
+
+// Привязывает карту к другому счету владельца. Лимиты карты хранятся в валюте
+// счета, поэтому привязанную карту можно перенести только на счет той же валюты.
+func (s *cardServiceImpl) LinkAccount(ctx context.Context, userID, cardID, accountID string) (*models.Card, error) {
+    if _, err := s.authorizer.AuthorizeCard(ctx, userID, cardID); err != nil {
+        return nil, err
+    }
+    account, err := s.cardAccount(ctx, userID, accountID)
+    if err != nil {
+        return nil, err
+    }
+
+    var c *models.Card
+    err = s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+        if c, err = s.lockCard(ctx, cardID); err != nil {
+            return err
+        }
+        if c.Status == models.CardStatusClosed {
+            return ErrCardClosed
+        }
+        if c.AccountID != "" {
+            current, err := s.accountRepo.GetByID(ctx, c.AccountID)
+            if err != nil {
+                return err
+            }
+            if current.Currency != account.Currency {
+                return ErrCurrencyMismatch
+            }
+        }
+
+        c.AccountID = accountID
+        return s.repo.UpdateAccount(ctx, cardID, accountID)
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    s.logger.WithFields(logrus.Fields{
+        "user_id":    userID,
+        "card_id":    cardID,
+        "account_id": accountID,
+    }).Info("Card linked to account")
+    return c, nil
+}
+
+// Временная блокировка владельцем
+func (s *cardServiceImpl) Block(ctx context.Context, userID, cardID string) (*models.Card, error) {
+    return s.changeStatus(ctx, userID, cardID, func(c *models.Card) error {
+        if err := s.checkUsable(c); err != nil {
+            return err
+        }
+        c.Status = models.CardStatusBlocked
+        return nil
+    })
+}
+
+func (s *cardServiceImpl) Unblock(ctx context.Context, userID, cardID string) (*models.Card, error) {
+    return s.changeStatus(ctx, userID, cardID, func(c *models.Card) error {
+        switch {
+        case c.Status == models.CardStatusClosed:
+            return ErrCardClosed
+        case c.Status != models.CardStatusBlocked:
+            return ErrCardNotBlocked
+        case c.IsExpired(s.now()):
+            return ErrCardExpired
+        }
+        c.Status = models.CardStatusActive
+        return nil
+    })
+}
+
+// Постоянная блокировка утерянной или украденной карты; снять ее нельзя,
+// взамен выпускается новая карта
+func (s *cardServiceImpl) Close(ctx context.Context, userID, cardID, reason string) (*models.Card, error) {
+    if reason != models.CardBlockReasonLost && reason != models.CardBlockReasonStolen {
+        return nil, ErrInvalidBlockReason
+    }
+    return s.changeStatus(ctx, userID, cardID, func(c *models.Card) error {
+        if c.Status == models.CardStatusClosed {
+            return ErrCardClosed
+        }
+        c.Status = models.CardStatusClosed
+        c.BlockReason = reason
+        return nil
+    })
+}
+
+// Выпускает новую карту той же платежной системы взамен старой с переносом
+// лимитов. Старая карта, если она еще действует, закрывается.
+func (s *cardServiceImpl) Reissue(ctx context.Context, userID, cardID string) (*models.Card, error) {
+    if _, err := s.authorizer.AuthorizeCard(ctx, userID, cardID); err != nil {
+        return nil, err
+    }
+
+    var replacement *models.Card
+    err := s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+        old, err := s.lockCard(ctx, cardID)
+        if err != nil {
+            return err
+        }
+        if old.ReplacedBy != "" {
+            return ErrCardReissued
+        }
+        // Перевыпуск не должен обходить заморозку, установленную банком
+        if old.IsFrozen() {
+            return ErrCardFrozen
+        }
+
+        replacement, err = s.issue(ctx, userID, old.AccountID, old.PaymentSystem)
+        if err != nil {
+            return err
+        }
+
+        currency, err := s.limitCurrency(ctx, old)
+        if err != nil {
+            return err
+        }
+        limits, err := s.limitRepo.Get(ctx, old.ID, currency)
+        if err != nil {
+            return err
+        }
+        if err := s.limitRepo.Upsert(ctx, replacement.ID, limits); err != nil {
+            return err
+        }
+
+        now := s.now()
+        old.ReplacedBy = replacement.ID
+        if old.Status != models.CardStatusClosed {
+            old.Status = models.CardStatusClosed
+            old.BlockReason = models.CardBlockReasonReissued
+            old.StatusChangedAt = &now
+        }
+        return s.repo.UpdateStatus(ctx, old)
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    s.logger.WithFields(logrus.Fields{
+        "user_id":     userID,
+        "card_id":     cardID,
+        "new_card_id": replacement.ID,
+    }).Info("Card reissued")
+    return replacement, nil
+}
+
+// Устанавливает PIN карты, для которой он еще не задан
+func (s *cardServiceImpl) SetPIN(ctx context.Context, userID, cardID, pin string) error {
+    return s.savePIN(ctx, userID, cardID, pin, func(c *models.Card) (bool, error) {
+        if c.PINSet {
+            return false, ErrPINAlreadySet
+        }
+        return true, nil
+    })
+}
+
+// Меняет PIN после проверки текущего. Неверный PIN сохраняется в счетчике,
+// после MaxPINAttempts ошибок подряд карта закрывается и требует перевыпуска.
+func (s *cardServiceImpl) ChangePIN(ctx context.Context, userID, cardID, oldPIN, newPIN string) error {
+    var failed bool
+    err := s.savePIN(ctx, userID, cardID, newPIN, func(c *models.Card) (bool, error) {
+        if !c.PINSet {
+            return false, ErrPINNotSet
+        }
+        if err := bcrypt.CompareHashAndPassword([]byte(c.PINHash), []byte(oldPIN)); err != nil {
+            failed = true
+            return false, s.recordPINFailure(ctx, c)
+        }
+        return true, nil
+    })
+    if err != nil {
+        return err
+    }
+    if failed {
+        s.logger.WithFields(logrus.Fields{
+            "user_id": userID,
+            "card_id": cardID,
+        }).Warn("Card PIN change rejected: incorrect PIN")
+        return ErrIncorrectPIN
+    }
+    return nil
+}
+
+func (s *cardServiceImpl) GetLimits(ctx context.Context, userID, cardID string) (*models.CardLimits, error) {
+    c, err := s.authorizer.AuthorizeCard(ctx, userID, cardID)
+    if err != nil {
+        return nil, err
+    }
+    currency, err := s.limitCurrency(ctx, c)
+    if err != nil {
+        return nil, err
+    }
+    return s.limitRepo.Get(ctx, cardID, currency)
+}
+
+// Заменяет лимиты и ограничения карты; пустое значение снимает ограничение
+func (s *cardServiceImpl) UpdateLimits(ctx context.Context, userID, cardID string, limits *models.CardLimits) (*models.CardLimits, error) {
+    c, err := s.authorizer.AuthorizeCard(ctx, userID, cardID)
+    if err != nil {
+        return nil, err
+    }
+    currency, err := s.limitCurrency(ctx, c)
+    if err != nil {
+        return nil, err
+    }
+    for _, limit := range []*money.Money{limits.PerTransaction, limits.Daily, limits.Monthly} {
+        if limit == nil {
+            continue
+        }
+        if limit.Currency != "" && limit.Currency != currency {
+            return nil, ErrCurrencyMismatch
+        }
+        limit.Currency = currency
+        if !limit.IsPositive() {
+            return nil, ErrInvalidAmount
+        }
+    }
+    for _, flag := range []**bool{&limits.OnlineEnabled, &limits.OfflineEnabled, &limits.ForeignEnabled} {
+        if *flag == nil {
+            enabled := true
+            *flag = &enabled
+        }
+    }
+    if limits.AllowedMCC, err = normalizeMCC(limits.AllowedMCC); err != nil {
+        return nil, err
+    }
+    if limits.BlockedMCC, err = normalizeMCC(limits.BlockedMCC); err != nil {
+        return nil, err
+    }
+
+    err = s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+        c, err := s.lockCard(ctx, cardID)
+        if err != nil {
+            return err
+        }
+        if c.Status == models.CardStatusClosed {
+            return ErrCardClosed
+        }
+        return s.limitRepo.Upsert(ctx, cardID, limits)
+    })
+    if err != nil {
+        return nil, err
+    }
+    return limits, nil
+}
+
+// Раскрывает полный номер карты владельцу после повторного ввода пароля.
+// Каждое раскрытие записывается в лог с маскированным номером.
+func (s *cardServiceImpl) RevealNumber(ctx context.Context, userID, cardID, password string) (*models.Card, error) {
+    c, err := s.authorizer.AuthorizeCard(ctx, userID, cardID)
+    if err != nil {
+        return nil, err
+    }
+    if c.Status == models.CardStatusClosed {
+        return nil, ErrCardClosed
+    }
+
+    user, err := s.userRepo.GetByID(ctx, userID)
+    if err != nil {
+        return nil, err
+    }
+    if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+        s.logger.WithFields(logrus.Fields{
+            "user_id": userID,
+            "card_id": cardID,
+        }).Warn("Card number reveal rejected: invalid password")
+        return nil, ErrInvalidCredentials
+    }
+
+    if c.Number, err = s.repo.RevealNumber(ctx, cardID); err != nil {
+        return nil, err
+    }
+
+    s.logger.WithFields(logrus.Fields{
+        "user_id": userID,
+        "card_id": cardID,
+        "number":  c.MaskedNumber,
+    }).Info("Card number revealed")
+    return c, nil
+}
+
+// Шифрует номера карт, сохраненные открытым текстом до включения шифрования
+func (s *cardServiceImpl) EncryptStoredNumbers(ctx context.Context) error {
+    total := 0
+    for {
+        var n int
+        err := s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+            var err error
+            n, err = s.repo.EncryptPlaintextBatch(ctx, s.batchSize)
+            return err
+        })
+        if err != nil {
+            return err
+        }
+        total += n
+        if n < s.batchSize {
+            break
+        }
+    }
+
+    if total > 0 {
+        s.logger.Infof("Encrypted %d stored card numbers", total)
+    }
+    return nil
+}
+
+// Генерирует номер, свободный по слепому индексу, и сохраняет карту
+func (s *cardServiceImpl) issue(ctx context.Context, userID, accountID, paymentSystem string) (*models.Card, error) {
+    cvv, err := card.GenerateCVV()
+    if err != nil {
+        return nil, fmt.Errorf("failed to generate CVV: %w", err)
+    }
+
+    issued := s.now()
+    expires := time.Date(issued.Year(), issued.Month()+time.Month(s.config.ValidityMonths), 1, 0, 0, 0, 0, time.UTC)
+    c := &models.Card{
+        UserID:        userID,
+        AccountID:     accountID,
+        PaymentSystem: paymentSystem,
+        Expiry:        expires.Format("01/06"),
+        CVV:           cvv,
+    }
+
+    for attempt := 0; attempt < maxPANAttempts; attempt++ {
+        r, err := randomBINRange(s.config.BINRanges[paymentSystem])
+        if err != nil {
+            return nil, err
+        }
+        if c.Number, err = card.GeneratePAN(r); err != nil {
+            return nil, fmt.Errorf("failed to generate card number: %w", err)
+        }
+
+        // Проверка до вставки: ошибка уникальности прервала бы внешнюю транзакцию
+        if _, err := s.repo.GetByNumber(ctx, c.Number); err == nil {
+            continue
+        } else if !errors.Is(err, repositories.ErrCardNotFound) {
+            return nil, err
+        }
+
+        err = s.repo.Create(ctx, c)
+        if errors.Is(err, repositories.ErrDuplicateCardNumber) {
+            continue
+        }
+        if err != nil {
+            return nil, err
+        }
+
+        s.logger.WithFields(logrus.Fields{
+            "user_id": userID,
+            "card_id": c.ID,
+            "number":  c.MaskedNumber,
+        }).Info("Card issued")
+        c.Number = ""
+        return c, nil
+    }
+    return nil, fmt.Errorf("failed to allocate a unique card number after %d attempts", maxPANAttempts)
+}
+
+// Счет для карты: собственный действующий счет пользователя, кроме срочного вклада
+func (s *cardServiceImpl) cardAccount(ctx context.Context, userID, accountID string) (*models.Account, error) {
+    if accountID == "" {
+        return nil, ErrAccountRequired
+    }
+    // Доверенные пользователи счета не могут выпускать к нему карты
+    account, err := s.authorizer.AuthorizeAccountOwner(ctx, userID, accountID)
+    if err != nil {
+        return nil, err
+    }
+    if account.IsClosed() {
+        return nil, ErrAccountClosed
+    }
+    if account.ProductType == models.ProductTypeTermDeposit {
+        return nil, ErrDepositLocked
+    }
+    return account, nil
+}
+
+// Валюта лимитов карты - валюта привязанного счета
+func (s *cardServiceImpl) limitCurrency(ctx context.Context, c *models.Card) (string, error) {
+    if c.AccountID == "" {
+        return money.DefaultCurrency, nil
+    }
+    account, err := s.accountRepo.GetByID(ctx, c.AccountID)
+    if err != nil {
+        return "", err
+    }
+    return account.Currency, nil
+}
+
+// Проверяет, что картой можно пользоваться: она не заблокирована и не истекла
+func (s *cardServiceImpl) checkUsable(c *models.Card) error {
+    switch {
+    case c.Status == models.CardStatusClosed:
+        return ErrCardClosed
+    case c.Status == models.CardStatusBlocked:
+        return ErrCardBlocked
+    case c.IsExpired(s.now()):
+        return ErrCardExpired
+    }
+    return nil
+}
+
+// Блокирует карту; вызывается внутри транзакции
+func (s *cardServiceImpl) lockCard(ctx context.Context, cardID string) (*models.Card, error) {
+    c, err := s.repo.GetByIDForUpdate(ctx, cardID)
+    if err != nil {
+        if errors.Is(err, repositories.ErrCardNotFound) {
+            return nil, ErrCardNotFound
+        }
+        return nil, err
+    }
+    return c, nil
+}
+
+// Меняет статус карты под блокировкой строки; apply проверяет допустимость перехода
+func (s *cardServiceImpl) changeStatus(ctx context.Context, userID, cardID string, apply func(*models.Card) error) (*models.Card, error) {
+    if _, err := s.authorizer.AuthorizeCard(ctx, userID, cardID); err != nil {
+        return nil, err
+    }
+
+    var c *models.Card
+    err := s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+        var err error
+        if c, err = s.lockCard(ctx, cardID); err != nil {
+            return err
+        }
+        if err := apply(c); err != nil {
+            return err
+        }
+        now := s.now()
+        c.StatusChangedAt = &now
+        return s.repo.UpdateStatus(ctx, c)
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    s.logger.WithFields(logrus.Fields{
+        "user_id": userID,
+        "card_id": cardID,
+        "status":  c.Status,
+        "reason":  c.BlockReason,
+    }).Info("Card status changed")
+    return c, nil
+}
+
+// Сохраняет хеш PIN; check проверяет текущее состояние PIN под блокировкой строки.
+// Если check вернул false без ошибки, PIN не меняется, а изменения check сохраняются.
+func (s *cardServiceImpl) savePIN(ctx context.Context, userID, cardID, pin string, check func(*models.Card) (bool, error)) error {
+    if !validPIN(pin) {
+        return ErrInvalidPIN
+    }
+    if _, err := s.authorizer.AuthorizeCard(ctx, userID, cardID); err != nil {
+        return err
+    }
+
+    return s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+        c, err := s.lockCard(ctx, cardID)
+        if err != nil {
+            return err
+        }
+        if err := s.checkUsable(c); err != nil {
+            return err
+        }
+        ok, err := check(c)
+        if err != nil || !ok {
+            return err
+        }
+
+        hash, err := bcrypt.GenerateFromPassword([]byte(pin), bcrypt.DefaultCost)
+        if err != nil {
+            return fmt.Errorf("PIN hashing failed: %w", err)
+        }
+        return s.repo.SetPINHash(ctx, cardID, string(hash))
+    })
+}
+
+// Учитывает неверный PIN; на последней попытке закрывает карту.
+// Вызывается внутри транзакции, которая фиксируется и при неверном PIN.
+func (s *cardServiceImpl) recordPINFailure(ctx context.Context, c *models.Card) error {
+    attempts := c.PINAttempts + 1
+    if err := s.repo.SetPINFailedAttempts(ctx, c.ID, attempts); err != nil {
+        return err
+    }
+    if attempts < s.config.MaxPINAttempts {
+        return nil
+    }
+
+    now := s.now()
+    c.Status = models.CardStatusClosed
+    c.BlockReason = models.CardBlockReasonTooManyAttempts
+    c.StatusChangedAt = &now
+    if err := s.repo.UpdateStatus(ctx, c); err != nil {
+        return err
+    }
+    s.logger.WithFields(logrus.Fields{
+        "user_id": c.UserID,
+        "card_id": c.ID,
+    }).Warn("Card closed after too many incorrect PIN attempts")
+    return nil
+}
+
+// PIN из четырех цифр; одинаковые цифры и последовательности вида 1234 запрещены
+func validPIN(pin string) bool {
+    if len(pin) != 4 {
+        return false
+    }
+    for _, c := range pin {
+        if c < '0' || c > '9' {
+            return false
+        }
+    }
+
+    same, ascending, descending := true, true, true
+    for i := 1; i < len(pin); i++ {
+        same = same && pin[i] == pin[0]
+        ascending = ascending && pin[i] == pin[i-1]+1
+        descending = descending && pin[i] == pin[i-1]-1
+    }
+    return !same && !ascending && !descending
+}
+
+// Проверяет коды категорий мерчантов и убирает повторы
+func normalizeMCC(codes []string) ([]string, error) {
+    normalized := []string{}
+    seen := map[string]bool{}
+    for _, code := range codes {
+        if !mccPattern.MatchString(code) {
+            return nil, ErrInvalidMCC
+        }
+        if !seen[code] {
+            seen[code] = true
+            normalized = append(normalized, code)
+        }
+    }
+    return normalized, nil
+}
+
+func randomBINRange(ranges []card.BINRange) (card.BINRange, error) {
+    if len(ranges) == 1 {
+        return ranges[0], nil
+    }
+    i, err := rand.Int(rand.Reader, big.NewInt(int64(len(ranges))))
+    if err != nil {
+        return card.BINRange{}, err
     }
-    err := s.repo.Create(ctx, card)
-    return card, err
+    return ranges[i.Int64()], nil
 }
@@ -6,7 +6,11 @@ import (
 	"errors"  
 	"fmt"     
 	"io"       
+	"math/big"
 	"net/http" 
+	"strconv"
+	"strings"
+	"sync"
 	"time"     
 
 	"github.com/Misha-Glazunov/bank-api/internal/config" 
@@ -14,10 +18,24 @@ import (
 	"github.com/sirupsen/logrus"                        
 )
 
+const (
+	soapActionKeyRate       = "http://web.cbr.ru/KeyRate"
+	soapActionGetCursOnDate = "http://web.cbr.ru/GetCursOnDate"
+	baseCurrency            = "RUB"
+)
+
 type centralBankServiceImpl struct {
 	client *http.Client
 	config *config.CentralCBConfig
 	logger *logrus.Logger
+
+	// Курсы за последнюю запрошенную дату: официальные курсы меняются раз в день
+	mu        sync.Mutex
+	ratesDate string
+	rates     map[string]*big.Rat
+
+	keyRateDate string
+	keyRate     *big.Rat
 }
 
 func NewCentralBankService(cfg *config.Config, logger *logrus.Logger) CentralBankService {
@@ -42,9 +60,21 @@ func buildSOAPRequest(cfg *config.CentralCBConfig) string {
         </soap12:Envelope>`, fromDate, toDate)
 }
 
-func sendRequest(soapRequest string, cfg *config.CentralCBConfig) ([]byte, error) {
+func buildCursOnDateRequest(date time.Time) string {
+	return fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>
+        <soap12:Envelope xmlns:soap12="http://www.w3.org/2003/05/soap-envelope">
+            <soap12:Body>
+                <GetCursOnDate xmlns="http://web.cbr.ru/">
+                    <On_date>%s</On_date>
+                </GetCursOnDate>
+            </soap12:Body>
+        </soap12:Envelope>`, date.Format("2006-01-02"))
+}
+
+func sendRequest(ctx context.Context, soapRequest, action string, cfg *config.CentralCBConfig) ([]byte, error) {
 	client := &http.Client{Timeout: cfg.Timeout}
-	req, err := http.NewRequest(
+	req, err := http.NewRequestWithContext(
+		ctx,
 		"POST",
 		cfg.WSDLURL,
 		bytes.NewBuffer([]byte(soapRequest)),
@@ -54,7 +84,7 @@ func sendRequest(soapRequest string, cfg *config.CentralCBConfig) ([]byte, error
 	}
 
 	req.Header.Set("Content-Type", "application/soap+xml; charset=utf-8")
-	req.Header.Set("SOAPAction", "http://web.cbr.ru/KeyRate")
+	req.Header.Set("SOAPAction", action)
 
 	resp, err := client.Do(req)
 	if err != nil {
@@ -62,46 +92,186 @@ func sendRequest(soapRequest string, cfg *config.CentralCBConfig) ([]byte, error
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ЦБ вернул статус %d", resp.StatusCode)
+	}
+
 	return io.ReadAll(resp.Body)
 }
 
-func parseXMLResponse(rawBody []byte) (float64, error) {
+// Выполняет SOAP-запрос с повторами согласно настройкам интеграции
+func (s *centralBankServiceImpl) call(ctx context.Context, soapRequest, action string) ([]byte, error) {
+	var lastErr error
+	for attempt := 0; attempt <= s.config.RetryCount; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(s.config.RetryDelay):
+			}
+		}
+
+		body, err := sendRequest(ctx, soapRequest, action, s.config)
+		if err == nil {
+			return body, nil
+		}
+		lastErr = err
+		s.logger.Warnf("CBR request %s failed (attempt %d): %v", action, attempt+1, err)
+	}
+	return nil, lastErr
+}
+
+// Разбирает ответ KeyRate; первая запись содержит действующую ставку
+func parseKeyRateResponse(rawBody []byte) (*big.Rat, error) {
 	doc := etree.NewDocument()
 	if err := doc.ReadFromBytes(rawBody); err != nil {
-		return 0, fmt.Errorf("ошибка парсинга XML: %v", err)
+		return nil, fmt.Errorf("ошибка парсинга XML: %v", err)
 	}
 
 	krElements := doc.FindElements("//diffgram/KeyRate/KR")
 	if len(krElements) == 0 {
-		return 0, errors.New("данные по ставке не найдены")
+		return nil, errors.New("данные по ставке не найдены")
 	}
 
 	rateElement := krElements[0].FindElement("./Rate")
 	if rateElement == nil {
-		return 0, errors.New("тег Rate отсутствует")
+		return nil, errors.New("тег Rate отсутствует")
 	}
 
-	rateStr := rateElement.Text()
-	var rate float64
-	if _, err := fmt.Sscanf(rateStr, "%f", &rate); err != nil {
-		return 0, fmt.Errorf("ошибка конвертации ставки: %v", err)
+	rate, ok := new(big.Rat).SetString(strings.Replace(strings.TrimSpace(rateElement.Text()), ",", ".", 1))
+	if !ok {
+		return nil, fmt.Errorf("ошибка конвертации ставки: %q", rateElement.Text())
 	}
 
 	return rate, nil
 }
 
-func (s *centralBankServiceImpl) GetCurrentRate(ctx context.Context) (float64, error) {
-	soapRequest := buildSOAPRequest(s.config)          
-	rawBody, err := sendRequest(soapRequest, s.config) 
+// Разбирает ответ GetCursOnDate в курсы рубля за одну единицу валюты
+func parseCursOnDateResponse(rawBody []byte) (map[string]*big.Rat, error) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(rawBody); err != nil {
+		return nil, fmt.Errorf("ошибка парсинга XML: %v", err)
+	}
+
+	elements := doc.FindElements("//ValuteData/ValuteCursOnDate")
+	if len(elements) == 0 {
+		return nil, errors.New("данные по курсам не найдены")
+	}
+
+	rates := make(map[string]*big.Rat, len(elements))
+	for _, el := range elements {
+		code := el.FindElement("./VchCode")
+		nominal := el.FindElement("./Vnom")
+		curs := el.FindElement("./Vcurs")
+		if code == nil || nominal == nil || curs == nil {
+			continue
+		}
+
+		value, ok := new(big.Rat).SetString(strings.Replace(strings.TrimSpace(curs.Text()), ",", ".", 1))
+		if !ok {
+			return nil, fmt.Errorf("ошибка конвертации курса %s", code.Text())
+		}
+		nom, err := strconv.ParseInt(strings.TrimSpace(nominal.Text()), 10, 64)
+		if err != nil || nom <= 0 {
+			return nil, fmt.Errorf("ошибка конвертации номинала %s", code.Text())
+		}
 
+		rates[strings.TrimSpace(code.Text())] = value.Quo(value, big.NewRat(nom, 1))
+	}
+
+	return rates, nil
+}
+
+// Действующая ключевая ставка ЦБ числом для отображения; расчеты ведутся по GetKeyRate
+func (s *centralBankServiceImpl) GetCurrentRate(ctx context.Context) (float64, error) {
+	rate, err := s.GetKeyRate(ctx)
 	if err != nil {
 		return 0, fmt.Errorf("failed to get rate: %w", err)
 	}
 
-	rate, err := parseXMLResponse(rawBody)
+	value, _ := rate.Float64()
+	return value, nil
+}
+
+// Действующая ключевая ставка ЦБ в процентах годовых; запрашивается раз в день
+func (s *centralBankServiceImpl) GetKeyRate(ctx context.Context) (*big.Rat, error) {
+	day := time.Now().Format("2006-01-02")
+
+	s.mu.Lock()
+	if s.keyRateDate == day {
+		rate := s.keyRate
+		s.mu.Unlock()
+		return rate, nil
+	}
+	s.mu.Unlock()
+
+	rawBody, err := s.call(ctx, buildSOAPRequest(s.config), soapActionKeyRate)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrKeyRateUnavailable, err)
+	}
+
+	rate, err := parseKeyRateResponse(rawBody)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrKeyRateUnavailable, err)
+	}
+
+	s.mu.Lock()
+	s.keyRateDate = day
+	s.keyRate = rate
+	s.mu.Unlock()
+
+	return rate, nil
+}
+
+// Официальные курсы ЦБ на дату: сколько рублей стоит одна единица валюты
+func (s *centralBankServiceImpl) GetCursOnDate(ctx context.Context, date time.Time) (map[string]*big.Rat, error) {
+	day := date.Format("2006-01-02")
+
+	s.mu.Lock()
+	if s.ratesDate == day {
+		rates := s.rates
+		s.mu.Unlock()
+		return rates, nil
+	}
+	s.mu.Unlock()
+
+	rawBody, err := s.call(ctx, buildCursOnDateRequest(date), soapActionGetCursOnDate)
 	if err != nil {
-		return 0, fmt.Errorf("failed to parse response: %w", err)
+		return nil, fmt.Errorf("%w: %v", ErrExchangeRateUnavailable, err)
+	}
+
+	rates, err := parseCursOnDateResponse(rawBody)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrExchangeRateUnavailable, err)
+	}
+	rates[baseCurrency] = big.NewRat(1, 1)
+
+	s.mu.Lock()
+	s.ratesDate, s.rates = day, rates
+	s.mu.Unlock()
+
+	return rates, nil
+}
+
+// Кросс-курс по официальным курсам ЦБ: сколько единиц to дают за единицу from
+func (s *centralBankServiceImpl) GetExchangeRate(ctx context.Context, from, to string, date time.Time) (*big.Rat, error) {
+	if from == to {
+		return big.NewRat(1, 1), nil
+	}
+
+	rates, err := s.GetCursOnDate(ctx, date)
+	if err != nil {
+		return nil, err
+	}
+
+	fromRate, ok := rates[from]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s/%s", ErrUnsupportedCurrencyPair, from, to)
+	}
+	toRate, ok := rates[to]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s/%s", ErrUnsupportedCurrencyPair, from, to)
 	}
 
-	return rate + 5.0, nil
+	return new(big.Rat).Quo(fromRate, toRate), nil
 }
@@ -0,0 +1,554 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/Misha-Glazunov/bank-api/internal/models"
+	"github.com/Misha-Glazunov/bank-api/internal/repositories"
+	"github.com/Misha-Glazunov/bank-api/pkg/money"
+	"github.com/Misha-Glazunov/bank-api/pkg/utils"
+)
+
+// Точность хранения начисленных, но не выплаченных процентов
+const accruedPrecision = 6
+
+type depositServiceImpl struct {
+	txManager       repositories.TxManager
+	authorizer      Authorizer
+	accountRepo     repositories.AccountRepository
+	ledgerRepo      repositories.LedgerRepository
+	transactionRepo repositories.TransactionRepository
+	repo            repositories.DepositRepository
+	payments        PaymentService
+	cbService       CentralBankService
+	batchSize       int
+	logger          *logrus.Logger
+	now             func() time.Time
+}
+
+func NewDepositService(
+	txManager repositories.TxManager,
+	authorizer Authorizer,
+	accountRepo repositories.AccountRepository,
+	ledgerRepo repositories.LedgerRepository,
+	transactionRepo repositories.TransactionRepository,
+	repo repositories.DepositRepository,
+	payments PaymentService,
+	cbService CentralBankService,
+	batchSize int,
+	logger *logrus.Logger,
+) DepositService {
+	return &depositServiceImpl{
+		txManager:       txManager,
+		authorizer:      authorizer,
+		accountRepo:     accountRepo,
+		ledgerRepo:      ledgerRepo,
+		transactionRepo: transactionRepo,
+		repo:            repo,
+		payments:        payments,
+		cbService:       cbService,
+		batchSize:       batchSize,
+		logger:          logger,
+		now:             func() time.Time { return time.Now().UTC() },
+	}
+}
+
+func (s *depositServiceImpl) ListProducts(ctx context.Context) ([]*models.DepositProduct, error) {
+	products, err := s.repo.ListProducts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if products == nil {
+		products = []*models.DepositProduct{}
+	}
+	return products, nil
+}
+
+// Открывает счет вклада и переводит на него сумму с другого счета пользователя.
+// Ставка срочного вклада фиксируется на дату открытия.
+func (s *depositServiceImpl) Open(ctx context.Context, userID string, app models.DepositApplication) (*models.Deposit, error) {
+	if !app.Amount.IsPositive() {
+		return nil, ErrInvalidAmount
+	}
+
+	product, err := s.repo.GetProduct(ctx, app.ProductCode)
+	if err != nil {
+		if errors.Is(err, repositories.ErrDepositProductNotFound) {
+			return nil, ErrUnsupportedProduct
+		}
+		return nil, err
+	}
+
+	source, err := s.authorizer.AuthorizeAccount(ctx, userID, app.FromAccountID)
+	if err != nil {
+		return nil, err
+	}
+	// Вклад пополняется только со своего счета
+	if source.UserID != userID {
+		return nil, ErrAccessDenied
+	}
+	if source.Currency != money.DefaultCurrency {
+		return nil, ErrUnsupportedCurrency
+	}
+	amount, err := inAccountCurrency(app.Amount, source)
+	if err != nil {
+		return nil, err
+	}
+	if amount.LessThan(product.MinAmount) {
+		return nil, ErrDepositAmountTooLow
+	}
+
+	rate, err := s.productRate(ctx, product)
+	if err != nil {
+		return nil, err
+	}
+
+	today := s.today()
+	deposit := &models.Deposit{
+		UserID:        userID,
+		ProductCode:   product.Code,
+		Kind:          product.Kind,
+		AnnualRate:    rate.FloatString(ratePrecision),
+		OpenedOn:      today,
+		LastAccruedOn: today.AddDate(0, 0, -1),
+		Status:        models.DepositStatusActive,
+	}
+	productType := models.ProductTypeSavings
+	if product.Kind == models.DepositKindTerm {
+		productType = models.ProductTypeTermDeposit
+		maturesOn := today.AddDate(0, product.TermMonths, 0)
+		deposit.MaturesOn = &maturesOn
+	}
+
+	err = s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		account := &models.Account{
+			UserID:           userID,
+			Balance:          money.Zero(money.DefaultCurrency),
+			AvailableBalance: money.Zero(money.DefaultCurrency),
+			Currency:         money.DefaultCurrency,
+			ProductType:      productType,
+			Status:           models.AccountStatusActive,
+		}
+		if err := s.accountRepo.Create(ctx, account); err != nil {
+			return err
+		}
+
+		deposit.AccountID = account.ID
+		if err := s.repo.Create(ctx, deposit); err != nil {
+			return err
+		}
+
+		return s.payments.Transfer(ctx, userID, source.ID, account.ID, amount)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.GetByID(ctx, deposit.ID)
+}
+
+func (s *depositServiceImpl) List(ctx context.Context, userID string) ([]*models.Deposit, error) {
+	deposits, err := s.repo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if deposits == nil {
+		deposits = []*models.Deposit{}
+	}
+	return deposits, nil
+}
+
+func (s *depositServiceImpl) Get(ctx context.Context, userID, id string) (*models.Deposit, error) {
+	return s.authorize(ctx, userID, id)
+}
+
+// Ежедневные начисления процентов по вкладу
+func (s *depositServiceImpl) ListAccruals(ctx context.Context, userID, id string) ([]*models.DepositAccrual, error) {
+	if _, err := s.authorize(ctx, userID, id); err != nil {
+		return nil, err
+	}
+
+	accruals, err := s.repo.ListAccruals(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if accruals == nil {
+		accruals = []*models.DepositAccrual{}
+	}
+	return accruals, nil
+}
+
+// Закрывает вклад и переводит остаток на указанный счет пользователя.
+// При досрочном расторжении срочного вклада проценты пересчитываются
+// по ставке досрочного расторжения, излишне выплаченные удерживаются.
+func (s *depositServiceImpl) Close(ctx context.Context, userID, id, toAccountID string) (*models.Deposit, error) {
+	deposit, err := s.authorize(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if toAccountID == deposit.AccountID {
+		return nil, ErrSameAccount
+	}
+	if _, err := s.authorizer.AuthorizeAccount(ctx, userID, toAccountID); err != nil {
+		return nil, err
+	}
+
+	err = s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		deposit, err := s.repo.GetByIDForUpdate(ctx, id)
+		if err != nil {
+			return err
+		}
+		if deposit.Status == models.DepositStatusClosed {
+			return ErrDepositClosed
+		}
+		product, err := s.repo.GetProduct(ctx, deposit.ProductCode)
+		if err != nil {
+			return err
+		}
+
+		// Проценты доначисляются по вчерашний день включительно
+		if err := s.accrue(ctx, deposit, product, s.today().AddDate(0, 0, -1)); err != nil {
+			return err
+		}
+
+		accounts, err := lockAccounts(ctx, s.accountRepo, deposit.AccountID, toAccountID)
+		if err != nil {
+			return err
+		}
+		if accounts[deposit.AccountID].IsFrozen() {
+			return ErrAccountFrozen
+		}
+		to := accounts[toAccountID]
+		if to.IsClosed() {
+			return ErrAccountClosed
+		}
+		if to.Currency != deposit.Balance.Currency {
+			return ErrCurrencyMismatch
+		}
+
+		if deposit.Kind == models.DepositKindTerm && deposit.Status == models.DepositStatusActive {
+			if err := s.recalculateEarly(ctx, deposit, product); err != nil {
+				return err
+			}
+		} else if _, err := s.capitalize(ctx, deposit); err != nil {
+			return err
+		}
+		// Доли копеек при закрытии не выплачиваются
+		deposit.Accrued = "0"
+
+		account, err := s.accountRepo.GetByID(ctx, deposit.AccountID)
+		if err != nil {
+			return err
+		}
+		if account.Balance.IsNegative() {
+			return ErrAccountBalanceNotZero
+		}
+		// Выплачивается весь баланс, поэтому удержаний на счете вклада быть не должно
+		if account.AvailableBalance.Cmp(account.Balance) != 0 {
+			return ErrAccountHasHolds
+		}
+		if account.Balance.IsPositive() {
+			if err := s.payout(ctx, account, to); err != nil {
+				return err
+			}
+		}
+
+		if err := s.accountRepo.UpdateStatus(ctx, deposit.AccountID, models.AccountStatusClosed); err != nil {
+			return err
+		}
+		now := s.now()
+		deposit.Status = models.DepositStatusClosed
+		deposit.ClosedAt = &now
+		return s.repo.Update(ctx, deposit)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.GetByID(ctx, id)
+}
+
+// Начисляет проценты по всем действующим вкладам за прошедшие дни.
+// Повторный запуск в тот же день ничего не начисляет.
+func (s *depositServiceImpl) AccrueInterest(ctx context.Context) error {
+	through := s.today().AddDate(0, 0, -1)
+	ids, err := s.repo.ListDueForAccrual(ctx, through, s.batchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		err := s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+			deposit, err := s.repo.GetByIDForUpdate(ctx, id)
+			if err != nil {
+				return err
+			}
+			if deposit.Status != models.DepositStatusActive {
+				return nil
+			}
+			product, err := s.repo.GetProduct(ctx, deposit.ProductCode)
+			if err != nil {
+				return err
+			}
+
+			if err := s.accrue(ctx, deposit, product, through); err != nil {
+				return err
+			}
+			return s.repo.Update(ctx, deposit)
+		})
+		if err != nil {
+			s.logger.WithFields(logrus.Fields{
+				"deposit_id": id,
+			}).Errorf("Deposit interest accrual failed: %v", err)
+		}
+	}
+	return nil
+}
+
+// Начисляет проценты за каждый день после последнего начисления по through
+// включительно на остаток на конец дня. В последний день месяца и в день
+// окончания срока начисленные проценты капитализируются.
+func (s *depositServiceImpl) accrue(ctx context.Context, deposit *models.Deposit, product *models.DepositProduct, through time.Time) error {
+	if deposit.Status != models.DepositStatusActive || !deposit.LastAccruedOn.Before(through) {
+		return nil
+	}
+
+	// Ставка вклада до востребования следует за ключевой ставкой
+	if product.Kind == models.DepositKindOnDemand && product.KeyRatePegged() {
+		rate, err := s.productRate(ctx, product)
+		if err != nil {
+			return err
+		}
+		deposit.AnnualRate = rate.FloatString(ratePrecision)
+	}
+	rate, ok := new(big.Rat).SetString(deposit.AnnualRate)
+	if !ok {
+		return fmt.Errorf("invalid annual rate %q for deposit %s", deposit.AnnualRate, deposit.ID)
+	}
+
+	accrued, ok := new(big.Rat).SetString(deposit.Accrued)
+	if !ok {
+		return fmt.Errorf("invalid accrued interest %q for deposit %s", deposit.Accrued, deposit.ID)
+	}
+
+	for day := deposit.LastAccruedOn.AddDate(0, 0, 1); !day.After(through); day = day.AddDate(0, 0, 1) {
+		if deposit.MaturesOn != nil && !day.Before(*deposit.MaturesOn) {
+			break
+		}
+
+		balance, err := s.ledgerRepo.BalanceBefore(ctx, deposit.AccountID, day.AddDate(0, 0, 1))
+		if err != nil {
+			return err
+		}
+		amount := dailyInterest(balance, rate, day)
+
+		inserted, err := s.repo.CreateAccrual(ctx, &models.DepositAccrual{
+			DepositID:  deposit.ID,
+			Date:       day,
+			Balance:    balance,
+			AnnualRate: deposit.AnnualRate,
+			Amount:     amount.FloatString(accruedPrecision),
+		})
+		if err != nil {
+			return err
+		}
+		if inserted {
+			accrued.Add(accrued, amount)
+		}
+		deposit.LastAccruedOn = day
+		deposit.Accrued = accrued.FloatString(accruedPrecision)
+
+		if day.Equal(utils.EndOfMonth(day)) {
+			if accrued, err = s.capitalize(ctx, deposit); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Срочный вклад по окончании срока становится счетом до востребования
+	if deposit.MaturesOn != nil && !deposit.LastAccruedOn.Before(deposit.MaturesOn.AddDate(0, 0, -1)) {
+		if _, err := s.capitalize(ctx, deposit); err != nil {
+			return err
+		}
+		if err := s.accountRepo.UpdateProductType(ctx, deposit.AccountID, models.ProductTypeSavings); err != nil {
+			return err
+		}
+		deposit.Status = models.DepositStatusMatured
+		s.logger.WithFields(logrus.Fields{
+			"deposit_id": deposit.ID,
+		}).Info("Term deposit matured")
+	}
+	return nil
+}
+
+// Зачисляет начисленные проценты в целых копейках на счет вклада;
+// доли копеек остаются в начислении. Возвращает оставшуюся сумму начислений.
+func (s *depositServiceImpl) capitalize(ctx context.Context, deposit *models.Deposit) (*big.Rat, error) {
+	accrued, ok := new(big.Rat).SetString(deposit.Accrued)
+	if !ok {
+		return nil, fmt.Errorf("invalid accrued interest %q for deposit %s", deposit.Accrued, deposit.ID)
+	}
+
+	amount := money.FromRat(accrued, deposit.Balance.Currency, money.RoundDown)
+	if !amount.IsPositive() {
+		return accrued, nil
+	}
+	if err := s.postInterest(ctx, deposit, amount, "Deposit interest capitalization"); err != nil {
+		return nil, err
+	}
+
+	accrued.Sub(accrued, amount.Rat())
+	deposit.Accrued = accrued.FloatString(accruedPrecision)
+	deposit.InterestPaid = deposit.InterestPaid.Add(amount)
+	return accrued, nil
+}
+
+// Пересчитывает проценты за весь срок по ставке досрочного расторжения
+// и удерживает разницу с уже выплаченными процентами
+func (s *depositServiceImpl) recalculateEarly(ctx context.Context, deposit *models.Deposit, product *models.DepositProduct) error {
+	earlyRate, ok := new(big.Rat).SetString(product.EarlyWithdrawalRate)
+	if !ok {
+		return fmt.Errorf("invalid early withdrawal rate %q for deposit product %s", product.EarlyWithdrawalRate, product.Code)
+	}
+
+	accruals, err := s.repo.ListAccruals(ctx, deposit.ID)
+	if err != nil {
+		return err
+	}
+	entitled := new(big.Rat)
+	for _, accrual := range accruals {
+		entitled.Add(entitled, dailyInterest(accrual.Balance, earlyRate, accrual.Date))
+	}
+
+	adjustment := money.FromRat(entitled, deposit.Balance.Currency, money.RoundDown).Sub(deposit.InterestPaid)
+	if adjustment.IsZero() {
+		return nil
+	}
+	if err := s.postInterest(ctx, deposit, adjustment, "Early withdrawal interest recalculation"); err != nil {
+		return err
+	}
+	deposit.InterestPaid = deposit.InterestPaid.Add(adjustment)
+
+	s.logger.WithFields(logrus.Fields{
+		"deposit_id": deposit.ID,
+		"adjustment": adjustment.String(),
+	}).Info("Term deposit closed early")
+	return nil
+}
+
+// Проводка процентов по счету расходов на проценты; отрицательная сумма
+// означает удержание ранее выплаченных процентов
+func (s *depositServiceImpl) postInterest(ctx context.Context, deposit *models.Deposit, amount money.Money, description string) error {
+	entry, err := postWithSystemAccount(ctx, s.ledgerRepo,
+		models.EntryTypeInterest, models.SystemAccountInterestExpense, description,
+		deposit.AccountID, amount,
+	)
+	if err != nil {
+		return err
+	}
+
+	transaction := &models.Transaction{
+		ToAccount: deposit.AccountID,
+		Amount:    amount,
+		Currency:  amount.Currency,
+		Type:      models.TransactionTypeInterest,
+		EntryID:   entry.ID,
+	}
+	if amount.IsNegative() {
+		transaction.ToAccount = ""
+		transaction.FromAccount = deposit.AccountID
+		transaction.Amount = amount.Neg()
+	}
+	return s.transactionRepo.Create(ctx, transaction)
+}
+
+// Переводит весь остаток счета вклада на счет пользователя
+func (s *depositServiceImpl) payout(ctx context.Context, from, to *models.Account) error {
+	amount := from.Balance
+	entry := newEntry(models.EntryTypeTransfer, "Deposit payout",
+		debit(from.ID, amount),
+		credit(to.ID, amount),
+	)
+	if err := postEntry(ctx, s.ledgerRepo, entry); err != nil {
+		return fmt.Errorf("deposit payout posting failed: %w", err)
+	}
+
+	return s.transactionRepo.Create(ctx, &models.Transaction{
+		FromAccount: from.ID,
+		ToAccount:   to.ID,
+		Amount:      amount,
+		Currency:    amount.Currency,
+		Type:        models.TransactionTypeTransfer,
+		EntryID:     entry.ID,
+	})
+}
+
+// Годовая ставка продукта: фиксированная или ключевая ставка ЦБ плюс надбавка,
+// но не ниже нуля
+func (s *depositServiceImpl) productRate(ctx context.Context, product *models.DepositProduct) (*big.Rat, error) {
+	if !product.KeyRatePegged() {
+		rate, ok := new(big.Rat).SetString(product.Rate)
+		if !ok {
+			return nil, fmt.Errorf("invalid rate %q for deposit product %s", product.Rate, product.Code)
+		}
+		return rate, nil
+	}
+
+	margin, ok := new(big.Rat).SetString(product.KeyRateMargin)
+	if !ok {
+		return nil, fmt.Errorf("invalid key rate margin %q for deposit product %s", product.KeyRateMargin, product.Code)
+	}
+	keyRate, err := s.cbService.GetKeyRate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rate := new(big.Rat).Add(keyRate, margin)
+	if rate.Sign() < 0 {
+		rate.SetInt64(0)
+	}
+	return rate, nil
+}
+
+func (s *depositServiceImpl) authorize(ctx context.Context, userID, id string) (*models.Deposit, error) {
+	deposit, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, repositories.ErrDepositNotFound) {
+			return nil, ErrDepositNotFound
+		}
+		return nil, err
+	}
+
+	if deposit.UserID != userID {
+		s.logger.WithFields(logrus.Fields{
+			"user_id":    userID,
+			"deposit_id": id,
+		}).Warn("Deposit access denied")
+		return nil, ErrAccessDenied
+	}
+	return deposit, nil
+}
+
+func (s *depositServiceImpl) today() time.Time {
+	now := s.now()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// Проценты за день: остаток × годовая ставка / 100 / число дней в году.
+// На отрицательный остаток проценты не начисляются.
+func dailyInterest(balance money.Money, annualPercent *big.Rat, day time.Time) *big.Rat {
+	if !balance.IsPositive() {
+		return new(big.Rat)
+	}
+	daysInYear := int64(time.Date(day.Year(), 12, 31, 0, 0, 0, 0, time.UTC).YearDay())
+	interest := new(big.Rat).Mul(balance.Rat(), annualPercent)
+	return interest.Quo(interest, big.NewRat(100*daysInYear, 1))
+}
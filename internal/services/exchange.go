@@ -0,0 +1,52 @@
+package services
+
+import (
+	"context"
+	"math/big"
+	"time"
+
+	"github.com/Misha-Glazunov/bank-api/pkg/money"
+)
+
+// Точность, с которой курс сохраняется в операции и применяется к сумме
+const exchangeRatePrecision = 10
+
+// Конвертирует суммы по официальным курсам ЦБ за вычетом спреда банка
+type currencyConverter struct {
+	cbService CentralBankService
+	spread    *big.Rat
+}
+
+// Спред задается в процентах, например "1.5"
+func newCurrencyConverter(cbService CentralBankService, spreadPercent string) *currencyConverter {
+	spread, ok := new(big.Rat).SetString(spreadPercent)
+	if !ok {
+		spread = new(big.Rat)
+	}
+	return &currencyConverter{
+		cbService: cbService,
+		spread:    spread.Quo(spread, big.NewRat(100, 1)),
+	}
+}
+
+// Курс для клиента: сколько единиц to он получит за единицу from
+func (c *currencyConverter) Quote(ctx context.Context, from, to string) (*big.Rat, error) {
+	official, err := c.cbService.GetExchangeRate(ctx, from, to, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	rate := new(big.Rat).Sub(big.NewRat(1, 1), c.spread)
+	rate.Mul(rate, official)
+
+	// Округляем до хранимой точности, чтобы сохраненный курс воспроизводил сумму
+	rounded, _ := new(big.Rat).SetString(rate.FloatString(exchangeRatePrecision))
+	return rounded, nil
+}
+
+// Сумма зачисления округляется вниз до копейки
+func convertAmount(amount money.Money, rate *big.Rat, currency string) money.Money {
+	converted := amount.MulRat(rate, money.RoundDown)
+	converted.Currency = currency
+	return converted
+}
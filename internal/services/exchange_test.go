@@ -0,0 +1,138 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Misha-Glazunov/bank-api/pkg/money"
+)
+
+// Сервис ЦБ с курсами из фикстуры в кэше: сетевых запросов не будет
+func fixtureCentralBank(t *testing.T) *centralBankServiceImpl {
+	rawBody, err := os.ReadFile("testdata/curs_on_date.xml")
+	require.NoError(t, err)
+	rates, err := parseCursOnDateResponse(rawBody)
+	require.NoError(t, err)
+	rates[baseCurrency] = big.NewRat(1, 1)
+
+	return &centralBankServiceImpl{
+		ratesDate: time.Now().Format("2006-01-02"),
+		rates:     rates,
+	}
+}
+
+func TestParseCursOnDateResponse(t *testing.T) {
+	rawBody, err := os.ReadFile("testdata/curs_on_date.xml")
+	require.NoError(t, err)
+
+	rates, err := parseCursOnDateResponse(rawBody)
+	require.NoError(t, err)
+
+	// Запись без VchCode пропускается, курс делится на номинал
+	assert.Len(t, rates, 3)
+	assert.Equal(t, "90.0000", rates["USD"].FloatString(4))
+	assert.Equal(t, "99.5000", rates["EUR"].FloatString(4))
+	assert.Equal(t, "0.6125", rates["JPY"].FloatString(4))
+
+	_, err = parseCursOnDateResponse([]byte(`<ValuteData></ValuteData>`))
+	assert.Error(t, err)
+	_, err = parseCursOnDateResponse([]byte(`not xml`))
+	assert.Error(t, err)
+	_, err = parseCursOnDateResponse([]byte(`<ValuteData><ValuteCursOnDate><VchCode>USD</VchCode><Vnom>0</Vnom><Vcurs>90</Vcurs></ValuteCursOnDate></ValuteData>`))
+	assert.Error(t, err)
+}
+
+func TestParseKeyRateResponse(t *testing.T) {
+	rawBody, err := os.ReadFile("testdata/key_rate.xml")
+	require.NoError(t, err)
+
+	// Действующая ставка — первая запись
+	rate, err := parseKeyRateResponse(rawBody)
+	require.NoError(t, err)
+	assert.Equal(t, big.NewRat(20, 1), rate)
+
+	_, err = parseKeyRateResponse([]byte(`<diffgram><KeyRate></KeyRate></diffgram>`))
+	assert.Error(t, err)
+}
+
+func TestGetCurrentRateReturnsKeyRate(t *testing.T) {
+	cb := &centralBankServiceImpl{
+		keyRateDate: time.Now().Format("2006-01-02"),
+		keyRate:     big.NewRat(41, 2),
+	}
+
+	rate, err := cb.GetCurrentRate(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 20.5, rate)
+}
+
+func TestGetExchangeRate(t *testing.T) {
+	cb := fixtureCentralBank(t)
+	ctx := context.Background()
+
+	cases := map[[2]string]string{
+		{"USD", "RUB"}: "90.0000000000",
+		{"RUB", "USD"}: "0.0111111111",
+		{"EUR", "USD"}: "1.1055555556",
+		{"USD", "JPY"}: "146.9387755102",
+		{"EUR", "EUR"}: "1.0000000000",
+	}
+	for pair, want := range cases {
+		rate, err := cb.GetExchangeRate(ctx, pair[0], pair[1], time.Now())
+		if assert.NoError(t, err, "%s/%s", pair[0], pair[1]) {
+			assert.Equal(t, want, rate.FloatString(10), "%s/%s", pair[0], pair[1])
+		}
+	}
+
+	_, err := cb.GetExchangeRate(ctx, "USD", "GBP", time.Now())
+	assert.True(t, errors.Is(err, ErrUnsupportedCurrencyPair))
+}
+
+func TestQuoteAppliesSpread(t *testing.T) {
+	converter := newCurrencyConverter(fixtureCentralBank(t), "1.5")
+	ctx := context.Background()
+
+	cases := map[[2]string]string{
+		{"USD", "RUB"}: "88.6500000000",
+		{"EUR", "USD"}: "1.0889722222",
+		{"USD", "JPY"}: "144.7346938776",
+	}
+	for pair, want := range cases {
+		rate, err := converter.Quote(ctx, pair[0], pair[1])
+		if assert.NoError(t, err, "%s/%s", pair[0], pair[1]) {
+			// Курс уже округлен до хранимой точности
+			assert.Equal(t, want, rate.FloatString(exchangeRatePrecision), "%s/%s", pair[0], pair[1])
+			assert.Equal(t, rate.FloatString(exchangeRatePrecision+5), rate.FloatString(exchangeRatePrecision)+"00000")
+		}
+	}
+
+	// Некорректный спред трактуется как нулевой
+	rate, err := newCurrencyConverter(fixtureCentralBank(t), "abc").Quote(ctx, "USD", "RUB")
+	require.NoError(t, err)
+	assert.Equal(t, "90.00", rate.FloatString(2))
+}
+
+func TestConvertAmountRoundsDown(t *testing.T) {
+	cases := []struct {
+		amount money.Money
+		rate   string
+		want   money.Money
+	}{
+		{money.New(10000, "USD"), "88.65", money.New(886500, "RUB")},
+		{money.New(1000, "EUR"), "1.0889722222", money.New(1088, "USD")},
+		{money.New(1, "RUB"), "0.0111111111", money.New(0, "USD")},
+		{money.New(99999, "RUB"), "0.0111111111", money.New(1111, "USD")},
+	}
+	for _, c := range cases {
+		rate, ok := new(big.Rat).SetString(c.rate)
+		require.True(t, ok)
+		assert.Equal(t, c.want, convertAmount(c.amount, rate, c.want.Currency), "%s at %s", c.amount, c.rate)
+	}
+}
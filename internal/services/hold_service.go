@@ -0,0 +1,210 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/Misha-Glazunov/bank-api/internal/models"
+	"github.com/Misha-Glazunov/bank-api/internal/repositories"
+	"github.com/Misha-Glazunov/bank-api/pkg/money"
+	"github.com/Misha-Glazunov/bank-api/pkg/utils"
+)
+
+type holdServiceImpl struct {
+	txManager   repositories.TxManager
+	authorizer  Authorizer
+	accountRepo repositories.AccountRepository
+	repo        repositories.HoldRepository
+	batchSize   int
+	logger      *logrus.Logger
+	now         func() time.Time
+}
+
+func NewHoldService(
+	txManager repositories.TxManager,
+	authorizer Authorizer,
+	accountRepo repositories.AccountRepository,
+	repo repositories.HoldRepository,
+	batchSize int,
+	logger *logrus.Logger,
+) HoldService {
+	return &holdServiceImpl{
+		txManager:   txManager,
+		authorizer:  authorizer,
+		accountRepo: accountRepo,
+		repo:        repo,
+		batchSize:   batchSize,
+		logger:      logger,
+		now:         func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Резервирует часть доступного остатка счета. Овердрафт для резерва
+// не используется: удержать можно только собственные средства.
+func (s *holdServiceImpl) Create(ctx context.Context, userID, accountID string, req models.HoldRequest) (*models.Hold, error) {
+	if !req.Amount.IsPositive() {
+		return nil, ErrInvalidAmount
+	}
+	if req.Reason == "" {
+		return nil, ErrReasonRequired
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(s.now()) {
+		return nil, ErrInvalidHoldExpiry
+	}
+	if _, err := s.authorizer.AuthorizeAccountOwner(ctx, userID, accountID); err != nil {
+		return nil, err
+	}
+
+	var hold *models.Hold
+	err := s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		accounts, err := lockAccounts(ctx, s.accountRepo, accountID)
+		if err != nil {
+			return err
+		}
+
+		account := accounts[accountID]
+		if account.IsClosed() {
+			return ErrAccountClosed
+		}
+		if account.IsFrozen() {
+			return ErrAccountFrozen
+		}
+		amount, err := inAccountCurrency(req.Amount, account)
+		if err != nil {
+			return err
+		}
+		if account.AvailableBalance.LessThan(amount) {
+			return ErrInsufficientFunds
+		}
+
+		hold, err = placeHold(ctx, s.repo, account.ID, amount, req.Reason, models.HoldSourceManual, req.ExpiresAt)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"account_id": accountID,
+		"hold_id":    hold.ID,
+		"amount":     hold.Amount.String(),
+	}).Info("Hold placed")
+	return hold, nil
+}
+
+func (s *holdServiceImpl) List(ctx context.Context, userID, accountID string) ([]*models.Hold, error) {
+	if _, err := s.authorizer.AuthorizeAccount(ctx, userID, accountID); err != nil {
+		return nil, err
+	}
+
+	holds, err := s.repo.ListByAccount(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	if holds == nil {
+		holds = []*models.Hold{}
+	}
+	return holds, nil
+}
+
+// Снимает резерв владельца счета. Удержания под карточные авторизации
+// снимаются только списанием или отменой авторизации.
+func (s *holdServiceImpl) Release(ctx context.Context, userID, accountID, holdID string) (*models.Hold, error) {
+	if _, err := s.authorizer.AuthorizeAccountOwner(ctx, userID, accountID); err != nil {
+		return nil, err
+	}
+	if !utils.IsValidUUID(holdID) {
+		return nil, ErrHoldNotFound
+	}
+
+	var released *models.Hold
+	err := s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		hold, err := s.repo.GetForUpdate(ctx, accountID, holdID)
+		if err != nil {
+			if errors.Is(err, repositories.ErrHoldNotFound) {
+				return ErrHoldNotFound
+			}
+			return err
+		}
+		if !hold.IsActive() {
+			return ErrHoldNotActive
+		}
+		if hold.Source != models.HoldSourceManual {
+			return ErrHoldNotReleasable
+		}
+
+		released, err = s.repo.Finish(ctx, hold.ID, models.HoldStatusReleased)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"account_id": accountID,
+		"hold_id":    holdID,
+	}).Info("Hold released")
+	return released, nil
+}
+
+// Снимает удержания с истекшим сроком; за запуск обрабатывается
+// до batchSize удержаний за раз, пока просроченные не закончатся
+func (s *holdServiceImpl) ExpireDue(ctx context.Context) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		holds, err := s.repo.ExpireDue(ctx, s.now(), s.batchSize)
+		if err != nil {
+			return err
+		}
+		for _, hold := range holds {
+			s.logger.WithFields(logrus.Fields{
+				"account_id": hold.AccountID,
+				"hold_id":    hold.ID,
+				"amount":     hold.Amount.String(),
+			}).Info("Hold expired")
+		}
+		if len(holds) == 0 || len(holds) < s.batchSize {
+			return nil
+		}
+	}
+}
+
+func placeHold(
+	ctx context.Context,
+	repo repositories.HoldRepository,
+	accountID string,
+	amount money.Money,
+	reason, source string,
+	expiresAt *time.Time,
+) (*models.Hold, error) {
+	hold := &models.Hold{
+		AccountID: accountID,
+		Amount:    amount,
+		Currency:  amount.Currency,
+		Reason:    reason,
+		Source:    source,
+		Status:    models.HoldStatusActive,
+		ExpiresAt: expiresAt,
+	}
+	if err := repo.Create(ctx, hold); err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
+
+// Снимает удержание, если оно еще действует; истекшее удержание уже не уменьшает остаток
+func releaseHold(ctx context.Context, repo repositories.HoldRepository, holdID string) error {
+	if holdID == "" {
+		return nil
+	}
+	if _, err := repo.Finish(ctx, holdID, models.HoldStatusReleased); err != nil && !errors.Is(err, repositories.ErrHoldNotFound) {
+		return err
+	}
+	return nil
+}
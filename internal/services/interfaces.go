@@ -3,39 +3,240 @@ package services
 import (
     "context"
     "errors"
+    "math/big"
+    "time"
     
     "github.com/Misha-Glazunov/bank-api/internal/models"
+    "github.com/Misha-Glazunov/bank-api/pkg/money"
 )
 
 // Общие ошибки
 var (
-    ErrUserAlreadyExists  = errors.New("user already exists")
-    ErrInvalidCredentials = errors.New("invalid credentials")
-    ErrAccountNotFound    = errors.New("account not found")
-    ErrInsufficientFunds  = errors.New("insufficient funds")
+    ErrUserAlreadyExists          = errors.New("user already exists")
+    ErrInvalidCredentials         = errors.New("invalid credentials")
+    ErrAccountNotFound            = errors.New("account not found")
+    ErrInsufficientFunds          = errors.New("insufficient funds")
+    ErrInvalidAmount              = errors.New("amount must be positive")
+    ErrSameAccount                = errors.New("source and destination accounts must differ")
+    ErrCurrencyMismatch           = errors.New("amount currency does not match account currency")
+    ErrEntryNotFound              = errors.New("journal entry not found")
+    ErrEntryNotReversible         = errors.New("journal entry cannot be reversed")
+    ErrPostingRejected            = errors.New("posting rejected: account is closed or in another currency")
+    ErrInvalidCursor              = errors.New("invalid pagination cursor")
+    ErrAccessDenied               = errors.New("access denied")
+    ErrCardNotFound               = errors.New("card not found")
+    ErrDestinationNotFound        = errors.New("destination account not found")
+    ErrAccountClosed              = errors.New("account is closed")
+    ErrAccountBalanceNotZero      = errors.New("account balance must be zero to close")
+    ErrUnsupportedCurrency        = errors.New("unsupported currency")
+    ErrUnsupportedProduct         = errors.New("unsupported product type")
+    ErrUnsupportedCurrencyPair    = errors.New("unsupported currency pair")
+    ErrExchangeRateUnavailable    = errors.New("exchange rate is unavailable")
+    ErrLimitExceeded              = errors.New("limit exceeded")
+    ErrScheduledPaymentNotFound   = errors.New("scheduled payment not found")
+    ErrInvalidSchedule            = errors.New("invalid payment schedule")
+    ErrScheduledPaymentInactive   = errors.New("scheduled payment is no longer active")
+    ErrKeyRateUnavailable         = errors.New("key rate is unavailable")
+    ErrLoanNotFound               = errors.New("loan not found")
+    ErrLoanTermsOutOfRange        = errors.New("loan amount or term is outside product limits")
+    ErrLoanClosed                 = errors.New("loan is already repaid")
+    ErrRepaymentExceedsDebt       = errors.New("repayment exceeds outstanding debt")
+    ErrDepositNotFound            = errors.New("deposit not found")
+    ErrDepositClosed              = errors.New("deposit is already closed")
+    ErrDepositLocked              = errors.New("term deposit funds are locked until maturity")
+    ErrDepositAmountTooLow        = errors.New("deposit amount is below product minimum")
+    ErrInvalidPeriod              = errors.New("invalid statement period")
+    ErrInvalidPaymentFile         = errors.New("invalid pain.001 payment file")
+    ErrInvalidBulkMode            = errors.New("invalid bulk payment mode")
+    ErrUnsupportedPaymentSystem   = errors.New("unsupported payment system")
+    ErrCardBlocked                = errors.New("card is blocked")
+    ErrCardClosed                 = errors.New("card is permanently blocked")
+    ErrCardExpired                = errors.New("card has expired")
+    ErrCardNotBlocked             = errors.New("card is not blocked")
+    ErrCardReissued               = errors.New("card has already been reissued")
+    ErrInvalidBlockReason         = errors.New("block reason must be lost or stolen")
+    ErrInvalidPIN                 = errors.New("PIN must be 4 digits and not trivial")
+    ErrIncorrectPIN               = errors.New("incorrect PIN")
+    ErrPINAlreadySet              = errors.New("PIN is already set")
+    ErrPINNotSet                  = errors.New("PIN is not set")
+    ErrAccountRequired            = errors.New("account_id is required")
+    ErrCardDeclined               = errors.New("card authorization declined")
+    ErrCardAuthorizationNotFound  = errors.New("card authorization not found")
+    ErrDuplicateAuthorization     = errors.New("authorization with this reference already exists")
+    ErrReferenceRequired          = errors.New("reference is required")
+    ErrAuthorizationNotPending    = errors.New("authorization is no longer pending")
+    ErrAuthorizationExpired       = errors.New("authorization has expired")
+    ErrAuthorizationNotCaptured   = errors.New("authorization has not been captured")
+    ErrRefundReferenceConflict    = errors.New("refund reference was already used with a different amount")
+    ErrAmountExceedsAuthorization = errors.New("amount exceeds the remaining authorization amount")
+    ErrHoldNotFound               = errors.New("hold not found")
+    ErrHoldNotActive              = errors.New("hold is no longer active")
+    ErrHoldNotReleasable          = errors.New("hold is released by the operation that placed it")
+    ErrReasonRequired             = errors.New("reason is required")
+    ErrInvalidHoldExpiry          = errors.New("hold expiry must be in the future")
+    ErrAccountHasHolds            = errors.New("account has active holds")
+    ErrInvalidMCC                 = errors.New("MCC must be 4 digits")
+    ErrInvalidChannel             = errors.New("channel must be online or offline")
+    ErrInvalidCountry             = errors.New("country must be a two-letter code")
+    ErrInvalidRefreshToken        = errors.New("invalid or expired refresh token")
+    ErrInvalidActionToken         = errors.New("invalid or expired token")
+    ErrEmailNotVerified           = errors.New("email address is not verified")
+    ErrEmailAlreadyVerified       = errors.New("email address is already verified")
+    ErrTwoFactorRequired          = errors.New("two-factor code is required")
+    ErrInvalidTwoFactorCode       = errors.New("invalid two-factor code")
+    ErrTooManyTwoFactorAttempts   = errors.New("too many invalid two-factor codes, try again later")
+    ErrTwoFactorEnabled           = errors.New("two-factor authentication is already enabled")
+    ErrTwoFactorNotEnabled        = errors.New("two-factor authentication is not enabled")
+    ErrTwoFactorNotEnrolled       = errors.New("two-factor enrollment has not been started")
+    ErrInvalidChallenge           = errors.New("invalid or expired login challenge")
+    ErrAccountFrozen              = errors.New("account is frozen")
+    ErrCardFrozen                 = errors.New("card is frozen")
+    ErrAccountNotFrozen           = errors.New("account is not frozen")
+    ErrCardNotFrozen              = errors.New("card is not frozen")
+    ErrUserNotFound               = errors.New("user not found")
+    ErrInvalidRole                = errors.New("role must be customer, operator or admin")
+    ErrQueryRequired              = errors.New("search query is required")
+    ErrInvalidDirection           = errors.New("direction must be credit or debit")
+    ErrWeakPassword               = errors.New("password must be at least 8 characters and contain upper and lower case letters, a digit and a special character")
+    ErrInvalidEmail               = errors.New("invalid email address")
+    ErrInvalidUsername            = errors.New("username must be 3 to 32 letters, digits, dots, hyphens or underscores")
 )
 
 type AuthService interface {
     Register(ctx context.Context, email, username, password string) error
-    Login(ctx context.Context, email, password string) (string, error)
+    Login(ctx context.Context, email, password string) (*models.LoginResult, error)
+    CompleteLogin(ctx context.Context, challengeToken, code string) (*models.TokenPair, error)
+    Refresh(ctx context.Context, refreshToken string) (*models.TokenPair, error)
+    Logout(ctx context.Context, userID, sessionID string) error
+    VerifyEmail(ctx context.Context, token string) error
+    ResendVerification(ctx context.Context, userID string) error
+    RequestPasswordReset(ctx context.Context, email string) error
+    ResetPassword(ctx context.Context, token, password string) error
+}
+
+// Двухфакторная аутентификация по TOTP и подтверждение операций кодом
+type TwoFactorService interface {
+    Status(ctx context.Context, userID string) (*models.TwoFactorStatus, error)
+    Enroll(ctx context.Context, userID string) (*models.TOTPEnrollment, error)
+    Confirm(ctx context.Context, userID, code string) (*models.BackupCodes, error)
+    Disable(ctx context.Context, userID, code string) error
+    RegenerateBackupCodes(ctx context.Context, userID, code string) (*models.BackupCodes, error)
+    StepUp(ctx context.Context, userID, code string, amount *money.Money) error
+}
+
+// Администрирование клиентов сотрудниками банка. Каждое действие, включая
+// просмотр данных клиента, записывается в журнал аудита от имени actorID.
+type AdminService interface {
+    SearchUsers(ctx context.Context, actorID, query string, limit int) ([]*models.User, error)
+    GetUser(ctx context.Context, actorID, userID string) (*models.UserOverview, error)
+    ChangeRole(ctx context.Context, actorID, userID, role, reason string) (*models.User, error)
+    GetAccount(ctx context.Context, actorID, accountID string) (*models.Account, error)
+    FreezeAccount(ctx context.Context, actorID, accountID, reason string) (*models.Account, error)
+    UnfreezeAccount(ctx context.Context, actorID, accountID, reason string) (*models.Account, error)
+    FreezeCard(ctx context.Context, actorID, cardID, reason string) (*models.Card, error)
+    UnfreezeCard(ctx context.Context, actorID, cardID, reason string) (*models.Card, error)
+    AdjustBalance(ctx context.Context, actorID, accountID string, adjustment models.BalanceAdjustment) (*models.Account, error)
+    SetAccountLimits(ctx context.Context, actorID, accountID string, update models.AccountLimitsUpdate) (*models.AccountLimits, error)
+    ListAudit(ctx context.Context, actorID string, filter models.AuditFilter) ([]*models.AuditRecord, error)
+    ReverseEntry(ctx context.Context, actorID, entryID, reason string) (*models.JournalEntry, error)
+    Reconcile(ctx context.Context, actorID string) ([]*models.BalanceMismatch, error)
 }
 
 type AccountService interface {
-    CreateAccount(ctx context.Context, userID string) (*models.Account, error)
-    GetBalance(ctx context.Context, accountID string) (float64, error)
-    Deposit(ctx context.Context, accountID string, amount float64) error
-    Withdraw(ctx context.Context, accountID string, amount float64) error
+    CreateAccount(ctx context.Context, userID, currency, productType string) (*models.Account, error)
+    ListAccounts(ctx context.Context, userID string) ([]*models.Account, error)
+    GetAccount(ctx context.Context, userID, accountID string) (*models.Account, error)
+    GetBalance(ctx context.Context, userID, accountID string) (money.Money, error)
+    Deposit(ctx context.Context, userID, accountID string, amount money.Money) error
+    Withdraw(ctx context.Context, userID, accountID string, amount money.Money) error
+    CloseAccount(ctx context.Context, userID, accountID string) (*models.Account, error)
+    GetLimits(ctx context.Context, userID, accountID string) (*models.LimitsStatus, error)
+}
+
+// Удержания средств на счете
+type HoldService interface {
+    Create(ctx context.Context, userID, accountID string, req models.HoldRequest) (*models.Hold, error)
+    List(ctx context.Context, userID, accountID string) ([]*models.Hold, error)
+    Release(ctx context.Context, userID, accountID, holdID string) (*models.Hold, error)
+    ExpireDue(ctx context.Context) error
 }
 
 type CardService interface {
-    CreateCard(ctx context.Context, userID string) (*models.Card, error)
+    CreateCard(ctx context.Context, userID, accountID, paymentSystem string) (*models.Card, error)
+    List(ctx context.Context, userID string) ([]*models.Card, error)
+    Get(ctx context.Context, userID, cardID string) (*models.Card, error)
+    LinkAccount(ctx context.Context, userID, cardID, accountID string) (*models.Card, error)
+    Block(ctx context.Context, userID, cardID string) (*models.Card, error)
+    Unblock(ctx context.Context, userID, cardID string) (*models.Card, error)
+    Close(ctx context.Context, userID, cardID, reason string) (*models.Card, error)
+    Reissue(ctx context.Context, userID, cardID string) (*models.Card, error)
+    SetPIN(ctx context.Context, userID, cardID, pin string) error
+    ChangePIN(ctx context.Context, userID, cardID, oldPIN, newPIN string) error
+    GetLimits(ctx context.Context, userID, cardID string) (*models.CardLimits, error)
+    UpdateLimits(ctx context.Context, userID, cardID string, limits *models.CardLimits) (*models.CardLimits, error)
+    RevealNumber(ctx context.Context, userID, cardID, password string) (*models.Card, error)
+    EncryptStoredNumbers(ctx context.Context) error
+}
+
+// Авторизация и расчеты по карточным платежам от имени мерчанта
+type CardPaymentService interface {
+    Authorize(ctx context.Context, merchantID string, req models.CardAuthorizationRequest) (*models.CardAuthorization, error)
+    Get(ctx context.Context, merchantID, authorizationID string) (*models.CardAuthorization, error)
+    Capture(ctx context.Context, merchantID, authorizationID string, amount *money.Money) (*models.CardAuthorization, error)
+    Void(ctx context.Context, merchantID, authorizationID string) (*models.CardAuthorization, error)
+    Refund(ctx context.Context, merchantID, authorizationID string, req models.CardRefundRequest) (*models.CardAuthorization, error)
 }
 
 type CentralBankService interface {
     GetCurrentRate(ctx context.Context) (float64, error)
+    GetKeyRate(ctx context.Context) (*big.Rat, error)
+    GetCursOnDate(ctx context.Context, date time.Time) (map[string]*big.Rat, error)
+    GetExchangeRate(ctx context.Context, from, to string, date time.Time) (*big.Rat, error)
 }
 
 type PaymentService interface {
-    Transfer(ctx context.Context, fromAccountID, toAccountID string, amount float64) error
-    GetTransactions(ctx context.Context, accountID string) ([]*models.Transaction, error)
+    Transfer(ctx context.Context, userID, fromAccountID, toAccountID string, amount money.Money) error
+    GetTransactions(ctx context.Context, userID, accountID string, filter models.TransactionFilter, cursor string) (*models.TransactionPage, error)
+}
+
+type ScheduledPaymentService interface {
+    Create(ctx context.Context, userID string, payment *models.ScheduledPayment) (*models.ScheduledPayment, error)
+    List(ctx context.Context, userID string) ([]*models.ScheduledPayment, error)
+    Get(ctx context.Context, userID, id string) (*models.ScheduledPayment, error)
+    Update(ctx context.Context, userID, id string, update models.ScheduledPaymentUpdate) (*models.ScheduledPayment, error)
+    Cancel(ctx context.Context, userID, id string) (*models.ScheduledPayment, error)
+    ListRuns(ctx context.Context, userID, id string) ([]*models.ScheduledPaymentRun, error)
+    ExecuteDue(ctx context.Context) error
+}
+
+type LoanService interface {
+    ListProducts(ctx context.Context) ([]*models.LoanProduct, error)
+    Apply(ctx context.Context, userID string, app models.LoanApplication) (*models.Loan, error)
+    List(ctx context.Context, userID string) ([]*models.Loan, error)
+    Get(ctx context.Context, userID, id string) (*models.Loan, error)
+    Repay(ctx context.Context, userID, id string, amount money.Money, mode string) (*models.Loan, error)
+    ProcessDue(ctx context.Context) error
+}
+
+type DepositService interface {
+    ListProducts(ctx context.Context) ([]*models.DepositProduct, error)
+    Open(ctx context.Context, userID string, app models.DepositApplication) (*models.Deposit, error)
+    List(ctx context.Context, userID string) ([]*models.Deposit, error)
+    Get(ctx context.Context, userID, id string) (*models.Deposit, error)
+    ListAccruals(ctx context.Context, userID, id string) ([]*models.DepositAccrual, error)
+    Close(ctx context.Context, userID, id, toAccountID string) (*models.Deposit, error)
+    AccrueInterest(ctx context.Context) error
+}
+
+type StatementService interface {
+    Generate(ctx context.Context, userID, accountID string, from, to time.Time) (*models.Statement, error)
+}
+
+type BulkPaymentService interface {
+    Import(ctx context.Context, userID string, raw []byte, mode string) (*models.BulkPaymentReport, error)
+}
+
+type LedgerService interface {
+    Reverse(ctx context.Context, entryID, reason string) (*models.JournalEntry, error)
+    Reconcile(ctx context.Context) ([]*models.BalanceMismatch, error)
 }
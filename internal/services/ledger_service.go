@@ -0,0 +1,129 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Misha-Glazunov/bank-api/internal/models"
+	"github.com/Misha-Glazunov/bank-api/internal/repositories"
+	"github.com/Misha-Glazunov/bank-api/pkg/money"
+)
+
+type ledgerServiceImpl struct {
+	txManager   repositories.TxManager
+	accountRepo repositories.AccountRepository
+	ledgerRepo  repositories.LedgerRepository
+}
+
+func NewLedgerService(
+	txManager repositories.TxManager,
+	accountRepo repositories.AccountRepository,
+	ledgerRepo repositories.LedgerRepository,
+) LedgerService {
+	return &ledgerServiceImpl{
+		txManager:   txManager,
+		accountRepo: accountRepo,
+		ledgerRepo:  ledgerRepo,
+	}
+}
+
+// Сторнирует запись журнала зеркальными проводками
+func (s *ledgerServiceImpl) Reverse(ctx context.Context, entryID, reason string) (*models.JournalEntry, error) {
+	var reversal *models.JournalEntry
+	err := s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		original, err := s.ledgerRepo.GetEntry(ctx, entryID)
+		if err != nil {
+			if errors.Is(err, repositories.ErrEntryNotFound) {
+				return ErrEntryNotFound
+			}
+			return err
+		}
+		if original.Type == models.EntryTypeReversal || original.ReversedBy != "" {
+			return ErrEntryNotReversible
+		}
+
+		ids := make([]string, 0, len(original.Postings))
+		postings := make([]models.Posting, 0, len(original.Postings))
+		for _, p := range original.Postings {
+			ids = append(ids, p.AccountID)
+			if p.Direction == models.PostingDebit {
+				postings = append(postings, credit(p.AccountID, p.Amount))
+			} else {
+				postings = append(postings, debit(p.AccountID, p.Amount))
+			}
+		}
+
+		if _, err := lockAccounts(ctx, s.accountRepo, ids...); err != nil {
+			return err
+		}
+
+		reversal = newEntry(models.EntryTypeReversal, fmt.Sprintf("Reversal of %s: %s", entryID, reason), postings...)
+		reversal.ReversalOf = entryID
+		return postEntry(ctx, s.ledgerRepo, reversal)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reversal, nil
+}
+
+// Сверяет кэшированные балансы счетов с журналом
+func (s *ledgerServiceImpl) Reconcile(ctx context.Context) ([]*models.BalanceMismatch, error) {
+	return s.ledgerRepo.FindMismatches(ctx)
+}
+
+// Проводит запись журнала. Отказ репозитория из-за закрытого счета или чужой
+// валюты возвращается как ошибка сервиса, а не как внутренний сбой.
+func postEntry(ctx context.Context, ledgerRepo repositories.LedgerRepository, entry *models.JournalEntry) error {
+	if err := ledgerRepo.Post(ctx, entry); err != nil {
+		if errors.Is(err, repositories.ErrPostingRejected) {
+			return ErrPostingRejected
+		}
+		return err
+	}
+	return nil
+}
+
+func newEntry(entryType, description string, postings ...models.Posting) *models.JournalEntry {
+	return &models.JournalEntry{
+		Type:        entryType,
+		Description: description,
+		Postings:    postings,
+	}
+}
+
+func debit(accountID string, amount money.Money) models.Posting {
+	return models.Posting{AccountID: accountID, Direction: models.PostingDebit, Amount: amount}
+}
+
+func credit(accountID string, amount money.Money) models.Posting {
+	return models.Posting{AccountID: accountID, Direction: models.PostingCredit, Amount: amount}
+}
+
+// Проводка между счетом клиента и внутренним счетом банка.
+// Положительная сумма зачисляется клиенту, отрицательная списывается.
+func postWithSystemAccount(
+	ctx context.Context,
+	ledgerRepo repositories.LedgerRepository,
+	entryType, code, description string,
+	accountID string,
+	amount money.Money,
+) (*models.JournalEntry, error) {
+	system, err := ledgerRepo.SystemAccount(ctx, code, amount.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	var entry *models.JournalEntry
+	if amount.IsNegative() {
+		entry = newEntry(entryType, description, debit(accountID, amount.Neg()), credit(system.ID, amount.Neg()))
+	} else {
+		entry = newEntry(entryType, description, debit(system.ID, amount), credit(accountID, amount))
+	}
+
+	if err := postEntry(ctx, ledgerRepo, entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
@@ -0,0 +1,224 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Misha-Glazunov/bank-api/internal/config"
+	"github.com/Misha-Glazunov/bank-api/internal/models"
+	"github.com/Misha-Glazunov/bank-api/internal/repositories"
+	"github.com/Misha-Glazunov/bank-api/pkg/money"
+)
+
+// Превышение лимита с остатком, который еще можно списать
+type LimitExceededError struct {
+	Limit     string
+	Amount    money.Money
+	Remaining money.Money
+}
+
+func (e *LimitExceededError) Error() string {
+	return fmt.Sprintf("%s limit of %s exceeded, remaining %s", e.Limit, e.Amount, e.Remaining)
+}
+
+// Выход за границу овердрафта считается нехваткой средств,
+// остальные лимиты — отдельной ошибкой
+func (e *LimitExceededError) Is(target error) bool {
+	if e.Limit == models.LimitOverdraft {
+		return target == ErrInsufficientFunds
+	}
+	return target == ErrLimitExceeded
+}
+
+// Проверяет исходящие операции по лимитам из конфигурации
+// с учетом индивидуальных значений счета
+type limitsEngine struct {
+	defaults        config.LimitsConfig
+	limitRepo       repositories.AccountLimitRepository
+	transactionRepo repositories.TransactionRepository
+	userRepo        repositories.UserRepository
+}
+
+func newLimitsEngine(
+	defaults config.LimitsConfig,
+	limitRepo repositories.AccountLimitRepository,
+	transactionRepo repositories.TransactionRepository,
+	userRepo repositories.UserRepository,
+) *limitsEngine {
+	return &limitsEngine{
+		defaults:        defaults,
+		limitRepo:       limitRepo,
+		transactionRepo: transactionRepo,
+		userRepo:        userRepo,
+	}
+}
+
+// Блокирует лимиты владельца счета до конца транзакции.
+// Вызывается до блокировки счетов, чтобы порядок блокировок был единым.
+func (e *limitsEngine) Lock(ctx context.Context, userID string) error {
+	return e.limitRepo.LockOwner(ctx, userID)
+}
+
+// Действующие лимиты счета: индивидуальные значения поверх значений по умолчанию.
+// Овердрафт по умолчанию доступен только на текущих счетах.
+func (e *limitsEngine) Effective(ctx context.Context, account *models.Account) (*models.AccountLimits, error) {
+	limits, err := e.limitRepo.Get(ctx, account.ID, account.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	// Лимиты задаются для каждой валюты отдельно: рублевые суммы
+	// не применяются к валютным счетам
+	defaults, ok := e.defaults.ByCurrency[account.Currency]
+	if !ok {
+		return nil, fmt.Errorf("no default limits for currency %s", account.Currency)
+	}
+
+	overdraft := defaults.Overdraft
+	if account.ProductType != models.ProductTypeCurrent {
+		overdraft = ""
+	}
+
+	for _, f := range []struct {
+		value string
+		dst   **money.Money
+	}{
+		{defaults.MaxTransfer, &limits.MaxTransfer},
+		{overdraft, &limits.Overdraft},
+		{defaults.DailyOutgoing, &limits.DailyOutgoing},
+		{defaults.MonthlyOutgoing, &limits.MonthlyOutgoing},
+	} {
+		if *f.dst != nil || f.value == "" {
+			continue
+		}
+		value, err := money.Parse(f.value, account.Currency)
+		if err != nil {
+			return nil, fmt.Errorf("invalid default limit %q: %w", f.value, err)
+		}
+		*f.dst = &value
+	}
+
+	return limits, nil
+}
+
+// Действующие лимиты и остатки по ним на текущие сутки и месяц
+func (e *limitsEngine) Status(ctx context.Context, account *models.Account) (*models.LimitsStatus, error) {
+	limits, err := e.Effective(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &models.LimitsStatus{
+		AccountLimits: *limits,
+		Available:     available(account, limits),
+	}
+	if status.DailyRemaining, err = e.periodRemaining(ctx, account, limits.DailyOutgoing, "day"); err != nil {
+		return nil, err
+	}
+	if status.MonthlyRemaining, err = e.periodRemaining(ctx, account, limits.MonthlyOutgoing, "month"); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// Проверяет списание суммы со счета по операции пользователя userID - владельца
+// или доверенного пользователя счета. Счет должен быть заблокирован вызывающим.
+// Переводы между своими счетами не учитываются в дневном и месячном лимитах.
+// С замороженного счета и до подтверждения адреса владельцем и тем, кто
+// выполняет операцию, списания запрещены.
+func (e *limitsEngine) CheckOutgoing(ctx context.Context, userID string, account *models.Account, amount money.Money, ownTransfer bool) error {
+	if account.IsFrozen() {
+		return ErrAccountFrozen
+	}
+	userIDs := []string{account.UserID}
+	if userID != account.UserID {
+		userIDs = append(userIDs, userID)
+	}
+	for _, id := range userIDs {
+		user, err := e.userRepo.GetByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if !user.IsEmailVerified() {
+			return ErrEmailNotVerified
+		}
+	}
+	limits, err := e.Effective(ctx, account)
+	if err != nil {
+		return err
+	}
+
+	if limits.MaxTransfer != nil && limits.MaxTransfer.LessThan(amount) {
+		return &LimitExceededError{
+			Limit:     models.LimitMaxTransfer,
+			Amount:    *limits.MaxTransfer,
+			Remaining: *limits.MaxTransfer,
+		}
+	}
+
+	if remaining := available(account, limits); remaining.LessThan(amount) {
+		overdraft := money.Zero(account.Currency)
+		if limits.Overdraft != nil {
+			overdraft = *limits.Overdraft
+		}
+		return &LimitExceededError{
+			Limit:     models.LimitOverdraft,
+			Amount:    overdraft,
+			Remaining: nonNegative(remaining),
+		}
+	}
+
+	if ownTransfer {
+		return nil
+	}
+
+	for _, period := range []struct {
+		name  string
+		limit *money.Money
+		trunc string
+	}{
+		{models.LimitDailyOutgoing, limits.DailyOutgoing, "day"},
+		{models.LimitMonthlyOutgoing, limits.MonthlyOutgoing, "month"},
+	} {
+		remaining, err := e.periodRemaining(ctx, account, period.limit, period.trunc)
+		if err != nil {
+			return err
+		}
+		if remaining != nil && remaining.LessThan(amount) {
+			return &LimitExceededError{
+				Limit:     period.name,
+				Amount:    *period.limit,
+				Remaining: *remaining,
+			}
+		}
+	}
+	return nil
+}
+
+// Остаток лимита за период по всем счетам владельца в валюте счета; nil — лимита нет
+func (e *limitsEngine) periodRemaining(ctx context.Context, account *models.Account, limit *money.Money, period string) (*money.Money, error) {
+	if limit == nil {
+		return nil, nil
+	}
+	spent, err := e.transactionRepo.SumOutgoing(ctx, account.UserID, account.Currency, period)
+	if err != nil {
+		return nil, err
+	}
+	remaining := nonNegative(limit.Sub(spent))
+	return &remaining, nil
+}
+
+// Сумма, которую можно списать: доступный остаток за вычетом удержаний с учетом овердрафта
+func available(account *models.Account, limits *models.AccountLimits) money.Money {
+	if limits.Overdraft == nil {
+		return account.AvailableBalance
+	}
+	return account.AvailableBalance.Add(*limits.Overdraft)
+}
+
+func nonNegative(m money.Money) money.Money {
+	if m.IsNegative() {
+		return money.Zero(m.Currency)
+	}
+	return m
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/Misha-Glazunov/bank-api/internal/models"
+	"github.com/Misha-Glazunov/bank-api/pkg/money"
+)
+
+// Строка графика: основной долг и проценты за месяц
+type scheduleLine struct {
+	principal money.Money
+	interest  money.Money
+}
+
+// Месячная ставка из годовой ставки в процентах
+func monthlyRate(annualPercent *big.Rat) *big.Rat {
+	return new(big.Rat).Quo(annualPercent, big.NewRat(1200, 1))
+}
+
+// Аннуитетный платеж P·r·(1+r)^n / ((1+r)^n − 1), округленный до копейки
+func annuityPayment(principal money.Money, r *big.Rat, n int) money.Money {
+	if r.Sign() == 0 {
+		return principal.MulRat(big.NewRat(1, int64(n)), money.RoundHalfUp)
+	}
+
+	growth := new(big.Rat).Add(big.NewRat(1, 1), r)
+	pow := big.NewRat(1, 1)
+	for i := 0; i < n; i++ {
+		pow.Mul(pow, growth)
+	}
+
+	k := new(big.Rat).Mul(r, pow)
+	k.Quo(k, new(big.Rat).Sub(pow, big.NewRat(1, 1)))
+	return principal.MulRat(k, money.RoundHalfUp)
+}
+
+// Аннуитетный график с заданным платежом не длиннее maxN месяцев.
+// Последний платеж закрывает остаток долга с учетом округлений.
+func annuitySchedule(principal money.Money, r *big.Rat, payment money.Money, maxN int) []scheduleLine {
+	var lines []scheduleLine
+	remaining := principal
+	for i := 0; remaining.IsPositive() && i < maxN; i++ {
+		interest := remaining.MulRat(r, money.RoundHalfUp)
+		part := payment.Sub(interest)
+		if i == maxN-1 || remaining.LessThan(part) || !part.IsPositive() {
+			part = remaining
+		}
+		lines = append(lines, scheduleLine{principal: part, interest: interest})
+		remaining = remaining.Sub(part)
+	}
+	return lines
+}
+
+// Дифференцированный график: основной долг гасится равными частями,
+// проценты начисляются на остаток
+func differentiatedSchedule(principal money.Money, r *big.Rat, part money.Money, maxN int) []scheduleLine {
+	var lines []scheduleLine
+	remaining := principal
+	for i := 0; remaining.IsPositive() && i < maxN; i++ {
+		interest := remaining.MulRat(r, money.RoundHalfUp)
+		p := part
+		if i == maxN-1 || remaining.LessThan(p) || !p.IsPositive() {
+			p = remaining
+		}
+		lines = append(lines, scheduleLine{principal: p, interest: interest})
+		remaining = remaining.Sub(p)
+	}
+	return lines
+}
+
+// График на n месяцев для нового кредита или после досрочного погашения с уменьшением платежа
+func buildSchedule(scheduleType string, principal money.Money, r *big.Rat, n int) []scheduleLine {
+	if scheduleType == models.LoanScheduleDifferentiated {
+		part := principal.MulRat(big.NewRat(1, int64(n)), money.RoundDown)
+		return differentiatedSchedule(principal, r, part, n)
+	}
+	return annuitySchedule(principal, r, annuityPayment(principal, r, n), n)
+}
+
+// Даты платежей: ежемесячно в день выдачи, в коротких месяцах — в последний день
+func installmentDates(disbursedOn time.Time, n int) []time.Time {
+	dates := make([]time.Time, 0, n)
+	day := disbursedOn.Day()
+	d := disbursedOn
+	for i := 0; i < n; i++ {
+		d = nextOccurrence(models.RecurrenceMonthly, day, d)
+		dates = append(dates, d)
+	}
+	return dates
+}
@@ -0,0 +1,107 @@
+package services
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Misha-Glazunov/bank-api/internal/models"
+	"github.com/Misha-Glazunov/bank-api/pkg/money"
+)
+
+func rub(amount string) money.Money {
+	m, err := money.Parse(amount, "RUB")
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// Сумма основного долга по графику
+func totalPrincipal(lines []scheduleLine) money.Money {
+	total := money.Zero("RUB")
+	for _, line := range lines {
+		total = total.Add(line.principal)
+	}
+	return total
+}
+
+func TestMonthlyRate(t *testing.T) {
+	assert.Equal(t, big.NewRat(1, 100), monthlyRate(big.NewRat(12, 1)))
+	assert.Equal(t, "0.0175", monthlyRate(big.NewRat(21, 1)).FloatString(4))
+}
+
+func TestAnnuityPayment(t *testing.T) {
+	r := monthlyRate(big.NewRat(12, 1))
+	assert.Equal(t, rub("8884.88"), annuityPayment(rub("100000.00"), r, 12))
+	assert.Equal(t, rub("101000.00"), annuityPayment(rub("100000.00"), r, 1))
+
+	// Без процентов платеж — равная доля долга
+	assert.Equal(t, rub("333.33"), annuityPayment(rub("1000.00"), new(big.Rat), 3))
+}
+
+func TestAnnuitySchedule(t *testing.T) {
+	principal := rub("100000.00")
+	r := monthlyRate(big.NewRat(12, 1))
+	lines := buildSchedule(models.LoanScheduleAnnuity, principal, r, 12)
+
+	if !assert.Len(t, lines, 12) {
+		return
+	}
+	assert.Equal(t, scheduleLine{principal: rub("7884.88"), interest: rub("1000.00")}, lines[0])
+	assert.Equal(t, scheduleLine{principal: rub("7963.73"), interest: rub("921.15")}, lines[1])
+	for _, line := range lines[:11] {
+		assert.Equal(t, rub("8884.88"), line.principal.Add(line.interest))
+	}
+
+	// Последний платеж закрывает остаток, накопленный округлениями
+	assert.Equal(t, scheduleLine{principal: rub("8796.88"), interest: rub("87.97")}, lines[11])
+	assert.Equal(t, principal, totalPrincipal(lines))
+}
+
+func TestAnnuityScheduleLastPaymentRounding(t *testing.T) {
+	lines := buildSchedule(models.LoanScheduleAnnuity, rub("1000.00"), new(big.Rat), 3)
+
+	assert.Equal(t, []scheduleLine{
+		{principal: rub("333.33"), interest: rub("0")},
+		{principal: rub("333.33"), interest: rub("0")},
+		{principal: rub("333.34"), interest: rub("0")},
+	}, lines)
+}
+
+func TestAnnuityScheduleShortensWithLargerPayment(t *testing.T) {
+	// После досрочного погашения с сокращением срока платеж прежний, срок короче
+	r := monthlyRate(big.NewRat(12, 1))
+	lines := annuitySchedule(rub("10000.00"), r, rub("4000.00"), 12)
+
+	assert.Equal(t, []scheduleLine{
+		{principal: rub("3900.00"), interest: rub("100.00")},
+		{principal: rub("3939.00"), interest: rub("61.00")},
+		{principal: rub("2161.00"), interest: rub("21.61")},
+	}, lines)
+}
+
+func TestDifferentiatedSchedule(t *testing.T) {
+	r := monthlyRate(big.NewRat(12, 1))
+	lines := buildSchedule(models.LoanScheduleDifferentiated, rub("1000.00"), r, 3)
+
+	assert.Equal(t, []scheduleLine{
+		{principal: rub("333.33"), interest: rub("10.00")},
+		{principal: rub("333.33"), interest: rub("6.67")},
+		{principal: rub("333.34"), interest: rub("3.33")},
+	}, lines)
+}
+
+func TestInstallmentDates(t *testing.T) {
+	disbursed := time.Date(2025, time.January, 31, 10, 30, 0, 0, time.UTC)
+	dates := installmentDates(disbursed, 4)
+
+	assert.Equal(t, []time.Time{
+		time.Date(2025, time.February, 28, 10, 30, 0, 0, time.UTC),
+		time.Date(2025, time.March, 31, 10, 30, 0, 0, time.UTC),
+		time.Date(2025, time.April, 30, 10, 30, 0, 0, time.UTC),
+		time.Date(2025, time.May, 31, 10, 30, 0, 0, time.UTC),
+	}, dates)
+}
@@ -0,0 +1,609 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/Misha-Glazunov/bank-api/internal/models"
+	"github.com/Misha-Glazunov/bank-api/internal/repositories"
+	"github.com/Misha-Glazunov/bank-api/pkg/money"
+)
+
+// Точность хранения годовых ставок
+const ratePrecision = 4
+
+type loanServiceImpl struct {
+	txManager       repositories.TxManager
+	authorizer      Authorizer
+	accountRepo     repositories.AccountRepository
+	ledgerRepo      repositories.LedgerRepository
+	transactionRepo repositories.TransactionRepository
+	repo            repositories.LoanRepository
+	cbService       CentralBankService
+	batchSize       int
+	logger          *logrus.Logger
+	now             func() time.Time
+}
+
+func NewLoanService(
+	txManager repositories.TxManager,
+	authorizer Authorizer,
+	accountRepo repositories.AccountRepository,
+	ledgerRepo repositories.LedgerRepository,
+	transactionRepo repositories.TransactionRepository,
+	repo repositories.LoanRepository,
+	cbService CentralBankService,
+	batchSize int,
+	logger *logrus.Logger,
+) LoanService {
+	return &loanServiceImpl{
+		txManager:       txManager,
+		authorizer:      authorizer,
+		accountRepo:     accountRepo,
+		ledgerRepo:      ledgerRepo,
+		transactionRepo: transactionRepo,
+		repo:            repo,
+		cbService:       cbService,
+		batchSize:       batchSize,
+		logger:          logger,
+		now:             func() time.Time { return time.Now().UTC() },
+	}
+}
+
+func (s *loanServiceImpl) ListProducts(ctx context.Context) ([]*models.LoanProduct, error) {
+	products, err := s.repo.ListProducts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if products == nil {
+		products = []*models.LoanProduct{}
+	}
+	return products, nil
+}
+
+// Рассматривает заявку и сразу выдает кредит на рублевый счет заемщика.
+// Ставка равна ключевой ставке ЦБ на день выдачи плюс маржа продукта.
+func (s *loanServiceImpl) Apply(ctx context.Context, userID string, app models.LoanApplication) (*models.Loan, error) {
+	if !app.Amount.IsPositive() {
+		return nil, ErrInvalidAmount
+	}
+	if app.ScheduleType == "" {
+		app.ScheduleType = models.LoanScheduleAnnuity
+	}
+	if app.ScheduleType != models.LoanScheduleAnnuity && app.ScheduleType != models.LoanScheduleDifferentiated {
+		return nil, ErrInvalidSchedule
+	}
+
+	product, err := s.repo.GetProduct(ctx, app.ProductCode)
+	if err != nil {
+		if errors.Is(err, repositories.ErrLoanProductNotFound) {
+			return nil, ErrUnsupportedProduct
+		}
+		return nil, err
+	}
+
+	// Кредит выдается только на собственный счет заемщика
+	account, err := s.authorizer.AuthorizeAccountOwner(ctx, userID, app.AccountID)
+	if err != nil {
+		return nil, err
+	}
+	if account.Currency != money.DefaultCurrency {
+		return nil, ErrUnsupportedCurrency
+	}
+	amount, err := inAccountCurrency(app.Amount, account)
+	if err != nil {
+		return nil, err
+	}
+	if amount.LessThan(product.MinAmount) || product.MaxAmount.LessThan(amount) ||
+		app.TermMonths < product.MinTermMonths || app.TermMonths > product.MaxTermMonths {
+		return nil, ErrLoanTermsOutOfRange
+	}
+
+	keyRate, err := s.cbService.GetKeyRate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	margin, ok := new(big.Rat).SetString(product.Margin)
+	if !ok {
+		return nil, fmt.Errorf("invalid margin %q for loan product %s", product.Margin, product.Code)
+	}
+	annualRate := new(big.Rat).Add(keyRate, margin)
+
+	today := s.today()
+	loan := &models.Loan{
+		UserID:           userID,
+		AccountID:        account.ID,
+		ProductCode:      product.Code,
+		Principal:        amount,
+		Outstanding:      amount,
+		Currency:         amount.Currency,
+		KeyRate:          keyRate.FloatString(ratePrecision),
+		AnnualRate:       annualRate.FloatString(ratePrecision),
+		PenaltyRate:      product.PenaltyRate,
+		ScheduleType:     app.ScheduleType,
+		TermMonths:       app.TermMonths,
+		Status:           models.LoanStatusActive,
+		DisbursedOn:      today,
+		PenaltyAccruedOn: today,
+	}
+
+	lines := buildSchedule(loan.ScheduleType, amount, monthlyRate(annualRate), app.TermMonths)
+	dates := installmentDates(today, len(lines))
+
+	err = s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		accounts, err := lockAccounts(ctx, s.accountRepo, account.ID)
+		if err != nil {
+			return err
+		}
+		if accounts[account.ID].IsClosed() {
+			return ErrAccountClosed
+		}
+
+		if err := s.repo.Create(ctx, loan); err != nil {
+			return err
+		}
+		loan.Installments = newInstallments(loan.ID, 1, lines, dates)
+		if err := s.repo.CreateInstallments(ctx, loan.Installments); err != nil {
+			return err
+		}
+
+		portfolio, err := s.ledgerRepo.SystemAccount(ctx, models.SystemAccountLoanPortfolio, loan.Currency)
+		if err != nil {
+			return err
+		}
+		entry := newEntry(models.EntryTypeLoanDisbursement, "Loan disbursement "+loan.ID,
+			debit(portfolio.ID, amount),
+			credit(account.ID, amount),
+		)
+		if err := postEntry(ctx, s.ledgerRepo, entry); err != nil {
+			return fmt.Errorf("loan disbursement posting failed: %w", err)
+		}
+
+		return s.transactionRepo.Create(ctx, &models.Transaction{
+			ToAccount: account.ID,
+			Amount:    amount,
+			Currency:  amount.Currency,
+			Type:      models.TransactionTypeLoanDisbursement,
+			EntryID:   entry.ID,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return loan, nil
+}
+
+func (s *loanServiceImpl) List(ctx context.Context, userID string) ([]*models.Loan, error) {
+	loans, err := s.repo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if loans == nil {
+		loans = []*models.Loan{}
+	}
+	return loans, nil
+}
+
+// Кредит с графиком платежей; доступен только заемщику
+func (s *loanServiceImpl) Get(ctx context.Context, userID, id string) (*models.Loan, error) {
+	loan, err := s.authorize(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	loan.Installments, err = s.repo.ListInstallments(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return loan, nil
+}
+
+// Досрочное погашение: сначала гасится наступившая задолженность,
+// остаток уменьшает основной долг, и будущие платежи пересчитываются
+// с уменьшением платежа или срока. Проценты за текущий период
+// начисляются на остаток долга после погашения.
+func (s *loanServiceImpl) Repay(ctx context.Context, userID, id string, amount money.Money, mode string) (*models.Loan, error) {
+	if !amount.IsPositive() {
+		return nil, ErrInvalidAmount
+	}
+	if mode == "" {
+		mode = models.RepaymentReduceTerm
+	}
+	if mode != models.RepaymentReduceTerm && mode != models.RepaymentReducePayment {
+		return nil, ErrInvalidSchedule
+	}
+	if _, err := s.authorize(ctx, userID, id); err != nil {
+		return nil, err
+	}
+
+	err := s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		loan, installments, err := s.lockLoan(ctx, id)
+		if err != nil {
+			return err
+		}
+		if loan.Status == models.LoanStatusClosed {
+			return ErrLoanClosed
+		}
+
+		today := s.today()
+		s.accruePenalties(loan, installments, today)
+
+		accounts, err := lockAccounts(ctx, s.accountRepo, loan.AccountID)
+		if err != nil {
+			return err
+		}
+		account := accounts[loan.AccountID]
+		if account.IsClosed() {
+			return ErrAccountClosed
+		}
+		if account.IsFrozen() {
+			return ErrAccountFrozen
+		}
+		amount, err := inAccountCurrency(amount, account)
+		if err != nil {
+			return err
+		}
+		if account.AvailableBalance.LessThan(amount) {
+			return ErrInsufficientFunds
+		}
+
+		due := dueInstallments(installments, today)
+		debt := loan.Outstanding
+		for _, inst := range due {
+			penalty, interest, _ := inst.Due()
+			debt = debt.Add(penalty).Add(interest)
+		}
+		if debt.LessThan(amount) {
+			return ErrRepaymentExceedsDebt
+		}
+
+		penalty, interest, principal := s.allocate(due, amount)
+		prepaid := amount.Sub(penalty).Sub(interest).Sub(principal)
+		loan.Outstanding = loan.Outstanding.Sub(principal).Sub(prepaid)
+
+		if err := s.postRepayment(ctx, loan, penalty, interest, principal.Add(prepaid)); err != nil {
+			return err
+		}
+		if err := s.saveInstallments(ctx, due); err != nil {
+			return err
+		}
+		if prepaid.IsPositive() {
+			if err := s.reschedule(ctx, loan, installments, today, mode); err != nil {
+				return err
+			}
+		}
+		return s.closeIfRepaid(ctx, loan)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(ctx, userID, id)
+}
+
+// Начисляет неустойку по просроченным платежам и списывает наступившие платежи
+// со счета заемщика в пределах положительного остатка
+func (s *loanServiceImpl) ProcessDue(ctx context.Context) error {
+	today := s.today()
+	ids, err := s.repo.ListWithDueInstallments(ctx, today, s.batchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := s.collect(ctx, id, today); err != nil {
+			s.logger.WithFields(logrus.Fields{
+				"loan_id": id,
+			}).Errorf("Loan installment collection failed: %v", err)
+		}
+	}
+	return nil
+}
+
+func (s *loanServiceImpl) collect(ctx context.Context, id string, today time.Time) error {
+	return s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		loan, installments, err := s.lockLoan(ctx, id)
+		if err != nil {
+			return err
+		}
+		if loan.Status == models.LoanStatusClosed {
+			return nil
+		}
+
+		s.accruePenalties(loan, installments, today)
+		due := dueInstallments(installments, today)
+
+		accounts, err := lockAccounts(ctx, s.accountRepo, loan.AccountID)
+		if err != nil {
+			return err
+		}
+		account := accounts[loan.AccountID]
+
+		// Автоматическое списание не уводит счет в овердрафт
+		if !account.IsClosed() && account.AvailableBalance.IsPositive() {
+			penalty, interest, principal := s.allocate(due, account.AvailableBalance)
+			paid := penalty.Add(interest).Add(principal)
+			if paid.IsPositive() {
+				loan.Outstanding = loan.Outstanding.Sub(principal)
+				if err := s.postRepayment(ctx, loan, penalty, interest, principal); err != nil {
+					return err
+				}
+				s.logger.WithFields(logrus.Fields{
+					"loan_id": loan.ID,
+					"amount":  paid.String(),
+				}).Info("Loan installment collected")
+			}
+		}
+
+		if err := s.saveInstallments(ctx, due); err != nil {
+			return err
+		}
+		return s.closeIfRepaid(ctx, loan)
+	})
+}
+
+// Неустойка за каждый полный день просрочки на непогашенные проценты и основной долг.
+// Повторный вызов в тот же день ничего не начисляет.
+func (s *loanServiceImpl) accruePenalties(loan *models.Loan, installments []*models.LoanInstallment, today time.Time) {
+	if !loan.PenaltyAccruedOn.Before(today) {
+		return
+	}
+
+	rate, ok := new(big.Rat).SetString(loan.PenaltyRate)
+	if !ok {
+		rate = new(big.Rat)
+	}
+	daily := new(big.Rat).Quo(rate, big.NewRat(36500, 1))
+
+	for _, inst := range installments {
+		if inst.Status == models.InstallmentPaid || !inst.DueDate.Before(today) {
+			continue
+		}
+		inst.Status = models.InstallmentOverdue
+
+		from := loan.PenaltyAccruedOn
+		if from.Before(inst.DueDate) {
+			from = inst.DueDate
+		}
+		days := int64(today.Sub(from).Hours() / 24)
+		if days <= 0 {
+			continue
+		}
+
+		_, interest, principal := inst.Due()
+		base := interest.Add(principal)
+		factor := new(big.Rat).Mul(daily, big.NewRat(days, 1))
+		inst.Penalty = inst.Penalty.Add(base.MulRat(factor, money.RoundHalfUp))
+	}
+	loan.PenaltyAccruedOn = today
+}
+
+// Распределяет сумму по наступившим платежам от старых к новым:
+// неустойка, затем проценты, затем основной долг
+func (s *loanServiceImpl) allocate(due []*models.LoanInstallment, budget money.Money) (penalty, interest, principal money.Money) {
+	currency := budget.Currency
+	penalty, interest, principal = money.Zero(currency), money.Zero(currency), money.Zero(currency)
+	now := s.now()
+
+	take := func(owed money.Money) money.Money {
+		if budget.LessThan(owed) {
+			owed = budget
+		}
+		budget = budget.Sub(owed)
+		return owed
+	}
+
+	for _, inst := range due {
+		duePenalty, dueInterest, duePrincipal := inst.Due()
+
+		paid := take(duePenalty)
+		inst.PaidPenalty = inst.PaidPenalty.Add(paid)
+		penalty = penalty.Add(paid)
+
+		paid = take(dueInterest)
+		inst.PaidInterest = inst.PaidInterest.Add(paid)
+		interest = interest.Add(paid)
+
+		paid = take(duePrincipal)
+		inst.PaidPrincipal = inst.PaidPrincipal.Add(paid)
+		principal = principal.Add(paid)
+
+		if p, i, d := inst.Due(); p.IsZero() && i.IsZero() && d.IsZero() {
+			inst.Status = models.InstallmentPaid
+			inst.PaidAt = &now
+		}
+	}
+	return penalty, interest, principal
+}
+
+// Пересчитывает будущие платежи по остатку долга после досрочного погашения
+func (s *loanServiceImpl) reschedule(ctx context.Context, loan *models.Loan, installments []*models.LoanInstallment, today time.Time, mode string) error {
+	var future []*models.LoanInstallment
+	for _, inst := range installments {
+		if inst.DueDate.After(today) && inst.Status == models.InstallmentPending {
+			future = append(future, inst)
+		}
+	}
+	if len(future) == 0 {
+		return nil
+	}
+
+	if err := s.repo.DeleteInstallmentsAfter(ctx, loan.ID, today); err != nil {
+		return err
+	}
+	if !loan.Outstanding.IsPositive() {
+		return nil
+	}
+
+	annualRate, ok := new(big.Rat).SetString(loan.AnnualRate)
+	if !ok {
+		return fmt.Errorf("invalid annual rate %q for loan %s", loan.AnnualRate, loan.ID)
+	}
+	r := monthlyRate(annualRate)
+
+	var lines []scheduleLine
+	switch {
+	case mode == models.RepaymentReducePayment:
+		lines = buildSchedule(loan.ScheduleType, loan.Outstanding, r, len(future))
+	case loan.ScheduleType == models.LoanScheduleDifferentiated:
+		lines = differentiatedSchedule(loan.Outstanding, r, future[0].Principal, len(future))
+	default:
+		payment := future[0].Principal.Add(future[0].Interest)
+		lines = annuitySchedule(loan.Outstanding, r, payment, len(future))
+	}
+
+	dates := make([]time.Time, 0, len(lines))
+	for i := range lines {
+		dates = append(dates, future[i].DueDate)
+	}
+	return s.repo.CreateInstallments(ctx, newInstallments(loan.ID, future[0].Number, lines, dates))
+}
+
+// Проводка погашения: списание со счета заемщика и зачисление на счета
+// кредитного портфеля, процентных доходов и доходов от неустоек
+func (s *loanServiceImpl) postRepayment(ctx context.Context, loan *models.Loan, penalty, interest, principal money.Money) error {
+	total := penalty.Add(interest).Add(principal)
+	postings := []models.Posting{debit(loan.AccountID, total)}
+	for _, part := range []struct {
+		code   string
+		amount money.Money
+	}{
+		{models.SystemAccountLoanPortfolio, principal},
+		{models.SystemAccountInterestIncome, interest},
+		{models.SystemAccountPenaltyIncome, penalty},
+	} {
+		if !part.amount.IsPositive() {
+			continue
+		}
+		system, err := s.ledgerRepo.SystemAccount(ctx, part.code, loan.Currency)
+		if err != nil {
+			return err
+		}
+		postings = append(postings, credit(system.ID, part.amount))
+	}
+
+	entry := newEntry(models.EntryTypeLoanRepayment, "Loan repayment "+loan.ID, postings...)
+	if err := postEntry(ctx, s.ledgerRepo, entry); err != nil {
+		return fmt.Errorf("loan repayment posting failed: %w", err)
+	}
+
+	return s.transactionRepo.Create(ctx, &models.Transaction{
+		FromAccount: loan.AccountID,
+		Amount:      total,
+		Currency:    total.Currency,
+		Type:        models.TransactionTypeLoanRepayment,
+		EntryID:     entry.ID,
+	})
+}
+
+func (s *loanServiceImpl) saveInstallments(ctx context.Context, installments []*models.LoanInstallment) error {
+	for _, inst := range installments {
+		if err := s.repo.UpdateInstallment(ctx, inst); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Закрывает кредит, когда основной долг погашен и наступивших платежей не осталось
+func (s *loanServiceImpl) closeIfRepaid(ctx context.Context, loan *models.Loan) error {
+	if !loan.Outstanding.IsPositive() {
+		installments, err := s.repo.ListInstallments(ctx, loan.ID)
+		if err != nil {
+			return err
+		}
+
+		repaid := true
+		for _, inst := range installments {
+			if inst.Status != models.InstallmentPaid {
+				repaid = false
+				break
+			}
+		}
+		if repaid {
+			now := s.now()
+			loan.Status = models.LoanStatusClosed
+			loan.ClosedAt = &now
+		}
+	}
+	return s.repo.Update(ctx, loan)
+}
+
+func (s *loanServiceImpl) authorize(ctx context.Context, userID, id string) (*models.Loan, error) {
+	loan, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, repositories.ErrLoanNotFound) {
+			return nil, ErrLoanNotFound
+		}
+		return nil, err
+	}
+
+	if loan.UserID != userID {
+		s.logger.WithFields(logrus.Fields{
+			"user_id": userID,
+			"loan_id": id,
+		}).Warn("Loan access denied")
+		return nil, ErrAccessDenied
+	}
+	return loan, nil
+}
+
+// Блокирует кредит и читает его график; вызывается внутри транзакции
+func (s *loanServiceImpl) lockLoan(ctx context.Context, id string) (*models.Loan, []*models.LoanInstallment, error) {
+	loan, err := s.repo.GetByIDForUpdate(ctx, id)
+	if err != nil {
+		if errors.Is(err, repositories.ErrLoanNotFound) {
+			return nil, nil, ErrLoanNotFound
+		}
+		return nil, nil, err
+	}
+
+	installments, err := s.repo.ListInstallments(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	return loan, installments, nil
+}
+
+func (s *loanServiceImpl) today() time.Time {
+	now := s.now()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// Непогашенные платежи с наступившей датой
+func dueInstallments(installments []*models.LoanInstallment, today time.Time) []*models.LoanInstallment {
+	var due []*models.LoanInstallment
+	for _, inst := range installments {
+		if inst.Status != models.InstallmentPaid && !inst.DueDate.After(today) {
+			due = append(due, inst)
+		}
+	}
+	return due
+}
+
+func newInstallments(loanID string, firstNumber int, lines []scheduleLine, dates []time.Time) []*models.LoanInstallment {
+	installments := make([]*models.LoanInstallment, 0, len(lines))
+	for i, line := range lines {
+		zero := money.Zero(line.principal.Currency)
+		installments = append(installments, &models.LoanInstallment{
+			LoanID:        loanID,
+			Number:        firstNumber + i,
+			DueDate:       dates[i],
+			Principal:     line.principal,
+			Interest:      line.interest,
+			Penalty:       zero,
+			PaidPrincipal: zero,
+			PaidInterest:  zero,
+			PaidPenalty:   zero,
+			Status:        models.InstallmentPending,
+		})
+	}
+	return installments
+}
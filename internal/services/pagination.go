@@ -0,0 +1,58 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	"github.com/Misha-Glazunov/bank-api/internal/models"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 100
+)
+
+// Содержимое курсора: сортировка, для которой он выдан, и ключ последней записи
+type transactionCursor struct {
+	SortBy   string `json:"s"`
+	SortDesc bool   `json:"d"`
+	Value    string `json:"v"`
+	ID       string `json:"id"`
+}
+
+func encodeCursor(filter models.TransactionFilter, last *models.Transaction) string {
+	c := transactionCursor{
+		SortBy:   filter.SortBy,
+		SortDesc: filter.SortDesc,
+		ID:       last.ID,
+	}
+	if filter.SortBy == models.TransactionSortAmount {
+		c.Value = last.Amount.String()
+	} else {
+		c.Value = last.CreatedAt.Format(time.RFC3339Nano)
+	}
+
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// Переносит ключ из курсора в фильтр; курсор должен соответствовать текущей сортировке
+func decodeCursor(cursor string, filter *models.TransactionFilter) error {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return ErrInvalidCursor
+	}
+
+	var c transactionCursor
+	if err := json.Unmarshal(raw, &c); err != nil || c.ID == "" {
+		return ErrInvalidCursor
+	}
+	if c.SortBy != filter.SortBy || c.SortDesc != filter.SortDesc {
+		return ErrInvalidCursor
+	}
+
+	filter.AfterValue = c.Value
+	filter.AfterID = c.ID
+	return nil
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/beevik/etree"
+
+	"github.com/Misha-Glazunov/bank-api/internal/models"
+	"github.com/Misha-Glazunov/bank-api/pkg/money"
+)
+
+// Пространство имен pain.001 без номера версии: принимаются 001.001.03 и более поздние
+const pain001NamespacePrefix = "urn:iso:std:iso:20022:tech:xsd:pain.001.001."
+
+// Разбирает XML pain.001 (CustomerCreditTransferInitiation). Проверки сумм
+// и идентификаторов выполняются отдельно, чтобы вернуть отчет pain.002.
+func parsePain001(raw []byte) (*models.BulkPayment, error) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(raw); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPaymentFile, err)
+	}
+
+	root := doc.Root()
+	if root == nil || root.Tag != "Document" || !strings.HasPrefix(root.NamespaceURI(), pain001NamespacePrefix) {
+		return nil, fmt.Errorf("%w: not a pain.001 document", ErrInvalidPaymentFile)
+	}
+	initiation := root.SelectElement("CstmrCdtTrfInitn")
+	if initiation == nil {
+		return nil, fmt.Errorf("%w: CstmrCdtTrfInitn is missing", ErrInvalidPaymentFile)
+	}
+
+	payment := &models.BulkPayment{
+		MessageID:            elementText(initiation, "GrpHdr/MsgId"),
+		NumberOfTransactions: elementText(initiation, "GrpHdr/NbOfTxs"),
+		ControlSum:           elementText(initiation, "GrpHdr/CtrlSum"),
+	}
+
+	for _, info := range initiation.SelectElements("PmtInf") {
+		instruction := &models.BulkInstruction{
+			PaymentInfoID:        elementText(info, "PmtInfId"),
+			DebtorAccount:        accountIdentifier(info.FindElement("DbtrAcct/Id")),
+			NumberOfTransactions: elementText(info, "NbOfTxs"),
+			ControlSum:           elementText(info, "CtrlSum"),
+		}
+
+		for _, tx := range info.SelectElements("CdtTrfTxInf") {
+			transfer := &models.BulkTransfer{
+				InstructionID:   elementText(tx, "PmtId/InstrId"),
+				EndToEndID:      elementText(tx, "PmtId/EndToEndId"),
+				CreditorAccount: accountIdentifier(tx.FindElement("CdtrAcct/Id")),
+				CreditorName:    elementText(tx, "Cdtr/Nm"),
+				RemittanceInfo:  elementText(tx, "RmtInf/Ustrd"),
+			}
+			if amt := tx.FindElement("Amt/InstdAmt"); amt != nil {
+				currency := amt.SelectAttrValue("Ccy", "")
+				if amount, err := money.Parse(strings.TrimSpace(amt.Text()), currency); err == nil && currency != "" {
+					transfer.Amount = &amount
+				}
+			}
+			instruction.Transfers = append(instruction.Transfers, transfer)
+		}
+
+		payment.Instructions = append(payment.Instructions, instruction)
+	}
+
+	return payment, nil
+}
+
+// Идентификатор счета: IBAN или прочий идентификатор (Othr/Id)
+func accountIdentifier(id *etree.Element) string {
+	if id == nil {
+		return ""
+	}
+	if iban := elementText(id, "IBAN"); iban != "" {
+		return iban
+	}
+	return elementText(id, "Othr/Id")
+}
+
+func elementText(parent *etree.Element, path string) string {
+	if el := parent.FindElement(path); el != nil {
+		return strings.TrimSpace(el.Text())
+	}
+	return ""
+}
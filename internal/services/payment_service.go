@@ -1,40 +1,246 @@
 package services
 
 import (
-    "context"
-    "fmt"
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
 
-    "github.com/Misha-Glazunov/bank-api/internal/models"
-    "github.com/Misha-Glazunov/bank-api/internal/repositories"
+	"github.com/Misha-Glazunov/bank-api/internal/config"
+	"github.com/Misha-Glazunov/bank-api/internal/models"
+	"github.com/Misha-Glazunov/bank-api/internal/repositories"
+	"github.com/Misha-Glazunov/bank-api/pkg/money"
 )
 
 type paymentServiceImpl struct {
-    accountRepo     repositories.AccountRepository
-    transactionRepo repositories.TransactionRepository
+	txManager       repositories.TxManager
+	authorizer      Authorizer
+	accountRepo     repositories.AccountRepository
+	ledgerRepo      repositories.LedgerRepository
+	transactionRepo repositories.TransactionRepository
+	converter       *currencyConverter
+	limits          *limitsEngine
 }
 
 func NewPaymentService(
-    accountRepo repositories.AccountRepository,
-    transactionRepo repositories.TransactionRepository,
+	txManager repositories.TxManager,
+	authorizer Authorizer,
+	accountRepo repositories.AccountRepository,
+	userRepo repositories.UserRepository,
+	ledgerRepo repositories.LedgerRepository,
+	transactionRepo repositories.TransactionRepository,
+	cbService CentralBankService,
+	fxSpreadPercent string,
+	limitRepo repositories.AccountLimitRepository,
+	limits config.LimitsConfig,
 ) PaymentService {
-    return &paymentServiceImpl{
-        accountRepo:     accountRepo,
-        transactionRepo: transactionRepo,
-    }
+	return &paymentServiceImpl{
+		txManager:       txManager,
+		authorizer:      authorizer,
+		accountRepo:     accountRepo,
+		ledgerRepo:      ledgerRepo,
+		transactionRepo: transactionRepo,
+		converter:       newCurrencyConverter(cbService, fxSpreadPercent),
+		limits:          newLimitsEngine(limits, limitRepo, transactionRepo, userRepo),
+	}
 }
 
-func (s *paymentServiceImpl) Transfer(ctx context.Context, fromAccountID, toAccountID string, amount float64) error {
-    if err := s.accountRepo.UpdateBalance(ctx, fromAccountID, -amount); err != nil {
-        return fmt.Errorf("withdrawal failed: %w", err)
-    }
+// Переводит средства между счетами в одной транзакции БД.
+// Оба счета блокируются в порядке возрастания ID, чтобы встречные
+// переводы не приводили к взаимной блокировке. Сумма указывается в валюте
+// счета списания; при разных валютах зачисление конвертируется по курсу ЦБ со спредом.
+// Подтверждение адреса владельцем и автором перевода и лимиты проверяет CheckOutgoing.
+func (s *paymentServiceImpl) Transfer(ctx context.Context, userID, fromAccountID, toAccountID string, amount money.Money) error {
+	if !amount.IsPositive() {
+		return ErrInvalidAmount
+	}
+	if fromAccountID == toAccountID {
+		return ErrSameAccount
+	}
 
-    if err := s.accountRepo.UpdateBalance(ctx, toAccountID, amount); err != nil {
-        s.accountRepo.UpdateBalance(ctx, fromAccountID, amount) // Rollback
-        return fmt.Errorf("deposit failed: %w", err)
-    }
-    return nil
+	// Списывать можно только со своего счета, зачислять — на любой существующий
+	source, err := s.authorizer.AuthorizeAccount(ctx, userID, fromAccountID)
+	if err != nil {
+		return err
+	}
+	destination, err := getDestination(ctx, s.accountRepo, toAccountID)
+	if err != nil {
+		return err
+	}
+
+	// Курс запрашивается до открытия транзакции, чтобы не держать блокировки во время вызова ЦБ
+	var rate *big.Rat
+	if source.Currency != destination.Currency {
+		rate, err = s.converter.Quote(ctx, source.Currency, destination.Currency)
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		// Лимиты считаются по владельцу счета списания
+		if err := s.limits.Lock(ctx, source.UserID); err != nil {
+			return err
+		}
+		accounts, err := lockAccounts(ctx, s.accountRepo, fromAccountID, toAccountID)
+		if err != nil {
+			return err
+		}
+
+		from, to := accounts[fromAccountID], accounts[toAccountID]
+		if from.IsClosed() || to.IsClosed() {
+			return ErrAccountClosed
+		}
+		if from.ProductType == models.ProductTypeTermDeposit {
+			return ErrDepositLocked
+		}
+		amount, err := inAccountCurrency(amount, from)
+		if err != nil {
+			return err
+		}
+
+		ownTransfer := from.UserID == to.UserID
+		if err := s.limits.CheckOutgoing(ctx, userID, from, amount, ownTransfer); err != nil {
+			return err
+		}
+
+		transaction := &models.Transaction{
+			FromAccount: fromAccountID,
+			ToAccount:   toAccountID,
+			Amount:      amount,
+			Currency:    amount.Currency,
+			Type:        models.TransactionTypeTransfer,
+		}
+
+		var entry *models.JournalEntry
+		if rate == nil {
+			entry = newEntry(models.EntryTypeTransfer, "Transfer between accounts",
+				debit(fromAccountID, amount),
+				credit(toAccountID, amount),
+			)
+		} else {
+			converted := convertAmount(amount, rate, to.Currency)
+			if !converted.IsPositive() {
+				return ErrInvalidAmount
+			}
+			entry, err = s.fxEntry(ctx, from, to, amount, converted)
+			if err != nil {
+				return err
+			}
+			transaction.ExchangeRate = rate.FloatString(exchangeRatePrecision)
+			transaction.ConvertedAmount = &converted
+			transaction.ConvertedCurrency = converted.Currency
+		}
+
+		if err := postEntry(ctx, s.ledgerRepo, entry); err != nil {
+			return fmt.Errorf("transfer posting failed: %w", err)
+		}
+
+		transaction.EntryID = entry.ID
+		return s.transactionRepo.Create(ctx, transaction)
+	})
+}
+
+// Запись журнала для перевода с конвертацией: каждая валюта балансируется
+// через валютную позицию банка
+func (s *paymentServiceImpl) fxEntry(ctx context.Context, from, to *models.Account, amount, converted money.Money) (*models.JournalEntry, error) {
+	fromPosition, err := s.ledgerRepo.SystemAccount(ctx, models.SystemAccountFXPosition, from.Currency)
+	if err != nil {
+		return nil, err
+	}
+	toPosition, err := s.ledgerRepo.SystemAccount(ctx, models.SystemAccountFXPosition, to.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	return newEntry(models.EntryTypeTransfer,
+		fmt.Sprintf("Currency exchange %s/%s", from.Currency, to.Currency),
+		debit(from.ID, amount),
+		credit(fromPosition.ID, amount),
+		debit(toPosition.ID, converted),
+		credit(to.ID, converted),
+	), nil
+}
+
+// Возвращает страницу истории операций по счету пользователя
+func (s *paymentServiceImpl) GetTransactions(ctx context.Context, userID, accountID string, filter models.TransactionFilter, cursor string) (*models.TransactionPage, error) {
+	if _, err := s.authorizer.AuthorizeAccount(ctx, userID, accountID); err != nil {
+		return nil, err
+	}
+
+	filter.AccountID = accountID
+	if filter.Limit <= 0 || filter.Limit > maxPageSize {
+		filter.Limit = defaultPageSize
+	}
+	if cursor != "" {
+		if err := decodeCursor(cursor, &filter); err != nil {
+			return nil, err
+		}
+	}
+
+	// Запрашиваем на одну запись больше, чтобы понять, есть ли следующая страница
+	limit := filter.Limit
+	filter.Limit++
+	transactions, err := s.transactionRepo.List(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &models.TransactionPage{Transactions: transactions}
+	if len(transactions) > limit {
+		page.Transactions = transactions[:limit]
+		page.NextCursor = encodeCursor(filter, page.Transactions[limit-1])
+	}
+	if page.Transactions == nil {
+		page.Transactions = []*models.Transaction{}
+	}
+	return page, nil
+}
+
+// Блокирует счета в детерминированном порядке и возвращает их по ID
+func lockAccounts(ctx context.Context, repo repositories.AccountRepository, ids ...string) (map[string]*models.Account, error) {
+	sorted := append([]string(nil), ids...)
+	sort.Strings(sorted)
+
+	accounts := make(map[string]*models.Account, len(sorted))
+	for _, id := range sorted {
+		if _, ok := accounts[id]; ok {
+			continue
+		}
+		account, err := repo.GetByIDForUpdate(ctx, id)
+		if err != nil {
+			if errors.Is(err, repositories.ErrAccountNotFound) {
+				return nil, ErrAccountNotFound
+			}
+			return nil, err
+		}
+		accounts[id] = account
+	}
+	return accounts, nil
+}
+
+// Счет зачисления перевода. Внутренние счета банка (без владельца)
+// не могут быть получателями и считаются несуществующими.
+func getDestination(ctx context.Context, accountRepo repositories.AccountRepository, accountID string) (*models.Account, error) {
+	account, err := accountRepo.GetByID(ctx, accountID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrAccountNotFound) {
+			return nil, ErrDestinationNotFound
+		}
+		return nil, err
+	}
+	if account.UserID == "" {
+		return nil, ErrDestinationNotFound
+	}
+	return account, nil
 }
 
-func (s *paymentServiceImpl) GetTransactions(ctx context.Context, accountID string) ([]*models.Transaction, error) {
-    return s.transactionRepo.GetByAccountID(ctx, accountID)
+// Приводит сумму к валюте счета; сумма без валюты считается суммой в валюте счета
+func inAccountCurrency(amount money.Money, account *models.Account) (money.Money, error) {
+	if amount.Currency != "" && amount.Currency != account.Currency {
+		return money.Money{}, ErrCurrencyMismatch
+	}
+	amount.Currency = account.Currency
+	return amount, nil
 }
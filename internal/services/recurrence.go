@@ -0,0 +1,45 @@
+package services
+
+import (
+	"time"
+
+	"github.com/Misha-Glazunov/bank-api/internal/models"
+	"github.com/Misha-Glazunov/bank-api/pkg/utils"
+)
+
+// Первая дата исполнения не раньше start
+func firstOccurrence(recurrence string, day int, start time.Time) time.Time {
+	switch recurrence {
+	case models.RecurrenceMonthly, models.RecurrenceMonthEnd:
+		first := occurrenceInMonth(recurrence, day, start, start)
+		if first.Before(start) {
+			first = occurrenceInMonth(recurrence, day, utils.BeginningOfMonth(start).AddDate(0, 1, 0), start)
+		}
+		return first
+	}
+	return start
+}
+
+// Следующая дата исполнения после t; для разового перевода — нулевое время
+func nextOccurrence(recurrence string, day int, t time.Time) time.Time {
+	switch recurrence {
+	case models.RecurrenceDaily:
+		return t.AddDate(0, 0, 1)
+	case models.RecurrenceWeekly:
+		return t.AddDate(0, 0, 7)
+	case models.RecurrenceMonthly, models.RecurrenceMonthEnd:
+		return occurrenceInMonth(recurrence, day, utils.BeginningOfMonth(t).AddDate(0, 1, 0), t)
+	}
+	return time.Time{}
+}
+
+// Дата исполнения в месяце month со временем суток из clock.
+// День N, которого нет в коротком месяце, переносится на последний день месяца.
+func occurrenceInMonth(recurrence string, day int, month, clock time.Time) time.Time {
+	last := utils.EndOfMonth(month)
+	if recurrence == models.RecurrenceMonthly && day < last.Day() {
+		last = time.Date(month.Year(), month.Month(), day, 0, 0, 0, 0, month.Location())
+	}
+	return time.Date(last.Year(), last.Month(), last.Day(),
+		clock.Hour(), clock.Minute(), clock.Second(), 0, clock.Location())
+}
@@ -0,0 +1,432 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/Misha-Glazunov/bank-api/internal/config"
+	"github.com/Misha-Glazunov/bank-api/internal/models"
+	"github.com/Misha-Glazunov/bank-api/internal/repositories"
+)
+
+var recurrences = map[string]bool{
+	models.RecurrenceOnce:     true,
+	models.RecurrenceDaily:    true,
+	models.RecurrenceWeekly:   true,
+	models.RecurrenceMonthly:  true,
+	models.RecurrenceMonthEnd: true,
+}
+
+type scheduledPaymentServiceImpl struct {
+	txManager   repositories.TxManager
+	authorizer  Authorizer
+	accountRepo repositories.AccountRepository
+	repo        repositories.ScheduledPaymentRepository
+	payments    PaymentService
+	policy      config.SchedulerConfig
+	logger      *logrus.Logger
+	now         func() time.Time
+}
+
+func NewScheduledPaymentService(
+	txManager repositories.TxManager,
+	authorizer Authorizer,
+	accountRepo repositories.AccountRepository,
+	repo repositories.ScheduledPaymentRepository,
+	payments PaymentService,
+	policy config.SchedulerConfig,
+	logger *logrus.Logger,
+) ScheduledPaymentService {
+	return &scheduledPaymentServiceImpl{
+		txManager:   txManager,
+		authorizer:  authorizer,
+		accountRepo: accountRepo,
+		repo:        repo,
+		payments:    payments,
+		policy:      policy,
+		logger:      logger,
+		now:         func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Создает отложенный или регулярный перевод. Разовый перевод требует даты в будущем,
+// регулярный без даты начинается немедленно.
+func (s *scheduledPaymentServiceImpl) Create(ctx context.Context, userID string, payment *models.ScheduledPayment) (*models.ScheduledPayment, error) {
+	if !payment.Amount.IsPositive() {
+		return nil, ErrInvalidAmount
+	}
+	if payment.FromAccount == payment.ToAccount {
+		return nil, ErrSameAccount
+	}
+	if !recurrences[payment.Recurrence] {
+		return nil, ErrInvalidSchedule
+	}
+	if (payment.Recurrence == models.RecurrenceMonthly) != (payment.DayOfMonth != 0) ||
+		payment.DayOfMonth < 0 || payment.DayOfMonth > 31 {
+		return nil, ErrInvalidSchedule
+	}
+
+	now := s.now()
+	start := payment.ScheduledFor.UTC()
+	if start.IsZero() {
+		if payment.Recurrence == models.RecurrenceOnce {
+			return nil, ErrInvalidSchedule
+		}
+		start = now
+	}
+	if start.Before(now) {
+		return nil, ErrInvalidSchedule
+	}
+	// Расписание хранится с точностью до секунды
+	start = start.Truncate(time.Second)
+
+	source, err := s.authorizer.AuthorizeAccount(ctx, userID, payment.FromAccount)
+	if err != nil {
+		return nil, err
+	}
+	if source.IsClosed() {
+		return nil, ErrAccountClosed
+	}
+	if source.ProductType == models.ProductTypeTermDeposit {
+		return nil, ErrDepositLocked
+	}
+	if _, err := getDestination(ctx, s.accountRepo, payment.ToAccount); err != nil {
+		return nil, err
+	}
+	amount, err := inAccountCurrency(payment.Amount, source)
+	if err != nil {
+		return nil, err
+	}
+
+	first := firstOccurrence(payment.Recurrence, payment.DayOfMonth, start)
+	if payment.EndAt != nil && payment.EndAt.Before(first) {
+		return nil, ErrInvalidSchedule
+	}
+
+	created := &models.ScheduledPayment{
+		UserID:       userID,
+		FromAccount:  payment.FromAccount,
+		ToAccount:    payment.ToAccount,
+		Amount:       amount,
+		Currency:     amount.Currency,
+		Recurrence:   payment.Recurrence,
+		DayOfMonth:   payment.DayOfMonth,
+		ScheduledFor: first,
+		NextRunAt:    first,
+		EndAt:        payment.EndAt,
+		Status:       models.ScheduledPaymentActive,
+	}
+	if err := s.repo.Create(ctx, created); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+func (s *scheduledPaymentServiceImpl) List(ctx context.Context, userID string) ([]*models.ScheduledPayment, error) {
+	payments, err := s.repo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if payments == nil {
+		payments = []*models.ScheduledPayment{}
+	}
+	return payments, nil
+}
+
+// Перевод доступен только создавшему его пользователю
+func (s *scheduledPaymentServiceImpl) Get(ctx context.Context, userID, id string) (*models.ScheduledPayment, error) {
+	payment, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, repositories.ErrScheduledPaymentNotFound) {
+			return nil, ErrScheduledPaymentNotFound
+		}
+		return nil, err
+	}
+
+	if payment.UserID != userID {
+		s.logger.WithFields(logrus.Fields{
+			"user_id":              userID,
+			"scheduled_payment_id": id,
+		}).Warn("Scheduled payment access denied")
+		return nil, ErrAccessDenied
+	}
+	return payment, nil
+}
+
+// Меняет сумму, дату окончания или приостанавливает и возобновляет перевод.
+// При возобновлении пропущенные даты регулярного перевода не исполняются.
+func (s *scheduledPaymentServiceImpl) Update(ctx context.Context, userID, id string, update models.ScheduledPaymentUpdate) (*models.ScheduledPayment, error) {
+	if _, err := s.Get(ctx, userID, id); err != nil {
+		return nil, err
+	}
+
+	var updated *models.ScheduledPayment
+	err := s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		payment, err := s.lock(ctx, id)
+		if err != nil {
+			return err
+		}
+		if payment.Status != models.ScheduledPaymentActive && payment.Status != models.ScheduledPaymentPaused {
+			return ErrScheduledPaymentInactive
+		}
+
+		if update.Amount != nil {
+			if !update.Amount.IsPositive() {
+				return ErrInvalidAmount
+			}
+			if update.Amount.Currency != "" && update.Amount.Currency != payment.Currency {
+				return ErrCurrencyMismatch
+			}
+			payment.Amount.Amount = update.Amount.Amount
+		}
+		if update.EndAt != nil {
+			endAt := update.EndAt.UTC()
+			if endAt.Before(payment.ScheduledFor) {
+				return ErrInvalidSchedule
+			}
+			payment.EndAt = &endAt
+		}
+		if update.Status != nil && *update.Status != payment.Status {
+			switch *update.Status {
+			case models.ScheduledPaymentPaused:
+				payment.Status = models.ScheduledPaymentPaused
+			case models.ScheduledPaymentActive:
+				payment.Status = models.ScheduledPaymentActive
+				if payment.Recurrence != models.RecurrenceOnce {
+					s.skipMissed(payment, s.now())
+				}
+			default:
+				return ErrInvalidSchedule
+			}
+		}
+
+		if err := s.repo.Update(ctx, payment); err != nil {
+			return err
+		}
+		updated = payment
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+func (s *scheduledPaymentServiceImpl) Cancel(ctx context.Context, userID, id string) (*models.ScheduledPayment, error) {
+	if _, err := s.Get(ctx, userID, id); err != nil {
+		return nil, err
+	}
+
+	var cancelled *models.ScheduledPayment
+	err := s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		payment, err := s.lock(ctx, id)
+		if err != nil {
+			return err
+		}
+		if payment.Status != models.ScheduledPaymentActive && payment.Status != models.ScheduledPaymentPaused {
+			return ErrScheduledPaymentInactive
+		}
+
+		payment.Status = models.ScheduledPaymentCancelled
+		if err := s.repo.Update(ctx, payment); err != nil {
+			return err
+		}
+		cancelled = payment
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cancelled, nil
+}
+
+func (s *scheduledPaymentServiceImpl) ListRuns(ctx context.Context, userID, id string) ([]*models.ScheduledPaymentRun, error) {
+	if _, err := s.Get(ctx, userID, id); err != nil {
+		return nil, err
+	}
+
+	runs, err := s.repo.ListRuns(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if runs == nil {
+		runs = []*models.ScheduledPaymentRun{}
+	}
+	return runs, nil
+}
+
+// Исполняет переводы, время которых наступило. Каждый перевод исполняется
+// в своей транзакции вместе с записью результата, поэтому он не может
+// пройти дважды, даже если исполнителей несколько.
+func (s *scheduledPaymentServiceImpl) ExecuteDue(ctx context.Context) error {
+	now := s.now()
+	ids, err := s.repo.ListDue(ctx, now, s.policy.BatchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := s.execute(ctx, id, now); err != nil {
+			s.logger.WithFields(logrus.Fields{
+				"scheduled_payment_id": id,
+			}).Errorf("Scheduled payment execution failed: %v", err)
+		}
+	}
+	return nil
+}
+
+func (s *scheduledPaymentServiceImpl) execute(ctx context.Context, id string, now time.Time) error {
+	var claimed *models.ScheduledPayment
+	var transferErr error
+
+	err := s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		payment, err := s.repo.ClaimDue(ctx, id, now)
+		if err != nil {
+			if errors.Is(err, repositories.ErrScheduledPaymentNotFound) {
+				// Перевод уже исполняется другим воркером или перестал быть активным
+				return nil
+			}
+			return err
+		}
+		claimed = payment
+
+		transferErr = s.payments.Transfer(ctx, payment.UserID, payment.FromAccount, payment.ToAccount, payment.Amount)
+		if transferErr != nil {
+			return transferErr
+		}
+		return s.recordOutcome(ctx, payment, nil, now)
+	})
+	if claimed == nil || transferErr == nil {
+		return err
+	}
+	if !isPaymentOutcome(transferErr) {
+		// Внутренняя ошибка: перевод останется к исполнению и будет повторен
+		return transferErr
+	}
+
+	// Перевод отклонен: транзакция откатилась, результат фиксируется отдельно
+	return s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		payment, err := s.repo.ClaimDue(ctx, id, now)
+		if err != nil {
+			if errors.Is(err, repositories.ErrScheduledPaymentNotFound) {
+				return nil
+			}
+			return err
+		}
+		if payment.Attempts != claimed.Attempts || !payment.ScheduledFor.Equal(claimed.ScheduledFor) {
+			return nil
+		}
+		return s.recordOutcome(ctx, payment, transferErr, now)
+	})
+}
+
+// Записывает результат попытки и переводит расписание на следующий шаг.
+// Нехватка средств повторяется по политике, отказ по счету останавливает перевод,
+// остальные отказы пропускают текущую дату.
+func (s *scheduledPaymentServiceImpl) recordOutcome(ctx context.Context, payment *models.ScheduledPayment, cause error, now time.Time) error {
+	run := &models.ScheduledPaymentRun{
+		ScheduledPaymentID: payment.ID,
+		ScheduledFor:       payment.ScheduledFor,
+		Attempt:            payment.Attempts + 1,
+		Status:             models.ScheduledRunSucceeded,
+	}
+	payment.LastError = ""
+
+	if cause != nil {
+		run.Error = cause.Error()
+		payment.LastError = cause.Error()
+
+		switch {
+		case isRetryable(cause) && payment.Attempts < s.policy.MaxRetries:
+			run.Status = models.ScheduledRunRetrying
+			payment.Attempts++
+			payment.NextRunAt = now.Add(s.policy.RetryDelay)
+		case isPermanent(cause):
+			run.Status = models.ScheduledRunFailed
+			payment.Status = models.ScheduledPaymentFailed
+		default:
+			run.Status = models.ScheduledRunFailed
+		}
+	}
+
+	if run.Status != models.ScheduledRunRetrying && payment.Status == models.ScheduledPaymentActive {
+		s.advance(payment, now)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"scheduled_payment_id": payment.ID,
+		"attempt":              run.Attempt,
+		"status":               run.Status,
+	}).Info("Scheduled payment processed")
+
+	if err := s.repo.CreateRun(ctx, run); err != nil {
+		return err
+	}
+	return s.repo.Update(ctx, payment)
+}
+
+// Переходит к следующей дате; разовый перевод и перевод после даты окончания завершаются
+func (s *scheduledPaymentServiceImpl) advance(payment *models.ScheduledPayment, now time.Time) {
+	payment.Attempts = 0
+	next := nextOccurrence(payment.Recurrence, payment.DayOfMonth, payment.ScheduledFor)
+	for !next.IsZero() && !next.After(now) {
+		next = nextOccurrence(payment.Recurrence, payment.DayOfMonth, next)
+	}
+
+	if next.IsZero() || (payment.EndAt != nil && next.After(*payment.EndAt)) {
+		payment.Status = models.ScheduledPaymentCompleted
+		return
+	}
+	payment.ScheduledFor = next
+	payment.NextRunAt = next
+}
+
+// Пропускает даты, прошедшие за время паузы
+func (s *scheduledPaymentServiceImpl) skipMissed(payment *models.ScheduledPayment, now time.Time) {
+	if !payment.ScheduledFor.Before(now) {
+		return
+	}
+	s.advance(payment, now)
+}
+
+func (s *scheduledPaymentServiceImpl) lock(ctx context.Context, id string) (*models.ScheduledPayment, error) {
+	payment, err := s.repo.GetByIDForUpdate(ctx, id)
+	if err != nil {
+		if errors.Is(err, repositories.ErrScheduledPaymentNotFound) {
+			return nil, ErrScheduledPaymentNotFound
+		}
+		return nil, err
+	}
+	return payment, nil
+}
+
+// Отказы, которые фиксируются как результат исполнения, а не как сбой воркера
+func isPaymentOutcome(err error) bool {
+	return isRetryable(err) || isPermanent(err) ||
+		errors.Is(err, ErrLimitExceeded) ||
+		errors.Is(err, ErrEmailNotVerified) ||
+		errors.Is(err, ErrAccountFrozen) ||
+		errors.Is(err, ErrInvalidAmount) ||
+		errors.Is(err, ErrCurrencyMismatch) ||
+		errors.Is(err, ErrUnsupportedCurrencyPair)
+}
+
+func isRetryable(err error) bool {
+	return errors.Is(err, ErrInsufficientFunds) || errors.Is(err, ErrExchangeRateUnavailable)
+}
+
+// Отказы, после которых перевод уже не сможет пройти
+func isPermanent(err error) bool {
+	return errors.Is(err, ErrAccountClosed) ||
+		errors.Is(err, ErrAccessDenied) ||
+		errors.Is(err, ErrAccountNotFound) ||
+		errors.Is(err, ErrDestinationNotFound) ||
+		errors.Is(err, ErrDepositLocked) ||
+		errors.Is(err, ErrPostingRejected)
+}
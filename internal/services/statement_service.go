@@ -0,0 +1,108 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/Misha-Glazunov/bank-api/internal/models"
+	"github.com/Misha-Glazunov/bank-api/internal/repositories"
+	"github.com/Misha-Glazunov/bank-api/pkg/money"
+)
+
+// Максимальная длина периода выписки
+const maxStatementPeriod = 366 * 24 * time.Hour
+
+type statementServiceImpl struct {
+	txManager  repositories.TxManager
+	authorizer Authorizer
+	ledgerRepo repositories.LedgerRepository
+	logger     *logrus.Logger
+	now        func() time.Time
+}
+
+func NewStatementService(
+	txManager repositories.TxManager,
+	authorizer Authorizer,
+	ledgerRepo repositories.LedgerRepository,
+	logger *logrus.Logger,
+) StatementService {
+	return &statementServiceImpl{
+		txManager:  txManager,
+		authorizer: authorizer,
+		ledgerRepo: ledgerRepo,
+		logger:     logger,
+		now:        func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Строит выписку по проводкам журнала за период [from, to).
+// Остатки и строки читаются в одной транзакции, поэтому выписка
+// всегда сходится с балансом счета на границах периода.
+func (s *statementServiceImpl) Generate(ctx context.Context, userID, accountID string, from, to time.Time) (*models.Statement, error) {
+	if !from.Before(to) || to.Sub(from) > maxStatementPeriod {
+		return nil, ErrInvalidPeriod
+	}
+	account, err := s.authorizer.AuthorizeAccount(ctx, userID, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	statement := &models.Statement{
+		AccountID:    account.ID,
+		Currency:     account.Currency,
+		From:         from.UTC(),
+		To:           to.UTC(),
+		TotalCredits: money.Zero(account.Currency),
+		TotalDebits:  money.Zero(account.Currency),
+		GeneratedAt:  s.now(),
+	}
+
+	var closing money.Money
+	err = s.txManager.WithinSnapshot(ctx, func(ctx context.Context) error {
+		var err error
+		if statement.OpeningBalance, err = s.ledgerRepo.BalanceBefore(ctx, accountID, from); err != nil {
+			return err
+		}
+		if statement.Lines, err = s.ledgerRepo.ListAccountPostings(ctx, accountID, from, to); err != nil {
+			return err
+		}
+		closing, err = s.ledgerRepo.BalanceBefore(ctx, accountID, to)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	balance := statement.OpeningBalance
+	for _, line := range statement.Lines {
+		if line.Direction == models.DirectionCredit {
+			balance = balance.Add(line.Amount)
+			statement.TotalCredits = statement.TotalCredits.Add(line.Amount)
+			statement.CreditCount++
+		} else {
+			balance = balance.Sub(line.Amount)
+			statement.TotalDebits = statement.TotalDebits.Add(line.Amount)
+			statement.DebitCount++
+		}
+		line.Balance = balance
+		line.BookedAt = line.BookedAt.UTC()
+	}
+	if statement.Lines == nil {
+		statement.Lines = []*models.StatementLine{}
+	}
+
+	if balance.Cmp(closing) != 0 {
+		s.logger.WithFields(logrus.Fields{
+			"account_id": accountID,
+			"computed":   balance.String(),
+			"ledger":     closing.String(),
+		}).Error("Statement does not reconcile with ledger balance")
+		return nil, fmt.Errorf("statement for account %s does not reconcile: computed %s, ledger %s",
+			accountID, balance, closing)
+	}
+	statement.ClosingBalance = closing
+	return statement, nil
+}
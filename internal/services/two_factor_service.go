@@ -0,0 +1,326 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/Misha-Glazunov/bank-api/internal/config"
+	"github.com/Misha-Glazunov/bank-api/internal/models"
+	"github.com/Misha-Glazunov/bank-api/internal/repositories"
+	"github.com/Misha-Glazunov/bank-api/pkg/money"
+	"github.com/Misha-Glazunov/bank-api/pkg/totp"
+)
+
+const (
+	// Число резервных кодов в наборе
+	backupCodeCount = 10
+	// Длина резервного кода в символах base32 (50 бит)
+	backupCodeLength = 10
+	// Допуск расхождения часов: принимается код соседнего 30-секундного шага
+	totpSkew = 1
+)
+
+var backupCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+type twoFactorServiceImpl struct {
+	txManager     repositories.TxManager
+	userRepo      repositories.UserRepository
+	repo          repositories.TwoFactorRepository
+	verifier      *twoFactorVerifier
+	issuer        string
+	stepUpAmounts map[string]money.Money
+	now           func() time.Time
+}
+
+func NewTwoFactorService(
+	txManager repositories.TxManager,
+	userRepo repositories.UserRepository,
+	repo repositories.TwoFactorRepository,
+	cfg config.TwoFactorConfig,
+	logger *logrus.Logger,
+) TwoFactorService {
+	// Пороги проверены при загрузке конфигурации
+	stepUpAmounts := make(map[string]money.Money, len(cfg.StepUpAmounts))
+	for currency, value := range cfg.StepUpAmounts {
+		stepUpAmounts[currency], _ = money.Parse(value, currency)
+	}
+
+	return &twoFactorServiceImpl{
+		txManager:     txManager,
+		userRepo:      userRepo,
+		repo:          repo,
+		verifier:      newTwoFactorVerifier(txManager, repo, cfg, logger),
+		issuer:        cfg.Issuer,
+		stepUpAmounts: stepUpAmounts,
+		now:           func() time.Time { return time.Now().UTC() },
+	}
+}
+
+func (s *twoFactorServiceImpl) Status(ctx context.Context, userID string) (*models.TwoFactorStatus, error) {
+	secret, err := s.repo.Get(ctx, userID)
+	if err != nil && !errors.Is(err, repositories.ErrTOTPNotFound) {
+		return nil, err
+	}
+	if secret == nil || !secret.IsConfirmed() {
+		return &models.TwoFactorStatus{}, nil
+	}
+
+	remaining, err := s.repo.CountBackupCodes(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &models.TwoFactorStatus{
+		Enabled:              true,
+		EnabledAt:            secret.ConfirmedAt,
+		BackupCodesRemaining: remaining,
+	}, nil
+}
+
+// Создает новый секрет TOTP. Секрет начинает действовать после подтверждения кодом;
+// повторный вызов до подтверждения заменяет секрет.
+func (s *twoFactorServiceImpl) Enroll(ctx context.Context, userID string) (*models.TOTPEnrollment, error) {
+	enabled, err := s.verifier.Enabled(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		return nil, ErrTwoFactorEnabled
+	}
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.SavePending(ctx, userID, secret); err != nil {
+		return nil, err
+	}
+
+	return &models.TOTPEnrollment{
+		Secret: secret,
+		URI:    totp.URI(s.issuer, user.Email, secret),
+	}, nil
+}
+
+// Включает двухфакторную аутентификацию по первому коду из приложения
+// и возвращает набор резервных кодов
+func (s *twoFactorServiceImpl) Confirm(ctx context.Context, userID, code string) (*models.BackupCodes, error) {
+	var codes []string
+	err := s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		secret, err := s.repo.GetForUpdate(ctx, userID)
+		if err != nil {
+			if errors.Is(err, repositories.ErrTOTPNotFound) {
+				return ErrTwoFactorNotEnrolled
+			}
+			return err
+		}
+		if secret.IsConfirmed() {
+			return ErrTwoFactorEnabled
+		}
+
+		step, ok := totp.Validate(secret.Secret, normalizeTwoFactorCode(code), s.now(), totpSkew)
+		if !ok {
+			return ErrInvalidTwoFactorCode
+		}
+		if err := s.repo.Confirm(ctx, userID, step); err != nil {
+			return err
+		}
+
+		codes, err = s.replaceBackupCodes(ctx, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &models.BackupCodes{Codes: codes}, nil
+}
+
+// Отключает двухфакторную аутентификацию; требует действующего кода
+func (s *twoFactorServiceImpl) Disable(ctx context.Context, userID, code string) error {
+	if err := s.verifier.Verify(ctx, userID, code); err != nil {
+		return err
+	}
+	return s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		return s.repo.Delete(ctx, userID)
+	})
+}
+
+// Выдает новый набор резервных кодов взамен прежнего; требует действующего кода
+func (s *twoFactorServiceImpl) RegenerateBackupCodes(ctx context.Context, userID, code string) (*models.BackupCodes, error) {
+	if err := s.verifier.Verify(ctx, userID, code); err != nil {
+		return nil, err
+	}
+
+	var codes []string
+	err := s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		codes, err = s.replaceBackupCodes(ctx, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &models.BackupCodes{Codes: codes}, nil
+}
+
+// Дополнительная проверка кодом перед операцией. Без суммы код требуется всегда,
+// с суммой — начиная с порога для ее валюты; для валюты без порога код требуется
+// при любой сумме. Пользователям без двухфакторной аутентификации код не нужен.
+func (s *twoFactorServiceImpl) StepUp(ctx context.Context, userID, code string, amount *money.Money) error {
+	if amount != nil {
+		if threshold, ok := s.stepUpAmounts[amount.Currency]; ok && amount.LessThan(threshold) {
+			return nil
+		}
+	}
+	enabled, err := s.verifier.Enabled(ctx, userID)
+	if err != nil || !enabled {
+		return err
+	}
+	return s.verifier.Verify(ctx, userID, code)
+}
+
+func (s *twoFactorServiceImpl) replaceBackupCodes(ctx context.Context, userID string) ([]string, error) {
+	codes := make([]string, backupCodeCount)
+	hashes := make([]string, backupCodeCount)
+	for i := range codes {
+		code, err := generateBackupCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+		hashes[i] = hashToken(normalizeTwoFactorCode(code))
+	}
+
+	if err := s.repo.ReplaceBackupCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Проверка второго фактора, общая для входа и подтверждения операций
+type twoFactorVerifier struct {
+	txManager repositories.TxManager
+	repo      repositories.TwoFactorRepository
+	cfg       config.TwoFactorConfig
+	logger    *logrus.Logger
+	now       func() time.Time
+}
+
+func newTwoFactorVerifier(
+	txManager repositories.TxManager,
+	repo repositories.TwoFactorRepository,
+	cfg config.TwoFactorConfig,
+	logger *logrus.Logger,
+) *twoFactorVerifier {
+	return &twoFactorVerifier{
+		txManager: txManager,
+		repo:      repo,
+		cfg:       cfg,
+		logger:    logger,
+		now:       func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Включена ли у пользователя двухфакторная аутентификация
+func (v *twoFactorVerifier) Enabled(ctx context.Context, userID string) (bool, error) {
+	secret, err := v.repo.Get(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrTOTPNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return secret.IsConfirmed(), nil
+}
+
+// Проверяет код TOTP или резервный код. Код TOTP принимается один раз,
+// резервный код после использования удаляется из набора. Неудачная попытка
+// сохраняется, после MaxAttempts ошибок подряд проверки блокируются.
+// Вызывается вне транзакции: иначе откат отменил бы учет ошибки.
+func (v *twoFactorVerifier) Verify(ctx context.Context, userID, code string) error {
+	code = normalizeTwoFactorCode(code)
+	if code == "" {
+		return ErrTwoFactorRequired
+	}
+
+	var failed bool
+	err := v.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		secret, err := v.repo.GetForUpdate(ctx, userID)
+		if err != nil {
+			if errors.Is(err, repositories.ErrTOTPNotFound) {
+				return ErrTwoFactorNotEnabled
+			}
+			return err
+		}
+		if !secret.IsConfirmed() {
+			return ErrTwoFactorNotEnabled
+		}
+
+		now := v.now()
+		if secret.LockedUntil != nil && now.Before(*secret.LockedUntil) {
+			return ErrTooManyTwoFactorAttempts
+		}
+
+		step, ok, err := v.match(ctx, secret, code, now)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return v.repo.RecordUse(ctx, userID, step)
+		}
+
+		failed = true
+		attempts := secret.FailedAttempts + 1
+		var lockedUntil *time.Time
+		if attempts >= v.cfg.MaxAttempts {
+			until := now.Add(v.cfg.LockoutDuration)
+			lockedUntil = &until
+			attempts = 0
+		}
+		return v.repo.RecordFailure(ctx, userID, attempts, lockedUntil)
+	})
+	if err != nil {
+		return err
+	}
+	if failed {
+		v.logger.WithField("user_id", userID).Warn("Invalid two-factor code")
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+// Сверяет код с секретом или с резервными кодами. Для кода TOTP возвращает
+// его шаг; шаги не новее последнего принятого отклоняются как повтор.
+func (v *twoFactorVerifier) match(ctx context.Context, secret *models.TOTP, code string, now time.Time) (int64, bool, error) {
+	if len(code) == totp.Digits {
+		step, ok := totp.Validate(secret.Secret, code, now, totpSkew)
+		return step, ok && step > secret.LastUsedStep, nil
+	}
+	used, err := v.repo.UseBackupCode(ctx, secret.UserID, hashToken(code))
+	return 0, used, err
+}
+
+// Резервный код вида "abcde-fghij"
+func generateBackupCode() (string, error) {
+	raw := make([]byte, 7)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("backup code generation failed: %w", err)
+	}
+	code := strings.ToLower(backupCodeEncoding.EncodeToString(raw))[:backupCodeLength]
+	return code[:backupCodeLength/2] + "-" + code[backupCodeLength/2:], nil
+}
+
+// Код сравнивается без пробелов, дефисов и без учета регистра
+func normalizeTwoFactorCode(code string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(code))
+}
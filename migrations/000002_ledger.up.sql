@@ -0,0 +1,55 @@
+-- Внутренние счета банка (касса, доходы, расходы) не принадлежат пользователю
+ALTER TABLE accounts ADD COLUMN system_code VARCHAR(50);
+CREATE UNIQUE INDEX accounts_system_code_currency_idx
+    ON accounts (system_code, currency) WHERE system_code IS NOT NULL;
+
+CREATE TABLE journal_entries (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    type VARCHAR(30) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    reversal_of UUID UNIQUE REFERENCES journal_entries(id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE postings (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    entry_id UUID NOT NULL REFERENCES journal_entries(id),
+    account_id UUID NOT NULL REFERENCES accounts(id),
+    direction VARCHAR(6) NOT NULL CHECK (direction IN ('debit', 'credit')),
+    amount DECIMAL(15,2) NOT NULL CHECK (amount > 0),
+    currency VARCHAR(3) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX postings_entry_id_idx ON postings (entry_id);
+CREATE INDEX postings_account_id_created_at_idx ON postings (account_id, created_at);
+
+-- Существующие остатки переносятся в журнал вступительными проводками
+DO $$
+DECLARE
+    acc RECORD;
+    opening_id UUID;
+    entry_id UUID;
+BEGIN
+    FOR acc IN
+        SELECT id, balance, currency FROM accounts
+        WHERE system_code IS NULL AND balance <> 0
+    LOOP
+        INSERT INTO accounts (system_code, currency, balance)
+        VALUES ('opening_balance', acc.currency, 0)
+        ON CONFLICT (system_code, currency) WHERE system_code IS NOT NULL DO NOTHING;
+
+        SELECT id INTO opening_id FROM accounts
+        WHERE system_code = 'opening_balance' AND currency = acc.currency;
+
+        INSERT INTO journal_entries (type, description)
+        VALUES ('opening_balance', 'Opening balance')
+        RETURNING id INTO entry_id;
+
+        INSERT INTO postings (entry_id, account_id, direction, amount, currency) VALUES
+            (entry_id, acc.id, CASE WHEN acc.balance > 0 THEN 'credit' ELSE 'debit' END, abs(acc.balance), acc.currency),
+            (entry_id, opening_id, CASE WHEN acc.balance > 0 THEN 'debit' ELSE 'credit' END, abs(acc.balance), acc.currency);
+
+        UPDATE accounts SET balance = balance - acc.balance WHERE id = opening_id;
+    END LOOP;
+END $$;
@@ -0,0 +1,24 @@
+CREATE TABLE cards (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id),
+    number VARCHAR(19) NOT NULL,
+    expiry VARCHAR(5) NOT NULL,
+    cvv_hash TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX cards_user_id_idx ON cards (user_id);
+
+CREATE TABLE transactions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    from_account UUID REFERENCES accounts(id),
+    to_account UUID REFERENCES accounts(id),
+    amount DECIMAL(15,2) NOT NULL CHECK (amount > 0),
+    currency VARCHAR(3) NOT NULL,
+    type VARCHAR(30) NOT NULL,
+    entry_id UUID REFERENCES journal_entries(id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX transactions_from_account_idx ON transactions (from_account, created_at, id);
+CREATE INDEX transactions_to_account_idx ON transactions (to_account, created_at, id);
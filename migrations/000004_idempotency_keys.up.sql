@@ -0,0 +1,14 @@
+-- Сохраненные ответы на запросы с заголовком Idempotency-Key.
+-- response_code IS NULL означает, что запрос еще выполняется.
+CREATE TABLE idempotency_keys (
+    user_id UUID NOT NULL REFERENCES users(id),
+    key VARCHAR(255) NOT NULL,
+    request_hash VARCHAR(64) NOT NULL,
+    response_code INT,
+    response_body BYTEA,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, key)
+);
+
+CREATE INDEX idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
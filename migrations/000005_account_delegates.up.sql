@@ -0,0 +1,9 @@
+-- Пользователи, которым владелец доверил распоряжаться счетом
+CREATE TABLE account_delegates (
+    account_id UUID NOT NULL REFERENCES accounts(id),
+    user_id UUID NOT NULL REFERENCES users(id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (account_id, user_id)
+);
+
+CREATE INDEX account_delegates_user_id_idx ON account_delegates (user_id);
@@ -0,0 +1,4 @@
+ALTER TABLE accounts
+    ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'active',
+    ADD COLUMN product_type VARCHAR(30) NOT NULL DEFAULT 'current',
+    ADD COLUMN closed_at TIMESTAMP;
@@ -0,0 +1,5 @@
+-- Для переводов между счетами в разных валютах сохраняется примененный курс
+ALTER TABLE transactions
+    ADD COLUMN exchange_rate NUMERIC(20,10),
+    ADD COLUMN converted_amount DECIMAL(15,2),
+    ADD COLUMN converted_currency VARCHAR(3);
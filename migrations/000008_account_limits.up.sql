@@ -0,0 +1,9 @@
+-- Индивидуальные лимиты счета; NULL означает значение по умолчанию из конфигурации
+CREATE TABLE account_limits (
+    account_id UUID PRIMARY KEY REFERENCES accounts(id),
+    max_transfer DECIMAL(15,2),
+    overdraft DECIMAL(15,2),
+    daily_outgoing DECIMAL(15,2),
+    monthly_outgoing DECIMAL(15,2),
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
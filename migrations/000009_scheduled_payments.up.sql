@@ -0,0 +1,38 @@
+-- Регулярные и отложенные переводы
+CREATE TABLE scheduled_payments (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id),
+    from_account UUID NOT NULL REFERENCES accounts(id),
+    to_account UUID NOT NULL REFERENCES accounts(id),
+    amount DECIMAL(15,2) NOT NULL CHECK (amount > 0),
+    currency VARCHAR(3) NOT NULL,
+    recurrence VARCHAR(20) NOT NULL
+        CHECK (recurrence IN ('once', 'daily', 'weekly', 'monthly', 'month_end')),
+    day_of_month INT CHECK (day_of_month BETWEEN 1 AND 31),
+    -- Плановая дата текущего исполнения и время следующей попытки (с учетом повторов)
+    scheduled_for TIMESTAMP NOT NULL,
+    next_run_at TIMESTAMP NOT NULL,
+    end_at TIMESTAMP,
+    attempts INT NOT NULL DEFAULT 0,
+    status VARCHAR(20) NOT NULL DEFAULT 'active'
+        CHECK (status IN ('active', 'paused', 'completed', 'cancelled', 'failed')),
+    last_error TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX scheduled_payments_user_id_idx ON scheduled_payments (user_id);
+CREATE INDEX scheduled_payments_due_idx ON scheduled_payments (next_run_at) WHERE status = 'active';
+
+-- Результаты исполнения регулярных переводов
+CREATE TABLE scheduled_payment_runs (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    scheduled_payment_id UUID NOT NULL REFERENCES scheduled_payments(id) ON DELETE CASCADE,
+    scheduled_for TIMESTAMP NOT NULL,
+    attempt INT NOT NULL,
+    status VARCHAR(20) NOT NULL CHECK (status IN ('succeeded', 'retrying', 'failed')),
+    error TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX scheduled_payment_runs_payment_idx ON scheduled_payment_runs (scheduled_payment_id, created_at);
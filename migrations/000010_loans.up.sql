@@ -0,0 +1,58 @@
+-- Кредитные продукты: ставка равна ключевой ставке ЦБ плюс маржа продукта
+CREATE TABLE loan_products (
+    code VARCHAR(30) PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    margin DECIMAL(6,3) NOT NULL CHECK (margin >= 0),
+    min_amount DECIMAL(15,2) NOT NULL CHECK (min_amount > 0),
+    max_amount DECIMAL(15,2) NOT NULL CHECK (max_amount >= min_amount),
+    min_term_months INT NOT NULL CHECK (min_term_months > 0),
+    max_term_months INT NOT NULL CHECK (max_term_months >= min_term_months),
+    -- Годовая ставка неустойки на просроченную задолженность, %
+    penalty_rate DECIMAL(6,3) NOT NULL CHECK (penalty_rate >= 0)
+);
+
+INSERT INTO loan_products (code, name, margin, min_amount, max_amount, min_term_months, max_term_months, penalty_rate) VALUES
+    ('consumer', 'Потребительский кредит', 6.5, 30000, 3000000, 6, 60, 20),
+    ('express', 'Экспресс-кредит', 12, 5000, 300000, 1, 12, 20);
+
+CREATE TABLE loans (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id),
+    account_id UUID NOT NULL REFERENCES accounts(id),
+    product_code VARCHAR(30) NOT NULL REFERENCES loan_products(code),
+    principal DECIMAL(15,2) NOT NULL CHECK (principal > 0),
+    outstanding DECIMAL(15,2) NOT NULL CHECK (outstanding >= 0),
+    currency VARCHAR(3) NOT NULL,
+    key_rate DECIMAL(7,4) NOT NULL,
+    annual_rate DECIMAL(7,4) NOT NULL,
+    penalty_rate DECIMAL(6,3) NOT NULL,
+    schedule_type VARCHAR(20) NOT NULL CHECK (schedule_type IN ('annuity', 'differentiated')),
+    term_months INT NOT NULL CHECK (term_months > 0),
+    status VARCHAR(20) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'closed')),
+    disbursed_on DATE NOT NULL,
+    -- Дата последнего начисления неустойки
+    penalty_accrued_on DATE NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    closed_at TIMESTAMP
+);
+
+CREATE INDEX loans_user_id_idx ON loans (user_id);
+
+-- График платежей
+CREATE TABLE loan_installments (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    loan_id UUID NOT NULL REFERENCES loans(id),
+    number INT NOT NULL,
+    due_date DATE NOT NULL,
+    principal DECIMAL(15,2) NOT NULL CHECK (principal >= 0),
+    interest DECIMAL(15,2) NOT NULL CHECK (interest >= 0),
+    penalty DECIMAL(15,2) NOT NULL DEFAULT 0,
+    paid_principal DECIMAL(15,2) NOT NULL DEFAULT 0,
+    paid_interest DECIMAL(15,2) NOT NULL DEFAULT 0,
+    paid_penalty DECIMAL(15,2) NOT NULL DEFAULT 0,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'overdue', 'paid')),
+    paid_at TIMESTAMP,
+    UNIQUE (loan_id, number)
+);
+
+CREATE INDEX loan_installments_due_idx ON loan_installments (due_date) WHERE status <> 'paid';
@@ -0,0 +1,51 @@
+-- Вклады: срочные и до востребования. Ставка фиксирована
+-- или привязана к ключевой ставке ЦБ через надбавку.
+CREATE TABLE deposit_products (
+    code VARCHAR(30) PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('term', 'on_demand')),
+    rate DECIMAL(7,4) CHECK (rate >= 0),
+    key_rate_margin DECIMAL(7,4),
+    term_months INT CHECK (term_months > 0),
+    min_amount DECIMAL(15,2) NOT NULL DEFAULT 0 CHECK (min_amount >= 0),
+    -- Годовая ставка, по которой пересчитываются проценты при досрочном расторжении, %
+    early_withdrawal_rate DECIMAL(7,4) NOT NULL DEFAULT 0 CHECK (early_withdrawal_rate >= 0),
+    CHECK ((rate IS NULL) <> (key_rate_margin IS NULL)),
+    CHECK ((kind = 'term') = (term_months IS NOT NULL))
+);
+
+INSERT INTO deposit_products (code, name, kind, rate, key_rate_margin, term_months, min_amount, early_withdrawal_rate) VALUES
+    ('savings', 'Накопительный счет', 'on_demand', NULL, -2, NULL, 0, 0),
+    ('term_6m', 'Вклад на 6 месяцев', 'term', NULL, -1, 6, 10000, 0.01),
+    ('term_12m', 'Вклад на 12 месяцев', 'term', 16, NULL, 12, 10000, 0.01);
+
+CREATE TABLE deposits (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id),
+    account_id UUID NOT NULL UNIQUE REFERENCES accounts(id),
+    product_code VARCHAR(30) NOT NULL REFERENCES deposit_products(code),
+    annual_rate DECIMAL(7,4) NOT NULL,
+    opened_on DATE NOT NULL,
+    matures_on DATE,
+    status VARCHAR(20) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'matured', 'closed')),
+    -- Начисленные, но еще не капитализированные проценты с долями копеек
+    accrued DECIMAL(20,6) NOT NULL DEFAULT 0,
+    interest_paid DECIMAL(15,2) NOT NULL DEFAULT 0,
+    -- Последний день, за который начислены проценты
+    last_accrued_on DATE NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    closed_at TIMESTAMP
+);
+
+CREATE INDEX deposits_user_id_idx ON deposits (user_id);
+CREATE INDEX deposits_active_idx ON deposits (last_accrued_on) WHERE status = 'active';
+
+-- Ежедневные начисления; первичный ключ исключает повторное начисление за день
+CREATE TABLE deposit_accruals (
+    deposit_id UUID NOT NULL REFERENCES deposits(id) ON DELETE CASCADE,
+    accrual_date DATE NOT NULL,
+    balance DECIMAL(15,2) NOT NULL,
+    annual_rate DECIMAL(7,4) NOT NULL,
+    amount DECIMAL(20,6) NOT NULL,
+    PRIMARY KEY (deposit_id, accrual_date)
+);
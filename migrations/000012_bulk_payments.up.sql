@@ -0,0 +1,12 @@
+-- Импортированные пакеты pain.001; идентификатор сообщения уникален для пользователя
+CREATE TABLE bulk_payment_batches (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id),
+    message_id VARCHAR(35) NOT NULL,
+    mode VARCHAR(20) NOT NULL CHECK (mode IN ('all_or_nothing', 'best_effort')),
+    status VARCHAR(4) NOT NULL,
+    number_of_transactions INT NOT NULL,
+    control_sum DECIMAL(18,2) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, message_id)
+);
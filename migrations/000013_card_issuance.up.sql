@@ -0,0 +1,47 @@
+ALTER TABLE cards ADD COLUMN payment_system VARCHAR(20);
+
+-- До генерации номеров все карты выпускались с тестовым номером 4111111111111111.
+-- Повторяющимся номерам назначаются уникальные номера Visa с контрольной цифрой по Луну.
+DO $$
+DECLARE
+    card RECORD;
+    payload TEXT;
+    candidate TEXT;
+    digit INT;
+    total INT;
+BEGIN
+    FOR card IN
+        SELECT id FROM cards
+        WHERE number IN (SELECT number FROM cards GROUP BY number HAVING COUNT(*) > 1)
+    LOOP
+        LOOP
+            payload := '427600' || lpad((floor(random() * 1000000000))::BIGINT::TEXT, 9, '0');
+            total := 0;
+            FOR i IN 1..15 LOOP
+                digit := substr(payload, 16 - i, 1)::INT;
+                IF i % 2 = 1 THEN
+                    digit := digit * 2;
+                    IF digit > 9 THEN
+                        digit := digit - 9;
+                    END IF;
+                END IF;
+                total := total + digit;
+            END LOOP;
+            candidate := payload || ((10 - total % 10) % 10)::TEXT;
+            EXIT WHEN NOT EXISTS (SELECT 1 FROM cards WHERE number = candidate);
+        END LOOP;
+
+        UPDATE cards SET number = candidate WHERE id = card.id;
+    END LOOP;
+END $$;
+
+UPDATE cards SET payment_system = CASE
+    WHEN substr(number, 1, 4)::INT BETWEEN 2200 AND 2204 THEN 'mir'
+    WHEN substr(number, 1, 1) = '4' THEN 'visa'
+    ELSE 'mastercard'
+END;
+
+ALTER TABLE cards ALTER COLUMN payment_system SET NOT NULL;
+
+-- Уникальность номера гарантируется базой; при коллизии сервис генерирует новый номер
+CREATE UNIQUE INDEX cards_number_key ON cards (number);
@@ -0,0 +1,21 @@
+-- Номера карт хранятся зашифрованными (AES-GCM) со слепым индексом HMAC-SHA256
+-- для поиска и проверки уникальности. Шифрование требует ключа приложения,
+-- поэтому существующие открытые номера шифрует сервис при запуске.
+ALTER TABLE cards
+    ADD COLUMN number_encrypted TEXT,
+    ADD COLUMN number_hash CHAR(64),
+    ADD COLUMN number_masked VARCHAR(19);
+
+ALTER TABLE cards ALTER COLUMN number DROP NOT NULL;
+
+UPDATE cards SET number_masked = substr(number, 1, 6) || repeat('*', length(number) - 10) || right(number, 4);
+
+ALTER TABLE cards ALTER COLUMN number_masked SET NOT NULL;
+
+CREATE UNIQUE INDEX cards_number_hash_key ON cards (number_hash);
+
+-- Строка хранит либо открытый номер до шифрования, либо шифротекст с индексом
+ALTER TABLE cards ADD CONSTRAINT cards_number_protected_check CHECK (
+    (number IS NOT NULL AND number_encrypted IS NULL AND number_hash IS NULL) OR
+    (number IS NULL AND number_encrypted IS NOT NULL AND number_hash IS NOT NULL)
+);
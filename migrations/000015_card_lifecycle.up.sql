@@ -0,0 +1,20 @@
+ALTER TABLE cards
+    ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'blocked', 'closed')),
+    ADD COLUMN block_reason VARCHAR(20) CHECK (block_reason IN ('lost', 'stolen', 'reissued')),
+    ADD COLUMN status_changed_at TIMESTAMP,
+    ADD COLUMN replaced_by UUID REFERENCES cards(id),
+    ADD COLUMN pin_hash TEXT;
+
+-- Причина указывается только для постоянной блокировки
+ALTER TABLE cards ADD CONSTRAINT cards_block_reason_status_check CHECK (
+    (status = 'closed') = (block_reason IS NOT NULL)
+);
+
+-- Лимиты расходных операций по карте; NULL означает отсутствие ограничения
+CREATE TABLE card_limits (
+    card_id UUID PRIMARY KEY REFERENCES cards(id),
+    per_transaction DECIMAL(15,2),
+    daily DECIMAL(15,2),
+    monthly DECIMAL(15,2),
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
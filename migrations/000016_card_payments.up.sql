@@ -0,0 +1,29 @@
+-- Карта списывает средства со связанного счета. Выпущенные ранее карты
+-- остаются без счета и отклоняются при авторизации, пока владелец сам
+-- не выберет счет: списание с произвольного счета без его согласия недопустимо.
+ALTER TABLE cards ADD COLUMN account_id UUID REFERENCES accounts(id);
+
+CREATE INDEX cards_account_id_idx ON cards (account_id);
+
+-- Авторизации карточных платежей. Пока авторизация не списана, не отменена
+-- и не истекла, ее сумма удерживается на счете карты.
+CREATE TABLE card_authorizations (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    card_id UUID NOT NULL REFERENCES cards(id),
+    account_id UUID NOT NULL REFERENCES accounts(id),
+    merchant_id VARCHAR(64) NOT NULL,
+    reference VARCHAR(64) NOT NULL,
+    description VARCHAR(255) NOT NULL DEFAULT '',
+    amount DECIMAL(15,2) NOT NULL CHECK (amount > 0),
+    captured_amount DECIMAL(15,2) NOT NULL DEFAULT 0 CHECK (captured_amount >= 0 AND captured_amount <= amount),
+    refunded_amount DECIMAL(15,2) NOT NULL DEFAULT 0 CHECK (refunded_amount >= 0 AND refunded_amount <= captured_amount),
+    currency VARCHAR(3) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'authorized'
+        CHECK (status IN ('authorized', 'captured', 'voided', 'refunded')),
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (merchant_id, reference)
+);
+
+CREATE INDEX card_authorizations_account_idx ON card_authorizations (account_id) WHERE status = 'authorized';
@@ -0,0 +1,41 @@
+-- Удержания средств на счете. Доступный остаток равен балансу за вычетом
+-- действующих удержаний; удержание без срока действует до снятия.
+CREATE TABLE account_holds (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    account_id UUID NOT NULL REFERENCES accounts(id),
+    amount DECIMAL(15,2) NOT NULL CHECK (amount > 0),
+    currency VARCHAR(3) NOT NULL,
+    reason VARCHAR(255) NOT NULL,
+    source VARCHAR(20) NOT NULL DEFAULT 'manual' CHECK (source IN ('manual', 'card_authorization')),
+    status VARCHAR(20) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'released', 'expired')),
+    expires_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    released_at TIMESTAMP
+);
+
+CREATE INDEX account_holds_active_idx ON account_holds (account_id) WHERE status = 'active';
+CREATE INDEX account_holds_expiry_idx ON account_holds (expires_at) WHERE status = 'active' AND expires_at IS NOT NULL;
+
+-- Сумма карточной авторизации удерживается отдельной записью
+ALTER TABLE card_authorizations ADD COLUMN hold_id UUID REFERENCES account_holds(id);
+
+DO $$
+DECLARE
+    a RECORD;
+    new_hold UUID;
+BEGIN
+    FOR a IN SELECT * FROM card_authorizations WHERE status = 'authorized' LOOP
+        INSERT INTO account_holds (account_id, amount, currency, reason, source, status, expires_at, created_at, released_at)
+        VALUES (
+            a.account_id, a.amount, a.currency, 'Card authorization ' || a.reference, 'card_authorization',
+            CASE WHEN a.expires_at > CURRENT_TIMESTAMP THEN 'active' ELSE 'expired' END,
+            a.expires_at, a.created_at,
+            CASE WHEN a.expires_at > CURRENT_TIMESTAMP THEN NULL ELSE a.expires_at END
+        )
+        RETURNING id INTO new_hold;
+
+        UPDATE card_authorizations SET hold_id = new_hold WHERE id = a.id;
+    END LOOP;
+END $$;
+
+DROP INDEX card_authorizations_account_idx;
@@ -0,0 +1,17 @@
+-- Ограничения по карте, которые задает владелец: каналы операций,
+-- операции за рубежом и списки кодов категорий мерчантов (MCC)
+ALTER TABLE card_limits
+    ADD COLUMN online_enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    ADD COLUMN offline_enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    ADD COLUMN foreign_enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    ADD COLUMN allowed_mcc VARCHAR(4)[] NOT NULL DEFAULT '{}',
+    ADD COLUMN blocked_mcc VARCHAR(4)[] NOT NULL DEFAULT '{}';
+
+-- Параметры операции из запроса мерчанта
+ALTER TABLE card_authorizations
+    ADD COLUMN mcc VARCHAR(4) NOT NULL DEFAULT '',
+    ADD COLUMN channel VARCHAR(10) NOT NULL DEFAULT 'online' CHECK (channel IN ('online', 'offline')),
+    ADD COLUMN country VARCHAR(2) NOT NULL DEFAULT '';
+
+-- Дневной и месячный лимиты карты считаются по ее авторизациям
+CREATE INDEX card_authorizations_card_idx ON card_authorizations (card_id, created_at);
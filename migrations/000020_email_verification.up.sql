@@ -0,0 +1,5 @@
+-- Подтверждение адреса электронной почты. Пользователи, зарегистрированные
+-- до появления подтверждения, считаются подтвержденными.
+ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMP;
+
+UPDATE users SET email_verified_at = COALESCE(created_at, CURRENT_TIMESTAMP);
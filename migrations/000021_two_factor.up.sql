@@ -0,0 +1,37 @@
+-- Двухфакторная аутентификация по TOTP (RFC 6238). Секрет хранится
+-- зашифрованным; до подтверждения кодом (confirmed_at) он не действует.
+CREATE TABLE user_totp (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    secret_encrypted TEXT NOT NULL,
+    confirmed_at TIMESTAMP,
+    -- Последний принятый временной шаг: код не принимается повторно
+    last_used_step BIGINT NOT NULL DEFAULT 0,
+    -- Неудачные проверки подряд; после лимита проверки блокируются до locked_until
+    failed_attempts INT NOT NULL DEFAULT 0,
+    locked_until TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Одноразовые резервные коды, хранятся в виде хеша
+CREATE TABLE backup_codes (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    used_at TIMESTAMP
+);
+
+CREATE INDEX backup_codes_user_idx ON backup_codes (user_id) WHERE used_at IS NULL;
+
+-- Второй шаг входа: токен выдается после проверки пароля и обменивается
+-- на пару токенов вместе с кодом TOTP или резервным кодом
+CREATE TABLE login_challenges (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    used_at TIMESTAMP
+);
+
+CREATE INDEX login_challenges_expires_idx ON login_challenges (expires_at);
@@ -0,0 +1,24 @@
+-- Роли пользователей: клиент, операционист и администратор
+ALTER TABLE users
+    ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'customer'
+        CHECK (role IN ('customer', 'operator', 'admin'));
+
+-- Заморозка счета и карты сотрудником банка запрещает списания. Она хранится
+-- отдельно от статуса, чтобы клиент не мог снять ее разблокировкой карты.
+ALTER TABLE accounts ADD COLUMN frozen_at TIMESTAMP;
+ALTER TABLE cards ADD COLUMN frozen_at TIMESTAMP;
+
+-- Журнал действий сотрудников, включая просмотр данных клиентов
+CREATE TABLE audit_log (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    actor_id UUID NOT NULL REFERENCES users(id),
+    action VARCHAR(50) NOT NULL,
+    target_type VARCHAR(20) NOT NULL,
+    target_id VARCHAR(255) NOT NULL,
+    reason TEXT,
+    details JSONB,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX audit_log_actor_idx ON audit_log (actor_id, created_at DESC);
+CREATE INDEX audit_log_target_idx ON audit_log (target_type, target_id, created_at DESC);
@@ -0,0 +1,7 @@
+-- Неверные PIN подряд при смене PIN; после лимита карта закрывается
+-- с причиной too_many_attempts и перевыпускается
+ALTER TABLE cards ADD COLUMN pin_failed_attempts INT NOT NULL DEFAULT 0;
+
+ALTER TABLE cards DROP CONSTRAINT cards_block_reason_check;
+ALTER TABLE cards ADD CONSTRAINT cards_block_reason_check
+    CHECK (block_reason IN ('lost', 'stolen', 'reissued', 'too_many_attempts'));
@@ -0,0 +1,3 @@
+-- Неверные срок действия или CVV подряд при авторизации; после лимита
+-- карта закрывается с причиной too_many_attempts
+ALTER TABLE cards ADD COLUMN cvv_failed_attempts INT NOT NULL DEFAULT 0;
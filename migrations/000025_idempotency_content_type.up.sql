@@ -0,0 +1,3 @@
+-- Тип содержимого сохраненного ответа: отчеты pain.002 возвращаются в XML.
+-- Для ответов, сохраненных раньше, подразумевается JSON.
+ALTER TABLE idempotency_keys ADD COLUMN response_content_type VARCHAR(255);
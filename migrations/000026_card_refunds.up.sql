@@ -0,0 +1,13 @@
+-- Возвраты по карточным платежам. Мерчант передает reference возврата,
+-- уникальный в пределах авторизации: повтор запроса с тем же reference
+-- (например, после таймаута) не создает второй возврат.
+CREATE TABLE card_refunds (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    authorization_id UUID NOT NULL REFERENCES card_authorizations(id),
+    reference VARCHAR(64) NOT NULL,
+    amount DECIMAL(15,2) NOT NULL CHECK (amount > 0),
+    currency VARCHAR(3) NOT NULL,
+    entry_id UUID NOT NULL REFERENCES journal_entries(id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (authorization_id, reference)
+);
@@ -0,0 +1,3 @@
+-- Аренда ключа на время выполнения запроса. Если процесс упал, не сохранив
+-- ответ, ключ с истекшей арендой занимает следующий запрос, не дожидаясь expires_at.
+ALTER TABLE idempotency_keys ADD COLUMN locked_until TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP;
@@ -0,0 +1,150 @@
+package card
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Платежные системы
+const (
+	PaymentSystemMir        = "mir"
+	PaymentSystemVisa       = "visa"
+	PaymentSystemMastercard = "mastercard"
+)
+
+// Длина номера карты
+const PANLength = 16
+
+// Длина CVV
+const CVVLength = 3
+
+var ErrInvalidBINRange = errors.New("invalid BIN range")
+
+// Диапазон BIN (первых цифр номера карты) включительно, границы одинаковой длины
+type BINRange struct {
+	Low  string
+	High string
+}
+
+// Разбирает BIN ("220070") или диапазон BIN ("22007000-22007099")
+func ParseBINRange(s string) (BINRange, error) {
+	low, high, found := strings.Cut(strings.TrimSpace(s), "-")
+	if !found {
+		high = low
+	}
+	r := BINRange{Low: strings.TrimSpace(low), High: strings.TrimSpace(high)}
+
+	if len(r.Low) < 6 || len(r.Low) > 11 || len(r.Low) != len(r.High) || !isDigits(r.Low) || !isDigits(r.High) {
+		return BINRange{}, fmt.Errorf("%w: %q", ErrInvalidBINRange, s)
+	}
+	if r.Low > r.High || r.Low[0] == '0' {
+		return BINRange{}, fmt.Errorf("%w: %q", ErrInvalidBINRange, s)
+	}
+	return r, nil
+}
+
+// Платежная система по префиксу номера карты; пустая строка, если префикс неизвестен
+func PaymentSystemOf(pan string) string {
+	if len(pan) < 4 || !isDigits(pan[:4]) {
+		return ""
+	}
+	var prefix int
+	fmt.Sscanf(pan[:4], "%d", &prefix)
+
+	switch {
+	case prefix >= 2200 && prefix <= 2204:
+		return PaymentSystemMir
+	case prefix >= 2221 && prefix <= 2720, prefix >= 5100 && prefix <= 5599:
+		return PaymentSystemMastercard
+	case pan[0] == '4':
+		return PaymentSystemVisa
+	}
+	return ""
+}
+
+// Генерирует случайный номер карты из диапазона с контрольной цифрой по алгоритму Луна
+func GeneratePAN(r BINRange) (string, error) {
+	low, _ := new(big.Int).SetString(r.Low, 10)
+	high, _ := new(big.Int).SetString(r.High, 10)
+	size := new(big.Int).Sub(high, low)
+	offset, err := rand.Int(rand.Reader, size.Add(size, big.NewInt(1)))
+	if err != nil {
+		return "", err
+	}
+	bin := low.Add(low, offset).String()
+
+	account, err := randomDigits(PANLength - len(bin) - 1)
+	if err != nil {
+		return "", err
+	}
+	payload := bin + account
+	return payload + string(luhnCheckDigit(payload)), nil
+}
+
+// Генерирует случайный трехзначный CVV
+func GenerateCVV() (string, error) {
+	return randomDigits(CVVLength)
+}
+
+// Проверяет формат CVV: ровно три цифры
+func ValidCVV(cvv string) bool {
+	return len(cvv) == CVVLength && isDigits(cvv)
+}
+
+// Маскирует номер карты: видны первые 6 и последние 4 цифры
+func MaskPAN(pan string) string {
+	if len(pan) < 10 {
+		return strings.Repeat("*", len(pan))
+	}
+	return pan[:6] + strings.Repeat("*", len(pan)-10) + pan[len(pan)-4:]
+}
+
+// Проверяет номер карты по алгоритму Луна
+func LuhnValid(pan string) bool {
+	if len(pan) < 2 || !isDigits(pan) {
+		return false
+	}
+	return luhnCheckDigit(pan[:len(pan)-1]) == pan[len(pan)-1]
+}
+
+// Контрольная цифра для номера без последней цифры
+func luhnCheckDigit(payload string) byte {
+	sum := 0
+	double := true
+	for i := len(payload) - 1; i >= 0; i-- {
+		d := int(payload[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+func randomDigits(n int) (string, error) {
+	digits := make([]byte, n)
+	for i := range digits {
+		d, err := rand.Int(rand.Reader, big.NewInt(10))
+		if err != nil {
+			return "", err
+		}
+		digits[i] = byte('0' + d.Int64())
+	}
+	return string(digits), nil
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
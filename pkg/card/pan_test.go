@@ -0,0 +1,138 @@
+package card
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLuhn(t *testing.T) {
+	valid := []string{
+		"79927398713",
+		"4111111111111111",
+		"4539578763621486",
+		"5555555555554444",
+		"2200000000000004",
+		"2221000000000009",
+	}
+	for _, pan := range valid {
+		assert.True(t, LuhnValid(pan), "pan %s", pan)
+		assert.Equal(t, pan[len(pan)-1], luhnCheckDigit(pan[:len(pan)-1]), "pan %s", pan)
+	}
+
+	for _, pan := range []string{"79927398710", "4111111111111112", "5555555555554440", "", "4", "4111-1111-1111-1111"} {
+		assert.False(t, LuhnValid(pan), "pan %q", pan)
+	}
+}
+
+func TestParseBINRange(t *testing.T) {
+	valid := map[string]BINRange{
+		"220070":            {"220070", "220070"},
+		" 427600 ":          {"427600", "427600"},
+		"22007000-22007099": {"22007000", "22007099"},
+		"546900 - 546999":   {"546900", "546999"},
+		"42760000000":       {"42760000000", "42760000000"},
+	}
+	for input, want := range valid {
+		r, err := ParseBINRange(input)
+		if assert.NoError(t, err, "input %q", input) {
+			assert.Equal(t, want, r, "input %q", input)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"22007",
+		"427600000000",
+		"220070-2200709",
+		"220099-220070",
+		"022007",
+		"42760a",
+		"220070-",
+	}
+	for _, input := range invalid {
+		_, err := ParseBINRange(input)
+		assert.True(t, errors.Is(err, ErrInvalidBINRange), "input %q", input)
+	}
+}
+
+func TestPaymentSystemOf(t *testing.T) {
+	cases := map[string]string{
+		"2200000000000004": PaymentSystemMir,
+		"2204999999999999": PaymentSystemMir,
+		"2205000000000000": "",
+		"2221000000000009": PaymentSystemMastercard,
+		"2720999999999999": PaymentSystemMastercard,
+		"5100000000000000": PaymentSystemMastercard,
+		"5599999999999999": PaymentSystemMastercard,
+		"5600000000000000": "",
+		"4111111111111111": PaymentSystemVisa,
+		"3400000000000000": "",
+		"220":              "",
+	}
+	for pan, want := range cases {
+		assert.Equal(t, want, PaymentSystemOf(pan), "pan %s", pan)
+	}
+}
+
+// Номер из каждого диапазона имеет нужную длину, префикс в границах диапазона,
+// верную контрольную цифру и принадлежит платежной системе диапазона
+func TestGeneratePAN(t *testing.T) {
+	cases := []struct {
+		system string
+		r      BINRange
+	}{
+		{PaymentSystemMir, BINRange{"220070", "220070"}},
+		{PaymentSystemMir, BINRange{"22000000", "22049999"}},
+		{PaymentSystemVisa, BINRange{"427600", "427699"}},
+		{PaymentSystemMastercard, BINRange{"546900", "546999"}},
+		{PaymentSystemMastercard, BINRange{"222100", "272099"}},
+	}
+	for _, tc := range cases {
+		for i := 0; i < 100; i++ {
+			pan, err := GeneratePAN(tc.r)
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Len(t, pan, PANLength)
+			assert.True(t, LuhnValid(pan), "pan %s", pan)
+			prefix := pan[:len(tc.r.Low)]
+			assert.True(t, prefix >= tc.r.Low && prefix <= tc.r.High, "pan %s outside %v", pan, tc.r)
+			assert.Equal(t, tc.system, PaymentSystemOf(pan), "pan %s", pan)
+		}
+	}
+}
+
+func TestCVV(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		cvv, err := GenerateCVV()
+		if assert.NoError(t, err) {
+			assert.True(t, ValidCVV(cvv), "cvv %s", cvv)
+		}
+	}
+
+	for _, cvv := range []string{"000", "123", "999"} {
+		assert.True(t, ValidCVV(cvv), "cvv %q", cvv)
+	}
+	for _, cvv := range []string{"", "12", "1234", "12a", " 12", "١٢٣"} {
+		assert.False(t, ValidCVV(cvv), "cvv %q", cvv)
+	}
+}
+
+func TestMaskPAN(t *testing.T) {
+	cases := map[string]string{
+		"4276001234567890":    "427600******7890",
+		"2200701234567890123": "220070*********0123",
+		"1234567890":          "1234567890",
+		"123456789":           "*********",
+		"":                    "",
+	}
+	for pan, want := range cases {
+		assert.Equal(t, want, MaskPAN(pan), "pan %q", pan)
+	}
+	masked := MaskPAN("4276001234567890")
+	assert.Equal(t, PANLength, len(masked))
+	assert.Equal(t, 6, strings.Count(masked, "*"))
+}
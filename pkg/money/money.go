@@ -0,0 +1,243 @@
+package money
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Валюта по умолчанию для счетов
+const DefaultCurrency = "RUB"
+
+// Максимальное число цифр целой части, помещающееся в DECIMAL(15,2)
+const maxIntegerDigits = 13
+
+var (
+	ErrInvalidAmount    = errors.New("invalid amount")
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+)
+
+// Строгий формат суммы во входящих данных: без знака, экспоненты и не более двух знаков после точки
+var amountPattern = regexp.MustCompile(`^(\d+)(?:\.(\d{1,2}))?$`)
+
+// Правило округления при умножении суммы на дробный коэффициент
+type RoundingMode int
+
+const (
+	// Половина округляется от нуля (арифметическое округление)
+	RoundHalfUp RoundingMode = iota
+	// Половина округляется к ближайшему четному (банковское округление)
+	RoundHalfEven
+	// Дробная часть отбрасывается
+	RoundDown
+)
+
+// Денежная сумма в минимальных единицах (копейках) с кодом валюты ISO 4217.
+// В JSON и в БД сумма представлена десятичной строкой вида "100.10".
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+func New(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+func Zero(currency string) Money {
+	return Money{Currency: currency}
+}
+
+// Разбирает неотрицательную сумму из внешнего ввода.
+// Отклоняет знак, экспоненту, NaN и более двух знаков после точки.
+func Parse(s string, currency string) (Money, error) {
+	m := amountPattern.FindStringSubmatch(s)
+	if m == nil {
+		return Money{}, fmt.Errorf("%w: %q must be a non-negative decimal with at most two fractional digits", ErrInvalidAmount, s)
+	}
+
+	integer := strings.TrimLeft(m[1], "0")
+	if len(integer) > maxIntegerDigits {
+		return Money{}, fmt.Errorf("%w: %q is too large", ErrInvalidAmount, s)
+	}
+
+	fraction := m[2]
+	for len(fraction) < 2 {
+		fraction += "0"
+	}
+
+	minor, err := strconv.ParseInt(m[1]+fraction, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+	return Money{Amount: minor, Currency: currency}, nil
+}
+
+// Разбирает сумму со знаком, например баланс из БД
+func parseSigned(s string, currency string) (Money, error) {
+	if strings.HasPrefix(s, "-") {
+		m, err := Parse(s[1:], currency)
+		return m.Neg(), err
+	}
+	return Parse(s, currency)
+}
+
+// Переводит рациональное число основных единиц (рублей) в сумму с заданным округлением
+func FromRat(r *big.Rat, currency string, mode RoundingMode) Money {
+	minor := new(big.Rat).Mul(r, big.NewRat(100, 1))
+	return Money{Amount: round(minor, mode), Currency: currency}
+}
+
+func (m Money) String() string {
+	sign := ""
+	amount := m.Amount
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, amount/100, amount%100)
+}
+
+// Сумма в основных единицах в виде точного рационального числа
+func (m Money) Rat() *big.Rat {
+	return big.NewRat(m.Amount, 100)
+}
+
+func (m Money) IsZero() bool     { return m.Amount == 0 }
+func (m Money) IsPositive() bool { return m.Amount > 0 }
+func (m Money) IsNegative() bool { return m.Amount < 0 }
+
+func (m Money) Neg() Money {
+	return Money{Amount: -m.Amount, Currency: m.Currency}
+}
+
+func (m Money) Add(o Money) Money {
+	return Money{Amount: m.Amount + o.Amount, Currency: m.mustMatch(o)}
+}
+
+func (m Money) Sub(o Money) Money {
+	return Money{Amount: m.Amount - o.Amount, Currency: m.mustMatch(o)}
+}
+
+// Сравнивает суммы: -1, 0 или 1
+func (m Money) Cmp(o Money) int {
+	m.mustMatch(o)
+	switch {
+	case m.Amount < o.Amount:
+		return -1
+	case m.Amount > o.Amount:
+		return 1
+	}
+	return 0
+}
+
+func (m Money) LessThan(o Money) bool {
+	return m.Cmp(o) < 0
+}
+
+// Умножает сумму на коэффициент с явным правилом округления до копейки
+func (m Money) MulRat(r *big.Rat, mode RoundingMode) Money {
+	product := new(big.Rat).Mul(big.NewRat(m.Amount, 1), r)
+	return Money{Amount: round(product, mode), Currency: m.Currency}
+}
+
+// Проверяет совпадение валют; пустая валюта совместима с любой
+func (m Money) SameCurrency(o Money) bool {
+	return m.Currency == "" || o.Currency == "" || m.Currency == o.Currency
+}
+
+// Смешение валют в Add, Sub и Cmp - ошибка программы, а не ввода: сервисы
+// приводят внешние суммы к валюте счета через inAccountCurrency и возвращают
+// ErrCurrencyMismatch до любых вычислений
+func (m Money) mustMatch(o Money) string {
+	if !m.SameCurrency(o) {
+		panic(fmt.Sprintf("money: %v: %s and %s", ErrCurrencyMismatch, m.Currency, o.Currency))
+	}
+	if m.Currency != "" {
+		return m.Currency
+	}
+	return o.Currency
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + m.String() + `"`), nil
+}
+
+// Принимает сумму как JSON-строку или JSON-число, не проходя через float64
+func (m *Money) UnmarshalJSON(data []byte) error {
+	raw := string(data)
+	if raw == "null" {
+		return fmt.Errorf("%w: amount is required", ErrInvalidAmount)
+	}
+	if unquoted, err := strconv.Unquote(raw); err == nil {
+		raw = unquoted
+	}
+
+	parsed, err := Parse(raw, m.Currency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
+
+// Читает значение DECIMAL из БД; валюта остается прежней
+func (m *Money) Scan(src interface{}) error {
+	var raw string
+	switch v := src.(type) {
+	case []byte:
+		raw = string(v)
+	case string:
+		raw = v
+	case int64:
+		*m = Money{Amount: v * 100, Currency: m.Currency}
+		return nil
+	case nil:
+		*m = Money{Currency: m.Currency}
+		return nil
+	default:
+		return fmt.Errorf("money: unsupported scan type %T", src)
+	}
+
+	parsed, err := parseSigned(raw, m.Currency)
+	if err != nil {
+		return fmt.Errorf("money: failed to scan %q: %w", raw, err)
+	}
+	*m = parsed
+	return nil
+}
+
+func round(r *big.Rat, mode RoundingMode) int64 {
+	num, den := r.Num(), r.Denom()
+	quo, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	if rem.Sign() == 0 {
+		return quo.Int64()
+	}
+
+	// Сравниваем удвоенный остаток со знаменателем, чтобы определить половину
+	twice := new(big.Int).Abs(rem)
+	twice.Lsh(twice, 1)
+	half := twice.Cmp(den)
+
+	away := false
+	switch mode {
+	case RoundHalfUp:
+		away = half >= 0
+	case RoundHalfEven:
+		away = half > 0 || (half == 0 && quo.Bit(0) == 1)
+	case RoundDown:
+		away = false
+	}
+
+	if away {
+		quo.Add(quo, big.NewInt(int64(num.Sign())))
+	}
+	return quo.Int64()
+}
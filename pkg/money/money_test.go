@@ -0,0 +1,118 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	valid := map[string]int64{
+		"0":                0,
+		"1":                100,
+		"1.5":              150,
+		"1.05":             105,
+		"100.10":           10010,
+		"007.00":           700,
+		"9999999999999.99": 999999999999999,
+	}
+	for input, want := range valid {
+		m, err := Parse(input, "RUB")
+		if assert.NoError(t, err, "input %q", input) {
+			assert.Equal(t, Money{Amount: want, Currency: "RUB"}, m, "input %q", input)
+		}
+	}
+
+	for _, input := range []string{"", "-1", "+1", "1.001", "1.", ".5", "1e2", "NaN", "1,00", " 1", "10000000000000"} {
+		_, err := Parse(input, "RUB")
+		assert.True(t, errors.Is(err, ErrInvalidAmount), "input %q", input)
+	}
+}
+
+func TestString(t *testing.T) {
+	cases := map[int64]string{
+		0:     "0.00",
+		5:     "0.05",
+		100:   "1.00",
+		12345: "123.45",
+		-5:    "-0.05",
+		-1050: "-10.50",
+	}
+	for amount, want := range cases {
+		assert.Equal(t, want, New(amount, "RUB").String())
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	cases := []struct {
+		a, b     Money
+		sum, sub Money
+		cmp      int
+	}{
+		{New(150, "RUB"), New(50, "RUB"), New(200, "RUB"), New(100, "RUB"), 1},
+		{New(50, "USD"), New(150, "USD"), New(200, "USD"), New(-100, "USD"), -1},
+		{New(70, "EUR"), New(70, "EUR"), New(140, "EUR"), New(0, "EUR"), 0},
+		// Сумма без валюты совместима с любой и принимает валюту второй
+		{New(100, ""), New(1, "RUB"), New(101, "RUB"), New(99, "RUB"), 1},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.sum, c.a.Add(c.b))
+		assert.Equal(t, c.sub, c.a.Sub(c.b))
+		assert.Equal(t, c.cmp, c.a.Cmp(c.b))
+		assert.Equal(t, c.cmp < 0, c.a.LessThan(c.b))
+	}
+}
+
+// Смешение валют - ошибка программы: сервисы приводят суммы к валюте счета
+// через inAccountCurrency до любых вычислений
+func TestArithmeticCurrencyMismatchPanics(t *testing.T) {
+	rub, usd := New(100, "RUB"), New(100, "USD")
+	assert.Panics(t, func() { rub.Add(usd) })
+	assert.Panics(t, func() { rub.Sub(usd) })
+	assert.Panics(t, func() { rub.Cmp(usd) })
+	assert.False(t, rub.SameCurrency(usd))
+}
+
+func TestMulRatRounding(t *testing.T) {
+	amount := New(105, "RUB")
+	half := big.NewRat(1, 2)
+	assert.Equal(t, int64(53), amount.MulRat(half, RoundHalfUp).Amount)
+	assert.Equal(t, int64(52), amount.MulRat(half, RoundHalfEven).Amount)
+	assert.Equal(t, int64(52), amount.MulRat(half, RoundDown).Amount)
+	assert.Equal(t, int64(-53), amount.Neg().MulRat(half, RoundHalfUp).Amount)
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	var body struct {
+		Amount Money `json:"amount"`
+	}
+	for input, want := range map[string]string{
+		`{"amount":"10.50"}`: `{"amount":"10.50"}`,
+		`{"amount":10.5}`:    `{"amount":"10.50"}`,
+		`{"amount":"0"}`:     `{"amount":"0.00"}`,
+		`{"amount":7}`:       `{"amount":"7.00"}`,
+	} {
+		if assert.NoError(t, json.Unmarshal([]byte(input), &body), "input %s", input) {
+			out, err := json.Marshal(body)
+			assert.NoError(t, err)
+			assert.JSONEq(t, want, string(out), "input %s", input)
+		}
+	}
+
+	for _, input := range []string{`{"amount":null}`, `{"amount":"-1"}`, `{"amount":1e2}`, `{"amount":"1.001"}`} {
+		err := json.Unmarshal([]byte(input), &body)
+		assert.True(t, errors.Is(err, ErrInvalidAmount), "input %s", input)
+	}
+}
+
+func TestScan(t *testing.T) {
+	m := Money{Currency: "USD"}
+	assert.NoError(t, m.Scan([]byte("-12.30")))
+	assert.Equal(t, New(-1230, "USD"), m)
+	assert.NoError(t, m.Scan(nil))
+	assert.Equal(t, Zero("USD"), m)
+	assert.Error(t, m.Scan(1.5))
+}
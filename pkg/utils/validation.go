@@ -34,3 +34,43 @@ func IsStrongPassword(password string) bool {
     return hasUpper && hasLower && hasNumber && hasSpecial && len(password) >= 8
 }
 
+// Проверяет формат IBAN и контрольные цифры по ISO 13616 (mod 97). Принимается
+// только электронная форма, как в pain.001: заглавные буквы, без пробелов.
+func IsValidIBAN(iban string) bool {
+    if len(iban) < 15 || len(iban) > 34 {
+        return false
+    }
+    if !ibanPattern.MatchString(iban) {
+        return false
+    }
+
+    // Первые четыре символа переносятся в конец, буквы заменяются числами A=10 ... Z=35
+    rearranged := iban[4:] + iban[:4]
+    remainder := 0
+    for _, c := range rearranged {
+        value := int(c - '0')
+        if c >= 'A' && c <= 'Z' {
+            value = int(c-'A') + 10
+            remainder = (remainder*100 + value) % 97
+            continue
+        }
+        remainder = (remainder*10 + value) % 97
+    }
+    return remainder == 1
+}
+
+var (
+    ibanPattern     = regexp.MustCompile(`^[A-Z]{2}[0-9]{2}[A-Z0-9]+$`)
+    usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9._-]{3,32}$`)
+    uuidPattern     = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+)
+
+// Имя пользователя: от 3 до 32 латинских букв, цифр, точек, дефисов и подчеркиваний
+func IsValidUsername(username string) bool {
+    return usernamePattern.MatchString(username)
+}
+
+// Проверяет запись UUID в каноническом виде 8-4-4-4-12
+func IsValidUUID(id string) bool {
+    return uuidPattern.MatchString(id)
+}
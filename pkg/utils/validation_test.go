@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsValidIBAN(t *testing.T) {
+	valid := []string{
+		"DE89370400440532013000",
+		"GB82WEST12345698765432",
+		"FR1420041010050500013M02606",
+		"NL91ABNA0417164300",
+		"BE68539007547034",
+		"NO9386011117947",
+		"MT84MALT011000012345MTLCAST001S",
+		"LC55HEMM000100010012001200023015",
+	}
+	for _, iban := range valid {
+		assert.True(t, IsValidIBAN(iban), "iban %s", iban)
+	}
+
+	invalid := map[string]string{
+		"DE88370400440532013000":              "bad check digits",
+		"GB82WEST12345698765433":              "bad check digits",
+		"DE00370400440532013000":              "check digits 00",
+		"1289370400440532013000":              "numeric country code",
+		"D989370400440532013000":              "numeric country code",
+		"DEXX370400440532013000":              "letters in check digits",
+		"NO938601111794":                      "too short",
+		"LC55HEMM0001000100120012000230150000": "too long",
+		"":                                    "empty",
+		"de89370400440532013000":              "lowercase",
+		"DE89370400440532013abc":              "lowercase BBAN",
+		"DE89 3704 0044 0532 0130 00":         "printed format with spaces",
+		" DE89370400440532013000":             "leading space",
+		"DE89-3704-0044-0532-0130-00":         "separators",
+	}
+	for iban, reason := range invalid {
+		assert.False(t, IsValidIBAN(iban), "iban %q: %s", iban, reason)
+	}
+}